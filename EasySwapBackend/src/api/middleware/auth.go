@@ -1,130 +1,100 @@
 package middleware
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/hex"
-	"fmt"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
-	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 )
 
 const CR_LOGIN_MSG_KEY string = "cache:es:login:msg"
 const CR_LOGIN_KEY string = "cache:es:login:address:data"
-const CR_LOGIN_SALT string = "es_login_salt&$%"
+const CR_LOGIN_REVOKE_KEY string = "cache:es:login:address:revoke"
+
+const (
+	SessionHeader = "session_id"
+
+	authSessionsKey = "auth_sessions" // gin context中已认证的会话
+	authErrorKey    = "auth_error"    // gin context中会话校验失败的原因
+)
 
-// 设置路由cookie
 // AuthMiddleWare 是一个认证中间件函数,用于验证请求中的会话令牌
 // 主要功能包括:
 // 1. 从请求头获取session_id,如果为空则跳过验证
 // 2. 支持多个session_id,用逗号分隔
-// 3. 对每个session_id进行以下验证:
-// 4. 如果验证失败则返回相应错误:
+// 3. 对每个session_id校验签名、有效期以及是否已登出
+// 4. 验证通过的会话及其地址写入gin context, 供后续处理函数使用
+// 5. 验证失败时不中断请求, 失败原因由RequireLogin返回:
 //   - 令牌格式错误返回ErrTokenVerify
-//   - 令牌过期返回ErrTokenExpire
-//
-// 5. 验证通过则继续处理请求
-func AuthMiddleWare(ctx *xkv.Store) gin.HandlerFunc {
+//   - 令牌过期或已登出返回ErrTokenExpire
+func AuthMiddleWare(sessions *SessionManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// cache:es:login:address:data:<用户地址>
-		values := c.Request.Header.Get("session_id")
+		values := c.Request.Header.Get(SessionHeader)
 		if values == "" {
 			c.Next()
 			return
 		}
 
-		sessionIDs := strings.Split(values, ",")
-		for _, sessionID := range sessionIDs {
-			encryptCode, err := hex.DecodeString(sessionID)
-			if err != nil {
-				xhttp.Error(c, errcode.ErrTokenVerify)
-				c.Abort()
-				return
-			}
-
-			//解密
-			decrptCode, err := AesDecryptOFB(encryptCode, []byte(CR_LOGIN_SALT))
+		var authed []*SessionClaims
+		for _, token := range strings.Split(values, ",") {
+			claims, err := sessions.Verify(c.Request.Context(), strings.TrimSpace(token))
 			if err != nil {
-				xhttp.Error(c, errcode.ErrTokenExpire)
-				c.Abort()
-				return
-			}
-			//从redis里取数据
-			result, err := ctx.Get(string(decrptCode))
-			if result == "" || err != nil {
-				xhttp.Error(c, errcode.ErrTokenExpire)
-				c.Abort()
-				return
+				c.Set(authErrorKey, err)
+				authed = nil
+				break
 			}
+			authed = append(authed, claims)
+		}
+		if len(authed) > 0 {
+			c.Set(authSessionsKey, authed)
 		}
 
 		c.Next()
 	}
 }
 
-func GetAuthUserAddress(c *gin.Context, ctx *xkv.Store) ([]string, error) {
-	values := c.Request.Header.Get("session_id")
-	if values == "" {
-		return nil, errors.New("failed on get token")
-	}
-
-	sessionIDs := strings.Split(values, ",")
-	var addrs []string
-	for _, sessionID := range sessionIDs {
-		encryptCode, err := hex.DecodeString(sessionID)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed on decode cookie")
-		}
-
-		//解密
-		decrptCode, err := AesDecryptOFB(encryptCode, []byte(CR_LOGIN_SALT))
-		if err != nil {
-			return nil, errors.Wrap(err, "invalid cookie")
-		}
-		//从redis里取数据
-		result, err := ctx.Get(string(decrptCode))
-		if result == "" || err != nil {
-			return nil, errors.Wrap(err, "failed on read cookie from cache")
-		}
-		arr := strings.Split(string(decrptCode), CR_LOGIN_KEY+":")
-		if len(arr) != 2 {
-			return nil, errors.New("user cache info format err")
+// RequireLogin 要求请求携带有效的会话, 需在AuthMiddleWare之后使用
+func RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(GetAuthSessions(c)) == 0 {
+			err := errcode.ErrTokenVerify
+			if v, ok := c.Get(authErrorKey); ok {
+				if e, ok := v.(*errcode.Err); ok {
+					err = e
+				}
+			}
+			xhttp.Error(c, err)
+			c.Abort()
+			return
 		}
 
-		if arr[1] == "" {
-			return nil, errors.New("invalid user address")
-		}
-		addrs = append(addrs, arr[1])
+		c.Next()
 	}
-
-	return addrs, nil
 }
 
-func AesDecryptOFB(data []byte, key []byte) ([]byte, error) {
-	block, _ := aes.NewCipher([]byte(key))
-	iv := data[:aes.BlockSize]
-	data = data[aes.BlockSize:]
-	if len(data)%aes.BlockSize != 0 {
-		return nil, fmt.Errorf("data is not a multiple of the block size")
+// GetAuthSessions 获取请求中已认证的会话
+func GetAuthSessions(c *gin.Context) []*SessionClaims {
+	v, ok := c.Get(authSessionsKey)
+	if !ok {
+		return nil
 	}
-
-	out := make([]byte, len(data))
-	mode := cipher.NewOFB(block, iv)
-	mode.XORKeyStream(out, data)
-
-	out = PKCS7UnPadding(out)
-	return out, nil
+	sessions, _ := v.([]*SessionClaims)
+	return sessions
 }
 
-// 去码
-func PKCS7UnPadding(origData []byte) []byte {
-	length := len(origData)
-	unpadding := int(origData[length-1])
-	return origData[:(length - unpadding)]
+// GetAuthUserAddress 获取请求中已认证的用户地址
+func GetAuthUserAddress(c *gin.Context) ([]string, error) {
+	sessions := GetAuthSessions(c)
+	if len(sessions) == 0 {
+		return nil, errors.New("failed on get token")
+	}
+
+	addrs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		addrs = append(addrs, session.Address)
+	}
+	return addrs, nil
 }
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleWare(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+
+	alice, _, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	bob, _, err := sessions.Issue(ctx, "0x0000000000000000000000000000000000000001", testChainID)
+	require.NoError(t, err)
+	revoked, revokedClaims, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	require.NoError(t, sessions.Revoke(ctx, revokedClaims))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}, AuthMiddleWare(sessions))
+	router.GET("/optional", func(c *gin.Context) {
+		c.JSON(http.StatusOK, len(GetAuthSessions(c)))
+	})
+	router.GET("/login", RequireLogin(), func(c *gin.Context) {
+		addrs, err := GetAuthUserAddress(c)
+		require.NoError(t, err)
+		c.JSON(http.StatusOK, addrs)
+	})
+
+	serve := func(path, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set(SessionHeader, header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	errCode := func(w *httptest.ResponseRecorder) uint32 {
+		var resp xhttp.Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Code
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr *errcode.Err
+		want    []string
+	}{
+		{"single session", alice, nil, []string{strings.ToLower(testAddress)}},
+		{"multiple sessions", alice + ", " + bob, nil, []string{strings.ToLower(testAddress), "0x0000000000000000000000000000000000000001"}},
+		{"no session", "", errcode.ErrTokenVerify, nil},
+		{"malformed", "not-a-token", errcode.ErrTokenVerify, nil},
+		{"revoked", revoked, errcode.ErrTokenExpire, nil},
+		{"one invalid rejects all", alice + "," + revoked, errcode.ErrTokenExpire, nil},
+		{"empty entry", alice + ",", errcode.ErrTokenVerify, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve("/login", tt.header)
+			if tt.wantErr != nil {
+				assert.Equal(t, http.StatusUnauthorized, w.Code)
+				assert.Equal(t, tt.wantErr.Code(), errCode(w))
+				return
+			}
+			require.Equal(t, http.StatusOK, w.Code)
+			var addrs []string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &addrs))
+			assert.Equal(t, tt.want, addrs)
+		})
+	}
+
+	// 未要求登录的接口不因会话无效而失败
+	w := serve("/optional", revoked)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Body.String())
+}
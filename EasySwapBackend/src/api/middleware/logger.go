@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
@@ -47,7 +49,9 @@ func RLog() gin.HandlerFunc {
 		requestBody, _ := ioutil.ReadAll(tee)
 		c.Request.Body = ioutil.NopCloser(&buf)
 		bodyLogWriter := &BodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-		c.Writer = bodyLogWriter
+		if !isStreamRequest(c.Request) { // 推送连接持续时间长, 不记录响应体
+			c.Writer = bodyLogWriter
+		}
 
 		// 记录开始时间
 		start := time.Now()
@@ -85,3 +89,9 @@ func RLog() gin.HandlerFunc {
 		}
 	}
 }
+
+// isStreamRequest 是否为websocket或SSE推送请求
+func isStreamRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+)
+
+const (
+	DefaultSessionExpire = 7 * 24 * 60 * 60 // 会话默认有效期, 单位秒
+	minSessionSecretLen  = 32
+)
+
+// SessionClaims 会话token中签名的内容
+type SessionClaims struct {
+	ID        string `json:"sid"`
+	Address   string `json:"addr"` // 小写地址
+	ChainID   int    `json:"chain_id"`
+	IssuedAt  int64  `json:"iat"` // 签发时间, 单位毫秒
+	ExpiresAt int64  `json:"exp"` // 过期时间, 单位秒
+}
+
+// sessionStore 会话使用的缓存操作, 由*xkv.Store实现
+type sessionStore interface {
+	Setex(key, value string, seconds int) error
+	Exists(key string) (bool, error)
+	Del(keys ...string) (int, error)
+	GetInt64(key string) (int64, error)
+	SetInt64(key string, value int64, seconds ...int) error
+}
+
+// SessionManager 签发和校验登录会话
+// token = base64url(claims) + "." + base64url(HMAC-SHA256(claims)), 签名保证内容不可篡改
+// 会话同时记录在redis中, 删除记录即登出; 按地址记录撤销时间, 早于该时间签发的会话全部失效
+type SessionManager struct {
+	store  sessionStore
+	secret []byte
+	expire int64
+}
+
+func NewSessionManager(store *xkv.Store, cfg *config.Session) (*SessionManager, error) {
+	if cfg == nil || len(cfg.Secret) < minSessionSecretLen {
+		return nil, errors.Errorf("session secret must be at least %d characters", minSessionSecretLen)
+	}
+
+	expire := cfg.ExpireSeconds
+	if expire <= 0 {
+		expire = DefaultSessionExpire
+	}
+	return &SessionManager{store: store, secret: []byte(cfg.Secret), expire: expire}, nil
+}
+
+func sessionCacheKey(address, id string) string {
+	return CR_LOGIN_KEY + ":" + strings.ToLower(address) + ":" + id
+}
+
+func sessionRevokeKey(address string) string {
+	return CR_LOGIN_REVOKE_KEY + ":" + strings.ToLower(address)
+}
+
+// Issue 为地址签发新的会话
+func (m *SessionManager) Issue(ctx context.Context, address string, chainID int) (string, *SessionClaims, error) {
+	now := time.Now()
+	claims := &SessionClaims{
+		ID:        strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Address:   strings.ToLower(address),
+		ChainID:   chainID,
+		IssuedAt:  now.UnixMilli(),
+		ExpiresAt: now.Unix() + m.expire,
+	}
+
+	token, err := m.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := m.store.Setex(sessionCacheKey(claims.Address, claims.ID), strconv.Itoa(chainID), int(m.expire)); err != nil {
+		return "", nil, errors.Wrap(err, "failed on cache session")
+	}
+	return token, claims, nil
+}
+
+// Verify 校验token签名、有效期及会话是否已登出
+func (m *SessionManager) Verify(ctx context.Context, token string) (*SessionClaims, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errcode.ErrTokenVerify
+	}
+	expected, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(expected, m.mac([]byte(payload))) {
+		return nil, errcode.ErrTokenVerify
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errcode.ErrTokenVerify
+	}
+	var claims SessionClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.ID == "" || claims.Address == "" {
+		return nil, errcode.ErrTokenVerify
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errcode.ErrTokenExpire
+	}
+
+	// 会话已登出
+	exists, err := m.store.Exists(sessionCacheKey(claims.Address, claims.ID))
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on read session from cache", zap.Error(err))
+		return nil, errcode.ErrUnexpected
+	}
+	if !exists {
+		return nil, errcode.ErrTokenExpire
+	}
+
+	// 会话签发后地址的所有会话已被撤销
+	revokedAt, err := m.store.GetInt64(sessionRevokeKey(claims.Address))
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on read session revocation from cache", zap.Error(err))
+		return nil, errcode.ErrUnexpected
+	}
+	if claims.IssuedAt <= revokedAt {
+		return nil, errcode.ErrTokenExpire
+	}
+
+	return &claims, nil
+}
+
+// Refresh 签发与原会话相同地址和链的新会话, 原会话失效
+func (m *SessionManager) Refresh(ctx context.Context, claims *SessionClaims) (string, *SessionClaims, error) {
+	token, refreshed, err := m.Issue(ctx, claims.Address, claims.ChainID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := m.Revoke(ctx, claims); err != nil {
+		return "", nil, err
+	}
+	return token, refreshed, nil
+}
+
+// Revoke 登出单个会话
+func (m *SessionManager) Revoke(ctx context.Context, claims *SessionClaims) error {
+	if _, err := m.store.Del(sessionCacheKey(claims.Address, claims.ID)); err != nil {
+		return errors.Wrap(err, "failed on delete session")
+	}
+	return nil
+}
+
+// RevokeAll 撤销地址当前所有的会话, 撤销记录保留到这些会话全部过期
+func (m *SessionManager) RevokeAll(ctx context.Context, address string) error {
+	if err := m.store.SetInt64(sessionRevokeKey(address), time.Now().UnixMilli(), int(m.expire)); err != nil {
+		return errors.Wrap(err, "failed on revoke sessions")
+	}
+	return nil
+}
+
+func (m *SessionManager) sign(claims *SessionClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "failed on marshal session")
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(m.mac([]byte(payload))), nil
+}
+
+func (m *SessionManager) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
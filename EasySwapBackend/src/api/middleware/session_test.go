@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+)
+
+const (
+	testSecret  = "0123456789abcdef0123456789abcdef"
+	testAddress = "0x2C7536E3605D9C16a7a3D7b1898e529396a65c23"
+	testChainID = 11155111
+)
+
+// memSessionStore 内存中的会话缓存, 不处理过期时间
+type memSessionStore map[string]string
+
+func (s memSessionStore) Setex(key, value string, seconds int) error {
+	s[key] = value
+	return nil
+}
+
+func (s memSessionStore) Exists(key string) (bool, error) {
+	_, ok := s[key]
+	return ok, nil
+}
+
+func (s memSessionStore) Del(keys ...string) (int, error) {
+	var count int
+	for _, key := range keys {
+		if _, ok := s[key]; ok {
+			delete(s, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s memSessionStore) GetInt64(key string) (int64, error) {
+	value, ok := s[key]
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s memSessionStore) SetInt64(key string, value int64, seconds ...int) error {
+	s[key] = strconv.FormatInt(value, 10)
+	return nil
+}
+
+func newTestSessions(t *testing.T, secret string) (*SessionManager, memSessionStore) {
+	store := memSessionStore{}
+	sessions, err := NewSessionManager(nil, &config.Session{Secret: secret})
+	require.NoError(t, err)
+	sessions.store = store
+	return sessions, store
+}
+
+func testContext() context.Context {
+	return xzap.ToContext(context.Background(), zap.NewNop())
+}
+
+func TestNewSessionManager(t *testing.T) {
+	_, err := NewSessionManager(nil, nil)
+	assert.Error(t, err)
+	_, err = NewSessionManager(nil, &config.Session{Secret: "short"})
+	assert.Error(t, err)
+
+	sessions, err := NewSessionManager(nil, &config.Session{Secret: testSecret})
+	require.NoError(t, err)
+	assert.Equal(t, int64(DefaultSessionExpire), sessions.expire)
+}
+
+func TestSessionIssueVerify(t *testing.T) {
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+
+	token, claims, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	assert.Equal(t, strings.ToLower(testAddress), claims.Address)
+	assert.Equal(t, testChainID, claims.ChainID)
+
+	verified, err := sessions.Verify(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, claims, verified)
+}
+
+func TestSessionVerifyRejects(t *testing.T) {
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+	token, _, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	payload, sig, _ := strings.Cut(token, ".")
+
+	// 篡改内容后保留原签名
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	require.NoError(t, err)
+	tamperedPayload := base64.RawURLEncoding.EncodeToString(
+		[]byte(strings.Replace(string(data), strings.ToLower(testAddress), "0x0000000000000000000000000000000000000001", 1)))
+	// 翻转签名的最后一个字节
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	require.NoError(t, err)
+	sigBytes[len(sigBytes)-1] ^= 0xff
+	tamperedSig := base64.RawURLEncoding.EncodeToString(sigBytes)
+
+	// 其他密钥签发的token
+	other, _ := newTestSessions(t, "fedcba9876543210fedcba9876543210")
+	otherToken, _, err := other.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+
+	// 签名正确但内容不是有效的会话
+	signed := func(raw string) string {
+		p := base64.RawURLEncoding.EncodeToString([]byte(raw))
+		return p + "." + base64.RawURLEncoding.EncodeToString(sessions.mac([]byte(p)))
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"separator only", "."},
+		{"missing signature", payload},
+		{"empty signature", payload + "."},
+		{"signature not base64", payload + ".!!!"},
+		{"extra segment", token + ".x"},
+		{"tampered payload", tamperedPayload + "." + sig},
+		{"tampered signature", payload + "." + tamperedSig},
+		{"wrong key", otherToken},
+		{"payload not base64", signed("x")[:1] + "!" + signed("x")[1:]},
+		{"payload not json", signed("not json")},
+		{"missing session id", signed(`{"addr":"0x01","exp":9999999999}`)},
+		{"missing address", signed(`{"sid":"abc","exp":9999999999}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				_, err := sessions.Verify(ctx, tt.token)
+				assert.Equal(t, errcode.ErrTokenVerify, err)
+			})
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	ctx := testContext()
+	sessions, store := newTestSessions(t, testSecret)
+
+	claims := &SessionClaims{
+		ID:        "expired",
+		Address:   strings.ToLower(testAddress),
+		ChainID:   testChainID,
+		IssuedAt:  time.Now().Add(-2 * time.Hour).UnixMilli(),
+		ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+	}
+	token, err := sessions.sign(claims)
+	require.NoError(t, err)
+	require.NoError(t, store.Setex(sessionCacheKey(claims.Address, claims.ID), "1", 60))
+
+	_, err = sessions.Verify(ctx, token)
+	assert.Equal(t, errcode.ErrTokenExpire, err)
+}
+
+func TestSessionRevoke(t *testing.T) {
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+
+	token, claims, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	other, _, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+
+	require.NoError(t, sessions.Revoke(ctx, claims))
+	_, err = sessions.Verify(ctx, token)
+	assert.Equal(t, errcode.ErrTokenExpire, err)
+
+	// 只登出指定的会话
+	_, err = sessions.Verify(ctx, other)
+	assert.NoError(t, err)
+}
+
+func TestSessionRevokeAll(t *testing.T) {
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+
+	before, _, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	otherAddress, _, err := sessions.Issue(ctx, "0x0000000000000000000000000000000000000001", testChainID)
+	require.NoError(t, err)
+
+	// 按地址撤销, 与地址大小写无关
+	require.NoError(t, sessions.RevokeAll(ctx, "0x"+strings.ToUpper(testAddress[2:])))
+	_, err = sessions.Verify(ctx, before)
+	assert.Equal(t, errcode.ErrTokenExpire, err)
+	_, err = sessions.Verify(ctx, otherAddress)
+	assert.NoError(t, err)
+
+	// 撤销之后签发的会话有效
+	time.Sleep(2 * time.Millisecond)
+	after, _, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+	_, err = sessions.Verify(ctx, after)
+	assert.NoError(t, err)
+}
+
+func TestSessionRefresh(t *testing.T) {
+	ctx := testContext()
+	sessions, _ := newTestSessions(t, testSecret)
+
+	token, claims, err := sessions.Issue(ctx, testAddress, testChainID)
+	require.NoError(t, err)
+
+	refreshedToken, refreshed, err := sessions.Refresh(ctx, claims)
+	require.NoError(t, err)
+	assert.NotEqual(t, claims.ID, refreshed.ID)
+	assert.Equal(t, claims.Address, refreshed.Address)
+	assert.Equal(t, claims.ChainID, refreshed.ChainID)
+
+	_, err = sessions.Verify(ctx, token)
+	assert.Equal(t, errcode.ErrTokenExpire, err)
+	verified, err := sessions.Verify(ctx, refreshedToken)
+	require.NoError(t, err)
+	assert.Equal(t, refreshed, verified)
+}
@@ -21,7 +21,7 @@ func NewRouter(svcCtx *svc.ServerCtx) *gin.Engine {
 	r.Use(cors.New(cors.Config{ // 使用cors中间件
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "X-CSRF-Token", "Authorization", "AccessToken", "Token"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "X-CSRF-Token", "Authorization", "AccessToken", "Token", "Last-Event-ID", middleware.SessionHeader},
 		ExposeHeaders:    []string{"Content-Length", "Content-Type", "Access-Control-Allow-Origin", "Access-Control-Allow-Headers", "X-GW-Error-Code", "X-GW-Error-Message"},
 		AllowCredentials: true,
 		MaxAge:           1 * time.Hour,
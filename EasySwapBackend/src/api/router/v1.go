@@ -10,12 +10,18 @@ import (
 
 func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 	apiV1 := r.Group("/api/v1")
+	apiV1.Use(middleware.AuthMiddleWare(svcCtx.Sessions)) // 解析会话, 已认证的地址写入gin context
 
 	user := apiV1.Group("/user")
 	{
 		user.GET("/:address/login-message", v1.GetLoginMessageHandler(svcCtx)) // 生成login签名信息
 		user.POST("/login", v1.UserLoginHandler(svcCtx))                       // 登陆
 		user.GET("/:address/sig-status", v1.GetSigStatusHandler(svcCtx))       // 获取用户签名状态
+
+		session := user.Group("", middleware.RequireLogin())
+		session.POST("/session/refresh", v1.RefreshSessionHandler(svcCtx)) // 刷新会话token
+		session.POST("/logout", v1.UserLogoutHandler(svcCtx))              // 登出当前会话
+		session.POST("/logout-all", v1.UserLogoutAllHandler(svcCtx))       // 登出地址的所有会话
 	}
 
 	collections := apiV1.Group("/collections")
@@ -23,6 +29,7 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 		// 接口定义： 路由 + 中间件 + 处理函数
 		collections.GET("/:address", v1.CollectionDetailHandler(svcCtx))                  // 指定Collection详情
 		collections.GET("/:address/bids", v1.CollectionBidsHandler(svcCtx))               // 指定Collection的bids信息
+		collections.GET("/:address/depth", v1.CollectionDepthHandler(svcCtx))             // 指定Collection的买卖深度
 		collections.GET("/:address/:token_id/bids", v1.CollectionItemBidsHandler(svcCtx)) // 指定Item的bid信息
 		collections.GET("/:address/items", v1.CollectionItemsHandler(svcCtx))             // 指定Collection的items信息
 
@@ -54,4 +61,36 @@ func loadV1(r *gin.Engine, svcCtx *svc.ServerCtx) {
 	{
 		orders.GET("", v1.OrderInfosHandler(svcCtx)) // 批量查询出价信息
 	}
+
+	signedOrders := apiV1.Group("/orders")
+	{
+		signedOrders.POST("", v1.SubmitOrderHandler(svcCtx)) // 提交链下EIP-712签名订单
+	}
+
+	exchange := apiV1.Group("/exchange")
+	{
+		exchange.GET("/status", v1.ExchangeStatusHandler(svcCtx)) // 查询订单簿合约暂停状态
+
+		// 构造待签名的订单簿交易
+		exchange.POST("/tx/buy", v1.BuyTxHandler(svcCtx))             // 购买指定挂单
+		exchange.POST("/tx/sweep", v1.SweepTxHandler(svcCtx))         // 购买collection中最低价的N个挂单
+		exchange.POST("/tx/sell", v1.SellTxHandler(svcCtx))           // 接受出价
+		exchange.POST("/tx/make", v1.MakeOrdersTxHandler(svcCtx))     // 挂单及出价
+		exchange.POST("/tx/cancel", v1.CancelOrdersTxHandler(svcCtx)) // 取消订单
+		exchange.POST("/tx/edit", v1.EditOrdersTxHandler(svcCtx))     // 修改订单价格及数量
+	}
+
+	stream := apiV1.Group("/stream")
+	{
+		stream.GET("", v1.MarketStreamHandler(svcCtx))       // SSE推送市场事件
+		stream.GET("/ws", v1.MarketWebsocketHandler(svcCtx)) // websocket推送市场事件
+	}
+
+	points := apiV1.Group("/points")
+	{
+		points.GET("/summary", middleware.CacheApi(svcCtx.KvStore, 60), v1.PointsSummaryHandler(svcCtx))         // 积分合约流通量及持有人数
+		points.GET("/leaderboard", middleware.CacheApi(svcCtx.KvStore, 60), v1.PointsLeaderboardHandler(svcCtx)) // 积分排行
+		points.GET("/:address", v1.PointsAccountHandler(svcCtx))                                                 // 账户余额及累计积分
+		points.GET("/:address/history", v1.PointsHistoryHandler(svcCtx))                                         // 账户每个周期的积分
+	}
 }
@@ -3,12 +3,15 @@ package v1
 import (
 	"encoding/json"
 	"strconv"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
@@ -16,6 +19,8 @@ import (
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
 )
 
+const defaultDepthLevels = 20
+
 func CollectionItemsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filterParam := c.Query("filters")
@@ -87,6 +92,50 @@ func CollectionBidsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+// CollectionDepthHandler 查询Collection按价格聚合的深度
+func CollectionDepthHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collectionAddr := c.Params.ByName("address")
+		if !common.IsHexAddress(collectionAddr) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, err := strconv.Atoi(c.Query("chain_id"))
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+		chain, ok := chainIDToChain[chainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		side := c.Query("side")
+		if side != "" && side != ordermanager.DepthSideBid && side != ordermanager.DepthSideAsk {
+			xhttp.Error(c, errcode.NewCustomErr("side must be bid or ask."))
+			return
+		}
+
+		levels := defaultDepthLevels
+		if c.Query("levels") != "" {
+			levels, err = strconv.Atoi(c.Query("levels"))
+			if err != nil || levels <= 0 || levels > ordermanager.MaxDepthLevels {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+		}
+
+		res, err := service.GetCollectionDepth(c.Request.Context(), svcCtx, chain, strings.ToLower(collectionAddr), side, levels)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+		xhttp.OkJson(c, res)
+	}
+}
+
 func CollectionItemBidsHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filterParam := c.Query("filters")
@@ -0,0 +1,182 @@
+package v1
+
+import (
+	"strconv"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// ExchangeStatusHandler 查询订单簿合约是否处于暂停状态
+func ExchangeStatusHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 32)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chain, ok := chainIDToChain[int(chainID)]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetExchangeStatus(c.Request.Context(), svcCtx, int(chainID), chain)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+
+		xhttp.OkJson(c, res)
+	}
+}
+
+// BuyTxHandler 构造购买指定挂单的交易
+func BuyTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.BuyTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildBuyTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
+
+// SweepTxHandler 构造扫货交易, 购买collection中最低价的N个挂单
+func SweepTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.SweepTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildSweepTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
+
+// SellTxHandler 构造接受出价的交易
+func SellTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.SellTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildSellTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
+
+// MakeOrdersTxHandler 构造挂单及出价的交易
+func MakeOrdersTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.MakeOrdersTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildMakeOrdersTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
+
+// CancelOrdersTxHandler 构造取消订单的交易
+func CancelOrdersTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.CancelOrdersTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildCancelOrdersTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
+
+// EditOrdersTxHandler 构造修改订单价格及数量的交易
+func EditOrdersTxHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.EditOrdersTxReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.BuildEditOrdersTx(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.BuildTxResp{Result: res})
+	}
+}
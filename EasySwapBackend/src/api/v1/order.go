@@ -43,3 +43,27 @@ func OrderInfosHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 		}{Result: res})
 	}
 }
+
+// SubmitOrderHandler 提交链下EIP-712签名订单
+func SubmitOrderHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := types.SubmitOrderReq{}
+		if err := c.BindJSON(&req); err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+
+		chain, ok := chainIDToChain[req.ChainID]
+		if !ok || req.Signature == "" {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.SubmitSignedOrder(c.Request.Context(), svcCtx, chain, req)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		xhttp.OkJson(c, types.SubmitOrderResp{Result: res})
+	}
+}
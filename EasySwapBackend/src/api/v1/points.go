@@ -0,0 +1,149 @@
+package v1
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const (
+	defaultPointsPageSize = 20
+	maxPointsPageSize     = 100
+)
+
+// parsePointsChain 解析chain_id参数
+func parsePointsChain(c *gin.Context) (int, string, bool) {
+	chainID, err := strconv.ParseInt(c.Query("chain_id"), 10, 32)
+	if err != nil {
+		return 0, "", false
+	}
+	chain, ok := chainIDToChain[int(chainID)]
+	return int(chainID), chain, ok
+}
+
+// parsePointsFilter 解析分页查询的filters参数
+func parsePointsFilter(c *gin.Context) (types.PointsFilterParams, string, bool) {
+	var filter types.PointsFilterParams
+	if err := json.Unmarshal([]byte(c.Query("filters")), &filter); err != nil {
+		return filter, "", false
+	}
+	chain, ok := chainIDToChain[filter.ChainID]
+	if !ok {
+		return filter, "", false
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = defaultPointsPageSize
+	}
+	if filter.PageSize > maxPointsPageSize {
+		filter.PageSize = maxPointsPageSize
+	}
+	return filter, chain, true
+}
+
+// parsePointsAddress 解析地址参数, 统一为校验和格式
+func parsePointsAddress(c *gin.Context) (string, bool) {
+	address := c.Params.ByName("address")
+	if !common.IsHexAddress(address) {
+		return "", false
+	}
+	return common.HexToAddress(address).String(), true
+}
+
+// PointsAccountHandler 查询账户余额及累计积分
+func PointsAccountHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address, ok := parsePointsAddress(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		chainID, chain, ok := parsePointsChain(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetPointsAccount(c.Request.Context(), svcCtx, chainID, chain, address)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+
+		xhttp.OkJson(c, res)
+	}
+}
+
+// PointsHistoryHandler 查询账户每个周期的积分
+func PointsHistoryHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address, ok := parsePointsAddress(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		filter, chain, ok := parsePointsFilter(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetPointsHistory(c.Request.Context(), svcCtx, filter.ChainID, chain, address, filter.Page, filter.PageSize)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+
+		xhttp.OkJson(c, res)
+	}
+}
+
+// PointsLeaderboardHandler 查询积分排行
+func PointsLeaderboardHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, chain, ok := parsePointsFilter(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetPointsLeaderboard(c.Request.Context(), svcCtx, chain, filter.Page, filter.PageSize)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+
+		xhttp.OkJson(c, res)
+	}
+}
+
+// PointsSummaryHandler 查询积分合约流通量、持有人数及已发放的积分
+func PointsSummaryHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chainID, chain, ok := parsePointsChain(c)
+		if !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		res, err := service.GetPointsSummary(c.Request.Context(), svcCtx, chainID, chain)
+		if err != nil {
+			xhttp.Error(c, errcode.ErrUnexpected)
+			return
+		}
+
+		xhttp.OkJson(c, res)
+	}
+}
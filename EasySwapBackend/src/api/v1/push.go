@@ -0,0 +1,261 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/push"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+const (
+	pushHeartbeatInterval = 15 * time.Second
+	pushWriteTimeout      = 10 * time.Second
+	wsReadLimit           = 4096
+)
+
+// 推送给客户端的控制事件
+const (
+	pushEventMessage    = "message"    // 市场事件
+	pushEventSubscribed = "subscribed" // 订阅主题变化
+	pushEventReset      = "reset"      // resume token已失效, 需要通过接口重新获取数据
+	pushEventOverflow   = "overflow"   // 消息积压, 连接将被关闭, 使用resume token重连
+	pushEventError      = "error"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true }, // 与cors配置一致, 允许所有来源
+}
+
+// pushFrame websocket连接收发的消息
+type pushFrame struct {
+	Event   string        `json:"event,omitempty"`
+	Op      string        `json:"op,omitempty"` // 客户端操作: subscribe, unsubscribe, ping
+	Topics  []string      `json:"topics,omitempty"`
+	Resume  string        `json:"resume,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Message *push.Message `json:"message,omitempty"`
+}
+
+// openPushSubscription 解析chain_id、topics及resume参数并创建订阅, 返回需要补发的消息
+func openPushSubscription(c *gin.Context, svcCtx *svc.ServerCtx, resume string) (*push.Subscriber, []*push.Message, bool, error) {
+	chainID, err := strconv.Atoi(c.Query("chain_id"))
+	if err != nil {
+		return nil, nil, false, errcode.ErrInvalidParams
+	}
+
+	var topics []string
+	if c.Query("topics") != "" {
+		topics = strings.Split(c.Query("topics"), ",")
+	}
+	sub, err := svcCtx.Push.Subscribe(chainID, topics)
+	if err != nil {
+		return nil, nil, false, errcode.NewCustomErr(err.Error())
+	}
+	if resume == "" {
+		return sub, nil, false, nil
+	}
+
+	replay, reset, err := svcCtx.Push.Replay(c.Request.Context(), sub, resume)
+	if err != nil {
+		svcCtx.Push.Unsubscribe(sub)
+		if err == push.ErrInvalidResume {
+			return nil, nil, false, errcode.NewCustomErr(err.Error())
+		}
+		xzap.WithContext(c.Request.Context()).Error("failed on replay market events", zap.Error(err))
+		return nil, nil, false, errcode.ErrUnexpected
+	}
+	return sub, replay, reset, nil
+}
+
+// MarketStreamHandler SSE推送市场事件
+// 参数: chain_id, topics(逗号分隔), resume(或Last-Event-ID请求头), 消息的id即为resume token
+func MarketStreamHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resume := c.GetHeader("Last-Event-ID")
+		if resume == "" {
+			resume = c.Query("resume")
+		}
+		sub, replay, reset, err := openPushSubscription(c, svcCtx, resume)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		defer svcCtx.Push.Unsubscribe(sub)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		cursor := push.NewCursor(resume)
+		send := func(event string, id string, data interface{}) bool {
+			raw, _ := json.Marshal(data)
+			if id != "" {
+				fmt.Fprintf(c.Writer, "id: %s\n", id)
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, raw); err != nil {
+				return false
+			}
+			c.Writer.Flush()
+			return true
+		}
+
+		if reset {
+			cursor = push.NewCursor("")
+			send(pushEventReset, "", gin.H{"resume": resume})
+		}
+		for _, msg := range replay {
+			if cursor.Accept(msg) && !send(pushEventMessage, msg.ID, msg) {
+				return
+			}
+		}
+		send(pushEventSubscribed, "", gin.H{"topics": sub.Topics()})
+
+		ticker := time.NewTicker(pushHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-sub.Done():
+				send(pushEventOverflow, "", gin.H{"resume": cursor.Resume()})
+				return
+			case msg := <-sub.Messages():
+				if cursor.Accept(msg) && !send(pushEventMessage, msg.ID, msg) {
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			}
+		}
+	}
+}
+
+// MarketWebsocketHandler websocket推送市场事件
+// 连接参数与SSE相同, 连接后可发送 {"op":"subscribe|unsubscribe","topics":[...]} 修改订阅
+func MarketWebsocketHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resume := c.Query("resume")
+		sub, replay, reset, err := openPushSubscription(c, svcCtx, resume)
+		if err != nil {
+			xhttp.Error(c, err)
+			return
+		}
+		defer svcCtx.Push.Unsubscribe(sub)
+
+		conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			xzap.WithContext(c.Request.Context()).Warn("failed on upgrade websocket", zap.Error(err))
+			return
+		}
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+
+		// 读取客户端的订阅操作, 写操作统一在下面的循环中执行
+		replies := make(chan pushFrame, 16)
+		go readPushFrames(ctx, cancel, conn, sub, replies)
+
+		cursor := push.NewCursor(resume)
+		send := func(frame pushFrame) bool {
+			conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+			return conn.WriteJSON(frame) == nil
+		}
+
+		if reset {
+			cursor = push.NewCursor("")
+			send(pushFrame{Event: pushEventReset, Resume: resume})
+		}
+		for _, msg := range replay {
+			if cursor.Accept(msg) && !send(pushFrame{Event: pushEventMessage, Message: msg}) {
+				return
+			}
+		}
+		send(pushFrame{Event: pushEventSubscribed, Topics: sub.Topics()})
+
+		ticker := time.NewTicker(pushHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.Done():
+				send(pushFrame{Event: pushEventOverflow, Resume: cursor.Resume()})
+				return
+			case msg := <-sub.Messages():
+				if cursor.Accept(msg) && !send(pushFrame{Event: pushEventMessage, Message: msg}) {
+					return
+				}
+			case reply := <-replies:
+				if !send(reply) {
+					return
+				}
+			case <-ticker.C:
+				conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func readPushFrames(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, sub *push.Subscriber, replies chan<- pushFrame) {
+	defer cancel()
+	conn.SetReadLimit(wsReadLimit)
+	conn.SetReadDeadline(time.Now().Add(3 * pushHeartbeatInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(3 * pushHeartbeatInterval))
+	})
+
+	for {
+		var frame pushFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(3 * pushHeartbeatInterval))
+
+		reply := pushFrame{Event: pushEventSubscribed}
+		switch frame.Op {
+		case "subscribe":
+			if err := sub.Subscribe(frame.Topics...); err != nil {
+				reply = pushFrame{Event: pushEventError, Error: err.Error()}
+			}
+		case "unsubscribe":
+			sub.Unsubscribe(frame.Topics...)
+		case "ping":
+			reply = pushFrame{Event: "pong"}
+		default:
+			reply = pushFrame{Event: pushEventError, Error: "unsupported op"}
+		}
+		if reply.Event == pushEventSubscribed {
+			reply.Topics = sub.Topics()
+		}
+
+		select {
+		case replies <- reply:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
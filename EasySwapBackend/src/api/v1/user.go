@@ -1,11 +1,15 @@
 package v1
 
 import (
+	"strconv"
+
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/kit/validator"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
 	"github.com/ProjectsTask/EasySwapBackend/src/service/v1"
 	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
@@ -36,6 +40,45 @@ func UserLoginHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	}
 }
 
+// RefreshSessionHandler 刷新请求中的会话, 返回新的token
+func RefreshSessionHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, err := service.RefreshSession(c.Request.Context(), svcCtx, middleware.GetAuthSessions(c))
+		if err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+
+		xhttp.OkJson(c, types.UserLoginResp{
+			Result: res,
+		})
+	}
+}
+
+// UserLogoutHandler 登出请求中的会话
+func UserLogoutHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := service.UserLogout(c.Request.Context(), svcCtx, middleware.GetAuthSessions(c)); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+
+		xhttp.OkJson(c, nil)
+	}
+}
+
+// UserLogoutAllHandler 撤销请求中地址的所有会话
+func UserLogoutAllHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := service.UserLogoutAll(c.Request.Context(), svcCtx, middleware.GetAuthSessions(c)); err != nil {
+			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
+			return
+		}
+
+		xhttp.OkJson(c, nil)
+	}
+}
+
 func GetLoginMessageHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		address := c.Params.ByName("address")
@@ -43,8 +86,29 @@ func GetLoginMessageHandler(svcCtx *svc.ServerCtx) gin.HandlerFunc {
 			xhttp.Error(c, errcode.NewCustomErr("user addr is null"))
 			return
 		}
+		if !common.IsHexAddress(address) {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
+
+		// 登录消息中的链, 未指定时使用第一个支持的链
+		var chainID int
+		if c.Query("chain_id") != "" {
+			id, err := strconv.ParseInt(c.Query("chain_id"), 10, 32)
+			if err != nil {
+				xhttp.Error(c, errcode.ErrInvalidParams)
+				return
+			}
+			chainID = int(id)
+		} else if len(svcCtx.C.ChainSupported) > 0 {
+			chainID = svcCtx.C.ChainSupported[0].ChainID
+		}
+		if _, ok := chainIDToChain[chainID]; !ok {
+			xhttp.Error(c, errcode.ErrInvalidParams)
+			return
+		}
 
-		res, err := service.GetUserLoginMsg(c.Request.Context(), svcCtx, address)
+		res, err := service.GetUserLoginMsg(c.Request.Context(), svcCtx, address, chainID)
 		if err != nil {
 			xhttp.Error(c, errcode.NewCustomErr(err.Error()))
 			return
@@ -67,7 +67,13 @@ func AesEncryptOFB(data []byte, key []byte) ([]byte, error) {
 }
 
 func AesDecryptOFB(data []byte, key []byte) ([]byte, error) {
-	block, _ := aes.NewCipher([]byte(key))
+	block, err := aes.NewCipher([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aes.BlockSize {
+		return nil, fmt.Errorf("data is shorter than the block size")
+	}
 	iv := data[:aes.BlockSize]
 	data = data[aes.BlockSize:]
 	if len(data)%aes.BlockSize != 0 {
@@ -78,8 +84,7 @@ func AesDecryptOFB(data []byte, key []byte) ([]byte, error) {
 	mode := cipher.NewOFB(block, iv)
 	mode.XORKeyStream(out, data)
 
-	out = PKCS7UnPadding(out)
-	return out, nil
+	return PKCS7UnPadding(out)
 }
 
 // 补码
@@ -91,8 +96,14 @@ func PKCS7Padding(ciphertext []byte, blocksize int) []byte {
 }
 
 // 去码
-func PKCS7UnPadding(origData []byte) []byte {
+func PKCS7UnPadding(origData []byte) ([]byte, error) {
 	length := len(origData)
+	if length == 0 {
+		return nil, fmt.Errorf("empty padded data")
+	}
 	unpadding := int(origData[length-1])
-	return origData[:(length - unpadding)]
+	if unpadding == 0 || unpadding > length {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return origData[:(length - unpadding)], nil
 }
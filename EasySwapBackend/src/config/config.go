@@ -20,6 +20,8 @@ type Config struct {
 	Evm            *erc.NftErc       `toml:"evm" json:"evm"`
 	MetadataParse  *MetadataParse    `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"`
 	ChainSupported []*ChainSupported `toml:"chain_supported" mapstructure:"chain_supported" json:"chain_supported"`
+	Siwe           *Siwe             `toml:"siwe" mapstructure:"siwe" json:"siwe"`
+	Session        *Session          `toml:"session" mapstructure:"session" json:"session"`
 }
 
 type ProjectCfg struct {
@@ -31,6 +33,20 @@ type Api struct {
 	MaxNum int64  `toml:"max_num" json:"max_num"`
 }
 
+// Siwe 登录消息(EIP-4361)的配置
+type Siwe struct {
+	Domain            string `toml:"domain" mapstructure:"domain" json:"domain"` // 请求签名的域名, 登录时校验消息中的域名
+	URI               string `toml:"uri" mapstructure:"uri" json:"uri"`
+	Statement         string `toml:"statement" mapstructure:"statement" json:"statement"`
+	ExpirationSeconds int64  `toml:"expiration_seconds" mapstructure:"expiration_seconds" json:"expiration_seconds"` // 登录消息有效期
+}
+
+// Session 登录会话的配置
+type Session struct {
+	Secret        string `toml:"secret" mapstructure:"secret" json:"-"`                              // 会话token的HMAC签名密钥
+	ExpireSeconds int64  `toml:"expire_seconds" mapstructure:"expire_seconds" json:"expire_seconds"` // 会话有效期, 默认7天
+}
+
 type KvConf struct {
 	Redis []*Redis `toml:"redis" mapstructure:"redis" json:"redis"`
 }
@@ -51,9 +67,13 @@ type MetadataParse struct {
 }
 
 type ChainSupported struct {
-	Name     string `toml:"name" mapstructure:"name" json:"name"`
-	ChainID  int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
-	Endpoint string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
+	Name           string `toml:"name" mapstructure:"name" json:"name"`
+	ChainID        int    `toml:"chain_id" mapstructure:"chain_id" json:"chain_id"`
+	Endpoint       string `toml:"endpoint" mapstructure:"endpoint" json:"endpoint"`
+	PointsToken    string `toml:"points_token" mapstructure:"points_token" json:"points_token"`                // 计算积分的ERC20合约, 与sync服务配置的第一个合约一致
+	PointsDecimals int32  `toml:"points_decimals" mapstructure:"points_decimals" json:"points_decimals"`       // 积分合约的精度, 默认18
+	OrderBook      string `toml:"orderbook_address" mapstructure:"orderbook_address" json:"orderbook_address"` // 订单簿合约, 用于校验链下签名订单
+	Vault          string `toml:"vault_address" mapstructure:"vault_address" json:"vault_address"`             // 订单簿的vault合约, 挂单需要授权给该地址
 }
 
 // UnmarshalConfig unmarshal conifg file
@@ -31,6 +31,7 @@ var eventTypesToID = map[string]int{
 	"item_bid":              multi.ItemBid,
 	"cancel_collection_bid": multi.CancelCollectionBid,
 	"cancel_item_bid":       multi.CancelItemBid,
+	"match_failed":          multi.MatchFailed,
 }
 
 var idToEventTypes = map[int]string{
@@ -46,6 +47,7 @@ var idToEventTypes = map[int]string{
 	multi.ItemBid:             "item_bid",
 	multi.CancelCollectionBid: "cancel_collection_bid",
 	multi.CancelItemBid:       "cancel_item_bid",
+	multi.MatchFailed:         "match_failed",
 }
 
 type ActivityCountCache struct {
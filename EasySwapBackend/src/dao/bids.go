@@ -0,0 +1,104 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// order manager维护的最高出价缓存, 缓存不存在或过滤后数量不足时由调用方查询数据库
+
+// cachedCollectionBids 读取collection出价缓存, 缓存不存在时返回nil
+func (d *Dao) cachedCollectionBids(ctx context.Context, chain string, collectionAddr string) *ordermanager.BestBids {
+	raw, err := d.KvStore.GetCtx(ctx, ordermanager.GenCollectionBidsKey(chain, collectionAddr))
+	if err != nil {
+		xzap.WithContext(ctx).Warn("failed on get collection bids cache", zap.Error(err))
+		return nil
+	}
+	if raw == "" {
+		return nil
+	}
+
+	var bids ordermanager.BestBids
+	if err := json.Unmarshal([]byte(raw), &bids); err != nil {
+		xzap.WithContext(ctx).Warn("failed on unmarshal collection bids cache", zap.Error(err))
+		return nil
+	}
+	return &bids
+}
+
+// cachedItemsBids 读取collection下多个item的出价缓存, 缓存不存在时返回nil; item没有出价时对应的值为nil
+func (d *Dao) cachedItemsBids(ctx context.Context, chain string, collectionAddr string, tokenIds []string) map[string]*ordermanager.BestBids {
+	fields := append([]string{ordermanager.ItemBidsLoadedField}, tokenIds...)
+	values, err := d.KvStore.HmgetCtx(ctx, ordermanager.GenItemBidsKey(chain, collectionAddr), fields...)
+	if err != nil {
+		xzap.WithContext(ctx).Warn("failed on get item bids cache", zap.Error(err))
+		return nil
+	}
+	if len(values) != len(fields) || values[0] == "" {
+		return nil
+	}
+
+	result := make(map[string]*ordermanager.BestBids, len(tokenIds))
+	for i, tokenId := range tokenIds {
+		raw := values[i+1]
+		if raw == "" {
+			result[tokenId] = nil
+			continue
+		}
+		var bids ordermanager.BestBids
+		if err := json.Unmarshal([]byte(raw), &bids); err != nil {
+			xzap.WithContext(ctx).Warn("failed on unmarshal item bids cache", zap.Error(err))
+			return nil
+		}
+		result[tokenId] = &bids
+	}
+	return result
+}
+
+// filterCachedBids 过滤缓存中已过期和userAddr的出价, 按剩余数量累计至少quantity个后返回
+// 缓存不完整且过滤后数量不足时ok为false
+func filterCachedBids(bids *ordermanager.BestBids, collectionAddr string, userAddr string, quantity int) ([]multi.Order, bool) {
+	if bids == nil {
+		return nil, true
+	}
+
+	now := time.Now().Unix()
+	var orders []multi.Order
+	var total int
+	for _, bid := range bids.Bids {
+		if bid.ExpireTime <= now || bid.QuantityRemaining <= 0 {
+			continue
+		}
+		if userAddr != "" && strings.EqualFold(bid.Maker, userAddr) {
+			continue
+		}
+
+		order := bid.Order()
+		order.CollectionAddress = collectionAddr
+		orders = append(orders, order)
+		total += int(bid.QuantityRemaining)
+		if total >= quantity {
+			return orders, true
+		}
+	}
+	return orders, bids.Complete
+}
+
+// groupItemsByCollection 按collection分组item
+func groupItemsByCollection(itemInfos []types.ItemInfo) map[string][]string {
+	items := make(map[string][]string)
+	for _, info := range itemInfos {
+		addr := strings.ToLower(info.CollectionAddress)
+		items[addr] = append(items[addr], info.TokenID)
+	}
+	return items
+}
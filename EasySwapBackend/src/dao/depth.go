@@ -0,0 +1,60 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// QueryCollectionDepth 查询collection的深度快照
+// 优先读取order manager维护的快照, 缓存不存在时按价格聚合订单表
+func (d *Dao) QueryCollectionDepth(ctx context.Context, chain string, collectionAddr string, levels int) (*ordermanager.DepthSnapshot, error) {
+	raw, err := d.KvStore.GetCtx(ctx, ordermanager.GenCollectionDepthKey(chain, collectionAddr))
+	if err != nil {
+		xzap.WithContext(ctx).Warn("failed on get collection depth cache", zap.Error(err))
+	}
+	if raw != "" {
+		var snapshot ordermanager.DepthSnapshot
+		if err := json.Unmarshal([]byte(raw), &snapshot); err == nil {
+			return &snapshot, nil
+		}
+		xzap.WithContext(ctx).Warn("failed on unmarshal collection depth cache", zap.Error(err))
+	}
+
+	snapshot := &ordermanager.DepthSnapshot{
+		Collection: strings.ToLower(collectionAddr),
+		UpdateTime: time.Now().UnixMilli(),
+	}
+
+	// 卖方: 有效的挂单(maker为NFT的owner, 非OpenSea禁止的item), 按价格升序
+	if err := d.DB.WithContext(ctx).Table(fmt.Sprintf("%s as co", multi.OrderTableName(chain))).
+		Select("co.price as price, count(*) as orders, count(*) as quantity").
+		Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", multi.ItemTableName(chain))).
+		Where("co.collection_address = ? and co.order_type = ? and co.order_status = ? and co.expire_time > ?",
+			collectionAddr, multi.ListingOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Where("co.maker = ci.owner and (ci.is_opensea_banned, co.marketplace_id) != (true, 1)").
+		Group("co.price").Order("co.price asc").Limit(levels).
+		Scan(&snapshot.Asks).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get collection ask depth")
+	}
+
+	// 买方: 有效的collection出价, 按价格降序
+	if err := d.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Select("price, count(*) as orders, sum(quantity_remaining) as quantity").
+		Where("collection_address = ? and order_type = ? and order_status = ? and quantity_remaining > 0 and expire_time > ?",
+			collectionAddr, multi.CollectionBidOrder, multi.OrderStatusActive, time.Now().Unix()).
+		Group("price").Order("price desc").Limit(levels).
+		Scan(&snapshot.Bids).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get collection bid depth")
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,21 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+)
+
+// QueryPauseWindows 查询订单簿合约最近的暂停区间, 按暂停时间倒序
+func (d *Dao) QueryPauseWindows(ctx context.Context, chain string, limit int) ([]multi.PauseWindow, error) {
+	var windows []multi.PauseWindow
+	if err := d.DB.WithContext(ctx).Table(multi.PauseWindowTableName(chain)).
+		Order("paused_time desc, id desc").
+		Limit(limit).
+		Find(&windows).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query pause windows")
+	}
+
+	return windows, nil
+}
@@ -440,15 +440,35 @@ func (d *Dao) QueryBestBids(ctx context.Context, chain string, userAddr string,
 // 主要功能:
 // 1. 根据链名称、用户地址和Itemem信息列表查询ItemItem的最高出价订单
 // 2. 如果指定了用户地址,则排除该用户的出价
-// 3. 返回所有符合条件的有效订单(未过期且有剩余数量)
+// 3. 返回有效订单(未过期且有剩余数量), 命中缓存的Item只返回最高出价, 其余返回所有符合条件的订单
 func (d *Dao) QueryItemsBestBids(ctx context.Context, chain string, userAddr string, itemInfos []types.ItemInfo) ([]multi.Order, error) {
+	// 优先读取order manager维护的出价缓存, 缓存中无法确定最高出价的item再查询数据库
+	var bestBids []multi.Order
+	var uncached []types.ItemInfo
+	for collectionAddr, tokenIds := range groupItemsByCollection(itemInfos) {
+		cached := d.cachedItemsBids(ctx, chain, collectionAddr, tokenIds)
+		for _, tokenId := range tokenIds {
+			bids, ok := cached[tokenId]
+			if cached != nil && ok {
+				if orders, ok := filterCachedBids(bids, collectionAddr, userAddr, 1); ok {
+					bestBids = append(bestBids, orders...)
+					continue
+				}
+			}
+			uncached = append(uncached, types.ItemInfo{CollectionAddress: collectionAddr, TokenID: tokenId})
+		}
+	}
+	if len(uncached) == 0 {
+		return bestBids, nil
+	}
+
 	// 构建查询条件,将每个Item的集合地址和tokenID组合成(addr,tokenId)形式
 	var conditions []clause.Expr
-	for _, info := range itemInfos {
+	for _, info := range uncached {
 		conditions = append(conditions, gorm.Expr("(?, ?)", info.CollectionAddress, info.TokenID))
 	}
 
-	var bestBids []multi.Order
+	var dbBids []multi.Order
 	var sql string
 
 	// 根据是否指定用户地址构建不同的SQL
@@ -462,7 +482,7 @@ func (d *Dao) QueryItemsBestBids(ctx context.Context, chain string, userAddr str
 		//   - 剩余数量大于0
 		//   - 未过期
 		sql = fmt.Sprintf(`
-SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining, size
+SELECT collection_address, order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining, size
     FROM %s
     WHERE (collection_address,token_id) IN (?)
       AND order_type = ?
@@ -474,7 +494,7 @@ SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_ty
 		// SQL解释:
 		// 与上面相同,但增加了排除指定用户的条件
 		sql = fmt.Sprintf(`
-SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining,size 
+SELECT collection_address, order_id, token_id, event_time, price, salt, expire_time, maker, order_type, quantity_remaining,size 
     FROM %s
     WHERE (collection_address,token_id) IN (?)
       AND order_type = ?
@@ -486,11 +506,11 @@ SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_ty
 	}
 
 	// 执行SQL查询
-	if err := d.DB.Raw(sql, conditions, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).Scan(&bestBids).Error; err != nil {
+	if err := d.DB.Raw(sql, conditions, multi.ItemBidOrder, multi.OrderStatusActive, time.Now().Unix()).Scan(&dbBids).Error; err != nil {
 		return nil, errors.Wrap(err, "failed on get item best bids")
 	}
 
-	return bestBids, nil
+	return append(bestBids, dbBids...), nil
 }
 
 // QueryCollectionsBestBid 查询多个集合的最高出价信息
@@ -499,6 +519,25 @@ SELECT order_id, token_id, event_time, price, salt, expire_time, maker, order_ty
 // 2. 如果指定了用户地址,则排除该用户的出价
 // 3. 返回每个集合中价格最高的有效订单(未过期且有剩余数量)
 func (d *Dao) QueryCollectionsBestBid(ctx context.Context, chain string, userAddr string, collectionAddrs []string) ([]*multi.Order, error) {
+	// 优先读取order manager维护的出价缓存
+	var cachedBids []*multi.Order
+	var uncached []string
+	for _, collectionAddr := range collectionAddrs {
+		if cached := d.cachedCollectionBids(ctx, chain, collectionAddr); cached != nil {
+			if orders, ok := filterCachedBids(cached, collectionAddr, userAddr, 1); ok {
+				if len(orders) > 0 {
+					cachedBids = append(cachedBids, &orders[0])
+				}
+				continue
+			}
+		}
+		uncached = append(uncached, collectionAddr)
+	}
+	if len(uncached) == 0 {
+		return cachedBids, nil
+	}
+	collectionAddrs = uncached
+
 	var bestBid []*multi.Order
 
 	// SQL解释:
@@ -534,7 +573,7 @@ func (d *Dao) QueryCollectionsBestBid(ctx context.Context, chain string, userAdd
 		return bestBid, errors.Wrap(err, "failed on get item best bids")
 	}
 
-	return bestBid, nil
+	return append(cachedBids, bestBid...), nil
 }
 
 // QueryCollectionBestBid 查询集合最高出价信息
@@ -545,6 +584,16 @@ func (d *Dao) QueryCollectionsBestBid(ctx context.Context, chain string, userAdd
 func (d *Dao) QueryCollectionBestBid(ctx context.Context, chain string,
 	userAddr string, collectionAddr string) (multi.Order, error) {
 	var bestBid multi.Order
+	// 优先读取order manager维护的出价缓存
+	if cached := d.cachedCollectionBids(ctx, chain, collectionAddr); cached != nil {
+		if orders, ok := filterCachedBids(cached, collectionAddr, userAddr, 1); ok {
+			if len(orders) > 0 {
+				bestBid = orders[0]
+			}
+			return bestBid, nil
+		}
+	}
+
 	var sql string
 
 	// SQL解释:
@@ -601,6 +650,12 @@ func (d *Dao) QueryCollectionBestBid(ctx context.Context, chain string,
 func (d *Dao) QueryCollectionTopNBid(ctx context.Context, chain string,
 	userAddr string, collectionAddr string, num int) ([]multi.Order, error) {
 	var bestBids []multi.Order
+	// 优先读取order manager维护的出价缓存, 缓存中的出价不足N个时查询数据库
+	cached := d.cachedCollectionBids(ctx, chain, collectionAddr)
+	if orders, ok := filterCachedBids(cached, collectionAddr, userAddr, num); cached != nil && ok {
+		return expandBids(orders, num), nil
+	}
+
 	var sql string
 
 	// 根据是否指定用户地址构建不同的SQL
@@ -649,7 +704,11 @@ func (d *Dao) QueryCollectionTopNBid(ctx context.Context, chain string,
 		return nil, errors.Wrap(err, "failed on get item best bids")
 	}
 
-	// 根据剩余数量展开订单
+	return expandBids(bestBids, num), nil
+}
+
+// expandBids 根据剩余数量展开订单, 返回指定数量的订单
+func expandBids(bestBids []multi.Order, num int) []multi.Order {
 	var results []multi.Order
 	for i := 0; i < len(bestBids); i++ {
 		for j := 0; j < int(bestBids[i].QuantityRemaining); j++ {
@@ -657,11 +716,10 @@ func (d *Dao) QueryCollectionTopNBid(ctx context.Context, chain string,
 		}
 	}
 
-	// 返回指定数量的订单
 	if num > len(results) {
-		return results[:], nil
+		return results[:]
 	}
-	return results[:num], nil
+	return results[:num]
 }
 
 var collectionDetailFields = []string{"id", "chain_id", "token_standard", "name", "address", "image_uri", "floor_price", "sale_price", "item_amount", "owner_amount"}
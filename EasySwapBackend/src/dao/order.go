@@ -0,0 +1,95 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrOrderExists = errors.New("order already exists")
+
+// QueryOrderFills 查询订单的成交记录, 按成交区块升序
+func (d *Dao) QueryOrderFills(ctx context.Context, chain string, orderIds []string) ([]multi.OrderFill, error) {
+	var fills []multi.OrderFill
+	if len(orderIds) == 0 {
+		return fills, nil
+	}
+
+	if err := d.DB.WithContext(ctx).Table(multi.OrderFillTableName(chain)).
+		Where("order_id in (?)", orderIds).
+		Order("block_number asc, log_index asc").
+		Find(&fills).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query order fills")
+	}
+
+	return fills, nil
+}
+
+// CreateSignedOrder 保存链下签名订单, 并在同一事务中写入outbox, 由同步服务投递到order manager的挂单队列
+func (d *Dao) CreateSignedOrder(ctx context.Context, chainID int64, chain string, order *multi.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal order")
+	}
+
+	return d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(multi.OrderTableName(chain)).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(order)
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create order")
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrderExists
+		}
+
+		if err := tx.Table(base.OutboxTableName()).Create(&base.Outbox{
+			ChainId: chainID,
+			Kind:    base.OutboxKindOrderQueue,
+			Payload: string(payload),
+			Status:  base.OutboxStatusPending,
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on add order to outbox")
+		}
+		return nil
+	})
+}
+
+// QueryOrdersByIDs 按订单id批量查询订单
+func (d *Dao) QueryOrdersByIDs(ctx context.Context, chain string, orderIds []string) ([]multi.Order, error) {
+	var orders []multi.Order
+	if len(orderIds) == 0 {
+		return orders, nil
+	}
+
+	if err := d.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Where("order_id in (?)", orderIds).
+		Find(&orders).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query orders")
+	}
+
+	return orders, nil
+}
+
+// QueryCheapestListings 查询collection中价格不超过maxPrice的有效挂单, 按价格升序, 不包含excludeMaker的挂单
+func (d *Dao) QueryCheapestListings(ctx context.Context, chain string, collectionAddr string, maxPrice decimal.Decimal, excludeMaker string, limit int) ([]multi.Order, error) {
+	var orders []multi.Order
+	if err := d.DB.WithContext(ctx).Table(multi.OrderTableName(chain)).
+		Where("collection_address = ? and order_type = ? and order_status = ? and marketplace_id = ?",
+			collectionAddr, multi.ListingOrder, multi.OrderStatusActive, multi.MarketOrderBook).
+		Where("price <= ? and expire_time > ? and maker != ?", maxPrice, time.Now().Unix(), excludeMaker).
+		Order("price asc, event_time asc").
+		Limit(limit).
+		Find(&orders).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query cheapest listings")
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,137 @@
+package dao
+
+import (
+	"context"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// QueryPointsBalance 查询账户在积分合约上的余额(最小单位)
+func (d *Dao) QueryPointsBalance(ctx context.Context, chain string, token string, owner string) (decimal.Decimal, error) {
+	var balance multi.BalanceSum
+	err := d.DB.WithContext(ctx).Table(multi.BalanceSumTableName(chain)).
+		Where("token_address = ? and owner = ?", token, owner).
+		First(&balance).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, errors.Wrap(err, "failed on query balance")
+	}
+
+	return balance.Quantity, nil
+}
+
+// QueryPointsSum 查询账户的累计积分, 不存在时返回nil
+func (d *Dao) QueryPointsSum(ctx context.Context, chain string, owner string) (*multi.IntegralSum, error) {
+	var sum multi.IntegralSum
+	err := d.DB.WithContext(ctx).Table(multi.IntegralSumTableName(chain)).
+		Where("owner = ?", owner).
+		First(&sum).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query integral sum")
+	}
+
+	return &sum, nil
+}
+
+// QueryPointsRank 积分为points时的排名, 积分相同的账户排名相同
+func (d *Dao) QueryPointsRank(ctx context.Context, chain string, points decimal.Decimal) (int64, error) {
+	var above int64
+	if err := d.DB.WithContext(ctx).Table(multi.IntegralSumTableName(chain)).
+		Where("integral > ?", points).
+		Count(&above).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on count integral rank")
+	}
+
+	return above + 1, nil
+}
+
+// QueryPointsHistory 分页查询账户每个周期的积分, 按周期倒序
+func (d *Dao) QueryPointsHistory(ctx context.Context, chain string, owner string, page, pageSize int) ([]multi.IntegralDetail, int64, error) {
+	db := d.DB.WithContext(ctx).Table(multi.IntegralDetailTableName(chain)).
+		Where("owner = ?", owner)
+
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count integral detail")
+	}
+
+	var details []multi.IntegralDetail
+	if err := db.Order("epoch_start desc").
+		Limit(pageSize).
+		Offset(pageSize * (page - 1)).
+		Find(&details).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query integral detail")
+	}
+
+	return details, count, nil
+}
+
+// QueryPointsLeaderboard 分页查询积分排行, 积分相同时按地址排序
+func (d *Dao) QueryPointsLeaderboard(ctx context.Context, chain string, page, pageSize int) ([]multi.IntegralSum, int64, error) {
+	db := d.DB.WithContext(ctx).Table(multi.IntegralSumTableName(chain)).
+		Where("integral > 0")
+
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on count integral sum")
+	}
+
+	var sums []multi.IntegralSum
+	if err := db.Order("integral desc, owner asc").
+		Limit(pageSize).
+		Offset(pageSize * (page - 1)).
+		Find(&sums).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "failed on query integral sum")
+	}
+
+	return sums, count, nil
+}
+
+type PointsSummary struct {
+	TotalSupply  decimal.Decimal
+	HolderCount  int64
+	TotalPoints  decimal.Decimal
+	LastEpochEnd int64
+}
+
+// QueryPointsSummary 查询积分合约的流通量(最小单位)、持有人数及已发放的积分
+func (d *Dao) QueryPointsSummary(ctx context.Context, chain string, token string) (*PointsSummary, error) {
+	var supply struct {
+		TotalSupply decimal.NullDecimal
+		HolderCount int64
+	}
+	if err := d.DB.WithContext(ctx).Table(multi.BalanceSumTableName(chain)).
+		Select("sum(quantity) as total_supply, count(*) as holder_count").
+		Where("token_address = ? and quantity > 0", token).
+		Scan(&supply).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query total supply")
+	}
+
+	var points struct {
+		TotalPoints  decimal.NullDecimal
+		LastEpochEnd *int64
+	}
+	if err := d.DB.WithContext(ctx).Table(multi.IntegralEpochTableName(chain)).
+		Select("sum(points) as total_points, max(epoch_end) as last_epoch_end").
+		Scan(&points).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query total points")
+	}
+
+	summary := &PointsSummary{
+		TotalSupply: supply.TotalSupply.Decimal,
+		HolderCount: supply.HolderCount,
+		TotalPoints: points.TotalPoints.Decimal,
+	}
+	if points.LastEpochEnd != nil {
+		summary.LastEpochEnd = *points.LastEpochEnd
+	}
+	return summary, nil
+}
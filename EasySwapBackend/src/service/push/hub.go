@@ -0,0 +1,316 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	SubscriberBuffer = 256  // 每个连接待发送的消息数, 超过后断开连接, 客户端使用resume token重连
+	MaxTopics        = 50   // 每个连接最多订阅的主题数
+	ReplayLimit      = 1000 // 重连时最多补发的消息数
+
+	tailCount = 100
+	tailBlock = time.Second
+)
+
+var (
+	ErrInvalidTopic    = errors.New("invalid topic")
+	ErrTooManyTopics   = errors.New("too many topics")
+	ErrInvalidResume   = errors.New("invalid resume token")
+	ErrChainNotSupport = errors.New("chain not supported")
+)
+
+// Message 推送给客户端的消息
+type Message struct {
+	ID      string          `json:"id"` // 消息id, 断线重连时作为resume token
+	ChainID int             `json:"chain_id"`
+	Topics  []string        `json:"topics"` // 命中的订阅主题
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// ParseTopic 校验主题并统一为小写地址
+// 支持 collection:<address>, floor:<address>, item:<address>:<token_id>, address:<address>
+func ParseTopic(topic string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(topic), ":")
+	switch {
+	case len(parts) == 2 && (parts[0] == "collection" || parts[0] == "floor" || parts[0] == "address"):
+	case len(parts) == 3 && parts[0] == "item" && parts[2] != "":
+	default:
+		return "", ErrInvalidTopic
+	}
+	if !common.IsHexAddress(parts[1]) {
+		return "", ErrInvalidTopic
+	}
+	parts[1] = strings.ToLower(parts[1])
+	return strings.Join(parts, ":"), nil
+}
+
+// Subscriber 单个连接的订阅
+type Subscriber struct {
+	chainID int
+	mu      sync.RWMutex
+	topics  map[string]bool
+	ch      chan *Message
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Subscribe 添加订阅主题
+func (s *Subscriber) Subscribe(topics ...string) error {
+	parsed := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		t, err := ParseTopic(topic)
+		if err != nil {
+			return errors.Wrap(err, topic)
+		}
+		parsed = append(parsed, t)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range parsed {
+		s.topics[t] = true
+	}
+	if len(s.topics) > MaxTopics {
+		for _, t := range parsed {
+			delete(s.topics, t)
+		}
+		return ErrTooManyTopics
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅主题
+func (s *Subscriber) Unsubscribe(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range topics {
+		if t, err := ParseTopic(topic); err == nil {
+			delete(s.topics, t)
+		}
+	}
+}
+
+// Topics 当前订阅的主题
+func (s *Subscriber) Topics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	topics := make([]string, 0, len(s.topics))
+	for t := range s.topics {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+// Messages 待发送的实时消息
+func (s *Subscriber) Messages() <-chan *Message {
+	return s.ch
+}
+
+// Done 连接发送过慢导致消息积压时关闭
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// match 返回事件命中的订阅主题
+func (s *Subscriber) match(topics []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched []string
+	for _, t := range topics {
+		if s.topics[t] {
+			matched = append(matched, t)
+		}
+	}
+	return matched
+}
+
+// deliver 不阻塞地投递消息, 积压超过SubscriberBuffer时关闭订阅
+func (s *Subscriber) deliver(msg *Message) {
+	select {
+	case s.ch <- msg:
+	default:
+		s.once.Do(func() { close(s.done) })
+	}
+}
+
+// Hub 读取order manager发布的市场事件并分发给订阅的连接, 每条链一个读取协程
+type Hub struct {
+	store  *xkv.Store
+	chains map[int]string // chain id -> chain name
+
+	mu   sync.RWMutex
+	subs map[int]map[*Subscriber]struct{}
+}
+
+func NewHub(store *xkv.Store, chains map[int]string) *Hub {
+	return &Hub{
+		store:  store,
+		chains: chains,
+		subs:   make(map[int]map[*Subscriber]struct{}),
+	}
+}
+
+// Start 启动每条链的事件读取
+func (h *Hub) Start(ctx context.Context) {
+	for chainID, chain := range h.chains {
+		go h.tail(ctx, chainID, chain)
+	}
+}
+
+func (h *Hub) tail(ctx context.Context, chainID int, chain string) {
+	key := ordermanager.GenMarketEventsStreamKey(chain)
+	// 从启动时刻开始读取, 之前的消息由客户端通过resume token补发
+	last := fmt.Sprintf("%d-0", time.Now().UnixMilli())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		messages, err := h.store.TailStream(ctx, key, last, tailCount, tailBlock)
+		if err != nil {
+			xzap.WithContext(ctx).Warn("failed on tail market events", zap.Error(err), zap.String("chain", chain))
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, msg := range messages {
+			last = msg.ID
+			h.dispatch(ctx, chainID, msg)
+		}
+	}
+}
+
+func (h *Hub) dispatch(ctx context.Context, chainID int, msg xkv.StreamMessage) {
+	event, topics, ok := decodeMarketEvent(ctx, msg)
+	if !ok {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs[chainID] {
+		if matched := sub.match(topics); len(matched) > 0 {
+			sub.deliver(newMessage(msg.ID, chainID, matched, event.Type, msg.Payload))
+		}
+	}
+}
+
+func decodeMarketEvent(ctx context.Context, msg xkv.StreamMessage) (*ordermanager.MarketEvent, []string, bool) {
+	var event ordermanager.MarketEvent
+	if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		xzap.WithContext(ctx).Warn("failed on unmarshal market event", zap.Error(err), zap.String("id", msg.ID))
+		return nil, nil, false
+	}
+	return &event, event.Topics(), true
+}
+
+func newMessage(id string, chainID int, topics []string, eventType string, payload string) *Message {
+	return &Message{ID: id, ChainID: chainID, Topics: topics, Type: eventType, Data: json.RawMessage(payload)}
+}
+
+// Subscribe 为连接创建订阅
+func (h *Hub) Subscribe(chainID int, topics []string) (*Subscriber, error) {
+	if _, ok := h.chains[chainID]; !ok {
+		return nil, ErrChainNotSupport
+	}
+
+	sub := &Subscriber{
+		chainID: chainID,
+		topics:  make(map[string]bool),
+		ch:      make(chan *Message, SubscriberBuffer),
+		done:    make(chan struct{}),
+	}
+	if err := sub.Subscribe(topics...); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[chainID] == nil {
+		h.subs[chainID] = make(map[*Subscriber]struct{})
+	}
+	h.subs[chainID][sub] = struct{}{}
+	return sub, nil
+}
+
+// Unsubscribe 连接关闭时移除订阅
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[sub.chainID], sub)
+}
+
+// Replay 补发resume之后订阅主题的消息
+// resume早于队列中保留的最早消息, 或之后的消息超过ReplayLimit时reset为true, 客户端需要通过接口重新获取数据
+func (h *Hub) Replay(ctx context.Context, sub *Subscriber, resume string) ([]*Message, bool, error) {
+	if _, _, ok := xkv.ParseStreamID(resume); !ok {
+		return nil, false, ErrInvalidResume
+	}
+	key := ordermanager.GenMarketEventsStreamKey(h.chains[sub.chainID])
+
+	oldest, err := h.store.RangeStream(ctx, key, "", 1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(oldest) > 0 && xkv.CompareStreamID(resume, oldest[0].ID) < 0 {
+		return nil, true, nil
+	}
+
+	pending, err := h.store.RangeStream(ctx, key, resume, ReplayLimit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(pending) > ReplayLimit {
+		return nil, true, nil
+	}
+
+	var messages []*Message
+	for _, msg := range pending {
+		event, topics, ok := decodeMarketEvent(ctx, msg)
+		if !ok {
+			continue
+		}
+		if matched := sub.match(topics); len(matched) > 0 {
+			messages = append(messages, newMessage(msg.ID, sub.chainID, matched, event.Type, msg.Payload))
+		}
+	}
+	return messages, false, nil
+}
+
+// Cursor 记录连接已发送的最后一条消息, 跳过补发期间重复收到的实时消息
+type Cursor struct {
+	last string
+}
+
+func NewCursor(resume string) *Cursor {
+	return &Cursor{last: resume}
+}
+
+// Accept 消息未发送过时返回true并记录
+func (c *Cursor) Accept(msg *Message) bool {
+	if c.last != "" && xkv.CompareStreamID(msg.ID, c.last) <= 0 {
+		return false
+	}
+	c.last = msg.ID
+	return true
+}
+
+// Resume 断线重连时使用的resume token
+func (c *Cursor) Resume() string {
+	return c.last
+}
@@ -13,8 +13,10 @@ import (
 	"github.com/zeromicro/go-zero/core/stores/redis"
 	"gorm.io/gorm"
 
+	"github.com/ProjectsTask/EasySwapBackend/src/api/middleware"
 	"github.com/ProjectsTask/EasySwapBackend/src/config"
 	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/push"
 )
 
 type ServerCtx struct {
@@ -25,6 +27,8 @@ type ServerCtx struct {
 	KvStore  *xkv.Store
 	RankKey  string
 	NodeSrvs map[int64]*nftchainservice.Service
+	Sessions *middleware.SessionManager
+	Push     *push.Hub
 }
 
 func NewServiceContext(c *config.Config) (*ServerCtx, error) {
@@ -71,6 +75,11 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 		}
 	}
 
+	sessions, err := middleware.NewSessionManager(store, c.Session)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create session manager")
+	}
+
 	dao := dao.New(context.Background(), db, store)
 	serverCtx := NewServerCtx(
 		WithDB(db),
@@ -81,6 +90,15 @@ func NewServiceContext(c *config.Config) (*ServerCtx, error) {
 	serverCtx.C = c
 
 	serverCtx.NodeSrvs = nodeSrvs
+	serverCtx.Sessions = sessions
+
+	// 推送市场事件
+	chains := make(map[int]string)
+	for _, supported := range c.ChainSupported {
+		chains[supported.ChainID] = supported.Name
+	}
+	serverCtx.Push = push.NewHub(store, chains)
+	serverCtx.Push.Start(context.Background())
 
 	return serverCtx, nil
 }
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// GetCollectionDepth 查询collection的深度, side为空时返回双方, 每一侧最多levels个档位
+func GetCollectionDepth(ctx context.Context, svcCtx *svc.ServerCtx, chain string, collectionAddr string, side string, levels int) (*types.CollectionDepthResp, error) {
+	snapshot, err := svcCtx.Dao.QueryCollectionDepth(ctx, chain, collectionAddr, levels)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query collection depth")
+	}
+
+	depth := types.CollectionDepth{
+		Collection: snapshot.Collection,
+		Sequence:   snapshot.Sequence,
+		Bids:       truncateDepthLevels(snapshot.Bids, levels),
+		Asks:       truncateDepthLevels(snapshot.Asks, levels),
+		UpdateTime: snapshot.UpdateTime,
+	}
+	if len(depth.Bids) > 0 {
+		depth.BestBid = depth.Bids[0].Price
+	}
+	if len(depth.Asks) > 0 {
+		depth.BestAsk = depth.Asks[0].Price
+	}
+	if len(depth.Bids) > 0 && len(depth.Asks) > 0 {
+		depth.Spread = depth.BestAsk.Sub(depth.BestBid)
+	}
+
+	switch side {
+	case ordermanager.DepthSideBid:
+		depth.Asks = []ordermanager.DepthLevel{}
+	case ordermanager.DepthSideAsk:
+		depth.Bids = []ordermanager.DepthLevel{}
+	}
+
+	return &types.CollectionDepthResp{Result: depth}, nil
+}
+
+func truncateDepthLevels(levels []ordermanager.DepthLevel, num int) []ordermanager.DepthLevel {
+	if levels == nil {
+		return []ordermanager.DepthLevel{}
+	}
+	if len(levels) > num {
+		return levels[:num]
+	}
+	return levels
+}
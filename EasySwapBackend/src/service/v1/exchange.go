@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const pauseWindowLimit = 20
+
+// GetExchangeStatus 获取订单簿合约的暂停状态及最近的暂停区间
+func GetExchangeStatus(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string) (*types.ExchangeStatusResp, error) {
+	windows, err := svcCtx.Dao.QueryPauseWindows(ctx, chain, pauseWindowLimit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query pause windows")
+	}
+
+	resp := &types.ExchangeStatusResp{
+		ChainID:      chainID,
+		PauseWindows: make([]types.PauseWindow, 0, len(windows)),
+	}
+	for _, window := range windows {
+		if window.UnpausedBlock == 0 && !resp.Paused {
+			resp.Paused = true
+			resp.PausedSince = window.PausedTime
+		}
+		resp.PauseWindows = append(resp.PauseWindows, types.PauseWindow{
+			PausedBy:       window.PausedBy,
+			PausedBlock:    window.PausedBlock,
+			PausedTxHash:   window.PausedTxHash,
+			PausedTime:     window.PausedTime,
+			UnpausedBy:     window.UnpausedBy,
+			UnpausedBlock:  window.UnpausedBlock,
+			UnpausedTxHash: window.UnpausedTxHash,
+			UnpausedTime:   window.UnpausedTime,
+		})
+	}
+
+	return resp, nil
+}
@@ -48,8 +48,53 @@ func GetOrderInfos(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chai
 		return nil, errors.Wrap(err, "failed on query collection best bids")
 	}
 
-	// 5. 处理并返回最终的出价信息
-	return processBids(tokenIds, itemsBestBids, collectionBids, collectionAddr), nil
+	// 5. 处理最终的出价信息
+	resultBids := processBids(tokenIds, itemsBestBids, collectionBids, collectionAddr)
+
+	// 6. 查询出价订单的成交记录(部分成交的Collection出价)
+	if err := attachBidFills(ctx, svcCtx, chain, resultBids); err != nil {
+		return nil, errors.Wrap(err, "failed on query bid fills")
+	}
+
+	return resultBids, nil
+}
+
+// attachBidFills 为出价信息附加订单的成交记录
+func attachBidFills(ctx context.Context, svcCtx *svc.ServerCtx, chain string, bids []types.ItemBid) error {
+	var orderIds []string
+	seen := make(map[string]bool)
+	for _, bid := range bids {
+		if bid.BidUnfilled < bid.BidSize && !seen[bid.OrderID] {
+			seen[bid.OrderID] = true
+			orderIds = append(orderIds, bid.OrderID)
+		}
+	}
+	if len(orderIds) == 0 {
+		return nil
+	}
+
+	fills, err := svcCtx.Dao.QueryOrderFills(ctx, chain, orderIds)
+	if err != nil {
+		return err
+	}
+
+	orderFills := make(map[string][]types.BidFill)
+	for _, fill := range fills {
+		orderFills[fill.OrderID] = append(orderFills[fill.OrderID], types.BidFill{
+			TxHash:      fill.TxHash,
+			Taker:       fill.Taker,
+			TokenId:     fill.TokenId,
+			FillAmount:  fill.FillAmount,
+			FillPrice:   fill.FillPrice,
+			BlockNumber: fill.BlockNumber,
+			EventTime:   fill.EventTime,
+		})
+	}
+	for i := range bids {
+		bids[i].Fills = orderFills[bids[i].OrderID]
+	}
+
+	return nil
 }
 
 // processBids 处理NFT的出价信息,返回每个NFT的最高出价
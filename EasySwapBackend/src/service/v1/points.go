@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const defaultPointsDecimals = 18
+
+// pointsToken 链上用于计算积分的ERC20合约及其精度
+func pointsToken(svcCtx *svc.ServerCtx, chainID int) (string, int32) {
+	for _, chain := range svcCtx.C.ChainSupported {
+		if chain.ChainID != chainID || chain.PointsToken == "" {
+			continue
+		}
+		decimals := chain.PointsDecimals
+		if decimals == 0 {
+			decimals = defaultPointsDecimals
+		}
+		return common.HexToAddress(chain.PointsToken).String(), decimals
+	}
+	return "", defaultPointsDecimals
+}
+
+// GetPointsAccount 获取账户当前余额、累计积分及排名
+func GetPointsAccount(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string, address string) (*types.PointsAccountResp, error) {
+	token, decimals := pointsToken(svcCtx, chainID)
+	balance, err := svcCtx.Dao.QueryPointsBalance(ctx, chain, token, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query points balance")
+	}
+
+	resp := &types.PointsAccountResp{
+		ChainID:    chainID,
+		Address:    address,
+		Balance:    balance.Shift(-decimals),
+		BalanceWei: balance,
+	}
+
+	sum, err := svcCtx.Dao.QueryPointsSum(ctx, chain, address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query points")
+	}
+	if sum == nil {
+		return resp, nil
+	}
+	resp.Points = sum.Integral
+	resp.DeadlineTime = sum.DeadlineTime
+	if sum.Integral.IsPositive() {
+		if resp.Rank, err = svcCtx.Dao.QueryPointsRank(ctx, chain, sum.Integral); err != nil {
+			return nil, errors.Wrap(err, "failed on query points rank")
+		}
+	}
+
+	return resp, nil
+}
+
+// GetPointsHistory 分页获取账户每个周期的积分
+func GetPointsHistory(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string, address string, page, pageSize int) (*types.PointsHistoryResp, error) {
+	_, decimals := pointsToken(svcCtx, chainID)
+	details, count, err := svcCtx.Dao.QueryPointsHistory(ctx, chain, address, page, pageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query points history")
+	}
+
+	history := make([]types.PointsHistory, 0, len(details))
+	for _, detail := range details {
+		history = append(history, types.PointsHistory{
+			EpochStart:     detail.EpochStart,
+			EpochEnd:       detail.EpochEnd,
+			OpeningBalance: detail.OpeningBalance.Shift(-decimals),
+			ClosingBalance: detail.ClosingBalance.Shift(-decimals),
+			Points:         detail.Points,
+		})
+	}
+
+	return &types.PointsHistoryResp{
+		Result: history,
+		Count:  count,
+	}, nil
+}
+
+// GetPointsLeaderboard 分页获取积分排行, 积分相同的账户排名相同
+func GetPointsLeaderboard(ctx context.Context, svcCtx *svc.ServerCtx, chain string, page, pageSize int) (*types.PointsLeaderboardResp, error) {
+	sums, count, err := svcCtx.Dao.QueryPointsLeaderboard(ctx, chain, page, pageSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query points leaderboard")
+	}
+
+	items := make([]types.PointsLeaderboardItem, 0, len(sums))
+	for i, sum := range sums {
+		rank := int64(pageSize*(page-1) + i + 1)
+		switch {
+		case i > 0 && sum.Integral.Equal(sums[i-1].Integral):
+			rank = items[i-1].Rank
+		case i == 0 && page > 1: // 与上一页最后的账户积分相同时沿用其排名
+			if rank, err = svcCtx.Dao.QueryPointsRank(ctx, chain, sum.Integral); err != nil {
+				return nil, errors.Wrap(err, "failed on query points rank")
+			}
+		}
+		items = append(items, types.PointsLeaderboardItem{
+			Rank:         rank,
+			Address:      sum.Owner,
+			Points:       sum.Integral,
+			DeadlineTime: sum.DeadlineTime,
+		})
+	}
+
+	return &types.PointsLeaderboardResp{
+		Result: items,
+		Count:  count,
+	}, nil
+}
+
+// GetPointsSummary 获取积分合约的流通量、持有人数及已发放的积分
+func GetPointsSummary(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, chain string) (*types.PointsSummaryResp, error) {
+	token, decimals := pointsToken(svcCtx, chainID)
+	summary, err := svcCtx.Dao.QueryPointsSummary(ctx, chain, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on query points summary")
+	}
+
+	return &types.PointsSummaryResp{
+		ChainID:      chainID,
+		TokenAddress: token,
+		TotalSupply:  summary.TotalSupply.Shift(-decimals),
+		HolderCount:  summary.HolderCount,
+		TotalPoints:  summary.TotalPoints,
+		LastEpochEnd: summary.LastEpochEnd,
+	}, nil
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/dao"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+// 与合约LibOrder一致
+const (
+	orderSideList = 0
+	orderSideBid  = 1
+
+	saleKindCollection = 0
+	saleKindItem       = 1
+
+	ethCurrencyAddress = "0x0000000000000000000000000000000000000000"
+
+	signedOrderAbi = `[
+{"inputs":[],"name":"eip712Domain","outputs":[{"name":"fields","type":"bytes1"},{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"},{"name":"salt","type":"bytes32"},{"name":"extensions","type":"uint256[]"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"},{"name":"operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"tokenId","type":"uint256"}],"name":"getApproved","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
+)
+
+var (
+	signedOrderContractAbi, _ = abi.JSON(strings.NewReader(signedOrderAbi))
+
+	orderTypeHash = crypto.Keccak256Hash([]byte("Order(uint8 side,uint8 saleKind,address maker,Asset nft,uint128 price,uint64 expiry,uint64 salt)Asset(uint256 tokenId,address collection,uint96 amount)"))
+	assetTypeHash = crypto.Keccak256Hash([]byte("Asset(uint256 tokenId,address collection,uint96 amount)"))
+
+	orderTypes = apitypes.Types{
+		"Order": {
+			{Name: "side", Type: "uint8"},
+			{Name: "saleKind", Type: "uint8"},
+			{Name: "maker", Type: "address"},
+			{Name: "nft", Type: "Asset"},
+			{Name: "price", Type: "uint128"},
+			{Name: "expiry", Type: "uint64"},
+			{Name: "salt", Type: "uint64"},
+		},
+		"Asset": {
+			{Name: "tokenId", Type: "uint256"},
+			{Name: "collection", Type: "address"},
+			{Name: "amount", Type: "uint96"},
+		},
+	}
+
+	orderDomains sync.Map // chain id -> *orderDomain, 合约升级后需要重启服务
+)
+
+// orderDomain 订单簿合约eip712Domain返回的签名域
+type orderDomain struct {
+	domain apitypes.TypedDataDomain
+	fields []apitypes.Type
+}
+
+// signedOrder 解析后的LibOrder.Order
+type signedOrder struct {
+	side       uint8
+	saleKind   uint8
+	maker      common.Address
+	tokenID    *big.Int
+	collection common.Address
+	amount     *big.Int
+	price      *big.Int
+	expiry     uint64
+	salt       uint64
+}
+
+// SubmitSignedOrder 校验链下EIP-712签名订单, 保存后经outbox写入order manager的挂单队列
+func SubmitSignedOrder(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.SubmitOrderReq) (*types.SubmittedOrder, error) {
+	chainCfg := chainSupported(svcCtx, req.ChainID)
+	if chainCfg == nil || !common.IsHexAddress(chainCfg.OrderBook) || !common.IsHexAddress(chainCfg.Vault) {
+		return nil, errcode.NewCustomErr("order submission not supported on this chain")
+	}
+
+	order, err := parseSignedOrder(req.Order)
+	if err != nil {
+		return nil, errcode.NewCustomErr(err.Error())
+	}
+	if order.expiry <= uint64(time.Now().Unix()) {
+		return nil, errcode.NewCustomErr("order expired")
+	}
+
+	domain, err := getOrderDomain(ctx, svcCtx, req.ChainID, common.HexToAddress(chainCfg.OrderBook))
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get order domain", zap.Error(err), zap.Int("chain_id", req.ChainID))
+		return nil, errcode.ErrUnexpected
+	}
+	digest, err := order.typedDataHash(domain)
+	if err != nil {
+		return nil, errcode.NewCustomErr(err.Error())
+	}
+	sig, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		return nil, errcode.NewCustomErr("invalid signature encoding")
+	}
+	if err := verifySignature(ctx, svcCtx, req.ChainID, order.maker, digest, sig); err != nil {
+		return nil, errcode.NewCustomErr("signer is not maker")
+	}
+
+	collection, err := svcCtx.Dao.QueryCollectionInfo(ctx, chain, order.collection.String())
+	if err != nil || collection == nil {
+		return nil, errcode.NewCustomErr("collection not found")
+	}
+
+	if order.side == orderSideList {
+		err = checkListingAsset(ctx, svcCtx, req.ChainID, order, common.HexToAddress(chainCfg.Vault))
+	} else {
+		err = checkBidBalance(ctx, svcCtx, req.ChainID, order)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newOrder := order.toOrder(hexutil.Encode(sig))
+	if err := svcCtx.Dao.CreateSignedOrder(ctx, int64(req.ChainID), chain, newOrder); err != nil {
+		if err == dao.ErrOrderExists {
+			return nil, errcode.NewCustomErr(err.Error())
+		}
+		xzap.WithContext(ctx).Error("failed on create signed order", zap.Error(err), zap.String("order_id", newOrder.OrderID))
+		return nil, errcode.ErrUnexpected
+	}
+
+	return &types.SubmittedOrder{
+		OrderID:    newOrder.OrderID,
+		OrderType:  newOrder.OrderType,
+		ExpireTime: newOrder.ExpireTime,
+	}, nil
+}
+
+func chainSupported(svcCtx *svc.ServerCtx, chainID int) *config.ChainSupported {
+	for _, supported := range svcCtx.C.ChainSupported {
+		if supported.ChainID == chainID {
+			return supported
+		}
+	}
+	return nil
+}
+
+// parseSignedOrder 校验订单字段, 规则与合约_makeOrderTry一致
+func parseSignedOrder(req types.SignedOrder) (*signedOrder, error) {
+	if req.Side != orderSideList && req.Side != orderSideBid {
+		return nil, errors.New("invalid side")
+	}
+	if req.SaleKind != saleKindCollection && req.SaleKind != saleKindItem {
+		return nil, errors.New("invalid sale kind")
+	}
+	if !common.IsHexAddress(req.Maker) || !common.IsHexAddress(req.Nft.Collection) {
+		return nil, errors.New("invalid address")
+	}
+
+	order := &signedOrder{
+		side:       req.Side,
+		saleKind:   req.SaleKind,
+		maker:      common.HexToAddress(req.Maker),
+		collection: common.HexToAddress(req.Nft.Collection),
+		expiry:     req.Expiry,
+		salt:       req.Salt,
+	}
+	var ok bool
+	if order.tokenID, ok = parseUint(req.Nft.TokenId, 256); !ok {
+		return nil, errors.New("invalid token id")
+	}
+	if order.amount, ok = parseUint(req.Nft.Amount, 96); !ok || order.amount.Sign() == 0 {
+		return nil, errors.New("invalid amount")
+	}
+	if order.price, ok = parseUint(req.Price, 128); !ok || order.price.Sign() == 0 {
+		return nil, errors.New("invalid price")
+	}
+	if order.salt == 0 || order.salt > math.MaxInt64 { // salt以bigint保存
+		return nil, errors.New("invalid salt")
+	}
+	if order.side == orderSideList && (order.saleKind != saleKindItem || order.amount.Cmp(big.NewInt(1)) != 0) {
+		return nil, errors.New("listing must be a single item")
+	}
+	if !order.amount.IsInt64() {
+		return nil, errors.New("invalid amount")
+	}
+	return order, nil
+}
+
+// parseUint 解析十进制字符串, 超过bits位时返回false
+func parseUint(s string, bits int) (*big.Int, bool) {
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() < 0 || v.BitLen() > bits {
+		return nil, false
+	}
+	return v, true
+}
+
+// orderKey 与合约LibOrder.hash一致, 作为订单id
+func (o *signedOrder) orderKey() common.Hash {
+	assetHash := crypto.Keccak256Hash(
+		assetTypeHash.Bytes(),
+		common.LeftPadBytes(o.tokenID.Bytes(), 32),
+		common.LeftPadBytes(o.collection.Bytes(), 32),
+		common.LeftPadBytes(o.amount.Bytes(), 32),
+	)
+	return crypto.Keccak256Hash(
+		orderTypeHash.Bytes(),
+		[]byte{o.side, o.saleKind},
+		o.maker.Bytes(),
+		assetHash.Bytes(),
+		common.LeftPadBytes(o.price.Bytes(), 16),
+		common.LeftPadBytes(new(big.Int).SetUint64(o.expiry).Bytes(), 8),
+		common.LeftPadBytes(new(big.Int).SetUint64(o.salt).Bytes(), 8),
+	)
+}
+
+// typedDataHash 订单的EIP-712签名hash
+func (o *signedOrder) typedDataHash(domain *orderDomain) ([]byte, error) {
+	typedTypes := apitypes.Types{"EIP712Domain": domain.fields}
+	for name, fields := range orderTypes {
+		typedTypes[name] = fields
+	}
+	hash, _, err := apitypes.TypedDataAndHash(apitypes.TypedData{
+		Types:       typedTypes,
+		PrimaryType: "Order",
+		Domain:      domain.domain,
+		Message: apitypes.TypedDataMessage{
+			"side":     big.NewInt(int64(o.side)),
+			"saleKind": big.NewInt(int64(o.saleKind)),
+			"maker":    o.maker.Hex(),
+			"nft": map[string]interface{}{
+				"tokenId":    o.tokenID,
+				"collection": o.collection.Hex(),
+				"amount":     o.amount,
+			},
+			"price":  o.price,
+			"expiry": new(big.Int).SetUint64(o.expiry),
+			"salt":   new(big.Int).SetUint64(o.salt),
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on hash typed data")
+	}
+	return hash, nil
+}
+
+func (o *signedOrder) toOrder(signature string) *multi.Order {
+	orderType := int64(multi.ListingOrder)
+	if o.side == orderSideBid {
+		if o.saleKind == saleKindCollection {
+			orderType = multi.CollectionBidOrder
+		} else {
+			orderType = multi.ItemBidOrder
+		}
+	}
+	return &multi.Order{
+		CollectionAddress: o.collection.String(),
+		MarketplaceId:     multi.MarketOrderBook,
+		TokenId:           o.tokenID.String(),
+		OrderID:           o.orderKey().Hex(),
+		OrderStatus:       multi.OrderStatusActive,
+		EventTime:         time.Now().Unix(),
+		ExpireTime:        int64(o.expiry),
+		CurrencyAddress:   ethCurrencyAddress,
+		Price:             decimal.NewFromBigInt(o.price, 0),
+		Maker:             o.maker.String(),
+		Taker:             ethCurrencyAddress,
+		QuantityRemaining: o.amount.Int64(),
+		Size:              o.amount.Int64(),
+		OrderType:         orderType,
+		Salt:              int64(o.salt),
+		Signature:         signature,
+	}
+}
+
+// getOrderDomain 调用订单簿合约的eip712Domain(EIP-5267)获取签名域
+func getOrderDomain(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, orderBook common.Address) (*orderDomain, error) {
+	if domain, ok := orderDomains.Load(chainID); ok {
+		return domain.(*orderDomain), nil
+	}
+
+	values, err := callContract(ctx, svcCtx, chainID, signedOrderContractAbi, orderBook, "eip712Domain")
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 7 {
+		return nil, errors.New("invalid eip712Domain response")
+	}
+	fields, _ := values[0].([1]byte)
+	name, _ := values[1].(string)
+	version, _ := values[2].(string)
+	chainIDValue, _ := values[3].(*big.Int)
+	verifyingContract, _ := values[4].(common.Address)
+	salt, _ := values[5].([32]byte)
+
+	// fields按位表示name, version, chainId, verifyingContract, salt是否参与签名
+	domain := &orderDomain{}
+	if fields[0]&0x01 != 0 {
+		domain.domain.Name = name
+		domain.fields = append(domain.fields, apitypes.Type{Name: "name", Type: "string"})
+	}
+	if fields[0]&0x02 != 0 {
+		domain.domain.Version = version
+		domain.fields = append(domain.fields, apitypes.Type{Name: "version", Type: "string"})
+	}
+	if fields[0]&0x04 != 0 && chainIDValue != nil {
+		domain.domain.ChainId = (*math.HexOrDecimal256)(chainIDValue)
+		domain.fields = append(domain.fields, apitypes.Type{Name: "chainId", Type: "uint256"})
+	}
+	if fields[0]&0x08 != 0 {
+		domain.domain.VerifyingContract = verifyingContract.Hex()
+		domain.fields = append(domain.fields, apitypes.Type{Name: "verifyingContract", Type: "address"})
+	}
+	if fields[0]&0x10 != 0 {
+		domain.domain.Salt = hexutil.Encode(salt[:])
+		domain.fields = append(domain.fields, apitypes.Type{Name: "salt", Type: "bytes32"})
+	}
+
+	orderDomains.Store(chainID, domain)
+	return domain, nil
+}
+
+// checkListingAsset 挂单的NFT需要由maker持有并授权给vault
+func checkListingAsset(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, order *signedOrder, vault common.Address) error {
+	nodeSrv, ok := svcCtx.NodeSrvs[int64(chainID)]
+	if !ok {
+		return errcode.ErrInvalidParams
+	}
+	owner, err := nodeSrv.FetchNftOwner(order.collection.String(), order.tokenID.String())
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on fetch nft owner", zap.Error(err))
+		return errcode.ErrUnexpected
+	}
+	if owner != order.maker {
+		return errcode.NewCustomErr("maker is not the owner")
+	}
+
+	values, err := callContract(ctx, svcCtx, chainID, signedOrderContractAbi, order.collection, "isApprovedForAll", order.maker, vault)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on check approval for all", zap.Error(err))
+		return errcode.ErrUnexpected
+	}
+	if approved, _ := values[0].(bool); approved {
+		return nil
+	}
+
+	values, err = callContract(ctx, svcCtx, chainID, signedOrderContractAbi, order.collection, "getApproved", order.tokenID)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on check token approval", zap.Error(err))
+		return errcode.ErrUnexpected
+	}
+	if approved, _ := values[0].(common.Address); approved != vault {
+		return errcode.NewCustomErr("nft not approved to vault")
+	}
+	return nil
+}
+
+// checkBidBalance 出价需要maker的ETH余额足够支付price*amount
+func checkBidBalance(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, order *signedOrder) error {
+	nodeSrv, ok := svcCtx.NodeSrvs[int64(chainID)]
+	if !ok {
+		return errcode.ErrInvalidParams
+	}
+	client, ok := nodeSrv.NodeClient.Client().(interface {
+		BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	})
+	if !ok {
+		return errcode.NewCustomErr("order submission not supported on this chain")
+	}
+
+	balance, err := client.BalanceAt(ctx, order.maker, nil)
+	if err != nil {
+		xzap.WithContext(ctx).Error("failed on get maker balance", zap.Error(err))
+		return errcode.ErrUnexpected
+	}
+	if balance.Cmp(new(big.Int).Mul(order.price, order.amount)) < 0 {
+		return errcode.NewCustomErr("insufficient balance")
+	}
+	return nil
+}
+
+// callContract 调用合约的view方法并解析返回值
+func callContract(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, contractAbi abi.ABI, to common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	nodeSrv, ok := svcCtx.NodeSrvs[int64(chainID)]
+	if !ok || nodeSrv.NodeClient == nil {
+		return nil, errors.Errorf("unsupported chain %d", chainID)
+	}
+
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pack "+method)
+	}
+	resp, err := nodeSrv.NodeClient.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on call "+method)
+	}
+	values, err := contractAbi.Unpack(method, resp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on unpack "+method)
+	}
+	if len(values) == 0 {
+		return nil, errors.New("empty response of " + method)
+	}
+	return values, nil
+}
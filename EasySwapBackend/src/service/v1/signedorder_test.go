@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const (
+	testMakerKey  = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	testOrderBook = "0xcEE5Ba6E1cA4b1A9bD7E2b0b7E8f2e0E0Fd2b0A1"
+	testChainID   = 11155111
+)
+
+// testDomain 与OrderValidator中EIP712Upgradeable的签名域一致(fields = 0x0f)
+func testDomain() *orderDomain {
+	return &orderDomain{
+		domain: apitypes.TypedDataDomain{
+			Name:              "EasySwapOrderBook",
+			Version:           "1",
+			ChainId:           math.NewHexOrDecimal256(testChainID),
+			VerifyingContract: common.HexToAddress(testOrderBook).Hex(),
+		},
+		fields: []apitypes.Type{
+			{Name: "name", Type: "string"},
+			{Name: "version", Type: "string"},
+			{Name: "chainId", Type: "uint256"},
+			{Name: "verifyingContract", Type: "address"},
+		},
+	}
+}
+
+// abiEncode 与solidity abi.encode一致
+func abiEncode(t *testing.T, types []string, values ...interface{}) []byte {
+	var args abi.Arguments
+	for _, name := range types {
+		typ, err := abi.NewType(name, "", nil)
+		require.NoError(t, err)
+		args = append(args, abi.Argument{Type: typ})
+	}
+	data, err := args.Pack(values...)
+	require.NoError(t, err)
+	return data
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// contractAssetHash LibOrder.hash(Asset)
+func contractAssetHash(t *testing.T, o *signedOrder) common.Hash {
+	return crypto.Keccak256Hash(abiEncode(t, []string{"bytes32", "uint256", "address", "uint96"},
+		[32]byte(assetTypeHash), o.tokenID, o.collection, o.amount))
+}
+
+// contractOrderKey LibOrder.hash(Order), abi.encodePacked
+func contractOrderKey(t *testing.T, o *signedOrder) common.Hash {
+	var packed []byte
+	packed = append(packed, orderTypeHash.Bytes()...)
+	packed = append(packed, o.side, o.saleKind)
+	packed = append(packed, o.maker.Bytes()...)
+	packed = append(packed, contractAssetHash(t, o).Bytes()...)
+	packed = append(packed, o.price.FillBytes(make([]byte, 16))...)
+	packed = append(packed, uint64Bytes(o.expiry)...)
+	packed = append(packed, uint64Bytes(o.salt)...)
+	return crypto.Keccak256Hash(packed)
+}
+
+// contractTypedDataHash _hashTypedDataV4(keccak256(abi.encode(ORDER_TYPEHASH, ...)))
+func contractTypedDataHash(t *testing.T, o *signedOrder) common.Hash {
+	domainTypeHash := crypto.Keccak256Hash([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	domainSeparator := crypto.Keccak256Hash(abiEncode(t, []string{"bytes32", "bytes32", "bytes32", "uint256", "address"},
+		[32]byte(domainTypeHash),
+		[32]byte(crypto.Keccak256Hash([]byte("EasySwapOrderBook"))),
+		[32]byte(crypto.Keccak256Hash([]byte("1"))),
+		big.NewInt(testChainID),
+		common.HexToAddress(testOrderBook)))
+	structHash := crypto.Keccak256Hash(abiEncode(t,
+		[]string{"bytes32", "uint8", "uint8", "address", "bytes32", "uint128", "uint64", "uint64"},
+		[32]byte(orderTypeHash), o.side, o.saleKind, o.maker, [32]byte(contractAssetHash(t, o)), o.price, o.expiry, o.salt))
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator.Bytes(), structHash.Bytes())
+}
+
+func TestSignedOrderHashes(t *testing.T) {
+	key, err := crypto.HexToECDSA(testMakerKey)
+	require.NoError(t, err)
+	maker := crypto.PubkeyToAddress(key.PublicKey)
+
+	tests := []struct {
+		name  string
+		order types.SignedOrder
+	}{
+		{"listing", types.SignedOrder{
+			Side: orderSideList, SaleKind: saleKindItem, Maker: maker.Hex(),
+			Nft:   types.OrderAsset{TokenId: "42", Collection: "0x5aF0D9827E0c53E4799BB226655A1de152A425a5", Amount: "1"},
+			Price: "10000000000000000", Expiry: 1893456000, Salt: 1,
+		}},
+		{"collection bid", types.SignedOrder{
+			Side: orderSideBid, SaleKind: saleKindCollection, Maker: maker.Hex(),
+			Nft:   types.OrderAsset{TokenId: "0", Collection: "0x5aF0D9827E0c53E4799BB226655A1de152A425a5", Amount: "3"},
+			Price: "2500000000000000000", Expiry: 1893456000, Salt: 987654321,
+		}},
+		{"max values", types.SignedOrder{
+			Side: orderSideBid, SaleKind: saleKindItem, Maker: maker.Hex(),
+			Nft:   types.OrderAsset{TokenId: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)).String(), Collection: "0x5aF0D9827E0c53E4799BB226655A1de152A425a5", Amount: "9223372036854775807"},
+			Price: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1)).String(), Expiry: 1<<64 - 1, Salt: 1<<63 - 1,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := parseSignedOrder(tt.order)
+			require.NoError(t, err)
+
+			assert.Equal(t, contractOrderKey(t, order), order.orderKey())
+			assert.Equal(t, contractOrderKey(t, order).Hex(), order.toOrder("").OrderID)
+
+			digest, err := order.typedDataHash(testDomain())
+			require.NoError(t, err)
+			assert.Equal(t, contractTypedDataHash(t, order).Bytes(), digest)
+
+			sig, err := crypto.Sign(digest, key)
+			require.NoError(t, err)
+			pub, err := crypto.SigToPub(digest, sig)
+			require.NoError(t, err)
+			assert.Equal(t, maker, crypto.PubkeyToAddress(*pub))
+
+			// 修改任一字段后签名不再对应maker
+			order.salt++
+			tampered, err := order.typedDataHash(testDomain())
+			require.NoError(t, err)
+			pub, err = crypto.SigToPub(tampered, sig)
+			require.NoError(t, err)
+			assert.NotEqual(t, maker, crypto.PubkeyToAddress(*pub))
+		})
+	}
+}
+
+func TestParseSignedOrderRejects(t *testing.T) {
+	valid := func() types.SignedOrder {
+		return types.SignedOrder{
+			Side: orderSideBid, SaleKind: saleKindItem, Maker: "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23",
+			Nft:   types.OrderAsset{TokenId: "1", Collection: "0x5aF0D9827E0c53E4799BB226655A1de152A425a5", Amount: "1"},
+			Price: "1000", Expiry: 1893456000, Salt: 1,
+		}
+	}
+	_, err := parseSignedOrder(valid())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(o *types.SignedOrder)
+		errMsg string
+	}{
+		{"amount overflows uint96", func(o *types.SignedOrder) { o.Nft.Amount = new(big.Int).Lsh(big.NewInt(1), 96).String() }, "invalid amount"},
+		{"amount overflows int64", func(o *types.SignedOrder) { o.Nft.Amount = "9223372036854775808" }, "invalid amount"},
+		{"zero amount", func(o *types.SignedOrder) { o.Nft.Amount = "0" }, "invalid amount"},
+		{"negative amount", func(o *types.SignedOrder) { o.Nft.Amount = "-1" }, "invalid amount"},
+		{"price overflows uint128", func(o *types.SignedOrder) { o.Price = new(big.Int).Lsh(big.NewInt(1), 128).String() }, "invalid price"},
+		{"zero price", func(o *types.SignedOrder) { o.Price = "0" }, "invalid price"},
+		{"hex price", func(o *types.SignedOrder) { o.Price = "0x10" }, "invalid price"},
+		{"zero salt", func(o *types.SignedOrder) { o.Salt = 0 }, "invalid salt"},
+		{"salt overflows int64", func(o *types.SignedOrder) { o.Salt = 1 << 63 }, "invalid salt"},
+		{"token id overflows uint256", func(o *types.SignedOrder) { o.Nft.TokenId = new(big.Int).Lsh(big.NewInt(1), 256).String() }, "invalid token id"},
+		{"invalid side", func(o *types.SignedOrder) { o.Side = 2 }, "invalid side"},
+		{"listing multiple items", func(o *types.SignedOrder) { o.Side = orderSideList; o.Nft.Amount = "2" }, "listing must be a single item"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := valid()
+			tt.modify(&order)
+			_, err := parseSignedOrder(order)
+			assert.EqualError(t, err, tt.errMsg)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+const (
+	siweVersion          = "1"
+	siweHeaderSuffix     = " wants you to sign in with your Ethereum account:"
+	siweTimeLayout       = time.RFC3339
+	siweClockSkew        = 60 // 允许的时钟误差, 单位秒
+	defaultSiweDomain    = "easyswap.link"
+	defaultSiweURI       = "https://easyswap.link"
+	defaultSiweExpire    = 600
+	defaultSiweStatement = "Welcome to EasySwap!"
+
+	erc1271Abi = `[{"inputs":[{"internalType":"bytes32","name":"hash","type":"bytes32"},{"internalType":"bytes","name":"signature","type":"bytes"}],"name":"isValidSignature","outputs":[{"internalType":"bytes4","name":"magicValue","type":"bytes4"}],"stateMutability":"view","type":"function"}]`
+)
+
+var (
+	erc1271MagicValue     = []byte{0x16, 0x26, 0xba, 0x7e}
+	erc1271ContractAbi, _ = abi.JSON(strings.NewReader(erc1271Abi))
+)
+
+// siweMessage EIP-4361登录消息
+type siweMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+}
+
+// siweNonceStore 登录消息nonce的缓存, 由xkv.Store实现
+type siweNonceStore interface {
+	Get(key string) (string, error)
+	GetDel(key string) (string, error)
+}
+
+// String 按EIP-4361格式生成待签名的消息
+func (m *siweMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeaderSuffix + "\n")
+	b.WriteString(m.Address.Hex() + "\n")
+	b.WriteString("\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+		b.WriteString("\n")
+	}
+	b.WriteString("URI: " + m.URI + "\n")
+	b.WriteString("Version: " + m.Version + "\n")
+	b.WriteString("Chain ID: " + strconv.Itoa(m.ChainID) + "\n")
+	b.WriteString("Nonce: " + m.Nonce + "\n")
+	b.WriteString("Issued At: " + m.IssuedAt.UTC().Format(siweTimeLayout))
+	if !m.ExpirationTime.IsZero() {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(siweTimeLayout))
+	}
+	if !m.NotBefore.IsZero() {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(siweTimeLayout))
+	}
+	return b.String()
+}
+
+// parseSiweMessage 解析EIP-4361登录消息
+func parseSiweMessage(message string) (*siweMessage, error) {
+	lines := strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], siweHeaderSuffix) {
+		return nil, errors.New("invalid siwe message header")
+	}
+
+	m := &siweMessage{Domain: strings.TrimSuffix(lines[0], siweHeaderSuffix)}
+	if !common.IsHexAddress(lines[1]) {
+		return nil, errors.New("invalid siwe message address")
+	}
+	m.Address = common.HexToAddress(lines[1])
+
+	var err error
+	for _, line := range lines[2:] {
+		key, value, found := strings.Cut(line, ": ")
+		switch {
+		case line == "":
+			continue
+		case found && key == "URI":
+			m.URI = value
+		case found && key == "Version":
+			m.Version = value
+		case found && key == "Chain ID":
+			if m.ChainID, err = strconv.Atoi(value); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe chain id")
+			}
+		case found && key == "Nonce":
+			m.Nonce = value
+		case found && key == "Issued At":
+			if m.IssuedAt, err = time.Parse(siweTimeLayout, value); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe issued at")
+			}
+		case found && key == "Expiration Time":
+			if m.ExpirationTime, err = time.Parse(siweTimeLayout, value); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe expiration time")
+			}
+		case found && key == "Not Before":
+			if m.NotBefore, err = time.Parse(siweTimeLayout, value); err != nil {
+				return nil, errors.Wrap(err, "invalid siwe not before")
+			}
+		case found && (key == "Request ID" || key == "Resources"):
+		case m.URI == "" && m.Statement == "":
+			m.Statement = line
+		}
+	}
+
+	if m.Domain == "" || m.URI == "" || m.Version != siweVersion || m.ChainID == 0 || m.Nonce == "" || m.IssuedAt.IsZero() {
+		return nil, errors.New("incomplete siwe message")
+	}
+	return m, nil
+}
+
+// siweConfig 登录消息配置, 未配置时使用默认值
+func siweConfig(svcCtx *svc.ServerCtx) config.Siwe {
+	cfg := config.Siwe{}
+	if svcCtx.C != nil && svcCtx.C.Siwe != nil {
+		cfg = *svcCtx.C.Siwe
+	}
+	if cfg.Domain == "" {
+		cfg.Domain = defaultSiweDomain
+	}
+	if cfg.URI == "" {
+		cfg.URI = defaultSiweURI
+	}
+	if cfg.Statement == "" {
+		cfg.Statement = defaultSiweStatement
+	}
+	if cfg.ExpirationSeconds <= 0 {
+		cfg.ExpirationSeconds = defaultSiweExpire
+	}
+	return cfg
+}
+
+// validateSiweMessage 校验登录消息的域名、URI、地址、链和有效期
+// 消息中的链必须是支持的链, 请求中指定了chainID时两者需一致
+func validateSiweMessage(m *siweMessage, cfg config.Siwe, chains []*config.ChainSupported, address common.Address, chainID int, now time.Time) error {
+	if m.Domain != cfg.Domain {
+		return errors.Errorf("unexpected siwe domain %s", m.Domain)
+	}
+	if m.URI != cfg.URI {
+		return errors.Errorf("unexpected siwe uri %s", m.URI)
+	}
+	if m.Address != address {
+		return errors.New("siwe address mismatch")
+	}
+	supported := false
+	for _, chain := range chains {
+		if chain.ChainID == m.ChainID {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return errors.Errorf("unsupported siwe chain id %d", m.ChainID)
+	}
+	if chainID != 0 && m.ChainID != chainID {
+		return errors.New("siwe chain id mismatch")
+	}
+	if m.IssuedAt.After(now.Add(siweClockSkew * time.Second)) {
+		return errors.New("siwe message issued in the future")
+	}
+	if !m.NotBefore.IsZero() && m.NotBefore.After(now.Add(siweClockSkew*time.Second)) {
+		return errors.New("siwe message not yet valid")
+	}
+	if !m.ExpirationTime.IsZero() && now.After(m.ExpirationTime) {
+		return errors.New("siwe message expired")
+	}
+	return nil
+}
+
+// issuedSiweNonce 缓存中保存的nonce, 包含签发消息时的链, 消息中的链被修改时校验失败
+func issuedSiweNonce(nonce string, chainID int) string {
+	return strconv.Itoa(chainID) + ":" + nonce
+}
+
+// checkSiweNonce 校验消息的nonce及链与签发时一致, 不消耗nonce
+func checkSiweNonce(store siweNonceStore, key string, m *siweMessage) error {
+	cached, err := store.Get(key)
+	if err != nil || cached == "" || cached != issuedSiweNonce(m.Nonce, m.ChainID) {
+		return errors.New("siwe nonce not issued or expired")
+	}
+	return nil
+}
+
+// consumeSiweNonce 删除nonce, 同一nonce只能登录一次
+func consumeSiweNonce(store siweNonceStore, key string, m *siweMessage) error {
+	consumed, err := store.GetDel(key)
+	if err != nil || consumed == "" || consumed != issuedSiweNonce(m.Nonce, m.ChainID) {
+		return errors.New("siwe nonce already used")
+	}
+	return nil
+}
+
+// verifyLoginSignature 校验personal_sign签名, 恢复出的地址与账户不一致时按EIP-1271合约钱包校验
+func verifyLoginSignature(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, address common.Address, message, signature string) error {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature encoding")
+	}
+	return verifySignature(ctx, svcCtx, chainID, address, accounts.TextHash([]byte(message)), sig)
+}
+
+// verifySignature 校验hash的签名, 恢复出的地址与账户不一致时按EIP-1271合约钱包校验
+func verifySignature(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, address common.Address, hash, sig []byte) error {
+	if len(sig) == crypto.SignatureLength {
+		recoverSig := make([]byte, len(sig))
+		copy(recoverSig, sig)
+		if recoverSig[crypto.RecoveryIDOffset] >= 27 {
+			recoverSig[crypto.RecoveryIDOffset] -= 27
+		}
+		if pub, err := crypto.SigToPub(hash, recoverSig); err == nil && crypto.PubkeyToAddress(*pub) == address {
+			return nil
+		}
+	}
+
+	return verifyErc1271Signature(ctx, svcCtx, chainID, address, hash, sig)
+}
+
+// verifyErc1271Signature 调用合约钱包的isValidSignature校验签名
+func verifyErc1271Signature(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, address common.Address, hash, sig []byte) error {
+	nodeSrv, ok := svcCtx.NodeSrvs[int64(chainID)]
+	if !ok || nodeSrv.NodeClient == nil {
+		return errors.Errorf("unsupported chain %d", chainID)
+	}
+
+	var digest [32]byte
+	copy(digest[:], hash)
+	data, err := erc1271ContractAbi.Pack("isValidSignature", digest, sig)
+	if err != nil {
+		return errors.Wrap(err, "failed on pack isValidSignature")
+	}
+
+	resp, err := nodeSrv.NodeClient.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature")
+	}
+	if len(resp) < len(erc1271MagicValue) || !bytes.Equal(resp[:len(erc1271MagicValue)], erc1271MagicValue) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// newSiweNonce EIP-4361要求nonce为至少8位的字母数字
+func newSiweNonce(uuid string) string {
+	return strings.ReplaceAll(uuid, "-", "")
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+)
+
+var (
+	testSiweNow    = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	testSiweChains = []*config.ChainSupported{{ChainID: testChainID}}
+	testSiweCfg    = config.Siwe{Domain: defaultSiweDomain, URI: defaultSiweURI}
+)
+
+func testSiweMessage(address common.Address) *siweMessage {
+	return &siweMessage{
+		Domain:         defaultSiweDomain,
+		Address:        address,
+		Statement:      defaultSiweStatement,
+		URI:            defaultSiweURI,
+		Version:        siweVersion,
+		ChainID:        testChainID,
+		Nonce:          "0a1b2c3d4e5f",
+		IssuedAt:       testSiweNow,
+		ExpirationTime: testSiweNow.Add(defaultSiweExpire * time.Second),
+	}
+}
+
+func TestParseSiweMessage(t *testing.T) {
+	address := common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")
+	message := testSiweMessage(address)
+	message.NotBefore = testSiweNow
+
+	parsed, err := parseSiweMessage(message.String())
+	require.NoError(t, err)
+	assert.Equal(t, message, parsed)
+
+	crlf, err := parseSiweMessage(strings.ReplaceAll(message.String(), "\n", "\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, message, crlf)
+
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{"empty", ""},
+		{"missing header", strings.SplitN(message.String(), "\n", 2)[1]},
+		{"invalid address", strings.Replace(message.String(), address.Hex(), "0x1234", 1)},
+		{"invalid chain id", strings.Replace(message.String(), "Chain ID: 11155111", "Chain ID: sepolia", 1)},
+		{"unsupported version", strings.Replace(message.String(), "Version: 1", "Version: 2", 1)},
+		{"missing nonce", strings.Replace(message.String(), "Nonce: 0a1b2c3d4e5f\n", "", 1)},
+		{"invalid issued at", strings.Replace(message.String(), "Issued At: 2024-05-01T12:00:00Z", "Issued At: yesterday", 1)},
+		{"invalid not before", strings.Replace(message.String(), "Not Before: 2024-05-01T12:00:00Z", "Not Before: soon", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSiweMessage(tt.message)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidateSiweMessage(t *testing.T) {
+	address := common.HexToAddress("0x2c7536E3605D9C16a7a3D7b1898e529396a65c23")
+	tests := []struct {
+		name    string
+		modify  func(m *siweMessage)
+		chainID int
+		wantErr string
+	}{
+		{"valid", func(m *siweMessage) {}, testChainID, ""},
+		{"chain id omitted in request", func(m *siweMessage) {}, 0, ""},
+		{"wrong domain", func(m *siweMessage) { m.Domain = "evil.example" }, testChainID, "unexpected siwe domain"},
+		{"wrong uri", func(m *siweMessage) { m.URI = "https://evil.example" }, testChainID, "unexpected siwe uri"},
+		{"wrong address", func(m *siweMessage) { m.Address = common.HexToAddress("0x01") }, testChainID, "siwe address mismatch"},
+		{"unsupported chain", func(m *siweMessage) { m.ChainID = 1 }, 1, "unsupported siwe chain id"},
+		{"unsupported chain without request chain id", func(m *siweMessage) { m.ChainID = 1 }, 0, "unsupported siwe chain id"},
+		{"request chain mismatch", func(m *siweMessage) {}, 1, "siwe chain id mismatch"},
+		{"issued in the future", func(m *siweMessage) { m.IssuedAt = testSiweNow.Add(2 * time.Minute) }, testChainID, "issued in the future"},
+		{"clock skew tolerated", func(m *siweMessage) { m.IssuedAt = testSiweNow.Add(30 * time.Second) }, testChainID, ""},
+		{"not yet valid", func(m *siweMessage) { m.NotBefore = testSiweNow.Add(time.Hour) }, testChainID, "not yet valid"},
+		{"expired", func(m *siweMessage) { m.ExpirationTime = testSiweNow.Add(-time.Second) }, testChainID, "siwe message expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := testSiweMessage(address)
+			tt.modify(message)
+			err := validateSiweMessage(message, testSiweCfg, testSiweChains, address, tt.chainID, testSiweNow)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, err := crypto.HexToECDSA(testMakerKey)
+	require.NoError(t, err)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+	other := common.HexToAddress("0xb0ee100000000000000000000000000000000002")
+
+	message := testSiweMessage(signer).String()
+	hash := accounts.TextHash([]byte(message))
+	sig, err := crypto.Sign(hash, key) // v为0/1
+	require.NoError(t, err)
+	legacySig := append([]byte{}, sig...)
+	legacySig[crypto.RecoveryIDOffset] += 27 // 钱包返回的v为27/28
+
+	// 没有节点服务, 走到EIP-1271校验时失败
+	svcCtx := &svc.ServerCtx{}
+	tests := []struct {
+		name    string
+		address common.Address
+		hash    []byte
+		sig     []byte
+		wantErr bool
+	}{
+		{"v 0/1", signer, hash, sig, false},
+		{"v 27/28", signer, hash, legacySig, false},
+		{"wrong signer", other, hash, legacySig, true},
+		{"different message", signer, accounts.TextHash([]byte(message + " ")), legacySig, true},
+		{"truncated signature", signer, hash, legacySig[:64], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignature(context.Background(), svcCtx, testChainID, tt.address, tt.hash, tt.sig)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.NoError(t, verifyLoginSignature(context.Background(), svcCtx, testChainID, signer, message,
+		"0x"+common.Bytes2Hex(legacySig)))
+	assert.Error(t, verifyLoginSignature(context.Background(), svcCtx, testChainID, signer, message, "not hex"))
+}
+
+// memNonceStore 内存中的nonce缓存
+type memNonceStore map[string]string
+
+func (s memNonceStore) Get(key string) (string, error) {
+	return s[key], nil
+}
+
+func (s memNonceStore) GetDel(key string) (string, error) {
+	value := s[key]
+	delete(s, key)
+	return value, nil
+}
+
+func TestSiweNonce(t *testing.T) {
+	message := testSiweMessage(common.HexToAddress("0x01"))
+	store := memNonceStore{"login": issuedSiweNonce(message.Nonce, message.ChainID)}
+
+	require.NoError(t, checkSiweNonce(store, "login", message))
+
+	// 修改消息中的链或nonce后与签发时不一致
+	otherChain := *message
+	otherChain.ChainID = 1
+	assert.Error(t, checkSiweNonce(store, "login", &otherChain))
+	otherNonce := *message
+	otherNonce.Nonce = "ffffffffffff"
+	assert.Error(t, checkSiweNonce(store, "login", &otherNonce))
+
+	// 重放已使用的nonce
+	require.NoError(t, consumeSiweNonce(store, "login", message))
+	assert.Error(t, checkSiweNonce(store, "login", message))
+	assert.Error(t, consumeSiweNonce(store, "login", message))
+}
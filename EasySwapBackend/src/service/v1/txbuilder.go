@@ -0,0 +1,581 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/errcode"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+const (
+	MaxTxOrders = 50 // 单笔交易最多包含的订单数
+
+	txOrderExpiry = 30 * time.Minute // 成交时临时构造的对手单有效期, 超时后交易失败需要重新构造
+	totalShare    = 10000            // 与合约LibPayInfo.TOTAL_SHARE一致
+
+	// LibOrder.Order的abi定义, 在orderBookAbi中替换ORDER_COMPONENTS
+	libOrderComponents = `[{"name":"side","type":"uint8"},{"name":"saleKind","type":"uint8"},{"name":"maker","type":"address"},{"name":"nft","type":"tuple","components":[{"name":"tokenId","type":"uint256"},{"name":"collection","type":"address"},{"name":"amount","type":"uint96"}]},{"name":"price","type":"uint128"},{"name":"expiry","type":"uint64"},{"name":"salt","type":"uint64"}]`
+	orderBookAbi       = `[
+{"inputs":[{"name":"sellOrder","type":"tuple","components":ORDER_COMPONENTS},{"name":"buyOrder","type":"tuple","components":ORDER_COMPONENTS}],"name":"matchOrder","outputs":[],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"matchDetails","type":"tuple[]","components":[{"name":"sellOrder","type":"tuple","components":ORDER_COMPONENTS},{"name":"buyOrder","type":"tuple","components":ORDER_COMPONENTS}]}],"name":"matchOrders","outputs":[{"name":"successes","type":"bool[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"newOrders","type":"tuple[]","components":ORDER_COMPONENTS}],"name":"makeOrders","outputs":[{"name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"orderKeys","type":"bytes32[]"}],"name":"cancelOrders","outputs":[{"name":"successes","type":"bool[]"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"editDetails","type":"tuple[]","components":[{"name":"oldOrderKey","type":"bytes32"},{"name":"newOrder","type":"tuple","components":ORDER_COMPONENTS}]}],"name":"editOrders","outputs":[{"name":"newOrderKeys","type":"bytes32[]"}],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"","type":"bytes32"}],"name":"orders","outputs":[{"name":"order","type":"tuple","components":ORDER_COMPONENTS},{"name":"next","type":"bytes32"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"","type":"bytes32"}],"name":"filledAmount","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[],"name":"protocolShare","outputs":[{"name":"","type":"uint128"}],"stateMutability":"view","type":"function"}]`
+)
+
+var orderBookContractAbi, _ = abi.JSON(strings.NewReader(strings.ReplaceAll(orderBookAbi, "ORDER_COMPONENTS", libOrderComponents)))
+
+// libAsset 与合约LibOrder.Asset对应, 用于abi编码
+type libAsset struct {
+	TokenId    *big.Int
+	Collection common.Address
+	Amount     *big.Int
+}
+
+// libOrder 与合约LibOrder.Order对应, 用于abi编码
+type libOrder struct {
+	Side     uint8
+	SaleKind uint8
+	Maker    common.Address
+	Nft      libAsset
+	Price    *big.Int
+	Expiry   uint64
+	Salt     uint64
+}
+
+type libMatchDetail struct {
+	SellOrder libOrder
+	BuyOrder  libOrder
+}
+
+type libEditDetail struct {
+	OldOrderKey [32]byte
+	NewOrder    libOrder
+}
+
+func (o *signedOrder) libOrder() libOrder {
+	return libOrder{
+		Side:     o.side,
+		SaleKind: o.saleKind,
+		Maker:    o.maker,
+		Nft:      libAsset{TokenId: o.tokenID, Collection: o.collection, Amount: o.amount},
+		Price:    o.price,
+		Expiry:   o.expiry,
+		Salt:     o.salt,
+	}
+}
+
+func (o *libOrder) signedOrder() *signedOrder {
+	return &signedOrder{
+		side:       o.Side,
+		saleKind:   o.SaleKind,
+		maker:      o.Maker,
+		tokenID:    o.Nft.TokenId,
+		collection: o.Nft.Collection,
+		amount:     o.Nft.Amount,
+		price:      o.Price,
+		expiry:     o.Expiry,
+		salt:       o.Salt,
+	}
+}
+
+// orderBook 构造订单簿合约交易, 订单以合约orders中保存的数据为准
+type orderBook struct {
+	svcCtx  *svc.ServerCtx
+	chainID int
+	address common.Address
+	vault   common.Address
+}
+
+func newOrderBook(svcCtx *svc.ServerCtx, chainID int) (*orderBook, error) {
+	chainCfg := chainSupported(svcCtx, chainID)
+	if chainCfg == nil || !common.IsHexAddress(chainCfg.OrderBook) {
+		return nil, errcode.NewCustomErr("order book not configured on this chain")
+	}
+	return &orderBook{
+		svcCtx:  svcCtx,
+		chainID: chainID,
+		address: common.HexToAddress(chainCfg.OrderBook),
+		vault:   common.HexToAddress(chainCfg.Vault),
+	}, nil
+}
+
+func (b *orderBook) call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	return callContract(ctx, b.svcCtx, b.chainID, orderBookContractAbi, b.address, method, args...)
+}
+
+// onChainOrder 查询订单在合约中的状态, 已成交、已取消或未上链的订单返回nil
+func (b *orderBook) onChainOrder(ctx context.Context, orderID string) (*libOrder, *big.Int, error) {
+	key := common.HexToHash(orderID)
+	values, err := b.call(ctx, "orders", key)
+	if err != nil {
+		return nil, nil, err
+	}
+	order, ok := abi.ConvertType(values[0], new(libOrder)).(*libOrder)
+	if !ok {
+		return nil, nil, errors.New("invalid orders response")
+	}
+	if order.Maker == (common.Address{}) {
+		return nil, nil, nil
+	}
+
+	values, err = b.call(ctx, "filledAmount", key)
+	if err != nil {
+		return nil, nil, err
+	}
+	filled, _ := values[0].(*big.Int)
+	if filled == nil {
+		filled = big.NewInt(0)
+	}
+	return order, filled, nil
+}
+
+func (b *orderBook) protocolFee(ctx context.Context, total *big.Int) (*big.Int, error) {
+	values, err := b.call(ctx, "protocolShare")
+	if err != nil {
+		return nil, err
+	}
+	share, _ := values[0].(*big.Int)
+	if share == nil {
+		return big.NewInt(0), nil
+	}
+	return new(big.Int).Div(new(big.Int).Mul(total, share), big.NewInt(totalShare)), nil
+}
+
+// build 打包calldata并生成交易
+func (b *orderBook) build(from common.Address, value *big.Int, method string, args ...interface{}) (*types.BuiltTx, error) {
+	data, err := orderBookContractAbi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &types.BuiltTx{
+		Tx: types.TxRequest{
+			ChainID: b.chainID,
+			From:    from.String(),
+			To:      b.address.String(),
+			Data:    hexutil.Encode(data),
+			Value:   value.String(),
+		},
+		ProtocolFee: "0",
+	}, nil
+}
+
+// checkOrderIDs 校验订单id格式及数量
+func checkOrderIDs(orderIDs []string) ([]string, error) {
+	if len(orderIDs) == 0 || len(orderIDs) > MaxTxOrders {
+		return nil, errcode.ErrInvalidParams
+	}
+	ids := make([]string, 0, len(orderIDs))
+	seen := make(map[string]bool)
+	for _, id := range orderIDs {
+		id = strings.ToLower(id)
+		if len(id) != 66 || !strings.HasPrefix(id, "0x") {
+			return nil, errcode.NewCustomErr("invalid order id " + id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func parseTxAccount(addr string) (common.Address, error) {
+	if !common.IsHexAddress(addr) {
+		return common.Address{}, errcode.ErrInvalidParams
+	}
+	return common.HexToAddress(addr), nil
+}
+
+// newTxSalt 临时对手单使用的随机salt, 保证不超过int64
+func newTxSalt() uint64 {
+	var buf [8]byte
+	for {
+		if _, err := rand.Read(buf[:]); err != nil {
+			return uint64(time.Now().UnixNano()) >> 1
+		}
+		if salt := binary.BigEndian.Uint64(buf[:]) >> 1; salt != 0 {
+			return salt
+		}
+	}
+}
+
+func isOrderExpired(expiry uint64) bool {
+	return expiry != 0 && expiry <= uint64(time.Now().Unix())
+}
+
+func logTxBuildError(ctx context.Context, method string, err error) error {
+	xzap.WithContext(ctx).Error("failed on build tx", zap.String("method", method), zap.Error(err))
+	return errcode.ErrUnexpected
+}
+
+// BuildBuyTx 构造购买挂单的交易, 单个订单使用matchOrder, 多个订单使用matchOrders
+func BuildBuyTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.BuyTxReq) (*types.BuiltTx, error) {
+	buyer, err := parseTxAccount(req.Buyer)
+	if err != nil {
+		return nil, err
+	}
+	orderIDs, err := checkOrderIDs(req.OrderIDs)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := svcCtx.Dao.QueryOrdersByIDs(ctx, chain, orderIDs)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "matchOrders", err)
+	}
+	byID := make(map[string]multi.Order)
+	for _, order := range orders {
+		byID[strings.ToLower(order.OrderID)] = order
+	}
+
+	listings := make([]multi.Order, 0, len(orderIDs))
+	var skipped []types.SkippedOrder
+	for _, id := range orderIDs {
+		order, ok := byID[id]
+		if !ok || order.OrderType != multi.ListingOrder {
+			skipped = append(skipped, types.SkippedOrder{OrderID: id, Reason: "listing not found"})
+			continue
+		}
+		listings = append(listings, order)
+	}
+	return buildMatchTx(ctx, svcCtx, req.ChainID, buyer, listings, len(orderIDs), skipped)
+}
+
+// BuildSweepTx 构造购买collection中count个最低价挂单的交易
+func BuildSweepTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.SweepTxReq) (*types.BuiltTx, error) {
+	buyer, err := parseTxAccount(req.Buyer)
+	if err != nil {
+		return nil, err
+	}
+	if !common.IsHexAddress(req.Collection) || req.Count <= 0 || req.Count > MaxTxOrders {
+		return nil, errcode.ErrInvalidParams
+	}
+	maxPrice, err := decimal.NewFromString(req.MaxPrice)
+	if err != nil || !maxPrice.IsPositive() {
+		return nil, errcode.NewCustomErr("invalid max price")
+	}
+
+	// 多取一些挂单, 链上校验失败的订单由后面的挂单补足
+	listings, err := svcCtx.Dao.QueryCheapestListings(ctx, chain, common.HexToAddress(req.Collection).String(),
+		maxPrice, buyer.String(), 2*req.Count)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "matchOrders", err)
+	}
+	return buildMatchTx(ctx, svcCtx, req.ChainID, buyer, listings, req.Count, nil)
+}
+
+// buildMatchTx 校验挂单的链上状态, 为最多limit个有效挂单构造价格相同的买单
+func buildMatchTx(ctx context.Context, svcCtx *svc.ServerCtx, chainID int, buyer common.Address, listings []multi.Order, limit int, skipped []types.SkippedOrder) (*types.BuiltTx, error) {
+	book, err := newOrderBook(svcCtx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var details []libMatchDetail
+	var included []string
+	total := big.NewInt(0)
+	expiry := uint64(time.Now().Add(txOrderExpiry).Unix())
+	for _, listing := range listings {
+		if len(details) >= limit {
+			break
+		}
+		sellOrder, filled, err := book.onChainOrder(ctx, listing.OrderID)
+		if err != nil {
+			return nil, logTxBuildError(ctx, "orders", err)
+		}
+		reason := ""
+		switch {
+		case sellOrder == nil:
+			reason = "order not on chain"
+		case sellOrder.Side != orderSideList:
+			reason = "not a listing"
+		case isOrderExpired(sellOrder.Expiry):
+			reason = "order expired"
+		case filled.Cmp(sellOrder.Nft.Amount) >= 0: // 合约成交后只记录filledAmount, 订单仍在orders中
+			reason = "order filled"
+		case sellOrder.Maker == buyer:
+			reason = "own order"
+		}
+		if reason != "" {
+			skipped = append(skipped, types.SkippedOrder{OrderID: listing.OrderID, Reason: reason})
+			continue
+		}
+
+		buyOrder := libOrder{
+			Side:     orderSideBid,
+			SaleKind: saleKindItem,
+			Maker:    buyer,
+			Nft:      sellOrder.Nft,
+			Price:    sellOrder.Price,
+			Expiry:   expiry,
+			Salt:     newTxSalt(),
+		}
+		details = append(details, libMatchDetail{SellOrder: *sellOrder, BuyOrder: buyOrder})
+		included = append(included, listing.OrderID)
+		total.Add(total, sellOrder.Price)
+	}
+	if len(details) == 0 {
+		return nil, errcode.NewCustomErr("no valid listings")
+	}
+
+	var tx *types.BuiltTx
+	if len(details) == 1 {
+		tx, err = book.build(buyer, total, "matchOrder", details[0].SellOrder, details[0].BuyOrder)
+	} else {
+		tx, err = book.build(buyer, total, "matchOrders", details)
+	}
+	if err != nil {
+		return nil, logTxBuildError(ctx, "matchOrders", err)
+	}
+	fee, err := book.protocolFee(ctx, total)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "protocolShare", err)
+	}
+	tx.Orders, tx.Skipped, tx.ProtocolFee = included, skipped, fee.String()
+	return tx, nil
+}
+
+// BuildSellTx 构造将NFT卖给出价的交易, 卖家需要将NFT授权给vault
+func BuildSellTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.SellTxReq) (*types.BuiltTx, error) {
+	seller, err := parseTxAccount(req.Seller)
+	if err != nil {
+		return nil, err
+	}
+	orderIDs, err := checkOrderIDs([]string{req.OrderID})
+	if err != nil {
+		return nil, err
+	}
+	tokenID, ok := parseUint(req.TokenID, 256)
+	if !ok {
+		return nil, errcode.NewCustomErr("invalid token id")
+	}
+	book, err := newOrderBook(svcCtx, req.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	buyOrder, filled, err := book.onChainOrder(ctx, orderIDs[0])
+	if err != nil {
+		return nil, logTxBuildError(ctx, "orders", err)
+	}
+	switch {
+	case buyOrder == nil || buyOrder.Side != orderSideBid:
+		return nil, errcode.NewCustomErr("bid not on chain")
+	case isOrderExpired(buyOrder.Expiry):
+		return nil, errcode.NewCustomErr("bid expired")
+	case filled.Cmp(buyOrder.Nft.Amount) >= 0:
+		return nil, errcode.NewCustomErr("bid filled")
+	case buyOrder.Maker == seller:
+		return nil, errcode.NewCustomErr("own order")
+	case buyOrder.SaleKind == saleKindItem && buyOrder.Nft.TokenId.Cmp(tokenID) != 0:
+		return nil, errcode.NewCustomErr("token id mismatch")
+	}
+
+	sellOrder := libOrder{
+		Side:     orderSideList,
+		SaleKind: saleKindItem,
+		Maker:    seller,
+		Nft:      libAsset{TokenId: tokenID, Collection: buyOrder.Nft.Collection, Amount: big.NewInt(1)},
+		Price:    buyOrder.Price,
+		Expiry:   uint64(time.Now().Add(txOrderExpiry).Unix()),
+		Salt:     newTxSalt(),
+	}
+	if err := checkListingAsset(ctx, svcCtx, req.ChainID, sellOrder.signedOrder(), book.vault); err != nil {
+		return nil, err
+	}
+
+	tx, err := book.build(seller, big.NewInt(0), "matchOrder", sellOrder, *buyOrder)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "matchOrder", err)
+	}
+	fee, err := book.protocolFee(ctx, buyOrder.Price)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "protocolShare", err)
+	}
+	tx.Orders, tx.ProtocolFee = orderIDs, fee.String()
+	return tx, nil
+}
+
+// BuildMakeOrdersTx 构造挂单及出价的交易, 出价需要支付price*amount
+func BuildMakeOrdersTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.MakeOrdersTxReq) (*types.BuiltTx, error) {
+	maker, err := parseTxAccount(req.Maker)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Orders) == 0 || len(req.Orders) > MaxTxOrders {
+		return nil, errcode.ErrInvalidParams
+	}
+	book, err := newOrderBook(svcCtx, req.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	newOrders := make([]libOrder, 0, len(req.Orders))
+	included := make([]string, 0, len(req.Orders))
+	value := big.NewInt(0)
+	for _, reqOrder := range req.Orders {
+		order, err := parseSignedOrder(reqOrder)
+		if err != nil {
+			return nil, errcode.NewCustomErr(err.Error())
+		}
+		if order.maker != maker {
+			return nil, errcode.NewCustomErr("order maker mismatch")
+		}
+		if isOrderExpired(order.expiry) {
+			return nil, errcode.NewCustomErr("order expired")
+		}
+		if order.side == orderSideList {
+			if err := checkListingAsset(ctx, svcCtx, req.ChainID, order, book.vault); err != nil {
+				return nil, err
+			}
+		} else {
+			value.Add(value, new(big.Int).Mul(order.price, order.amount))
+		}
+		newOrders = append(newOrders, order.libOrder())
+		included = append(included, order.orderKey().Hex())
+	}
+
+	tx, err := book.build(maker, value, "makeOrders", newOrders)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "makeOrders", err)
+	}
+	tx.Orders = included
+	return tx, nil
+}
+
+// BuildCancelOrdersTx 构造取消订单的交易, 只包含maker在链上的有效订单
+func BuildCancelOrdersTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.CancelOrdersTxReq) (*types.BuiltTx, error) {
+	maker, err := parseTxAccount(req.Maker)
+	if err != nil {
+		return nil, err
+	}
+	orderIDs, err := checkOrderIDs(req.OrderIDs)
+	if err != nil {
+		return nil, err
+	}
+	book, err := newOrderBook(svcCtx, req.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][32]byte
+	var included []string
+	var skipped []types.SkippedOrder
+	for _, id := range orderIDs {
+		order, _, err := book.onChainOrder(ctx, id)
+		if err != nil {
+			return nil, logTxBuildError(ctx, "orders", err)
+		}
+		if order == nil || order.Maker != maker {
+			skipped = append(skipped, types.SkippedOrder{OrderID: id, Reason: "order not on chain"})
+			continue
+		}
+		keys = append(keys, common.HexToHash(id))
+		included = append(included, id)
+	}
+	if len(keys) == 0 {
+		return nil, errcode.NewCustomErr("no valid orders")
+	}
+
+	tx, err := book.build(maker, big.NewInt(0), "cancelOrders", keys)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "cancelOrders", err)
+	}
+	tx.Orders, tx.Skipped = included, skipped
+	return tx, nil
+}
+
+// BuildEditOrdersTx 构造修改订单价格及数量的交易, 出价增加的部分需要支付
+func BuildEditOrdersTx(ctx context.Context, svcCtx *svc.ServerCtx, chain string, req types.EditOrdersTxReq) (*types.BuiltTx, error) {
+	maker, err := parseTxAccount(req.Maker)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Edits) == 0 || len(req.Edits) > MaxTxOrders {
+		return nil, errcode.ErrInvalidParams
+	}
+	book, err := newOrderBook(svcCtx, req.ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	var details []libEditDetail
+	var included []string
+	var skipped []types.SkippedOrder
+	value := big.NewInt(0)
+	for _, edit := range req.Edits {
+		orderIDs, err := checkOrderIDs([]string{edit.OrderID})
+		if err != nil {
+			return nil, err
+		}
+		price, ok := parseUint(edit.Price, 128)
+		if !ok || price.Sign() == 0 {
+			return nil, errcode.NewCustomErr("invalid price")
+		}
+
+		oldOrder, filled, err := book.onChainOrder(ctx, orderIDs[0])
+		if err != nil {
+			return nil, logTxBuildError(ctx, "orders", err)
+		}
+		if oldOrder == nil || oldOrder.Maker != maker || filled.Cmp(oldOrder.Nft.Amount) >= 0 {
+			skipped = append(skipped, types.SkippedOrder{OrderID: orderIDs[0], Reason: "order not on chain"})
+			continue
+		}
+
+		newOrder := *oldOrder
+		newOrder.Price = price
+		newOrder.Salt = newTxSalt()
+		if edit.Amount != "" {
+			if newOrder.Nft.Amount, ok = parseUint(edit.Amount, 96); !ok || newOrder.Nft.Amount.Sign() == 0 {
+				return nil, errcode.NewCustomErr("invalid amount")
+			}
+		}
+		if edit.Expiry != 0 {
+			newOrder.Expiry = edit.Expiry
+		}
+		if isOrderExpired(newOrder.Expiry) {
+			return nil, errcode.NewCustomErr("order expired")
+		}
+		if newOrder.Side == orderSideList && newOrder.Nft.Amount.Cmp(big.NewInt(1)) != 0 {
+			return nil, errcode.NewCustomErr("listing must be a single item")
+		}
+
+		if newOrder.Side == orderSideBid { // 与合约_editOrderTry一致, 只需支付新旧剩余金额的差值
+			oldRemaining := new(big.Int).Mul(oldOrder.Price, new(big.Int).Sub(oldOrder.Nft.Amount, filled))
+			newRemaining := new(big.Int).Mul(newOrder.Price, newOrder.Nft.Amount)
+			if newRemaining.Cmp(oldRemaining) > 0 {
+				value.Add(value, newRemaining.Sub(newRemaining, oldRemaining))
+			}
+		}
+		details = append(details, libEditDetail{OldOrderKey: common.HexToHash(orderIDs[0]), NewOrder: newOrder})
+		included = append(included, newOrder.signedOrder().orderKey().Hex())
+	}
+	if len(details) == 0 {
+		return nil, errcode.NewCustomErr("no valid orders")
+	}
+
+	tx, err := book.build(maker, value, "editOrders", details)
+	if err != nil {
+		return nil, logTxBuildError(ctx, "editOrders", err)
+	}
+	tx.Orders, tx.Skipped = included, skipped
+	return tx, nil
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBackend/src/config"
+	"github.com/ProjectsTask/EasySwapBackend/src/service/svc"
+	"github.com/ProjectsTask/EasySwapBackend/src/types/v1"
+)
+
+var (
+	txOrderBook  = common.HexToAddress("0x0b00000000000000000000000000000000000001")
+	txVault      = common.HexToAddress("0x0b00000000000000000000000000000000000002")
+	txCollection = common.HexToAddress("0x0c00000000000000000000000000000000000003")
+	txSeller     = common.HexToAddress("0x5e11e10000000000000000000000000000000001")
+	txBuyer      = common.HexToAddress("0xb0ee100000000000000000000000000000000002")
+)
+
+const txProtocolShare = 200
+
+// fakeOrderBook 模拟订单簿合约的orders/filledAmount/protocolShare及NFT合约的所有者和授权
+type fakeOrderBook struct {
+	chainclient.ChainClient
+	t      *testing.T
+	nftAbi *abi.ABI
+	orders map[common.Hash]libOrder
+	filled map[common.Hash]int64
+	owner  common.Address
+}
+
+func (f *fakeOrderBook) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if *msg.To == txOrderBook {
+		method, err := orderBookContractAbi.MethodById(msg.Data[:4])
+		require.NoError(f.t, err)
+		args, err := method.Inputs.Unpack(msg.Data[4:])
+		require.NoError(f.t, err)
+		switch method.Name {
+		case "orders":
+			order, ok := f.orders[args[0].([32]byte)]
+			if !ok {
+				order = libOrder{Nft: libAsset{TokenId: big.NewInt(0), Amount: big.NewInt(0)}, Price: big.NewInt(0)}
+			}
+			return method.Outputs.Pack(order, [32]byte{})
+		case "filledAmount":
+			return method.Outputs.Pack(big.NewInt(f.filled[args[0].([32]byte)]))
+		case "protocolShare":
+			return method.Outputs.Pack(big.NewInt(txProtocolShare))
+		}
+		return nil, errors.New("unexpected method " + method.Name)
+	}
+
+	method, err := signedOrderContractAbi.MethodById(msg.Data[:4])
+	if err != nil {
+		method, err = f.nftAbi.MethodById(msg.Data[:4])
+	}
+	require.NoError(f.t, err)
+	switch method.Name {
+	case "ownerOf":
+		return method.Outputs.Pack(f.owner)
+	case "isApprovedForAll":
+		return method.Outputs.Pack(true)
+	}
+	return nil, errors.New("unexpected method " + method.Name)
+}
+
+// add 保存上链订单, 返回订单id
+func (f *fakeOrderBook) add(order libOrder, filled int64) string {
+	key := order.signedOrder().orderKey()
+	f.orders[key] = order
+	f.filled[key] = filled
+	return key.Hex()
+}
+
+func newTxTestCtx(t *testing.T) (*svc.ServerCtx, *fakeOrderBook) {
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	client := &fakeOrderBook{
+		t:      t,
+		orders: make(map[common.Hash]libOrder),
+		filled: make(map[common.Hash]int64),
+		owner:  txSeller,
+	}
+	nodeSrv, err := nftchainservice.NewWithClient(ctx, client, "sepolia", nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	client.nftAbi = nodeSrv.Abi
+
+	svcCtx := &svc.ServerCtx{
+		C: &config.Config{ChainSupported: []*config.ChainSupported{{
+			ChainID:   testChainID,
+			OrderBook: txOrderBook.Hex(),
+			Vault:     txVault.Hex(),
+		}}},
+		NodeSrvs: map[int64]*nftchainservice.Service{testChainID: nodeSrv},
+	}
+	return svcCtx, client
+}
+
+func txTestOrder(side uint8, saleKind uint8, maker common.Address, tokenID, amount, price int64, salt uint64) libOrder {
+	return libOrder{
+		Side:     side,
+		SaleKind: saleKind,
+		Maker:    maker,
+		Nft:      libAsset{TokenId: big.NewInt(tokenID), Collection: txCollection, Amount: big.NewInt(amount)},
+		Price:    big.NewInt(price),
+		Expiry:   uint64(time.Now().Add(time.Hour).Unix()),
+		Salt:     salt,
+	}
+}
+
+// decodeTx 解析交易calldata, 按方法参数复制到out
+func decodeTx(t *testing.T, tx *types.BuiltTx, method string, out interface{}) {
+	assert.Equal(t, txOrderBook.String(), tx.Tx.To)
+	data, err := hexutil.Decode(tx.Tx.Data)
+	require.NoError(t, err)
+	m, err := orderBookContractAbi.MethodById(data[:4])
+	require.NoError(t, err)
+	require.Equal(t, method, m.Name)
+	args, err := m.Inputs.Unpack(data[4:])
+	require.NoError(t, err)
+	require.NoError(t, m.Inputs.Copy(out, args))
+}
+
+// assertSameOrder 按LibOrder.hash比较订单, 解码后的big.Int零值与原值的内部表示不同
+func assertSameOrder(t *testing.T, expected, actual libOrder) {
+	assert.Equal(t, expected.signedOrder().orderKey(), actual.signedOrder().orderKey())
+}
+
+func assertBuyOrderFor(t *testing.T, detail libMatchDetail) {
+	assert.Equal(t, uint8(orderSideBid), detail.BuyOrder.Side)
+	assert.Equal(t, uint8(saleKindItem), detail.BuyOrder.SaleKind)
+	assert.Equal(t, txBuyer, detail.BuyOrder.Maker)
+	assert.Equal(t, detail.SellOrder.Nft, detail.BuyOrder.Nft)
+	assert.Equal(t, detail.SellOrder.Price, detail.BuyOrder.Price)
+	assert.NotZero(t, detail.BuyOrder.Salt)
+}
+
+func TestBuildMatchTxBuy(t *testing.T) {
+	svcCtx, book := newTxTestCtx(t)
+	first := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 1, 1, 100, 1), 0)
+	sold := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 2, 1, 150, 2), 1)
+	second := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 3, 1, 200, 3), 0)
+	own := book.add(txTestOrder(orderSideList, saleKindItem, txBuyer, 4, 1, 300, 4), 0)
+	listings := []multi.Order{{OrderID: first}, {OrderID: sold}, {OrderID: second}, {OrderID: own}}
+
+	tx, err := buildMatchTx(context.Background(), svcCtx, testChainID, txBuyer, listings, len(listings), nil)
+	require.NoError(t, err)
+	assert.Equal(t, txBuyer.String(), tx.Tx.From)
+	assert.Equal(t, "300", tx.Tx.Value)
+	assert.Equal(t, "6", tx.ProtocolFee)
+	assert.Equal(t, []string{first, second}, tx.Orders)
+	assert.Equal(t, []types.SkippedOrder{
+		{OrderID: sold, Reason: "order filled"},
+		{OrderID: own, Reason: "own order"},
+	}, tx.Skipped)
+
+	var details []libMatchDetail
+	decodeTx(t, tx, "matchOrders", &details)
+	require.Len(t, details, 2)
+	assertSameOrder(t, book.orders[common.HexToHash(first)], details[0].SellOrder)
+	assertSameOrder(t, book.orders[common.HexToHash(second)], details[1].SellOrder)
+	for _, detail := range details {
+		assertBuyOrderFor(t, detail)
+	}
+
+	// 只有已成交的挂单时不构造交易
+	_, err = buildMatchTx(context.Background(), svcCtx, testChainID, txBuyer, []multi.Order{{OrderID: sold}}, 1, nil)
+	assert.Error(t, err)
+}
+
+func TestBuildMatchTxSweep(t *testing.T) {
+	svcCtx, book := newTxTestCtx(t)
+	sold := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 1, 1, 90, 1), 1)
+	cheapest := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 2, 1, 100, 2), 0)
+	next := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 3, 1, 110, 3), 0)
+	listings := []multi.Order{{OrderID: sold}, {OrderID: cheapest}, {OrderID: next}}
+
+	// 已成交的挂单由后面的挂单补足, 只有一个订单时使用matchOrder
+	tx, err := buildMatchTx(context.Background(), svcCtx, testChainID, txBuyer, listings, 1, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "100", tx.Tx.Value)
+	assert.Equal(t, "2", tx.ProtocolFee)
+	assert.Equal(t, []string{cheapest}, tx.Orders)
+	assert.Equal(t, []types.SkippedOrder{{OrderID: sold, Reason: "order filled"}}, tx.Skipped)
+
+	var detail libMatchDetail
+	decodeTx(t, tx, "matchOrder", &detail)
+	assertSameOrder(t, book.orders[common.HexToHash(cheapest)], detail.SellOrder)
+	assertBuyOrderFor(t, detail)
+}
+
+func TestBuildSellTx(t *testing.T) {
+	svcCtx, book := newTxTestCtx(t)
+	bid := book.add(txTestOrder(orderSideBid, saleKindCollection, txBuyer, 0, 3, 500, 1), 1)
+	filledBid := book.add(txTestOrder(orderSideBid, saleKindCollection, txBuyer, 0, 2, 500, 2), 2)
+
+	req := types.SellTxReq{ChainID: testChainID, Seller: txSeller.Hex(), OrderID: bid, TokenID: "7"}
+	tx, err := BuildSellTx(context.Background(), svcCtx, "sepolia", req)
+	require.NoError(t, err)
+	assert.Equal(t, "0", tx.Tx.Value)
+	assert.Equal(t, "10", tx.ProtocolFee)
+
+	var detail libMatchDetail
+	decodeTx(t, tx, "matchOrder", &detail)
+	assertSameOrder(t, book.orders[common.HexToHash(bid)], detail.BuyOrder)
+	assert.Equal(t, uint8(orderSideList), detail.SellOrder.Side)
+	assert.Equal(t, txSeller, detail.SellOrder.Maker)
+	assert.Equal(t, int64(7), detail.SellOrder.Nft.TokenId.Int64())
+	assert.Equal(t, int64(1), detail.SellOrder.Nft.Amount.Int64())
+	assert.Equal(t, int64(500), detail.SellOrder.Price.Int64())
+
+	req.OrderID = filledBid
+	_, err = BuildSellTx(context.Background(), svcCtx, "sepolia", req)
+	assert.Error(t, err)
+}
+
+func TestBuildMakeOrdersTx(t *testing.T) {
+	svcCtx, _ := newTxTestCtx(t)
+	expiry := uint64(time.Now().Add(time.Hour).Unix())
+	listing := types.SignedOrder{
+		Side: orderSideList, SaleKind: saleKindItem, Maker: txSeller.Hex(),
+		Nft:   types.OrderAsset{TokenId: "1", Collection: txCollection.Hex(), Amount: "1"},
+		Price: "100", Expiry: expiry, Salt: 1,
+	}
+	bid := types.SignedOrder{
+		Side: orderSideBid, SaleKind: saleKindCollection, Maker: txSeller.Hex(),
+		Nft:   types.OrderAsset{TokenId: "0", Collection: txCollection.Hex(), Amount: "3"},
+		Price: "50", Expiry: expiry, Salt: 2,
+	}
+
+	tx, err := BuildMakeOrdersTx(context.Background(), svcCtx, "sepolia", types.MakeOrdersTxReq{
+		ChainID: testChainID, Maker: txSeller.Hex(), Orders: []types.SignedOrder{listing, bid},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "150", tx.Tx.Value) // 只有出价需要支付price*amount
+
+	var orders []libOrder
+	decodeTx(t, tx, "makeOrders", &orders)
+	require.Len(t, orders, 2)
+	for i, req := range []types.SignedOrder{listing, bid} {
+		parsed, err := parseSignedOrder(req)
+		require.NoError(t, err)
+		assertSameOrder(t, parsed.libOrder(), orders[i])
+		assert.Equal(t, parsed.orderKey().Hex(), tx.Orders[i])
+	}
+
+	// maker与订单不一致
+	_, err = BuildMakeOrdersTx(context.Background(), svcCtx, "sepolia", types.MakeOrdersTxReq{
+		ChainID: testChainID, Maker: txBuyer.Hex(), Orders: []types.SignedOrder{bid},
+	})
+	assert.Error(t, err)
+}
+
+func TestBuildCancelOrdersTx(t *testing.T) {
+	svcCtx, book := newTxTestCtx(t)
+	mine := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 1, 1, 100, 1), 0)
+	others := book.add(txTestOrder(orderSideBid, saleKindItem, txBuyer, 1, 1, 100, 2), 0)
+	missing := common.Hash{0x01}.Hex()
+
+	tx, err := BuildCancelOrdersTx(context.Background(), svcCtx, "sepolia", types.CancelOrdersTxReq{
+		ChainID: testChainID, Maker: txSeller.Hex(), OrderIDs: []string{mine, others, missing},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0", tx.Tx.Value)
+	assert.Equal(t, []string{mine}, tx.Orders)
+	assert.Len(t, tx.Skipped, 2)
+
+	var keys [][32]byte
+	decodeTx(t, tx, "cancelOrders", &keys)
+	assert.Equal(t, [][32]byte{common.HexToHash(mine)}, keys)
+}
+
+func TestBuildEditOrdersTx(t *testing.T) {
+	svcCtx, book := newTxTestCtx(t)
+	bid := book.add(txTestOrder(orderSideBid, saleKindCollection, txSeller, 0, 3, 50, 1), 1)
+	listing := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 1, 1, 100, 2), 0)
+	sold := book.add(txTestOrder(orderSideList, saleKindItem, txSeller, 2, 1, 100, 3), 1)
+
+	tx, err := BuildEditOrdersTx(context.Background(), svcCtx, "sepolia", types.EditOrdersTxReq{
+		ChainID: testChainID, Maker: txSeller.Hex(), Edits: []types.OrderEdit{
+			{OrderID: bid, Price: "80"},
+			{OrderID: listing, Price: "90"},
+			{OrderID: sold, Price: "90"},
+		},
+	})
+	require.NoError(t, err)
+	// 出价剩余2个, 新订单3个: 80*3 - 50*2
+	assert.Equal(t, "140", tx.Tx.Value)
+	assert.Equal(t, []types.SkippedOrder{{OrderID: sold, Reason: "order not on chain"}}, tx.Skipped)
+
+	var details []libEditDetail
+	decodeTx(t, tx, "editOrders", &details)
+	require.Len(t, details, 2)
+	assert.Equal(t, [32]byte(common.HexToHash(bid)), details[0].OldOrderKey)
+	assert.Equal(t, int64(80), details[0].NewOrder.Price.Int64())
+	assert.Equal(t, int64(3), details[0].NewOrder.Nft.Amount.Int64())
+	assert.Equal(t, [32]byte(common.HexToHash(listing)), details[1].OldOrderKey)
+	assert.Equal(t, int64(90), details[1].NewOrder.Price.Int64())
+	for i, detail := range details {
+		assert.Equal(t, detail.NewOrder.signedOrder().orderKey().Hex(), tx.Orders[i])
+	}
+}
@@ -1,19 +1,13 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/hex"
-	"fmt"
-	"io"
 	"strings"
 	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/errcode"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 
@@ -26,35 +20,38 @@ func getUserLoginMsgCacheKey(address string) string {
 	return middleware.CR_LOGIN_MSG_KEY + ":" + strings.ToLower(address)
 }
 
-func getUserLoginTokenCacheKey(address string) string {
-	return middleware.CR_LOGIN_KEY + ":" + strings.ToLower(address)
-}
-
 func UserLogin(ctx context.Context, svcCtx *svc.ServerCtx, req types.LoginReq) (*types.UserLoginInfo, error) {
 	// 返回结果
 	res := types.UserLoginInfo{}
 
-	//todo: add verify signature
-	//ok := verifySignature(req.Message, req.Signature, req.PublicKey)
-	//if !ok {
-	//	return nil, errors.New("invalid signature")
-	//}
+	if !common.IsHexAddress(req.Address) {
+		return nil, errcode.ErrInvalidParams
+	}
+	address := common.HexToAddress(req.Address)
 
-	// 从缓存中获取登录消息UUID
-	cachedUUID, err := svcCtx.KvStore.Get(getUserLoginMsgCacheKey(req.Address))
-	if cachedUUID == "" || err != nil {
-		return nil, errcode.ErrTokenExpire
+	// 解析并校验EIP-4361登录消息
+	message, err := parseSiweMessage(req.Message)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid login message")
 	}
 
-	// 分割消息获取UUID
-	splits := strings.Split(req.Message, "Nonce:")
-	if len(splits) != 2 {
+	// 校验nonce及链与签发的登录消息一致
+	cacheKey := getUserLoginMsgCacheKey(req.Address)
+	if err := checkSiweNonce(svcCtx.KvStore, cacheKey, message); err != nil {
 		return nil, errcode.ErrTokenExpire
 	}
 
-	// 获取登录UUID并验证
-	loginUUID := strings.Trim(splits[1], "\n")
-	if loginUUID != cachedUUID {
+	if err := validateSiweMessage(message, siweConfig(svcCtx), svcCtx.C.ChainSupported, address, req.ChainID, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "invalid login message")
+	}
+
+	// 恢复签名地址, 合约钱包按EIP-1271校验
+	if err := verifyLoginSignature(ctx, svcCtx, message.ChainID, address, req.Message, req.Signature); err != nil {
+		return nil, errors.Wrap(err, "failed on verify signature")
+	}
+
+	// nonce只能使用一次
+	if err := consumeSiweNonce(svcCtx.KvStore, cacheKey, message); err != nil {
 		return nil, errcode.ErrTokenExpire
 	}
 
@@ -80,72 +77,84 @@ func UserLogin(ctx context.Context, svcCtx *svc.ServerCtx, req types.LoginReq) (
 		}
 		if err := svcCtx.DB.WithContext(ctx).Table(base.UserTableName()).
 			Create(user).Error; err != nil {
-			return nil, errors.Wrap(db.Error, "failed on create new user")
+			return nil, errors.Wrap(err, "failed on create new user")
 		}
 	}
 
-	// 生成用户token
-	tokenKey := getUserLoginTokenCacheKey(req.Address)
-	userToken, err := AesEncryptOFB([]byte(tokenKey), []byte(middleware.CR_LOGIN_SALT))
+	// 签发会话token
+	token, claims, err := svcCtx.Sessions.Issue(ctx, req.Address, message.ChainID)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get user token")
 	}
 
-	// 缓存用户token
-	if err := CacheUserToken(svcCtx, tokenKey, uuid.NewString()); err != nil {
-		return nil, err
-	}
-
 	// 设置返回结果
-	res.Token = hex.EncodeToString(userToken)
+	res.Token = token
+	res.ExpiresAt = claims.ExpiresAt
 	res.IsAllowed = user.IsAllowed
 
-	return &res, err
+	return &res, nil
 }
 
-// 把token写入redis
-func CacheUserToken(svcCtx *svc.ServerCtx, tokenKey, token string) error {
-	if err := svcCtx.KvStore.Setex(tokenKey, token, 30*24*60*60); err != nil {
-		return err
+// RefreshSession 为请求中的每个会话签发新token, 原token失效
+func RefreshSession(ctx context.Context, svcCtx *svc.ServerCtx, sessions []*middleware.SessionClaims) ([]types.SessionToken, error) {
+	tokens := make([]types.SessionToken, 0, len(sessions))
+	for _, session := range sessions {
+		token, claims, err := svcCtx.Sessions.Refresh(ctx, session)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on refresh session")
+		}
+		tokens = append(tokens, types.SessionToken{
+			Address:   claims.Address,
+			ChainID:   claims.ChainID,
+			Token:     token,
+			ExpiresAt: claims.ExpiresAt,
+		})
 	}
 
-	return nil
+	return tokens, nil
 }
 
-func AesEncryptOFB(data []byte, key []byte) ([]byte, error) {
-	data = PKCS7Padding(data, aes.BlockSize)
-	block, _ := aes.NewCipher([]byte(key))
-	out := make([]byte, aes.BlockSize+len(data))
-	iv := out[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
+// UserLogout 登出请求中的会话
+func UserLogout(ctx context.Context, svcCtx *svc.ServerCtx, sessions []*middleware.SessionClaims) error {
+	for _, session := range sessions {
+		if err := svcCtx.Sessions.Revoke(ctx, session); err != nil {
+			return errors.Wrap(err, "failed on logout")
+		}
 	}
 
-	stream := cipher.NewOFB(block, iv)
-	stream.XORKeyStream(out[aes.BlockSize:], data)
-	return out, nil
+	return nil
 }
 
-// 补码
-// AES加密数据块分组长度必须为128bit(byte[16])，密钥长度可以是128bit(byte[16])、192bit(byte[24])、256bit(byte[32])中的任意一个。
-func PKCS7Padding(ciphertext []byte, blocksize int) []byte {
-	padding := blocksize - len(ciphertext)%blocksize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(ciphertext, padtext...)
-}
+// UserLogoutAll 撤销请求中地址的所有会话, 包括其他设备上的会话
+func UserLogoutAll(ctx context.Context, svcCtx *svc.ServerCtx, sessions []*middleware.SessionClaims) error {
+	for _, session := range sessions {
+		if err := svcCtx.Sessions.RevokeAll(ctx, session.Address); err != nil {
+			return errors.Wrap(err, "failed on logout all sessions")
+		}
+	}
 
-func genLoginTemplate(nonce string) string {
-	return fmt.Sprintf("Welcome to EasySwap!\nNonce:%s", nonce)
+	return nil
 }
 
-func GetUserLoginMsg(ctx context.Context, svcCtx *svc.ServerCtx, address string) (*types.UserLoginMsgResp, error) {
-	uuid := uuid.NewString()
-	loginMsg := genLoginTemplate(uuid)
-	if err := svcCtx.KvStore.Setex(getUserLoginMsgCacheKey(address), uuid, 72*60*60); err != nil {
+func GetUserLoginMsg(ctx context.Context, svcCtx *svc.ServerCtx, address string, chainID int) (*types.UserLoginMsgResp, error) {
+	cfg := siweConfig(svcCtx)
+	now := time.Now().UTC().Truncate(time.Second)
+	message := siweMessage{
+		Domain:         cfg.Domain,
+		Address:        common.HexToAddress(address),
+		Statement:      cfg.Statement,
+		URI:            cfg.URI,
+		Version:        siweVersion,
+		ChainID:        chainID,
+		Nonce:          newSiweNonce(uuid.NewString()),
+		IssuedAt:       now,
+		ExpirationTime: now.Add(time.Duration(cfg.ExpirationSeconds) * time.Second),
+	}
+	if err := svcCtx.KvStore.Setex(getUserLoginMsgCacheKey(address), issuedSiweNonce(message.Nonce, chainID), int(cfg.ExpirationSeconds)); err != nil {
 		return nil, errors.Wrap(err, "failed on generate login msg")
 	}
 
-	return &types.UserLoginMsgResp{Address: address, Message: loginMsg}, nil
+	return &types.UserLoginMsgResp{Address: address, Message: message.String()}, nil
 }
 
 func GetSigStatusMsg(ctx context.Context, svcCtx *svc.ServerCtx, userAddr string) (*types.UserSignStatusResp, error) {
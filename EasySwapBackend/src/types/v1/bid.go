@@ -15,4 +15,15 @@ type ItemBid struct {
 	BidUnfilled       int64           `json:"bid_unfilled"`
 	Bidder            string          `json:"bidder"`
 	OrderType         int64           `json:"order_type"`
+	Fills             []BidFill       `json:"fills,omitempty"` // 订单的成交记录
+}
+
+type BidFill struct {
+	TxHash      string          `json:"tx_hash"`
+	Taker       string          `json:"taker"`
+	TokenId     string          `json:"token_id"`
+	FillAmount  int64           `json:"fill_amount"`
+	FillPrice   decimal.Decimal `json:"fill_price"`
+	BlockNumber int64           `json:"block_number"`
+	EventTime   int64           `json:"event_time"`
 }
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/shopspring/decimal"
+)
+
+type CollectionDepth struct {
+	Collection string                    `json:"collection"`
+	Sequence   int64                     `json:"sequence"` // 与深度增量的sequence对应, 从缓存读取失败时为0
+	Bids       []ordermanager.DepthLevel `json:"bids"`
+	Asks       []ordermanager.DepthLevel `json:"asks"`
+	BestBid    decimal.Decimal           `json:"best_bid"`
+	BestAsk    decimal.Decimal           `json:"best_ask"`
+	Spread     decimal.Decimal           `json:"spread"` // 双方都有订单时为best_ask - best_bid, 否则为0
+	UpdateTime int64                     `json:"update_time"`
+}
+
+type CollectionDepthResp struct {
+	Result interface{} `json:"result"`
+}
@@ -0,0 +1,94 @@
+package types
+
+type PauseWindow struct {
+	PausedBy       string `json:"paused_by"`
+	PausedBlock    int64  `json:"paused_block"`
+	PausedTxHash   string `json:"paused_tx_hash"`
+	PausedTime     int64  `json:"paused_time"`
+	UnpausedBy     string `json:"unpaused_by"`
+	UnpausedBlock  int64  `json:"unpaused_block"` // 0表示仍处于暂停状态
+	UnpausedTxHash string `json:"unpaused_tx_hash"`
+	UnpausedTime   int64  `json:"unpaused_time"`
+}
+
+type ExchangeStatusResp struct {
+	ChainID      int           `json:"chain_id"`
+	Paused       bool          `json:"paused"`
+	PausedSince  int64         `json:"paused_since"` // 当前暂停开始的时间, 未暂停时为0
+	PauseWindows []PauseWindow `json:"pause_windows"`
+}
+
+// TxRequest 待用户签名发送的交易
+type TxRequest struct {
+	ChainID int    `json:"chain_id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Data    string `json:"data"`
+	Value   string `json:"value"` // 单位wei
+}
+
+type SkippedOrder struct {
+	OrderID string `json:"order_id"`
+	Reason  string `json:"reason"`
+}
+
+type BuiltTx struct {
+	Tx          TxRequest      `json:"tx"`
+	Orders      []string       `json:"orders"`       // 交易包含的订单
+	Skipped     []SkippedOrder `json:"skipped"`      // 链上状态校验未通过的订单
+	ProtocolFee string         `json:"protocol_fee"` // 从卖家所得中扣除的协议费, 单位wei
+}
+
+type BuildTxResp struct {
+	Result *BuiltTx `json:"result"`
+}
+
+// BuyTxReq 购买指定的挂单
+type BuyTxReq struct {
+	ChainID  int      `json:"chain_id"`
+	Buyer    string   `json:"buyer"`
+	OrderIDs []string `json:"order_ids"`
+}
+
+// SweepTxReq 购买collection中价格不超过max_price的count个最低价挂单
+type SweepTxReq struct {
+	ChainID    int    `json:"chain_id"`
+	Buyer      string `json:"buyer"`
+	Collection string `json:"collection"`
+	Count      int    `json:"count"`
+	MaxPrice   string `json:"max_price"` // 单个挂单的最高价格, 单位wei
+}
+
+// SellTxReq 将token_id卖给指定的出价
+type SellTxReq struct {
+	ChainID int    `json:"chain_id"`
+	Seller  string `json:"seller"`
+	OrderID string `json:"order_id"`
+	TokenID string `json:"token_id"`
+}
+
+type MakeOrdersTxReq struct {
+	ChainID int           `json:"chain_id"`
+	Maker   string        `json:"maker"`
+	Orders  []SignedOrder `json:"orders"`
+}
+
+type CancelOrdersTxReq struct {
+	ChainID  int      `json:"chain_id"`
+	Maker    string   `json:"maker"`
+	OrderIDs []string `json:"order_ids"`
+}
+
+// OrderEdit 修改订单的价格及数量, 其余字段与原订单一致
+type OrderEdit struct {
+	OrderID string `json:"order_id"`
+	Price   string `json:"price"`
+	Amount  string `json:"amount"` // 为空时保持原数量
+	Expiry  uint64 `json:"expiry"` // 为0时保持原过期时间
+}
+
+type EditOrdersTxReq struct {
+	ChainID int         `json:"chain_id"`
+	Maker   string      `json:"maker"`
+	Edits   []OrderEdit `json:"edits"`
+}
@@ -6,3 +6,37 @@ type OrderInfosParam struct {
 	CollectionAddress string   `json:"collection_address"`
 	TokenIds          []string `json:"token_ids"`
 }
+
+// OrderAsset 与合约LibOrder.Asset一致
+type OrderAsset struct {
+	TokenId    string `json:"token_id"`
+	Collection string `json:"collection"`
+	Amount     string `json:"amount"`
+}
+
+// SignedOrder 与合约LibOrder.Order一致, 数值使用十进制字符串
+type SignedOrder struct {
+	Side     uint8      `json:"side"`      // 0: list 1: bid
+	SaleKind uint8      `json:"sale_kind"` // 0: collection 1: item
+	Maker    string     `json:"maker"`
+	Nft      OrderAsset `json:"nft"`
+	Price    string     `json:"price"`
+	Expiry   uint64     `json:"expiry"`
+	Salt     uint64     `json:"salt"`
+}
+
+type SubmitOrderReq struct {
+	ChainID   int         `json:"chain_id"`
+	Order     SignedOrder `json:"order"`
+	Signature string      `json:"signature"` // 对Order的EIP-712签名
+}
+
+type SubmitOrderResp struct {
+	Result interface{} `json:"result"`
+}
+
+type SubmittedOrder struct {
+	OrderID    string `json:"order_id"` // 与合约LibOrder.hash一致
+	OrderType  int64  `json:"order_type"`
+	ExpireTime int64  `json:"expire_time"`
+}
@@ -0,0 +1,53 @@
+package types
+
+import "github.com/shopspring/decimal"
+
+type PointsFilterParams struct {
+	ChainID  int `json:"chain_id"`
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+type PointsAccountResp struct {
+	ChainID      int             `json:"chain_id"`
+	Address      string          `json:"address"`
+	Balance      decimal.Decimal `json:"balance"`     // 代币数量, 已按精度换算
+	BalanceWei   decimal.Decimal `json:"balance_wei"` // 最小单位
+	Points       decimal.Decimal `json:"points"`
+	Rank         int64           `json:"rank"`          // 没有积分时为0
+	DeadlineTime int64           `json:"deadline_time"` // 积分计算到的时间
+}
+
+type PointsHistory struct {
+	EpochStart     int64           `json:"epoch_start"`
+	EpochEnd       int64           `json:"epoch_end"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Points         decimal.Decimal `json:"points"`
+}
+
+type PointsHistoryResp struct {
+	Result interface{} `json:"result"`
+	Count  int64       `json:"count"`
+}
+
+type PointsLeaderboardItem struct {
+	Rank         int64           `json:"rank"`
+	Address      string          `json:"address"`
+	Points       decimal.Decimal `json:"points"`
+	DeadlineTime int64           `json:"deadline_time"`
+}
+
+type PointsLeaderboardResp struct {
+	Result interface{} `json:"result"`
+	Count  int64       `json:"count"`
+}
+
+type PointsSummaryResp struct {
+	ChainID      int             `json:"chain_id"`
+	TokenAddress string          `json:"token_address"`
+	TotalSupply  decimal.Decimal `json:"total_supply"` // 代币数量, 已按精度换算
+	HolderCount  int64           `json:"holder_count"`
+	TotalPoints  decimal.Decimal `json:"total_points"`
+	LastEpochEnd int64           `json:"last_epoch_end"` // 最近一次计算的周期结束时间
+}
@@ -9,9 +9,17 @@ type LoginReq struct {
 
 type UserLoginInfo struct {
 	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
 	IsAllowed bool   `json:"is_allowed"`
 }
 
+type SessionToken struct {
+	Address   string `json:"address"`
+	ChainID   int    `json:"chain_id"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
 type UserLoginResp struct {
 	Result interface{} `json:"result"`
 }
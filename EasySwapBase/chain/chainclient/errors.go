@@ -0,0 +1,36 @@
+package chainclient
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrEndpointBehind 没有节点同步到请求的区块, 稍后重试
+var ErrEndpointBehind = errors.New("no endpoint synced to requested block")
+
+// rangeTooLargeErrors 各节点服务商在日志结果过多、响应过大或区块区间过大时返回的错误
+var rangeTooLargeErrors = []string{
+	"query returned more than",
+	"too many results",
+	"response size",
+	"response is too big",
+	"block range",
+	"range is too",
+	"range too large",
+	"max results",
+}
+
+// IsRangeTooLarge 拉取日志的错误是否因区块区间过大, 缩小区间后可以重试
+func IsRangeTooLarge(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range rangeTooLargeErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
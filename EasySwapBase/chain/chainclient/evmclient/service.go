@@ -5,13 +5,18 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/pkg/errors"
 
 	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
 )
 
+// BatchSize 单个JSON-RPC批量请求包含的最多请求数
+const BatchSize = 100
+
 type Service struct {
 	client *ethclient.Client
 }
@@ -32,28 +37,7 @@ func (s *Service) Client() interface{} {
 }
 
 func (s *Service) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
-	var addresses []common.Address
-	for _, addr := range q.Addresses {
-		addresses = append(addresses, common.HexToAddress(addr))
-	}
-
-	var topicsHash [][]common.Hash
-	for _, topics := range q.Topics {
-		var topicHash []common.Hash
-		for _, topic := range topics {
-			topicHash = append(topicHash, common.HexToHash(topic))
-		}
-		topicsHash = append(topicsHash, topicHash)
-	}
-
-	queryParam := ethereum.FilterQuery{
-		FromBlock: q.FromBlock,
-		ToBlock:   q.ToBlock,
-		Addresses: addresses,
-		Topics:    topicsHash,
-	}
-
-	logs, err := s.client.FilterLogs(ctx, queryParam)
+	logs, err := s.client.FilterLogs(ctx, q.EVMQuery())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get events")
 	}
@@ -100,3 +84,74 @@ func (s *Service) BlockWithTxs(ctx context.Context, blockNumber uint64) (interfa
 	}
 	return blockWithTxs, nil
 }
+
+// HeaderByNumber 区块哈希取自节点响应, 见logTypes.RPCHeader
+func (s *Service) HeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error) {
+	var header *logTypes.RPCHeader
+	if err := s.client.Client().CallContext(ctx, &header, "eth_getBlockByNumber", blockNumArg(blockNum), false); err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+	if header == nil {
+		return nil, errors.Wrap(ethereum.NotFound, "failed on get block header")
+	}
+
+	return header.BlockHeader(), nil
+}
+
+func blockNumArg(blockNum *big.Int) string {
+	if blockNum == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(blockNum)
+}
+
+// HeadersByNumber 通过JSON-RPC批量请求获取区块头, 每个请求最多包含BatchSize个区块
+func (s *Service) HeadersByNumber(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error) {
+	result := make([]*logTypes.BlockHeader, 0, len(blockNums))
+	for start := 0; start < len(blockNums); start += BatchSize {
+		end := start + BatchSize
+		if end > len(blockNums) {
+			end = len(blockNums)
+		}
+
+		headers := make([]*logTypes.RPCHeader, end-start)
+		batch := make([]rpc.BatchElem, end-start)
+		for i, blockNum := range blockNums[start:end] {
+			batch[i] = rpc.BatchElem{
+				Method: "eth_getBlockByNumber",
+				Args:   []interface{}{hexutil.EncodeUint64(blockNum), false},
+				Result: &headers[i],
+			}
+		}
+		if err := s.client.Client().BatchCallContext(ctx, batch); err != nil {
+			return nil, errors.Wrap(err, "failed on batch get block headers")
+		}
+		for i, elem := range batch {
+			if elem.Error != nil {
+				return nil, errors.Wrap(elem.Error, "failed on get block header")
+			}
+			if headers[i] == nil {
+				return nil, errors.Wrapf(ethereum.NotFound, "block %d", blockNums[start+i])
+			}
+			result = append(result, headers[i].BlockHeader())
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.BlockHeader) (ethereum.Subscription, error) {
+	headers := make(chan *logTypes.RPCHeader)
+	sub, err := s.client.Client().EthSubscribe(ctx, headers, "newHeads")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe new head")
+	}
+	return logTypes.ForwardHeaders(sub, headers, ch), nil
+}
+
+func (s *Service) SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- ethereumTypes.Log) (ethereum.Subscription, error) {
+	sub, err := s.client.SubscribeFilterLogs(ctx, q.EVMQuery(), ch)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe logs")
+	}
+	return sub, nil
+}
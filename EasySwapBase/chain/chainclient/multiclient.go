@@ -0,0 +1,548 @@
+package chainclient
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+const (
+	defaultMaxAttempts      = 3
+	defaultMaxHeadLag       = 5
+	defaultFailureThreshold = 3
+	defaultCooldown         = 30 * time.Second
+	latencyDecay            = 0.2         // 延迟及错误率的指数加权系数
+	errorPenalty            = 5000.0      // 错误率为1时的评分惩罚, 单位ms
+	laggingPenalty          = 60000.0     // 落后节点的评分惩罚, 单位ms
+	headRefreshInterval     = time.Second // 节点未同步到请求的区块时, 距上次查询超过该时间才重新查询最新区块
+)
+
+// MultiConfig 多节点客户端配置, 零值使用默认配置
+type MultiConfig struct {
+	RequestsPerSecond float64       // 每个节点每秒的请求预算, 0为不限制
+	Burst             int           // 请求预算允许的突发请求数, 默认为RequestsPerSecond
+	MaxAttempts       int           // 单次调用最多尝试的节点数, 默认3
+	MaxHeadLag        uint64        // 落后最高区块超过该值的节点降低优先级, 默认5
+	FailureThreshold  int           // 连续失败达到该次数后暂停使用, 默认3
+	Cooldown          time.Duration // 暂停使用的时间, 默认30s
+}
+
+// EndpointStats 节点的健康状态, 用于监控
+type EndpointStats struct {
+	Url                 string    `json:"url"`
+	Healthy             bool      `json:"healthy"`
+	LatencyMs           float64   `json:"latency_ms"`
+	ErrorRate           float64   `json:"error_rate"`
+	Head                uint64    `json:"head"`
+	Requests            uint64    `json:"requests"`
+	Failures            uint64    `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	CooldownUntil       time.Time `json:"cooldown_until"`
+}
+
+type endpoint struct {
+	url     string
+	client  ChainClient
+	limiter *tokenBucket
+
+	mu            sync.Mutex
+	latency       float64 // ms
+	errorRate     float64
+	head          uint64
+	headAt        time.Time
+	requests      uint64
+	failures      uint64
+	consecutive   int
+	cooldownUntil time.Time
+}
+
+// MultiClient 多节点的ChainClient实现, 按延迟、错误率及区块高度选择节点, 失败时在其他节点上重试
+// ChainClient的方法均为只读调用, 可以安全重试; 指定区块的请求只发给已同步到该区块的节点
+type MultiClient struct {
+	endpoints []*endpoint
+	cfg       MultiConfig
+	now       func() time.Time
+}
+
+// NewMulti 连接多个节点, 节点地址不能为空
+func NewMulti(chainID int, nodeUrls []string, cfg MultiConfig) (*MultiClient, error) {
+	var clients []ChainClient
+	var urls []string
+	for _, nodeUrl := range nodeUrls {
+		nodeUrl = strings.TrimSpace(nodeUrl)
+		if nodeUrl == "" {
+			continue
+		}
+		client, err := New(chainID, nodeUrl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed on create client for %s", redactUrl(nodeUrl))
+		}
+		clients = append(clients, client)
+		urls = append(urls, nodeUrl)
+	}
+	if len(clients) == 0 {
+		return nil, errors.New("no node url")
+	}
+	return newMultiClient(urls, clients, cfg), nil
+}
+
+func newMultiClient(urls []string, clients []ChainClient, cfg MultiConfig) *MultiClient {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.MaxHeadLag == 0 {
+		cfg.MaxHeadLag = defaultMaxHeadLag
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+
+	m := &MultiClient{cfg: cfg, now: time.Now}
+	for i := range clients {
+		m.endpoints = append(m.endpoints, &endpoint{
+			url:     redactUrl(urls[i]),
+			client:  clients[i],
+			limiter: newTokenBucket(cfg.RequestsPerSecond, cfg.Burst),
+		})
+	}
+	return m
+}
+
+// redactUrl 隐藏url路径中的api key, 用于日志及监控
+func redactUrl(nodeUrl string) string {
+	if i := strings.Index(nodeUrl, "://"); i >= 0 {
+		if j := strings.Index(nodeUrl[i+3:], "/"); j >= 0 {
+			return nodeUrl[:i+3+j]
+		}
+	}
+	return nodeUrl
+}
+
+// Stats 返回各节点的状态
+func (m *MultiClient) Stats() []EndpointStats {
+	now := m.now()
+	stats := make([]EndpointStats, 0, len(m.endpoints))
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		stats = append(stats, EndpointStats{
+			Url:                 ep.url,
+			Healthy:             !now.Before(ep.cooldownUntil),
+			LatencyMs:           ep.latency,
+			ErrorRate:           ep.errorRate,
+			Head:                ep.head,
+			Requests:            ep.requests,
+			Failures:            ep.failures,
+			ConsecutiveFailures: ep.consecutive,
+			CooldownUntil:       ep.cooldownUntil,
+		})
+		ep.mu.Unlock()
+	}
+	return stats
+}
+
+// StartHealthCheck 定期查询所有节点的最新区块, 更新区块高度及延迟
+func (m *MultiClient) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	go func() {
+		timer := time.NewTicker(interval)
+		defer timer.Stop()
+		for {
+			m.checkHeads()
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+func (m *MultiClient) checkHeads() {
+	var wg sync.WaitGroup
+	for _, ep := range m.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			m.refreshHead(ep)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// candidates 按评分从优到劣排列节点, 暂停使用的节点排在最后, 所有节点都不可用时仍可作为最后的选择
+func (m *MultiClient) candidates() []*endpoint {
+	now := m.now()
+	var maxHead uint64
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		if ep.head > maxHead {
+			maxHead = ep.head
+		}
+		ep.mu.Unlock()
+	}
+
+	type scored struct {
+		ep        *endpoint
+		available bool
+		score     float64
+	}
+	list := make([]scored, 0, len(m.endpoints))
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		score := ep.latency + ep.errorRate*errorPenalty
+		if maxHead > m.cfg.MaxHeadLag && ep.head < maxHead-m.cfg.MaxHeadLag {
+			score += laggingPenalty
+		}
+		list = append(list, scored{ep: ep, available: !now.Before(ep.cooldownUntil), score: score})
+		ep.mu.Unlock()
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].available != list[j].available {
+			return list[i].available
+		}
+		return list[i].score < list[j].score
+	})
+
+	endpoints := make([]*endpoint, 0, len(list))
+	for _, s := range list {
+		endpoints = append(endpoints, s.ep)
+	}
+	return endpoints
+}
+
+// do 在最优的节点上执行调用, 失败时换下一个节点重试, 超出请求预算的节点跳过
+// 所有节点都超出预算时等待最优节点的预算
+// minHead不为0时只使用最新区块不低于minHead的节点: 落后的节点对eth_getLogs等请求只返回其已有的区块, 结果不完整且不报错
+func (m *MultiClient) do(ctx context.Context, minHead uint64, call func(c ChainClient) error) error {
+	var lastErr error
+	var throttled []*endpoint
+	attempts := 0
+	for _, ep := range m.candidates() {
+		if attempts >= m.cfg.MaxAttempts {
+			break
+		}
+		if !ep.limiter.take(m.now()) {
+			throttled = append(throttled, ep)
+			continue
+		}
+		if synced, refreshed := m.synced(ep, minHead); !synced {
+			if lastErr == nil {
+				lastErr = errors.Wrapf(ErrEndpointBehind, "block %d", minHead)
+			}
+			continue
+		} else if refreshed && !ep.limiter.take(m.now()) {
+			throttled = append(throttled, ep)
+			continue
+		}
+		attempts++
+		err := m.invoke(ep, call)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		lastErr = err
+	}
+
+	if attempts == 0 && len(throttled) > 0 {
+		ep := throttled[0]
+		if err := ep.limiter.wait(ctx); err != nil {
+			return err
+		}
+		if synced, _ := m.synced(ep, minHead); !synced {
+			return errors.Wrapf(ErrEndpointBehind, "block %d", minHead)
+		}
+		return m.invoke(ep, call)
+	}
+	return lastErr
+}
+
+// synced 节点已知的最新区块低于minHead时重新查询, refreshed表示是否发出了查询请求
+func (m *MultiClient) synced(ep *endpoint, minHead uint64) (synced bool, refreshed bool) {
+	head, headAt := ep.getHead()
+	if minHead == 0 || head >= minHead {
+		return true, false
+	}
+	if m.now().Sub(headAt) < headRefreshInterval {
+		return false, false
+	}
+	head, err := m.refreshHead(ep)
+	return err == nil && head >= minHead, true
+}
+
+// refreshHead 查询节点的最新区块并更新
+func (m *MultiClient) refreshHead(ep *endpoint) (uint64, error) {
+	var head uint64
+	err := m.invoke(ep, func(c ChainClient) error {
+		var err error
+		head, err = c.BlockNumber()
+		return err
+	})
+	if err == nil {
+		ep.setHead(head, m.now())
+	}
+	return head, err
+}
+
+// endpointOf 返回client所属的节点
+func (m *MultiClient) endpointOf(c ChainClient) *endpoint {
+	for _, ep := range m.endpoints {
+		if ep.client == c {
+			return ep
+		}
+	}
+	return nil
+}
+
+// invoke 执行调用并记录节点的延迟及结果
+func (m *MultiClient) invoke(ep *endpoint, call func(c ChainClient) error) error {
+	start := m.now()
+	err := call(ep.client)
+	elapsed := float64(m.now().Sub(start)) / float64(time.Millisecond)
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.requests++
+	if ep.requests == 1 {
+		ep.latency = elapsed
+	} else {
+		ep.latency = (1-latencyDecay)*ep.latency + latencyDecay*elapsed
+	}
+
+	if err == nil || !isEndpointFailure(err) {
+		ep.errorRate = (1 - latencyDecay) * ep.errorRate
+		ep.consecutive = 0
+		return err
+	}
+	ep.errorRate = (1-latencyDecay)*ep.errorRate + latencyDecay
+	ep.failures++
+	ep.consecutive++
+	if ep.consecutive >= m.cfg.FailureThreshold || isRateLimited(err) {
+		ep.cooldownUntil = m.now().Add(m.cfg.Cooldown)
+	}
+	return err
+}
+
+func (ep *endpoint) getHead() (uint64, time.Time) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	return ep.head, ep.headAt
+}
+
+func (ep *endpoint) setHead(head uint64, now time.Time) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.headAt = now
+	if head > ep.head {
+		ep.head = head
+	}
+}
+
+// isRetryable 合约调用revert、调用方取消及日志区间过大等与节点无关的错误不重试, 区间过大由调用方缩小区间
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || IsRangeTooLarge(err) {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(err.Error()), "execution reverted")
+}
+
+// isEndpointFailure 节点本身的错误, 计入错误率; 数据未找到可能只是节点落后, 不计入
+func isEndpointFailure(err error) bool {
+	if !isRetryable(err) {
+		return false
+	}
+	return !errors.Is(err, ethereum.NotFound)
+}
+
+func isRateLimited(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "429") || strings.Contains(msg, "too many requests") || strings.Contains(msg, "rate limit")
+}
+
+func (m *MultiClient) Client() interface{} {
+	return m.candidates()[0].client.Client()
+}
+
+// blockOf 请求指定的区块高度, 为空(最新区块)时返回0
+func blockOf(blockNum *big.Int) uint64 {
+	if blockNum == nil || blockNum.Sign() < 0 || !blockNum.IsUint64() {
+		return 0
+	}
+	return blockNum.Uint64()
+}
+
+func (m *MultiClient) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
+	var logs []interface{}
+	err := m.do(ctx, blockOf(q.ToBlock), func(c ChainClient) error {
+		var err error
+		logs, err = c.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+func (m *MultiClient) BlockTimeByNumber(ctx context.Context, blockNum *big.Int) (uint64, error) {
+	var blockTime uint64
+	err := m.do(ctx, blockOf(blockNum), func(c ChainClient) error {
+		var err error
+		blockTime, err = c.BlockTimeByNumber(ctx, blockNum)
+		return err
+	})
+	return blockTime, err
+}
+
+func (m *MultiClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := m.do(ctx, blockOf(blockNumber), func(c ChainClient) error {
+		var err error
+		result, err = c.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+func (m *MultiClient) CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error) {
+	var result interface{}
+	err := m.do(ctx, blockOf(param.BlockNumber), func(c ChainClient) error {
+		var err error
+		result, err = c.CallContractByChain(ctx, param)
+		return err
+	})
+	return result, err
+}
+
+func (m *MultiClient) BlockNumber() (uint64, error) {
+	var blockNum uint64
+	err := m.do(context.Background(), 0, func(c ChainClient) error {
+		var err error
+		if blockNum, err = c.BlockNumber(); err == nil {
+			m.endpointOf(c).setHead(blockNum, m.now())
+		}
+		return err
+	})
+	return blockNum, err
+}
+
+func (m *MultiClient) BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error) {
+	var block interface{}
+	err := m.do(ctx, blockNumber, func(c ChainClient) error {
+		var err error
+		block, err = c.BlockWithTxs(ctx, blockNumber)
+		return err
+	})
+	return block, err
+}
+
+func (m *MultiClient) HeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error) {
+	var header *logTypes.BlockHeader
+	err := m.do(ctx, blockOf(blockNum), func(c ChainClient) error {
+		var err error
+		header, err = c.HeaderByNumber(ctx, blockNum)
+		return err
+	})
+	return header, err
+}
+
+func (m *MultiClient) HeadersByNumber(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error) {
+	var minHead uint64
+	for _, n := range blockNums {
+		if n > minHead {
+			minHead = n
+		}
+	}
+	var headers []*logTypes.BlockHeader
+	err := m.do(ctx, minHead, func(c ChainClient) error {
+		var err error
+		headers, err = c.HeadersByNumber(ctx, blockNums)
+		return err
+	})
+	return headers, err
+}
+
+func (m *MultiClient) SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.BlockHeader) (ethereum.Subscription, error) {
+	return m.subscribe(func(c ChainClient) (ethereum.Subscription, error) {
+		return c.SubscribeNewHead(ctx, ch)
+	})
+}
+
+func (m *MultiClient) SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- ethereumTypes.Log) (ethereum.Subscription, error) {
+	return m.subscribe(func(c ChainClient) (ethereum.Subscription, error) {
+		return c.SubscribeFilterLogs(ctx, q, ch)
+	})
+}
+
+// subscribe 订阅是长连接, 不计入节点的延迟及错误率, 按评分依次尝试直到订阅成功
+func (m *MultiClient) subscribe(call func(c ChainClient) (ethereum.Subscription, error)) (ethereum.Subscription, error) {
+	var lastErr error
+	for _, ep := range m.candidates() {
+		sub, err := call(ep.client)
+		if err == nil {
+			return sub, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// tokenBucket 节点的请求预算, rate为0时不限制
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b < 1 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for !b.take(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(float64(time.Second) / b.rate)):
+		}
+	}
+	return nil
+}
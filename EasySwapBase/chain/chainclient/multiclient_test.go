@@ -0,0 +1,228 @@
+package chainclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+type fakeClient struct {
+	head  uint64
+	err   error
+	calls int
+}
+
+func (f *fakeClient) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) BlockTimeByNumber(ctx context.Context, n *big.Int) (uint64, error) {
+	f.calls++
+	return 0, f.err
+}
+
+func (f *fakeClient) Client() interface{} { return f }
+
+func (f *fakeClient) CallContract(ctx context.Context, msg ethereum.CallMsg, n *big.Int) ([]byte, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) BlockNumber() (uint64, error) {
+	f.calls++
+	return f.head, f.err
+}
+
+func (f *fakeClient) BlockWithTxs(ctx context.Context, n uint64) (interface{}, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) HeaderByNumber(ctx context.Context, n *big.Int) (*logTypes.BlockHeader, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) HeadersByNumber(ctx context.Context, n []uint64) ([]*logTypes.BlockHeader, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.BlockHeader) (ethereum.Subscription, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func (f *fakeClient) SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- ethereumTypes.Log) (ethereum.Subscription, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	bad := &fakeClient{err: errors.New("connection refused")}
+	good := &fakeClient{head: 100}
+	m := newMultiClient([]string{"https://a/key", "https://b/key"}, []ChainClient{bad, good}, MultiConfig{FailureThreshold: 2})
+
+	head, err := m.BlockNumber()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), head)
+	assert.Equal(t, 1, bad.calls)
+	assert.Equal(t, 1, good.calls)
+
+	// 出错的节点评分变差, 之后优先使用正常节点
+	_, err = m.BlockNumber()
+	require.NoError(t, err)
+	assert.Equal(t, 1, bad.calls)
+	assert.Equal(t, 2, good.calls)
+
+	stats := m.Stats()
+	assert.Equal(t, "https://a", stats[0].Url)
+	assert.Equal(t, uint64(1), stats[0].Failures)
+	assert.Greater(t, stats[0].ErrorRate, 0.0)
+}
+
+func TestMultiClientCooldown(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limited := &fakeClient{err: errors.New("429 Too Many Requests")}
+	good := &fakeClient{err: errors.New("connection reset")}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{limited, good}, MultiConfig{Cooldown: time.Minute})
+	m.now = func() time.Time { return now }
+
+	_, err := m.BlockNumber()
+	require.Error(t, err)
+	stats := m.Stats()
+	assert.False(t, stats[0].Healthy, "rate limited endpoint should cool down immediately")
+	assert.True(t, stats[1].Healthy)
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, m.Stats()[0].Healthy)
+}
+
+func TestMultiClientNotRetryable(t *testing.T) {
+	reverted := &fakeClient{err: errors.New("execution reverted")}
+	other := &fakeClient{}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{reverted, other}, MultiConfig{})
+
+	_, err := m.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	require.Error(t, err)
+	assert.Equal(t, 0, other.calls)
+	assert.Equal(t, uint64(0), m.Stats()[0].Failures)
+}
+
+func TestMultiClientPrefersSyncedEndpoint(t *testing.T) {
+	lagging := &fakeClient{head: 90}
+	synced := &fakeClient{head: 100}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{lagging, synced}, MultiConfig{MaxHeadLag: 5})
+	m.checkHeads()
+
+	assert.Same(t, synced, m.Client())
+}
+
+func TestMultiClientRateLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	first := &fakeClient{}
+	second := &fakeClient{}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{first, second}, MultiConfig{RequestsPerSecond: 1})
+	m.now = func() time.Time { return now }
+
+	_, err := m.BlockNumber()
+	require.NoError(t, err)
+	_, err = m.BlockNumber() // 第一个节点的预算用完, 转到第二个节点
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.calls)
+	assert.Equal(t, 1, second.calls)
+
+	now = now.Add(time.Second)
+	_, err = m.BlockNumber()
+	require.NoError(t, err)
+	assert.Equal(t, 3, first.calls+second.calls)
+}
+
+func TestTokenBucket(t *testing.T) {
+	var unlimited *tokenBucket
+	assert.True(t, unlimited.take(time.Now()))
+
+	now := time.Unix(1000, 0)
+	b := newTokenBucket(2, 2)
+	assert.True(t, b.take(now))
+	assert.True(t, b.take(now))
+	assert.False(t, b.take(now))
+	assert.True(t, b.take(now.Add(500*time.Millisecond)))
+	assert.False(t, b.take(now.Add(500*time.Millisecond)))
+}
+
+func TestRedactUrl(t *testing.T) {
+	assert.Equal(t, "https://sepolia.infura.io", redactUrl("https://sepolia.infura.io/v3/secret"))
+	assert.Equal(t, "http://127.0.0.1:8545", redactUrl("http://127.0.0.1:8545"))
+}
+
+func TestMultiClientRangeTooLarge(t *testing.T) {
+	limited := &fakeClient{err: errors.New("query returned more than 10000 results")}
+	other := &fakeClient{}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{limited, other}, MultiConfig{})
+
+	_, err := m.FilterLogs(context.Background(), logTypes.FilterQuery{})
+	require.True(t, IsRangeTooLarge(err))
+	assert.Equal(t, 0, other.calls)
+	assert.Equal(t, uint64(0), m.Stats()[0].Failures)
+}
+
+func TestMultiClientRoutesToSyncedEndpoint(t *testing.T) {
+	now := time.Unix(1000, 0)
+	lagging := &fakeClient{head: 97}
+	synced := &fakeClient{head: 100}
+	m := newMultiClient([]string{"a", "b"}, []ChainClient{lagging, synced}, MultiConfig{MaxHeadLag: 5})
+	m.now = func() time.Time { return now }
+	// 落后节点延迟更低, 排在前面
+	m.endpoints[1].requests, m.endpoints[1].latency = 10, 100
+
+	// 落后节点未同步到ToBlock, 查询最新区块后跳过
+	_, err := m.FilterLogs(context.Background(), logTypes.FilterQuery{FromBlock: big.NewInt(90), ToBlock: big.NewInt(99)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, lagging.calls, "lagging endpoint only asked for its head")
+	assert.Equal(t, 2, synced.calls)
+	assert.Equal(t, uint64(97), m.Stats()[0].Head)
+	assert.Equal(t, uint64(100), m.Stats()[1].Head)
+
+	// 刚查询过的落后节点直接跳过
+	_, err = m.HeadersByNumber(context.Background(), []uint64{95, 99})
+	require.NoError(t, err)
+	_, err = m.CallContract(context.Background(), ethereum.CallMsg{}, big.NewInt(98))
+	require.NoError(t, err)
+	assert.Equal(t, 1, lagging.calls)
+	assert.Equal(t, 4, synced.calls)
+
+	// 未指定区块的请求不受限制
+	_, err = m.CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, lagging.calls)
+
+	// 两个节点都未同步到请求的区块
+	_, err = m.FilterLogs(context.Background(), logTypes.FilterQuery{ToBlock: big.NewInt(120)})
+	assert.ErrorIs(t, err, ErrEndpointBehind)
+
+	// 落后节点追上后重新使用, BlockNumber的结果更新节点的最新区块
+	now = now.Add(2 * time.Second)
+	lagging.head = 130
+	_, err = m.FilterLogs(context.Background(), logTypes.FilterQuery{ToBlock: big.NewInt(120)})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(130), m.Stats()[0].Head)
+	head, err := m.BlockNumber()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(130), head)
+}
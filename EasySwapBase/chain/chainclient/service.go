@@ -3,8 +3,10 @@ package chainclient
 import (
 	"context"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
 	"github.com/pkg/errors"
 
 	"github.com/ProjectsTask/EasySwapBase/chain"
@@ -20,9 +22,21 @@ type ChainClient interface {
 	CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error)
 	BlockNumber() (uint64, error)
 	BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error)
+	HeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error)
+	// HeadersByNumber 批量获取区块头, 返回顺序与blockNums一致
+	HeadersByNumber(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error)
+	// SubscribeNewHead 订阅新区块, 需要websocket节点
+	SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.BlockHeader) (ethereum.Subscription, error)
+	// SubscribeFilterLogs 订阅符合条件的新日志, 链重组时被移除的日志以Removed=true再次推送
+	SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- ethereumTypes.Log) (ethereum.Subscription, error)
 }
 
+// New 创建节点客户端, nodeUrl包含多个以逗号分隔的地址时使用默认配置的MultiClient
 func New(chainID int, nodeUrl string) (ChainClient, error) {
+	if strings.Contains(nodeUrl, ",") {
+		return NewMulti(chainID, strings.Split(nodeUrl, ","), MultiConfig{})
+	}
+
 	switch chainID {
 	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID, chain.BasepoliaChainID:
 		return evmclient.New(nodeUrl)
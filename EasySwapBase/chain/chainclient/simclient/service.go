@@ -0,0 +1,131 @@
+package simclient
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/pkg/errors"
+
+	logTypes "github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+// Service 基于go-ethereum模拟链的ChainClient实现, 用于在测试中按需出块和制造链重组
+type Service struct {
+	backend *backends.SimulatedBackend
+}
+
+func New(backend *backends.SimulatedBackend) *Service {
+	return &Service{
+		backend: backend,
+	}
+}
+
+func (s *Service) Client() interface{} {
+	return s.backend
+}
+
+func (s *Service) FilterLogs(ctx context.Context, q logTypes.FilterQuery) ([]interface{}, error) {
+	logs, err := s.backend.FilterLogs(ctx, q.EVMQuery())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get events")
+	}
+
+	var logEvents []interface{}
+	for _, log := range logs {
+		logEvents = append(logEvents, log)
+	}
+
+	return logEvents, nil
+}
+
+func (s *Service) BlockTimeByNumber(ctx context.Context, blockNum *big.Int) (uint64, error) {
+	header, err := s.backend.HeaderByNumber(ctx, blockNum)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get block header")
+	}
+
+	return header.Time, nil
+}
+
+func (s *Service) CallContractByChain(ctx context.Context, param logTypes.CallParam) (interface{}, error) {
+	return s.CallContract(ctx, param.EVMParam, param.BlockNumber)
+}
+
+func (s *Service) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return s.backend.CallContract(ctx, msg, blockNumber)
+}
+
+func (s *Service) BlockNumber() (uint64, error) {
+	header, err := s.backend.HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get simulated block number")
+	}
+
+	return header.Number.Uint64(), nil
+}
+
+func (s *Service) BlockWithTxs(ctx context.Context, blockNumber uint64) (interface{}, error) {
+	block, err := s.backend.BlockByNumber(ctx, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get simulated block")
+	}
+	return block, nil
+}
+
+func (s *Service) HeaderByNumber(ctx context.Context, blockNum *big.Int) (*logTypes.BlockHeader, error) {
+	header, err := s.backend.HeaderByNumber(ctx, blockNum)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+
+	return logTypes.HeaderOf(header, header.Hash()), nil // 模拟链的区块头与v1.12格式一致
+}
+
+func (s *Service) HeadersByNumber(ctx context.Context, blockNums []uint64) ([]*logTypes.BlockHeader, error) {
+	headers := make([]*logTypes.BlockHeader, 0, len(blockNums))
+	for _, blockNum := range blockNums {
+		header, err := s.HeaderByNumber(ctx, new(big.Int).SetUint64(blockNum))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+func (s *Service) SubscribeNewHead(ctx context.Context, ch chan<- *logTypes.BlockHeader) (ethereum.Subscription, error) {
+	headers := make(chan *ethereumTypes.Header)
+	sub, err := s.backend.SubscribeNewHead(ctx, headers)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe new head")
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				select {
+				case ch <- logTypes.HeaderOf(header, header.Hash()):
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+func (s *Service) SubscribeFilterLogs(ctx context.Context, q logTypes.FilterQuery, ch chan<- ethereumTypes.Log) (ethereum.Subscription, error) {
+	sub, err := s.backend.SubscribeFilterLogs(ctx, q.EVMQuery(), ch)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe logs")
+	}
+	return sub, nil
+}
@@ -0,0 +1,51 @@
+package headerservice
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+// lru 按区块高度缓存最近使用的区块头
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[uint64]*list.Element
+	order    *list.List // 最近使用的在前
+}
+
+func newLru(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		items:    make(map[uint64]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (l *lru) get(blockNum uint64) (*types.BlockHeader, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[blockNum]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*types.BlockHeader), true
+}
+
+func (l *lru) add(blockNum uint64, header *types.BlockHeader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.items[blockNum]; ok {
+		elem.Value = header
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.items[blockNum] = l.order.PushFront(header)
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*types.BlockHeader).Number)
+	}
+}
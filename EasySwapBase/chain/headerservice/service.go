@@ -0,0 +1,216 @@
+package headerservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const (
+	CacheHeaderPre = "cache:es:header:%d:%d" // chain id, 区块高度
+	CacheTTL       = 24 * time.Hour
+	LruSize        = 10000
+)
+
+// ErrHashMismatch 节点返回的区块哈希与日志中的不一致
+var ErrHashMismatch = errors.New("block hash mismatch")
+
+// Service 区块头服务, 依次从本地LRU、Redis及节点获取区块头, 节点上缺失的区块通过一次批量请求获取
+// 按日志查询时校验缓存的区块哈希, 区块已被重组时重新获取
+type Service struct {
+	client  chainclient.ChainClient
+	kv      *xkv.Store // 为空时只使用本地缓存
+	chainId int64
+	lru     *lru
+}
+
+func New(client chainclient.ChainClient, kv *xkv.Store, chainId int64) *Service {
+	return &Service{
+		client:  client,
+		kv:      kv,
+		chainId: chainId,
+		lru:     newLru(LruSize),
+	}
+}
+
+// Header 返回区块头, hash不为空时缓存中区块哈希不一致的区块头视为已失效
+func (s *Service) Header(ctx context.Context, blockNum uint64, hash string) (*types.BlockHeader, error) {
+	headers, err := s.lookup(ctx, []uint64{blockNum}, map[uint64]string{blockNum: hash})
+	if err != nil {
+		return nil, err
+	}
+	header := headers[blockNum]
+	if header == nil {
+		return nil, errors.Errorf("block header %d not found", blockNum)
+	}
+	return header, nil
+}
+
+// BlockTime 返回日志所在区块的时间
+func (s *Service) BlockTime(ctx context.Context, log ethereumTypes.Log) (uint64, error) {
+	header, err := s.Header(ctx, log.BlockNumber, log.BlockHash.String())
+	if err != nil {
+		return 0, err
+	}
+	return header.Time, nil
+}
+
+// Headers 批量返回区块头
+func (s *Service) Headers(ctx context.Context, blockNums []uint64) (map[uint64]*types.BlockHeader, error) {
+	return s.lookup(ctx, blockNums, nil)
+}
+
+// Prefetch 预先获取日志所在区块的区块头, 之后逐条处理日志时直接命中缓存
+func (s *Service) Prefetch(ctx context.Context, logs []ethereumTypes.Log) error {
+	hashes := make(map[uint64]string)
+	var blockNums []uint64
+	for _, log := range logs {
+		if _, ok := hashes[log.BlockNumber]; ok {
+			continue
+		}
+		hashes[log.BlockNumber] = log.BlockHash.String()
+		blockNums = append(blockNums, log.BlockNumber)
+	}
+	_, err := s.lookup(ctx, blockNums, hashes)
+	return err
+}
+
+// Add 缓存已从节点获取的区块头, 如链重组检测时获取的区块头
+func (s *Service) Add(ctx context.Context, headers ...*types.BlockHeader) {
+	for _, header := range headers {
+		s.lru.add(header.Number, header)
+	}
+	s.writeKv(ctx, headers)
+}
+
+func (s *Service) lookup(ctx context.Context, blockNums []uint64, hashes map[uint64]string) (map[uint64]*types.BlockHeader, error) {
+	valid := func(header *types.BlockHeader) bool {
+		hash := hashes[header.Number]
+		return hash == "" || strings.EqualFold(hash, header.Hash)
+	}
+
+	result := make(map[uint64]*types.BlockHeader, len(blockNums))
+	var missing []uint64
+	for _, blockNum := range blockNums {
+		if _, ok := result[blockNum]; ok {
+			continue
+		}
+		if header, ok := s.lru.get(blockNum); ok && valid(header) {
+			result[blockNum] = header
+			continue
+		}
+		result[blockNum] = nil
+		missing = append(missing, blockNum)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	var stillMissing []uint64
+	cached := s.readKv(ctx, missing)
+	for _, blockNum := range missing {
+		if header, ok := cached[blockNum]; ok && valid(header) {
+			s.lru.add(blockNum, header)
+			result[blockNum] = header
+			continue
+		}
+		stillMissing = append(stillMissing, blockNum)
+	}
+	if len(stillMissing) == 0 {
+		return result, nil
+	}
+
+	sort.Slice(stillMissing, func(i, j int) bool { return stillMissing[i] < stillMissing[j] })
+	headers, err := s.client.HeadersByNumber(ctx, stillMissing)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block headers")
+	}
+	// 节点返回的区块哈希与日志不一致时(链已重组或节点在分叉上)不缓存, 由调用方重新处理
+	var fetched []*types.BlockHeader
+	for _, header := range headers {
+		if header == nil || result[header.Number] != nil {
+			continue
+		}
+		if !valid(header) {
+			return nil, errors.Wrapf(ErrHashMismatch, "block %d: expected %s, got %s",
+				header.Number, hashes[header.Number], header.Hash)
+		}
+		fetched = append(fetched, header)
+	}
+	for _, header := range fetched {
+		s.lru.add(header.Number, header)
+		result[header.Number] = header
+	}
+	s.writeKv(ctx, fetched)
+	for _, blockNum := range stillMissing {
+		if result[blockNum] == nil {
+			return nil, errors.Errorf("block header %d not found", blockNum)
+		}
+	}
+	return result, nil
+}
+
+func (s *Service) cacheKey(blockNum uint64) string {
+	return fmt.Sprintf(CacheHeaderPre, s.chainId, blockNum)
+}
+
+// readKv 从Redis批量读取区块头, Redis出错时只记录日志, 由节点获取
+func (s *Service) readKv(ctx context.Context, blockNums []uint64) map[uint64]*types.BlockHeader {
+	if s.kv == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(blockNums))
+	for _, blockNum := range blockNums {
+		keys = append(keys, s.cacheKey(blockNum))
+	}
+	values, err := s.kv.Redis.MgetCtx(ctx, keys...)
+	if err != nil {
+		xzap.WithContext(ctx).Warn("failed on get cached block headers", zap.Error(err))
+		return nil
+	}
+
+	headers := make(map[uint64]*types.BlockHeader)
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		var header types.BlockHeader
+		if err := json.Unmarshal([]byte(value), &header); err != nil {
+			continue
+		}
+		headers[header.Number] = &header
+	}
+	return headers
+}
+
+func (s *Service) writeKv(ctx context.Context, headers []*types.BlockHeader) {
+	if s.kv == nil || len(headers) == 0 {
+		return
+	}
+	err := s.kv.Redis.PipelinedCtx(ctx, func(pipe redis.Pipeliner) error {
+		for _, header := range headers {
+			value, err := json.Marshal(header)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, s.cacheKey(header.Number), value, CacheTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		xzap.WithContext(ctx).Warn("failed on cache block headers", zap.Error(err))
+	}
+}
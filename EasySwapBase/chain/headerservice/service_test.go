@@ -0,0 +1,113 @@
+package headerservice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+type fakeClient struct {
+	chainclient.ChainClient
+	fork    string // 区块哈希的前缀, 模拟重组后的链
+	batches [][]uint64
+}
+
+func (f *fakeClient) HeadersByNumber(ctx context.Context, blockNums []uint64) ([]*types.BlockHeader, error) {
+	f.batches = append(f.batches, blockNums)
+	var headers []*types.BlockHeader
+	for _, n := range blockNums {
+		headers = append(headers, &types.BlockHeader{Number: n, Hash: hashOf(f.fork, n), Time: 1000 + n*12})
+	}
+	return headers, nil
+}
+
+func hashOf(fork string, n uint64) string {
+	return common.BytesToHash([]byte(fmt.Sprintf("%s%d", fork, n))).String()
+}
+
+func logAt(fork string, n uint64) ethereumTypes.Log {
+	return ethereumTypes.Log{BlockNumber: n, BlockHash: common.HexToHash(hashOf(fork, n))}
+}
+
+func TestPrefetchBatchesMissingHeaders(t *testing.T) {
+	client := &fakeClient{}
+	s := New(client, nil, 1)
+
+	require.NoError(t, s.Prefetch(context.Background(), []ethereumTypes.Log{logAt("", 12), logAt("", 10), logAt("", 12)}))
+	assert.Equal(t, [][]uint64{{10, 12}}, client.batches)
+
+	blockTime, err := s.BlockTime(context.Background(), logAt("", 12))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1144), blockTime)
+
+	headers, err := s.Headers(context.Background(), []uint64{10, 11, 12})
+	require.NoError(t, err)
+	assert.Len(t, headers, 3)
+	assert.Equal(t, [][]uint64{{10, 12}, {11}}, client.batches)
+}
+
+func TestHeaderRefetchAfterReorg(t *testing.T) {
+	client := &fakeClient{}
+	s := New(client, nil, 1)
+	_, err := s.BlockTime(context.Background(), logAt("", 20))
+	require.NoError(t, err)
+
+	client.fork = "fork"
+	header, err := s.Header(context.Background(), 20, hashOf("fork", 20))
+	require.NoError(t, err)
+	assert.Equal(t, hashOf("fork", 20), header.Hash)
+	assert.Len(t, client.batches, 2)
+
+	// 不校验哈希时直接使用缓存
+	_, err = s.Header(context.Background(), 20, "")
+	require.NoError(t, err)
+	assert.Len(t, client.batches, 2)
+}
+
+func TestFetchedHeaderHashMismatch(t *testing.T) {
+	client := &fakeClient{fork: "fork"}
+	s := New(client, nil, 1)
+
+	// 节点在另一条分叉上, 返回的区块头与日志不一致
+	err := s.Prefetch(context.Background(), []ethereumTypes.Log{logAt("", 30), logAt("", 31)})
+	require.ErrorIs(t, err, ErrHashMismatch)
+	_, ok := s.lru.get(30)
+	assert.False(t, ok, "mismatched header must not be cached")
+
+	_, err = s.BlockTime(context.Background(), logAt("", 30))
+	require.ErrorIs(t, err, ErrHashMismatch)
+
+	// 日志与缓存一致后不再请求节点
+	client.fork = ""
+	blockTime, err := s.BlockTime(context.Background(), logAt("", 30))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1360), blockTime)
+	batches := len(client.batches)
+	_, err = s.BlockTime(context.Background(), logAt("", 30))
+	require.NoError(t, err)
+	assert.Len(t, client.batches, batches)
+}
+
+func TestLruEvictsOldest(t *testing.T) {
+	l := newLru(2)
+	l.add(1, &types.BlockHeader{Number: 1})
+	l.add(2, &types.BlockHeader{Number: 2})
+	_, ok := l.get(1)
+	require.True(t, ok)
+	l.add(3, &types.BlockHeader{Number: 3})
+
+	_, ok = l.get(2)
+	assert.False(t, ok)
+	_, ok = l.get(1)
+	assert.True(t, ok)
+	_, ok = l.get(3)
+	assert.True(t, ok)
+}
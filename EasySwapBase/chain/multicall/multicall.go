@@ -0,0 +1,255 @@
+package multicall
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+const (
+	// Multicall3Address 各链上相同的Multicall3部署地址
+	Multicall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+	DefaultBatchSize  = 200
+	// fallbackConcurrency 没有JSON-RPC客户端时逐个eth_call的并发数
+	fallbackConcurrency = 8
+)
+
+const multicall3AbiJson = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicallAbi abi.ABI
+
+func init() {
+	var err error
+	if multicallAbi, err = abi.JSON(strings.NewReader(multicall3AbiJson)); err != nil {
+		panic(err)
+	}
+}
+
+var (
+	// ErrCallFailed 调用被合约回滚或返回为空
+	ErrCallFailed  = errors.New("call failed")
+	errNotDeployed = errors.New("multicall3 not deployed")
+)
+
+// Call 一次合约只读调用
+type Call struct {
+	Target common.Address
+	Data   []byte
+}
+
+// Result 单个调用的结果, 调用失败时Err不为空, 不影响同一批次的其他调用
+type Result struct {
+	Data []byte
+	Err  error
+}
+
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type result3 struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Caller 通过Multicall3的aggregate3批量执行只读调用
+// 链上没有部署Multicall3时改用JSON-RPC批量请求, 未设置JSON-RPC客户端时并发逐个调用
+type Caller struct {
+	client    chainclient.ChainClient
+	rpc       xhttp.RPCClient
+	address   common.Address
+	batchSize int
+
+	mu          sync.Mutex
+	unsupported bool // 已确认Multicall3未部署
+}
+
+func New(client chainclient.ChainClient) *Caller {
+	return &Caller{
+		client:    client,
+		address:   common.HexToAddress(Multicall3Address),
+		batchSize: DefaultBatchSize,
+	}
+}
+
+// WithRPC 设置Multicall3不可用时使用的JSON-RPC客户端
+func (c *Caller) WithRPC(rpc xhttp.RPCClient) *Caller {
+	c.rpc = rpc
+	return c
+}
+
+// WithAddress 设置Multicall3合约地址, 用于部署在非标准地址的链
+func (c *Caller) WithAddress(address common.Address) *Caller {
+	c.address = address
+	return c
+}
+
+// WithBatchSize 设置每次aggregate3及JSON-RPC批量请求包含的调用数
+func (c *Caller) WithBatchSize(size int) *Caller {
+	if size > 0 {
+		c.batchSize = size
+	}
+	return c
+}
+
+// Call 批量执行调用, 返回结果与calls顺序一致
+// aggregate3或JSON-RPC批量请求失败时返回error, 单个调用失败记录在对应Result.Err中
+func (c *Caller) Call(ctx context.Context, calls []Call) ([]Result, error) {
+	results := make([]Result, 0, len(calls))
+	for start := 0; start < len(calls); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		batch, err := c.callBatch(ctx, calls[start:end])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+	}
+	return results, nil
+}
+
+func (c *Caller) callBatch(ctx context.Context, calls []Call) ([]Result, error) {
+	if !c.isUnsupported() {
+		results, err := c.aggregate(ctx, calls)
+		if err == nil {
+			return results, nil
+		}
+		if !errors.Is(err, errNotDeployed) {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.unsupported = true
+		c.mu.Unlock()
+		xzap.WithContext(ctx).Warn("multicall3 not deployed, fallback to rpc batch",
+			zap.String("address", c.address.String()))
+	}
+	if c.rpc != nil {
+		return c.rpcBatch(ctx, calls)
+	}
+	return c.sequential(ctx, calls), nil
+}
+
+func (c *Caller) isUnsupported() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.unsupported
+}
+
+// aggregate 执行一次aggregate3调用, 对无代码地址的调用返回空数据, 据此判断合约未部署
+func (c *Caller) aggregate(ctx context.Context, calls []Call) ([]Result, error) {
+	args := make([]call3, len(calls))
+	for i, call := range calls {
+		args[i] = call3{Target: call.Target, AllowFailure: true, CallData: call.Data}
+	}
+	data, err := multicallAbi.Pack("aggregate3", args)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pack aggregate3")
+	}
+
+	resp, err := c.client.CallContract(ctx, ethereum.CallMsg{To: &c.address, Data: data}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on call aggregate3")
+	}
+	if len(resp) == 0 {
+		return nil, errNotDeployed
+	}
+
+	values, err := multicallAbi.Unpack("aggregate3", resp)
+	if err != nil || len(values) == 0 {
+		return nil, errors.Errorf("failed on unpack aggregate3: %v", err)
+	}
+	var returns []result3
+	if err := multicallAbi.Methods["aggregate3"].Outputs.Copy(&returns, values); err != nil {
+		return nil, errors.Wrap(err, "failed on copy aggregate3 result")
+	}
+	if len(returns) != len(calls) {
+		return nil, errors.Errorf("aggregate3 returned %d results for %d calls", len(returns), len(calls))
+	}
+
+	results := make([]Result, len(calls))
+	for i, ret := range returns {
+		results[i] = resultOf(ret.Success, ret.ReturnData)
+	}
+	return results, nil
+}
+
+// rpcBatch 将调用作为一次JSON-RPC批量请求中的多个eth_call
+func (c *Caller) rpcBatch(ctx context.Context, calls []Call) ([]Result, error) {
+	reqs := make([]*xhttp.RPCRequest, len(calls))
+	for i, call := range calls {
+		reqs[i] = xhttp.NewRPCRequest("eth_call", map[string]interface{}{
+			"to":   call.Target.Hex(),
+			"data": hexutil.Encode(call.Data),
+		}, "latest")
+	}
+	resps, err := c.rpc.CallBatch(reqs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on rpc batch eth_call")
+	}
+
+	results := make([]Result, len(calls))
+	for i, resp := range resps {
+		raw, err := resp.GetString()
+		if err != nil {
+			results[i] = Result{Err: errors.Wrap(ErrCallFailed, err.Error())}
+			continue
+		}
+		data, err := hexutil.Decode(raw)
+		if err != nil {
+			results[i] = Result{Err: errors.Wrap(err, "failed on decode eth_call result")}
+			continue
+		}
+		results[i] = resultOf(true, data)
+	}
+	return results, nil
+}
+
+// sequential 并发逐个调用, 单个调用的错误均记录在结果中
+func (c *Caller) sequential(ctx context.Context, calls []Call) []Result {
+	results := make([]Result, len(calls))
+	sem := make(chan struct{}, fallbackConcurrency)
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			data, err := c.client.CallContract(ctx, ethereum.CallMsg{To: &calls[i].Target, Data: calls[i].Data}, nil)
+			if err != nil {
+				results[i] = Result{Err: errors.Wrap(ErrCallFailed, err.Error())}
+				return
+			}
+			results[i] = resultOf(true, data)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func resultOf(success bool, data []byte) Result {
+	if !success {
+		return Result{Err: errors.Wrap(ErrCallFailed, "reverted")}
+	}
+	if len(data) == 0 { // 目标地址不是合约或方法不存在
+		return Result{Err: errors.Wrap(ErrCallFailed, "empty return data")}
+	}
+	return Result{Data: data}
+}
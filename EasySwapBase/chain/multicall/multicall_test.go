@@ -0,0 +1,162 @@
+package multicall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+)
+
+var (
+	okTarget     = common.HexToAddress("0x01")
+	revertTarget = common.HexToAddress("0x02")
+)
+
+// fakeClient okTarget原样返回调用数据, revertTarget回滚; deployed为false时模拟Multicall3未部署
+type fakeClient struct {
+	chainclient.ChainClient
+	deployed   bool
+	aggregates int
+	direct     int
+}
+
+func answer(target common.Address, data []byte) ([]byte, bool) {
+	if target == revertTarget {
+		return nil, false
+	}
+	return data, true
+}
+
+func (f *fakeClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if *msg.To != common.HexToAddress(Multicall3Address) {
+		f.direct++
+		data, ok := answer(*msg.To, msg.Data)
+		if !ok {
+			return nil, errors.New("execution reverted")
+		}
+		return data, nil
+	}
+
+	f.aggregates++
+	if !f.deployed {
+		return nil, nil
+	}
+	method := multicallAbi.Methods["aggregate3"]
+	values, err := method.Inputs.Unpack(msg.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	var calls []call3
+	if err := method.Inputs.Copy(&calls, values); err != nil {
+		return nil, err
+	}
+	returns := make([]result3, len(calls))
+	for i, call := range calls {
+		data, ok := answer(call.Target, call.CallData)
+		returns[i] = result3{Success: ok, ReturnData: data}
+	}
+	return method.Outputs.Pack(returns)
+}
+
+func testContext() context.Context {
+	return xzap.ToContext(context.Background(), zap.NewNop())
+}
+
+func testCalls() []Call {
+	return []Call{
+		{Target: okTarget, Data: []byte{1}},
+		{Target: revertTarget, Data: []byte{2}},
+		{Target: okTarget, Data: []byte{3}},
+	}
+}
+
+func assertResults(t *testing.T, results []Result) {
+	require.Len(t, results, 3)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, []byte{1}, results[0].Data)
+	assert.ErrorIs(t, results[1].Err, ErrCallFailed)
+	assert.Nil(t, results[1].Data)
+	assert.NoError(t, results[2].Err)
+	assert.Equal(t, []byte{3}, results[2].Data)
+}
+
+func TestCallAggregatesInBatches(t *testing.T) {
+	client := &fakeClient{deployed: true}
+	results, err := New(client).WithBatchSize(2).Call(testContext(), testCalls())
+	require.NoError(t, err)
+	assertResults(t, results)
+	assert.Equal(t, 2, client.aggregates)
+	assert.Equal(t, 0, client.direct)
+}
+
+func TestCallFallbackWhenNotDeployed(t *testing.T) {
+	client := &fakeClient{}
+	caller := New(client)
+	results, err := caller.Call(testContext(), testCalls())
+	require.NoError(t, err)
+	assertResults(t, results)
+	assert.Equal(t, 1, client.aggregates)
+	assert.Equal(t, 3, client.direct)
+
+	// 确认未部署后不再尝试aggregate3
+	_, err = caller.Call(testContext(), testCalls())
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.aggregates)
+}
+
+func TestCallFallbackToRPCBatch(t *testing.T) {
+	var batches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batches++
+		var reqs []struct {
+			ID     int               `json:"id"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		var resps []*xhttp.RPCResponse
+		for _, req := range reqs {
+			var msg struct {
+				To   common.Address `json:"to"`
+				Data hexutil.Bytes  `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(req.Params[0], &msg))
+			resp := &xhttp.RPCResponse{JSONRPC: "2.0", ID: req.ID}
+			if data, ok := answer(msg.To, msg.Data); ok {
+				resp.Result = hexutil.Encode(data)
+			} else {
+				resp.Error = map[string]interface{}{"code": 3, "message": "execution reverted"}
+			}
+			resps = append(resps, resp)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resps))
+	}))
+	defer server.Close()
+
+	client := &fakeClient{}
+	results, err := New(client).WithRPC(xhttp.NewRPCClient(server.URL)).Call(testContext(), testCalls())
+	require.NoError(t, err)
+	assertResults(t, results)
+	assert.Equal(t, 1, batches)
+	assert.Equal(t, 0, client.direct)
+}
+
+func TestResultOfEmptyData(t *testing.T) {
+	result := resultOf(true, nil)
+	assert.ErrorIs(t, result.Err, ErrCallFailed)
+	assert.True(t, bytes.Equal(resultOf(true, []byte{1}).Data, []byte{1}))
+}
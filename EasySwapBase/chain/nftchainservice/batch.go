@@ -0,0 +1,286 @@
+package nftchainservice
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/multicall"
+)
+
+// MetadataConcurrency 批量获取元数据时并发请求tokenURI内容的数量
+const MetadataConcurrency = 8
+
+// royaltyAbi ERC2981, 不在NftContract的ABI中
+var royaltyAbi abi.ABI
+
+func init() {
+	var err error
+	royaltyAbi, err = abi.JSON(strings.NewReader(`[{"inputs":[{"internalType":"uint256","name":"tokenId","type":"uint256"},{"internalType":"uint256","name":"salePrice","type":"uint256"}],"name":"royaltyInfo","outputs":[{"internalType":"address","name":"receiver","type":"address"},{"internalType":"uint256","name":"royaltyAmount","type":"uint256"}],"stateMutability":"view","type":"function"}]`))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TokenRef 指定collection中的一个NFT
+type TokenRef struct {
+	Collection string
+	TokenID    string
+}
+
+// HolderRef 指定collection中的一个持有者
+type HolderRef struct {
+	Collection string
+	Owner      string
+}
+
+// OperatorRef 指定collection中持有者对操作者的授权
+type OperatorRef struct {
+	Collection string
+	Owner      string
+	Operator   string
+}
+
+// AddressResult 批量读取的结果与请求顺序一致, 单个调用失败(如NFT已销毁、合约不支持该方法)时只设置Err
+type AddressResult struct {
+	Address common.Address
+	Err     error
+}
+
+type StringResult struct {
+	Value string
+	Err   error
+}
+
+type BigIntResult struct {
+	Value *big.Int
+	Err   error
+}
+
+type BoolResult struct {
+	Value bool
+	Err   error
+}
+
+type RoyaltyResult struct {
+	Receiver common.Address
+	Amount   *big.Int
+	Err      error
+}
+
+type MetadataResult struct {
+	Metadata *JsonMetadata
+	TokenUri string
+	Err      error
+}
+
+// batchCall 批量调用同一方法并解析返回值, 返回的error只表示请求节点失败
+func (s *Service) batchCall(contractAbi *abi.ABI, method string, targets []string, args [][]interface{}) ([][]interface{}, []error, error) {
+	values := make([][]interface{}, len(targets))
+	errs := make([]error, len(targets))
+	var calls []multicall.Call
+	var indexes []int
+	for i := range targets {
+		data, err := contractAbi.Pack(method, args[i]...)
+		if err != nil {
+			errs[i] = errors.Wrap(err, "failed on pack "+method)
+			continue
+		}
+		calls = append(calls, multicall.Call{Target: common.HexToAddress(targets[i]), Data: data})
+		indexes = append(indexes, i)
+	}
+	if len(calls) == 0 {
+		return values, errs, nil
+	}
+
+	results, err := s.Multicall.Call(s.ctx, calls)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed on batch call "+method)
+	}
+	for j, result := range results {
+		i := indexes[j]
+		if result.Err != nil {
+			errs[i] = result.Err
+			continue
+		}
+		out, err := contractAbi.Unpack(method, result.Data)
+		if err != nil || len(out) == 0 {
+			errs[i] = errors.Errorf("failed on unpack %s: %v", method, err)
+			continue
+		}
+		values[i] = out
+	}
+	return values, errs, nil
+}
+
+func tokenIdOf(tokenID string) interface{} {
+	tokenId, ok := new(big.Int).SetString(tokenID, 10)
+	if !ok {
+		return tokenID // 打包时报错, 记录为该调用的失败
+	}
+	return tokenId
+}
+
+func tokenArgs(tokens []TokenRef, extra ...interface{}) ([]string, [][]interface{}) {
+	targets := make([]string, len(tokens))
+	args := make([][]interface{}, len(tokens))
+	for i, token := range tokens {
+		targets[i] = token.Collection
+		args[i] = append([]interface{}{tokenIdOf(token.TokenID)}, extra...)
+	}
+	return targets, args
+}
+
+func (s *Service) batchAddresses(method string, tokens []TokenRef) ([]AddressResult, error) {
+	targets, args := tokenArgs(tokens)
+	values, errs, err := s.batchCall(s.Abi, method, targets, args)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]AddressResult, len(tokens))
+	for i := range tokens {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		results[i].Address = *abi.ConvertType(values[i][0], new(common.Address)).(*common.Address)
+	}
+	return results, nil
+}
+
+// FetchNftOwners 批量查询ownerOf
+func (s *Service) FetchNftOwners(tokens []TokenRef) ([]AddressResult, error) {
+	return s.batchAddresses("ownerOf", tokens)
+}
+
+// FetchApproved 批量查询getApproved
+func (s *Service) FetchApproved(tokens []TokenRef) ([]AddressResult, error) {
+	return s.batchAddresses("getApproved", tokens)
+}
+
+// FetchTokenURIs 批量查询tokenURI
+func (s *Service) FetchTokenURIs(tokens []TokenRef) ([]StringResult, error) {
+	targets, args := tokenArgs(tokens)
+	values, errs, err := s.batchCall(s.Abi, "tokenURI", targets, args)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]StringResult, len(tokens))
+	for i := range tokens {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		results[i].Value, _ = values[i][0].(string)
+	}
+	return results, nil
+}
+
+// FetchBalances 批量查询balanceOf
+func (s *Service) FetchBalances(holders []HolderRef) ([]BigIntResult, error) {
+	targets := make([]string, len(holders))
+	args := make([][]interface{}, len(holders))
+	for i, holder := range holders {
+		targets[i] = holder.Collection
+		args[i] = []interface{}{common.HexToAddress(holder.Owner)}
+	}
+	values, errs, err := s.batchCall(s.Abi, "balanceOf", targets, args)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BigIntResult, len(holders))
+	for i := range holders {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		results[i].Value, _ = values[i][0].(*big.Int)
+	}
+	return results, nil
+}
+
+// FetchApprovedForAll 批量查询isApprovedForAll
+func (s *Service) FetchApprovedForAll(operators []OperatorRef) ([]BoolResult, error) {
+	targets := make([]string, len(operators))
+	args := make([][]interface{}, len(operators))
+	for i, operator := range operators {
+		targets[i] = operator.Collection
+		args[i] = []interface{}{common.HexToAddress(operator.Owner), common.HexToAddress(operator.Operator)}
+	}
+	values, errs, err := s.batchCall(s.Abi, "isApprovedForAll", targets, args)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BoolResult, len(operators))
+	for i := range operators {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		results[i].Value, _ = values[i][0].(bool)
+	}
+	return results, nil
+}
+
+// FetchRoyaltyInfo 批量查询ERC2981 royaltyInfo, 未实现ERC2981的合约对应结果为失败
+func (s *Service) FetchRoyaltyInfo(tokens []TokenRef, salePrice *big.Int) ([]RoyaltyResult, error) {
+	targets, args := tokenArgs(tokens, salePrice)
+	values, errs, err := s.batchCall(&royaltyAbi, "royaltyInfo", targets, args)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]RoyaltyResult, len(tokens))
+	for i := range tokens {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		if len(values[i]) < 2 {
+			results[i].Err = errors.New("invalid royaltyInfo response")
+			continue
+		}
+		results[i].Receiver = *abi.ConvertType(values[i][0], new(common.Address)).(*common.Address)
+		results[i].Amount, _ = values[i][1].(*big.Int)
+	}
+	return results, nil
+}
+
+// FetchOnChainMetadatas 批量查询tokenURI后并发获取并解析元数据, 单个NFT失败时只设置对应的Err
+func (s *Service) FetchOnChainMetadatas(tokens []TokenRef) ([]MetadataResult, error) {
+	uris, err := s.FetchTokenURIs(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]MetadataResult, len(tokens))
+	sem := make(chan struct{}, MetadataConcurrency)
+	var wg sync.WaitGroup
+	for i := range uris {
+		if uris[i].Err != nil {
+			results[i].Err = errors.Wrap(uris[i].Err, "failed on request token uri")
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			tokenUri := uris[i].Value
+			results[i].TokenUri = tokenUri
+			body, err := s.fetchMetadataBody(tokenUri)
+			if err != nil {
+				results[i].Err = errors.Wrap(err, "failed on fetch nft metadata")
+				return
+			}
+			results[i].Metadata, results[i].Err = s.decodeMetadata(body, tokenUri)
+		}(i)
+	}
+	wg.Wait()
+	return results, nil
+}
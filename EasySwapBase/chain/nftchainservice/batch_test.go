@@ -0,0 +1,98 @@
+package nftchainservice
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/multicall"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+var testCollection = common.HexToAddress("0x10")
+
+// fakeClient 未部署Multicall3, tokenId为偶数的NFT已销毁
+type fakeClient struct {
+	chainclient.ChainClient
+	t *testing.T
+	s *Service
+}
+
+func (f *fakeClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if *msg.To != testCollection {
+		return nil, nil
+	}
+	method, err := f.s.Abi.MethodById(msg.Data[:4])
+	if err != nil {
+		method, err = royaltyAbi.MethodById(msg.Data[:4])
+	}
+	require.NoError(f.t, err)
+	args, err := method.Inputs.Unpack(msg.Data[4:])
+	require.NoError(f.t, err)
+
+	tokenId := args[0].(*big.Int)
+	if tokenId.Bit(0) == 0 {
+		return nil, errors.New("execution reverted: invalid token")
+	}
+	switch method.Name {
+	case "ownerOf":
+		return method.Outputs.Pack(common.BigToAddress(tokenId))
+	case "royaltyInfo":
+		salePrice := args[1].(*big.Int)
+		return method.Outputs.Pack(common.HexToAddress("0xfee"), new(big.Int).Div(salePrice, big.NewInt(20)))
+	}
+	return nil, errors.New("unexpected method " + method.Name)
+}
+
+func newTestService(t *testing.T) *Service {
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	client := &fakeClient{t: t}
+	s, err := NewWithClient(ctx, client, "sepolia", nil, nil, nil, nil, nil)
+	require.NoError(t, err)
+	client.s = s
+	return s
+}
+
+func TestFetchNftOwnersPartialFailure(t *testing.T) {
+	s := newTestService(t)
+	collection := testCollection.String()
+	results, err := s.FetchNftOwners([]TokenRef{
+		{Collection: collection, TokenID: "1"},
+		{Collection: collection, TokenID: "2"},
+		{Collection: collection, TokenID: "abc"},
+		{Collection: collection, TokenID: "3"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, common.BigToAddress(big.NewInt(1)), results[0].Address)
+	assert.ErrorIs(t, results[1].Err, multicall.ErrCallFailed)
+	assert.Error(t, results[2].Err)
+	assert.NoError(t, results[3].Err)
+	assert.Equal(t, common.BigToAddress(big.NewInt(3)), results[3].Address)
+}
+
+func TestFetchRoyaltyInfo(t *testing.T) {
+	s := newTestService(t)
+	collection := testCollection.String()
+	results, err := s.FetchRoyaltyInfo([]TokenRef{
+		{Collection: collection, TokenID: "1"},
+		{Collection: collection, TokenID: "2"},
+	}, big.NewInt(1000))
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, common.HexToAddress("0xfee"), results[0].Receiver)
+	assert.Equal(t, big.NewInt(50), results[0].Amount)
+	assert.Error(t, results[1].Err)
+}
@@ -64,34 +64,44 @@ func (s *Service) fetchNftMetadata(collectionAddr string, tokenID string) ([]byt
 	}
 
 	tokenUri := res[0].(string)
+	body, err := s.fetchMetadataBody(tokenUri)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, tokenUri, nil
+}
+
+// fetchMetadataBody 按tokenURI的类型(base64/ipfs/http)获取元数据内容
+func (s *Service) fetchMetadataBody(tokenUri string) ([]byte, error) {
 	var body []byte
+	var err error
 	if len(tokenUri) > 29 && tokenUri[0:29] == "data:application/json;base64," {
 		body, err = base64.StdEncoding.DecodeString(tokenUri[29:])
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on decode token uri: %s", tokenUri))
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on decode token uri: %s", tokenUri))
 		}
 	} else if len(tokenUri) > 5 && tokenUri[0:5] == "ipfs:" {
 		body, err = s.fetchIpfsData(tokenUri)
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on fetch token uri: %s", tokenUri))
 		}
 	} else if len(tokenUri) > 5 && tokenUri[0:4] != "http" {
-		return nil, "", errors.New(fmt.Sprintf("invalid url %s", tokenUri))
+		return nil, errors.New(fmt.Sprintf("invalid url %s", tokenUri))
 	}
 
 	if len(tokenUri) > 5 && tokenUri[0:4] == "http" {
 		body, err = s.fetchJsonData(tokenUri)
 		if err != nil {
-			return nil, "", errors.Wrap(err, fmt.Sprintf("failed on fetch metadata. uri:%s", tokenUri))
+			return nil, errors.Wrap(err, fmt.Sprintf("failed on fetch metadata. uri:%s", tokenUri))
 		}
 	}
 
 	if body != nil {
 		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
-		return body, tokenUri, nil
+		return body, nil
 	}
 
-	return nil, "", errors.New("empty metadata")
+	return nil, errors.New("empty metadata")
 }
 
 func (s *Service) FetchNftOwner(collectionAddr string, tokenID string) (common.Address, error) {
@@ -212,6 +222,10 @@ func (s *Service) FetchOnChainMetadata(collectionAddr string, tokenID string) (*
 		return nil, errors.Wrap(err, "failed on fetch nft metadata")
 	}
 
+	return s.decodeMetadata(rawData, tokenUri)
+}
+
+func (s *Service) decodeMetadata(rawData []byte, tokenUri string) (*JsonMetadata, error) {
 	if len(rawData) == 0 {
 		return nil, errors.New("metadata length is zero")
 	}
@@ -2,6 +2,7 @@ package nftchainservice
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -9,6 +10,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/headerservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/multicall"
 	"github.com/ProjectsTask/EasySwapBase/xhttp"
 )
 
@@ -27,6 +30,8 @@ type Service struct {
 	Abi            *abi.ABI
 	HttpClient     *xhttp.Client
 	NodeClient     chainclient.ChainClient
+	Multicall      *multicall.Caller      // 批量合约读取
+	Headers        *headerservice.Service // 设置时Transfer事件使用准确的区块时间
 	ChainName      string
 	NodeName       string
 	NameTags       []string
@@ -37,6 +42,28 @@ type Service struct {
 }
 
 func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags, imageTags, attributesTags,
+	traitNameTags, traitValueTags []string) (*Service, error) {
+	nodeClient, err := chainclient.New(chainID, endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create node client")
+	}
+
+	s, err := NewWithClient(ctx, nodeClient, chainName, nameTags, imageTags, attributesTags, traitNameTags, traitValueTags)
+	if err != nil {
+		return nil, err
+	}
+	// Multicall3未部署时通过第一个http节点批量eth_call
+	for _, url := range strings.Split(endpoint, ",") {
+		if url = strings.TrimSpace(url); strings.HasPrefix(url, "http") {
+			s.Multicall.WithRPC(xhttp.NewRPCClient(url))
+			break
+		}
+	}
+	return s, nil
+}
+
+// NewWithClient 使用已创建的节点客户端, 如多节点的chainclient.MultiClient
+func NewWithClient(ctx context.Context, nodeClient chainclient.ChainClient, chainName string, nameTags, imageTags, attributesTags,
 	traitNameTags, traitValueTags []string) (*Service, error) {
 	conf := xhttp.GetDefaultConfig()
 	conf.ForceAttemptHTTP2 = false
@@ -44,11 +71,6 @@ func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags,
 	conf.DialTimeout = time.Duration(defaultTimeout-5) * time.Second
 	conf.DialKeepAlive = time.Duration(defaultTimeout+10) * time.Second
 
-	nodeClient, err := chainclient.New(chainID, endpoint)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed on create node client")
-	}
-
 	abi, err := NftContractMetaData.GetAbi()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on get contract abi")
@@ -59,6 +81,7 @@ func New(ctx context.Context, endpoint, chainName string, chainID int, nameTags,
 		Abi:            abi,
 		HttpClient:     xhttp.NewClient(conf),
 		NodeClient:     nodeClient,
+		Multicall:      multicall.New(nodeClient),
 		ChainName:      chainName,
 		NameTags:       nameTags,
 		ImageTags:      imageTags,
@@ -43,11 +43,14 @@ type TransferLog struct {
 }
 
 func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog, error) {
-	// get block time
+	// get block time, 未设置区块头服务时按出块间隔估算
 	var startBlockTime uint64
 	var err error
 	switch s.ChainName {
 	case chain.Eth, chain.Optimism, chain.Sepolia, chain.Basepolia:
+		if s.Headers != nil {
+			break
+		}
 		blockTimestamp, err := s.NodeClient.BlockTimeByNumber(context.Background(), big.NewInt(int64(fromBlock)))
 		if err != nil {
 			return nil, errors.Wrap(err, "failed on get block time")
@@ -77,6 +80,18 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 		return nil, errors.Wrap(err, "failed on filter logs")
 	}
 
+	if s.Headers != nil {
+		evmLogs := make([]evmTypes.Log, 0, len(logs))
+		for _, log := range logs {
+			if evmLog, ok := log.(evmTypes.Log); ok {
+				evmLogs = append(evmLogs, evmLog)
+			}
+		}
+		if err := s.Headers.Prefetch(context.Background(), evmLogs); err != nil {
+			return nil, errors.Wrap(err, "failed on get block headers")
+		}
+	}
+
 	var transferLogs []*TransferLog
 	for _, log := range logs {
 		var evmLog evmTypes.Log
@@ -92,11 +107,17 @@ func (s *Service) GetNFTTransferEvent(fromBlock, toBlock uint64) ([]*TransferLog
 			}
 
 			tokenId := new(big.Int).SetBytes(evmLog.Topics[3][:])
+			blockTime := startBlockTime + (evmLog.BlockNumber-fromBlock)*uint64(BlockTimeGap[s.ChainName])
+			if s.Headers != nil {
+				if blockTime, err = s.Headers.BlockTime(context.Background(), evmLog); err != nil {
+					return nil, errors.Wrap(err, "failed on get block time")
+				}
+			}
 			transferLog := &TransferLog{
 				Address:         evmLog.Address.String(),
 				TransactionHash: evmLog.TxHash.String(),
 				BlockNumber:     evmLog.BlockNumber,
-				BlockTime:       startBlockTime + (evmLog.BlockNumber-fromBlock)*uint64(BlockTimeGap[s.ChainName]),
+				BlockTime:       blockTime,
 				BlockHash:       evmLog.BlockHash.String(),
 				Data:            evmLog.Data,
 				Topics:          evmLog.Topics,
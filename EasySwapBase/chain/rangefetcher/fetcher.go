@@ -0,0 +1,304 @@
+package rangefetcher
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+)
+
+const (
+	DefaultInitialRange  = 10
+	DefaultMaxRange      = 2000
+	DefaultTargetResults = 2000
+	DefaultConcurrency   = 4
+)
+
+// FetchFunc 拉取区块区间[fromBlock, toBlock]内的日志
+type FetchFunc func(fromBlock, toBlock uint64) ([]ethereumTypes.Log, error)
+
+// FilterLogs 按过滤条件拉取日志, q中的区块区间会被替换
+func FilterLogs(ctx context.Context, client chainclient.ChainClient, q types.FilterQuery) FetchFunc {
+	return func(fromBlock, toBlock uint64) ([]ethereumTypes.Log, error) {
+		q.FromBlock = new(big.Int).SetUint64(fromBlock)
+		q.ToBlock = new(big.Int).SetUint64(toBlock)
+		logs, err := client.FilterLogs(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		ethLogs := make([]ethereumTypes.Log, 0, len(logs))
+		for _, log := range logs {
+			ethLogs = append(ethLogs, log.(ethereumTypes.Log))
+		}
+		return ethLogs, nil
+	}
+}
+
+// Config 零值使用默认配置
+type Config struct {
+	InitialRange  uint64 // 初始每个请求的区块数
+	MaxRange      uint64 // 每个请求最多的区块数
+	TargetResults int    // 单个请求的日志数低于该值的一半时扩大区块数, 超过时缩小
+	Concurrency   int    // 同时请求的区块区间数
+}
+
+// Progress 追赶进度
+type Progress struct {
+	FromBlock       uint64  `json:"from_block"`   // 本轮追赶的起始区块
+	SyncedBlock     uint64  `json:"synced_block"` // 已拉取到的区块
+	TargetBlock     uint64  `json:"target_block"` // 最近一次请求的目标区块
+	Window          uint64  `json:"window"`       // 当前每个请求的区块数
+	Logs            int     `json:"logs"`         // 本轮已拉取的日志数
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+}
+
+// Remaining 距离目标区块的区块数
+func (p Progress) Remaining() uint64 {
+	if p.SyncedBlock >= p.TargetBlock {
+		return 0
+	}
+	return p.TargetBlock - p.SyncedBlock
+}
+
+// Percent 本轮追赶的完成比例, 0~100
+func (p Progress) Percent() float64 {
+	if p.TargetBlock < p.FromBlock || p.SyncedBlock >= p.TargetBlock {
+		return 100
+	}
+	if p.SyncedBlock < p.FromBlock {
+		return 0
+	}
+	return float64(p.SyncedBlock-p.FromBlock+1) / float64(p.TargetBlock-p.FromBlock+1) * 100
+}
+
+// Fetcher 自适应区块区间的日志拉取
+// 返回的日志少时扩大区块区间, 节点返回结果过多或响应过大时二分区间重试, 并发拉取多个区间后按(区块, 日志序号)顺序返回
+type Fetcher struct {
+	fetch FetchFunc
+	cfg   Config
+	now   func() time.Time
+
+	mu        sync.Mutex
+	window    uint64
+	progress  Progress
+	startedAt time.Time
+}
+
+func New(fetch FetchFunc, cfg Config) *Fetcher {
+	if cfg.InitialRange == 0 {
+		cfg.InitialRange = DefaultInitialRange
+	}
+	if cfg.MaxRange == 0 {
+		cfg.MaxRange = DefaultMaxRange
+	}
+	if cfg.MaxRange < cfg.InitialRange {
+		cfg.MaxRange = cfg.InitialRange
+	}
+	if cfg.TargetResults <= 0 {
+		cfg.TargetResults = DefaultTargetResults
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	return &Fetcher{
+		fetch:  fetch,
+		cfg:    cfg,
+		now:    time.Now,
+		window: cfg.InitialRange,
+	}
+}
+
+// Progress 返回当前的追赶进度
+func (f *Fetcher) Progress() Progress {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.progress
+	p.Window = f.window
+	return p
+}
+
+// chunk 一个请求的区块区间及结果
+type chunk struct {
+	from, to uint64
+	logs     []ethereumTypes.Log
+	minRange uint64 // 二分后成功的最小区间, 未二分时为0
+	err      error
+}
+
+// Next 从fromBlock开始并发拉取若干个区块区间, 不超过toBlock, 返回实际拉取到的区块及按顺序排列的日志
+// 部分区间失败时返回此前连续成功的区间, 第一个区间失败时返回错误
+func (f *Fetcher) Next(ctx context.Context, fromBlock, toBlock uint64) (uint64, []ethereumTypes.Log, error) {
+	if fromBlock > toBlock {
+		return 0, nil, errors.Errorf("invalid block range [%d, %d]", fromBlock, toBlock)
+	}
+
+	f.mu.Lock()
+	window := f.window
+	f.mu.Unlock()
+
+	var chunks []*chunk
+	for start := fromBlock; start <= toBlock && len(chunks) < f.cfg.Concurrency; start += window {
+		end := start + window - 1
+		if end > toBlock || end < start {
+			end = toBlock
+		}
+		chunks = append(chunks, &chunk{from: start, to: end})
+		if end == toBlock {
+			break
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range chunks {
+		wg.Add(1)
+		go func(c *chunk) {
+			defer wg.Done()
+			c.logs, c.minRange, c.err = f.fetchRange(ctx, c.from, c.to)
+		}(c)
+	}
+	wg.Wait()
+
+	var logs []ethereumTypes.Log
+	var done []*chunk
+	for _, c := range chunks {
+		if c.err != nil {
+			break
+		}
+		logs = append(logs, c.logs...)
+		done = append(done, c)
+	}
+	if len(done) == 0 {
+		return 0, nil, chunks[0].err
+	}
+	sortLogs(logs)
+
+	endBlock := done[len(done)-1].to
+	f.adjust(done, window)
+	f.record(fromBlock, endBlock, toBlock, len(logs))
+	return endBlock, logs, nil
+}
+
+// Fetch 拉取[fromBlock, toBlock]内的全部日志, 每拉取一批按区块顺序交给handler, handler返回错误时停止
+func (f *Fetcher) Fetch(ctx context.Context, fromBlock, toBlock uint64, handler func(fromBlock, toBlock uint64, logs []ethereumTypes.Log) error) error {
+	for start := fromBlock; start <= toBlock; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		end, logs, err := f.Next(ctx, start, toBlock)
+		if err != nil {
+			return err
+		}
+		if err := handler(start, end, logs); err != nil {
+			return err
+		}
+		if end == toBlock {
+			break
+		}
+		start = end + 1
+	}
+	return nil
+}
+
+// fetchRange 拉取单个区间, 区间过大时二分后分别拉取
+func (f *Fetcher) fetchRange(ctx context.Context, fromBlock, toBlock uint64) ([]ethereumTypes.Log, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	logs, err := f.fetch(fromBlock, toBlock)
+	if err == nil {
+		return logs, 0, nil
+	}
+	if !chainclient.IsRangeTooLarge(err) || fromBlock == toBlock {
+		return nil, 0, err
+	}
+
+	mid := fromBlock + (toBlock-fromBlock)/2
+	left, leftRange, err := f.fetchRange(ctx, fromBlock, mid)
+	if err != nil {
+		return nil, 0, err
+	}
+	right, rightRange, err := f.fetchRange(ctx, mid+1, toBlock)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	minRange := mid - fromBlock + 1
+	for _, r := range []uint64{leftRange, rightRange} {
+		if r > 0 && r < minRange {
+			minRange = r
+		}
+	}
+	return append(left, right...), minRange, nil
+}
+
+// adjust 根据本批的结果调整区块数: 发生二分时缩小到成功的区间, 日志过多时减半, 所有请求的日志都较少时加倍
+func (f *Fetcher) adjust(chunks []*chunk, window uint64) {
+	next := window
+	grow := true
+	for _, c := range chunks {
+		if c.minRange > 0 {
+			grow = false
+			if c.minRange < next {
+				next = c.minRange
+			}
+			continue
+		}
+		if len(c.logs) > f.cfg.TargetResults {
+			grow = false
+			if window/2 < next {
+				next = window / 2
+			}
+		} else if len(c.logs) >= f.cfg.TargetResults/2 || c.to-c.from+1 < window {
+			grow = false // 日志数适中, 或区间到达目标区块未用满, 无法判断
+		}
+	}
+	if grow {
+		next = window * 2
+	}
+	if next > f.cfg.MaxRange {
+		next = f.cfg.MaxRange
+	}
+	if next == 0 {
+		next = 1
+	}
+
+	f.mu.Lock()
+	f.window = next
+	f.mu.Unlock()
+}
+
+// record 更新追赶进度, fromBlock不是上次拉取的下一个区块时开始新一轮追赶
+func (f *Fetcher) record(fromBlock, endBlock, toBlock uint64, logs int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if f.startedAt.IsZero() || fromBlock != f.progress.SyncedBlock+1 {
+		f.progress = Progress{FromBlock: fromBlock}
+		f.startedAt = now
+	}
+	f.progress.SyncedBlock = endBlock
+	f.progress.TargetBlock = toBlock
+	f.progress.Logs += logs
+	if elapsed := now.Sub(f.startedAt).Seconds(); elapsed > 0 {
+		f.progress.BlocksPerSecond = float64(endBlock-f.progress.FromBlock+1) / elapsed
+	}
+}
+
+func sortLogs(logs []ethereumTypes.Log) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+}
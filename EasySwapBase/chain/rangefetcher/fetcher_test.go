@@ -0,0 +1,128 @@
+package rangefetcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode 每个区块两条日志, 区间内日志超过limit时返回结果过多
+type fakeNode struct {
+	mu     sync.Mutex
+	limit  int
+	fail   map[uint64]error
+	ranges [][2]uint64
+}
+
+func (n *fakeNode) fetch(fromBlock, toBlock uint64) ([]ethereumTypes.Log, error) {
+	n.mu.Lock()
+	n.ranges = append(n.ranges, [2]uint64{fromBlock, toBlock})
+	n.mu.Unlock()
+
+	if err := n.fail[fromBlock]; err != nil {
+		return nil, err
+	}
+	if n.limit > 0 && int(toBlock-fromBlock+1)*2 > n.limit {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+	var logs []ethereumTypes.Log
+	for b := toBlock; b >= fromBlock && b <= toBlock; b-- { // 倒序返回, 由Fetcher排序
+		logs = append(logs, ethereumTypes.Log{BlockNumber: b, Index: 1}, ethereumTypes.Log{BlockNumber: b, Index: 0})
+	}
+	return logs, nil
+}
+
+func assertOrdered(t *testing.T, logs []ethereumTypes.Log, fromBlock, toBlock uint64) {
+	require.Len(t, logs, int(toBlock-fromBlock+1)*2)
+	for i, log := range logs {
+		assert.Equal(t, fromBlock+uint64(i/2), log.BlockNumber)
+		assert.Equal(t, uint(i%2), log.Index)
+	}
+}
+
+func TestNextBisectsAndShrinks(t *testing.T) {
+	node := &fakeNode{limit: 8} // 每次最多4个区块
+	f := New(node.fetch, Config{InitialRange: 10, Concurrency: 1})
+
+	end, logs, err := f.Next(context.Background(), 100, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(109), end)
+	assertOrdered(t, logs, 100, 109)
+	assert.Equal(t, uint64(3), f.Progress().Window)
+
+	end, logs, err = f.Next(context.Background(), 110, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(112), end)
+	assertOrdered(t, logs, 110, 112)
+}
+
+func TestNextGrowsConcurrently(t *testing.T) {
+	node := &fakeNode{}
+	f := New(node.fetch, Config{InitialRange: 10, MaxRange: 40, Concurrency: 3})
+
+	end, logs, err := f.Next(context.Background(), 1, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(30), end)
+	assertOrdered(t, logs, 1, 30)
+	assert.Len(t, node.ranges, 3)
+	assert.Equal(t, uint64(20), f.Progress().Window)
+
+	end, _, err = f.Next(context.Background(), 31, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(90), end)
+	assert.Equal(t, uint64(40), f.Progress().Window, "window is capped by MaxRange")
+}
+
+func TestNextPartialFailure(t *testing.T) {
+	node := &fakeNode{fail: map[uint64]error{21: errors.New("connection reset")}}
+	f := New(node.fetch, Config{InitialRange: 10, Concurrency: 3})
+
+	end, logs, err := f.Next(context.Background(), 1, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), end)
+	assertOrdered(t, logs, 1, 20)
+
+	_, _, err = f.Next(context.Background(), 21, 1000)
+	assert.EqualError(t, err, "connection reset")
+}
+
+func TestFetchProgress(t *testing.T) {
+	now := time.Unix(1000, 0)
+	node := &fakeNode{}
+	f := New(node.fetch, Config{InitialRange: 10, Concurrency: 2})
+	f.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	var batches [][2]uint64
+	var total int
+	err := f.Fetch(context.Background(), 1, 95, func(fromBlock, toBlock uint64, logs []ethereumTypes.Log) error {
+		batches = append(batches, [2]uint64{fromBlock, toBlock})
+		total += len(logs)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][2]uint64{{1, 20}, {21, 60}, {61, 95}}, batches)
+	assert.Equal(t, 190, total)
+
+	progress := f.Progress()
+	assert.Equal(t, uint64(1), progress.FromBlock)
+	assert.Equal(t, uint64(95), progress.SyncedBlock)
+	assert.Equal(t, uint64(0), progress.Remaining())
+	assert.Equal(t, 100.0, progress.Percent())
+	assert.Equal(t, 190, progress.Logs)
+	assert.Greater(t, progress.BlocksPerSecond, 0.0)
+}
+
+func TestProgressPercent(t *testing.T) {
+	p := Progress{FromBlock: 101, SyncedBlock: 150, TargetBlock: 200}
+	assert.Equal(t, 50.0, p.Percent())
+	assert.Equal(t, uint64(50), p.Remaining())
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/pkg/errors"
+)
+
+// BlockHeader 区块头中索引服务关心的字段
+type BlockHeader struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+	Time       uint64
+}
+
+// HeaderOf 转换EVM区块头, hash为区块的真实哈希
+func HeaderOf(header *ethereumTypes.Header, hash common.Hash) *BlockHeader {
+	return &BlockHeader{
+		Number:     header.Number.Uint64(),
+		Hash:       hash.String(),
+		ParentHash: header.ParentHash.String(),
+		Time:       header.Time,
+	}
+}
+
+// RPCHeader 节点eth_getBlockByNumber及newHeads返回的区块头
+// go-ethereum v1.12的Header缺少Cancun之后新增的字段(blobGasUsed、excessBlobGas、parentBeaconBlockRoot等),
+// 对新区块Header.Hash()计算的哈希与链上不一致, 因此区块哈希直接取自响应中的hash字段
+type RPCHeader struct {
+	Header *ethereumTypes.Header
+	Hash   common.Hash
+}
+
+func (h *RPCHeader) UnmarshalJSON(data []byte) error {
+	var header ethereumTypes.Header
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	var fields struct {
+		Hash *common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields.Hash == nil {
+		return errors.New("missing required field 'hash' for header")
+	}
+	h.Header, h.Hash = &header, *fields.Hash
+	return nil
+}
+
+// BlockHeader 转换为BlockHeader
+func (h *RPCHeader) BlockHeader() *BlockHeader {
+	return HeaderOf(h.Header, h.Hash)
+}
+
+// ForwardHeaders 将节点新区块订阅收到的区块头转换后写入ch, 返回的订阅取消时同时取消sub
+func ForwardHeaders(sub ethereum.Subscription, headers <-chan *RPCHeader, ch chan<- *BlockHeader) ethereum.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				select {
+				case ch <- header.BlockHeader():
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	})
+}
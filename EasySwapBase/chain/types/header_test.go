@@ -0,0 +1,117 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardHeaders(t *testing.T) {
+	headers := make(chan *RPCHeader)
+	upstreamErr := make(chan error, 1)
+	upstream := event.NewSubscription(func(quit <-chan struct{}) error {
+		select {
+		case err := <-upstreamErr:
+			return err
+		case <-quit:
+			return nil
+		}
+	})
+
+	ch := make(chan *BlockHeader, 1)
+	sub := ForwardHeaders(upstream, headers, ch)
+
+	headers <- &RPCHeader{Header: &ethereumTypes.Header{Number: big.NewInt(7), Time: 70}, Hash: common.HexToHash("0x07")}
+	select {
+	case header := <-ch:
+		assert.Equal(t, uint64(7), header.Number)
+		assert.Equal(t, uint64(70), header.Time)
+		assert.Equal(t, common.HexToHash("0x07").String(), header.Hash)
+	case <-time.After(time.Second):
+		t.Fatal("header not forwarded")
+	}
+
+	upstreamErr <- errors.New("connection closed")
+	select {
+	case err := <-sub.Err():
+		require.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("upstream error not forwarded")
+	}
+}
+
+// cancunHeader 包含Cancun新增字段的区块头RLP结构, 用于校验测试数据中的区块哈希
+type cancunHeader struct {
+	ParentHash       common.Hash
+	UncleHash        common.Hash
+	Coinbase         common.Address
+	Root             common.Hash
+	TxHash           common.Hash
+	ReceiptHash      common.Hash
+	Bloom            ethereumTypes.Bloom
+	Difficulty       *big.Int
+	Number           *big.Int
+	GasLimit         uint64
+	GasUsed          uint64
+	Time             uint64
+	Extra            []byte
+	MixDigest        common.Hash
+	Nonce            ethereumTypes.BlockNonce
+	BaseFee          *big.Int
+	WithdrawalsHash  common.Hash
+	BlobGasUsed      uint64
+	ExcessBlobGas    uint64
+	ParentBeaconRoot common.Hash
+}
+
+func TestRPCHeaderUsesNodeHash(t *testing.T) {
+	data, err := os.ReadFile("testdata/header_cancun.json")
+	require.NoError(t, err)
+
+	var header RPCHeader
+	require.NoError(t, json.Unmarshal(data, &header))
+	expected := common.HexToHash("0xc6c9ef15abe13ce7639fd537a2c6d5a5d829c53816bcb7c58e5b0e74e9afb725")
+	assert.Equal(t, expected, header.Hash)
+	assert.Equal(t, expected.String(), header.BlockHeader().Hash)
+	assert.Equal(t, uint64(6000000), header.BlockHeader().Number)
+
+	// 测试数据中的hash是包含Cancun字段的真实区块哈希, v1.12的Header.Hash()与之不一致
+	var cancun struct {
+		BlobGasUsed      hexutil.Uint64 `json:"blobGasUsed"`
+		ExcessBlobGas    hexutil.Uint64 `json:"excessBlobGas"`
+		ParentBeaconRoot common.Hash    `json:"parentBeaconBlockRoot"`
+	}
+	require.NoError(t, json.Unmarshal(data, &cancun))
+	h := header.Header
+	enc, err := rlp.EncodeToBytes(&cancunHeader{
+		ParentHash: h.ParentHash, UncleHash: h.UncleHash, Coinbase: h.Coinbase, Root: h.Root,
+		TxHash: h.TxHash, ReceiptHash: h.ReceiptHash, Bloom: h.Bloom, Difficulty: h.Difficulty,
+		Number: h.Number, GasLimit: h.GasLimit, GasUsed: h.GasUsed, Time: h.Time, Extra: h.Extra,
+		MixDigest: h.MixDigest, Nonce: h.Nonce, BaseFee: h.BaseFee, WithdrawalsHash: *h.WithdrawalsHash,
+		BlobGasUsed: uint64(cancun.BlobGasUsed), ExcessBlobGas: uint64(cancun.ExcessBlobGas),
+		ParentBeaconRoot: cancun.ParentBeaconRoot,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, crypto.Keccak256Hash(enc))
+	assert.NotEqual(t, expected, h.Hash())
+
+	fields := make(map[string]interface{})
+	require.NoError(t, json.Unmarshal(data, &fields))
+	delete(fields, "hash")
+	data, err = json.Marshal(fields)
+	require.NoError(t, err)
+	var missing RPCHeader
+	assert.ErrorContains(t, json.Unmarshal(data, &missing), "hash")
+}
@@ -2,6 +2,9 @@ package types
 
 import (
 	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // FilterQuery contains options for contract log filtering.
@@ -24,3 +27,35 @@ type FilterQuery struct {
 	// {{A, B}, {C, D}}   matches topic (A OR B) in first position AND (C OR D) in second position
 	Topics [][]string
 }
+
+// EVMQuery 转换为EVM节点的日志过滤条件
+func (q FilterQuery) EVMQuery() ethereum.FilterQuery {
+	var addresses []common.Address
+	for _, addr := range q.Addresses {
+		addresses = append(addresses, common.HexToAddress(addr))
+	}
+
+	var topicsHash [][]common.Hash
+	for _, topics := range q.Topics {
+		var topicHash []common.Hash
+		for _, topic := range topics {
+			topicHash = append(topicHash, common.HexToHash(topic))
+		}
+		topicsHash = append(topicsHash, topicHash)
+	}
+
+	if q.BlockHash != "" {
+		blockHash := common.HexToHash(q.BlockHash)
+		return ethereum.FilterQuery{
+			BlockHash: &blockHash,
+			Addresses: addresses,
+			Topics:    topicsHash,
+		}
+	}
+	return ethereum.FilterQuery{
+		FromBlock: q.FromBlock,
+		ToBlock:   q.ToBlock,
+		Addresses: addresses,
+		Topics:    topicsHash,
+	}
+}
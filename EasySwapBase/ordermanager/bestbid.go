@@ -0,0 +1,425 @@
+package ordermanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+const (
+	MaxCollectionBids = 100 // 每个collection缓存的最高collection出价订单数
+	MaxItemBids       = 10  // 每个item缓存的最高item出价订单数
+
+	ItemBidsLoadedField = "_" // item出价hash中的占位字段, 存在时表示hash已由order manager维护
+)
+
+func GenCollectionBidsKey(chain, address string) string {
+	return fmt.Sprintf("cache:es:%s:collection:bids:%s", strings.ToLower(chain), strings.ToLower(address))
+}
+
+func GenItemBidsKey(chain, address string) string {
+	return fmt.Sprintf("cache:es:%s:collection:item_bids:%s", strings.ToLower(chain), strings.ToLower(address))
+}
+
+// BidInfo 缓存的出价订单
+type BidInfo struct {
+	OrderID           string          `json:"order_id"`
+	TokenID           string          `json:"token_id"`
+	Price             decimal.Decimal `json:"price"`
+	Maker             string          `json:"maker"`
+	OrderType         int64           `json:"order_type"`
+	EventTime         int64           `json:"event_time"`
+	ExpireTime        int64           `json:"expire_time"`
+	Salt              int64           `json:"salt"`
+	QuantityRemaining int64           `json:"quantity_remaining"`
+	Size              int64           `json:"size"`
+}
+
+func newBidInfo(order *multi.Order) *BidInfo {
+	return &BidInfo{
+		OrderID:           order.OrderID,
+		TokenID:           order.TokenId,
+		Price:             order.Price,
+		Maker:             strings.ToLower(order.Maker),
+		OrderType:         order.OrderType,
+		EventTime:         order.EventTime,
+		ExpireTime:        order.ExpireTime,
+		Salt:              order.Salt,
+		QuantityRemaining: order.QuantityRemaining,
+		Size:              order.Size,
+	}
+}
+
+// Order 转换为订单, 供查询出价的接口直接使用
+func (b *BidInfo) Order() multi.Order {
+	return multi.Order{
+		OrderID:           b.OrderID,
+		TokenId:           b.TokenID,
+		Price:             b.Price,
+		Maker:             b.Maker,
+		OrderType:         b.OrderType,
+		EventTime:         b.EventTime,
+		ExpireTime:        b.ExpireTime,
+		Salt:              b.Salt,
+		QuantityRemaining: b.QuantityRemaining,
+		Size:              b.Size,
+	}
+}
+
+// BestBids 缓存的最高出价列表, 按价格降序
+// Complete为true时列表包含全部有效出价, 否则只包含价格最高的部分, 过滤后数量不足时需要查询数据库
+type BestBids struct {
+	Bids     []*BidInfo `json:"bids"`
+	Complete bool       `json:"complete"`
+}
+
+// bidQueue 按价格降序保存最高的maxLen个出价
+type bidQueue struct {
+	bids     []*BidInfo
+	maxLen   int
+	complete bool // 是否包含全部有效出价
+}
+
+func newBidQueue(maxLen int) *bidQueue {
+	return &bidQueue{maxLen: maxLen, complete: true}
+}
+
+func (q *bidQueue) Len() int {
+	return len(q.bids)
+}
+
+func bidBefore(a, b *BidInfo) bool {
+	if !a.Price.Equal(b.Price) {
+		return a.Price.GreaterThan(b.Price)
+	}
+	if a.EventTime != b.EventTime {
+		return a.EventTime < b.EventTime
+	}
+	return a.OrderID < b.OrderID
+}
+
+// Upsert 添加或更新出价
+// 队列不完整时, 低于队列中最低价的出价无法确定排名, 不加入队列
+func (q *bidQueue) Upsert(bid *BidInfo) {
+	q.Remove(bid.OrderID)
+	if !q.complete && len(q.bids) > 0 && bidBefore(q.bids[len(q.bids)-1], bid) {
+		return
+	}
+
+	i := sort.Search(len(q.bids), func(i int) bool { return bidBefore(bid, q.bids[i]) })
+	q.bids = append(q.bids, nil)
+	copy(q.bids[i+1:], q.bids[i:])
+	q.bids[i] = bid
+
+	if len(q.bids) > q.maxLen {
+		q.bids = q.bids[:q.maxLen]
+		q.complete = false
+	}
+}
+
+// Remove 删除出价, 返回是否存在
+func (q *bidQueue) Remove(orderID string) bool {
+	for i, bid := range q.bids {
+		if bid.OrderID == orderID {
+			q.bids = append(q.bids[:i], q.bids[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Best 价格最高的出价
+func (q *bidQueue) Best() *BidInfo {
+	if len(q.bids) == 0 {
+		return nil
+	}
+	return q.bids[0]
+}
+
+// NeedReload 队列已空但数据库中还有未加载的出价
+func (q *bidQueue) NeedReload() bool {
+	return len(q.bids) == 0 && !q.complete
+}
+
+func (q *bidQueue) Snapshot() *BestBids {
+	bids := make([]*BidInfo, len(q.bids))
+	copy(bids, q.bids)
+	return &BestBids{Bids: bids, Complete: q.complete}
+}
+
+// bidBook 单个collection的最高collection出价及每个item的最高出价
+type bidBook struct {
+	collectionBids *bidQueue
+	itemBids       map[string]*bidQueue // token id -> item出价
+	bestBid        *BidInfo             // 已写入collection表的最高collection出价
+}
+
+func newBidBook() *bidBook {
+	return &bidBook{
+		collectionBids: newBidQueue(MaxCollectionBids),
+		itemBids:       make(map[string]*bidQueue),
+	}
+}
+
+// queueOf 出价所在的队列, create为false且队列不存在时返回nil
+func (b *bidBook) queueOf(bid *BidInfo, create bool) *bidQueue {
+	if bid.OrderType == multi.CollectionBidOrder {
+		return b.collectionBids
+	}
+	q, ok := b.itemBids[bid.TokenID]
+	if !ok && create {
+		q = newBidQueue(MaxItemBids)
+		b.itemBids[bid.TokenID] = q
+	}
+	return q
+}
+
+// Upsert 添加或更新出价
+func (b *bidBook) Upsert(bid *BidInfo) {
+	b.queueOf(bid, true).Upsert(bid)
+}
+
+// Remove 删除出价, 返回出价所在item的token id, 出价为collection出价时token id为空, 出价不存在时ok为false
+func (b *bidBook) Remove(orderID string) (tokenID string, ok bool) {
+	if b.collectionBids.Remove(orderID) {
+		return "", true
+	}
+	for tokenID, q := range b.itemBids {
+		if q.Remove(orderID) {
+			return tokenID, true
+		}
+	}
+	return "", false
+}
+
+// refreshBid 按数据库中订单的最新状态更新出价, 订单不再有效时从队列中删除
+func (om *OrderManager) refreshBid(collectionAddr string, orderID string) error {
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(collectionAddr)]
+	if !ok {
+		return errors.New("untracked collection")
+	}
+
+	var order multi.Order
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Select("order_id, token_id, price, maker, order_type, order_status, event_time, expire_time, salt, quantity_remaining, size").
+		Where("order_id = ?", orderID).
+		Take(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tradeInfo.depth.Remove(orderID)
+			return om.removeBid(collectionAddr, orderID)
+		}
+		return errors.Wrap(err, "failed on get bid order")
+	}
+	if order.OrderType != multi.CollectionBidOrder && order.OrderType != multi.ItemBidOrder {
+		return nil
+	}
+	if order.OrderStatus != multi.OrderStatusActive || order.QuantityRemaining <= 0 || order.ExpireTime <= time.Now().Unix() {
+		tradeInfo.depth.Remove(orderID)
+		return om.removeBid(collectionAddr, orderID)
+	}
+
+	bid := newBidInfo(&order)
+	tradeInfo.bids.Upsert(bid)
+	if bid.OrderType == multi.CollectionBidOrder {
+		tradeInfo.depth.Upsert(bid.OrderID, DepthSideBid, bid.Price, bid.QuantityRemaining, bid.Maker, bid.TokenID)
+		return om.saveCollectionBids(collectionAddr, tradeInfo.bids)
+	}
+	return om.saveItemBids(collectionAddr, tradeInfo.bids, bid.TokenID)
+}
+
+// removeBid 删除已取消、过期或成交的出价
+func (om *OrderManager) removeBid(collectionAddr string, orderID string) error {
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(collectionAddr)]
+	if !ok {
+		return errors.New("untracked collection")
+	}
+
+	tokenID, ok := tradeInfo.bids.Remove(orderID)
+	if !ok {
+		return nil
+	}
+	if tokenID == "" {
+		if tradeInfo.bids.collectionBids.NeedReload() {
+			if err := om.reloadCollectionBids(collectionAddr, tradeInfo.bids); err != nil {
+				return err
+			}
+		}
+		return om.saveCollectionBids(collectionAddr, tradeInfo.bids)
+	}
+
+	if q := tradeInfo.bids.itemBids[tokenID]; q.NeedReload() {
+		if err := om.reloadItemBids(collectionAddr, tradeInfo.bids, tokenID); err != nil {
+			return err
+		}
+	}
+	return om.saveItemBids(collectionAddr, tradeInfo.bids, tokenID)
+}
+
+func (om *OrderManager) activeBidsQuery() *gorm.DB {
+	return om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+		Select("id, order_id, collection_address, token_id, price, maker, order_type, event_time, expire_time, salt, quantity_remaining, size").
+		Where("order_status = ? and quantity_remaining > 0 and expire_time > ?", multi.OrderStatusActive, time.Now().Unix())
+}
+
+// reloadCollectionBids 从数据库重新加载collection价格最高的出价
+func (om *OrderManager) reloadCollectionBids(collectionAddr string, book *bidBook) error {
+	var orders []*multi.Order
+	if err := om.activeBidsQuery().
+		Where("collection_address = ? and order_type = ?", collectionAddr, multi.CollectionBidOrder).
+		Order("price desc").Limit(MaxCollectionBids + 1).
+		Scan(&orders).Error; err != nil {
+		return errors.Wrap(err, "failed on get collection best bids")
+	}
+
+	book.collectionBids = newBidQueue(MaxCollectionBids)
+	for _, order := range orders {
+		book.collectionBids.Upsert(newBidInfo(order))
+	}
+	return nil
+}
+
+// reloadItemBids 从数据库重新加载item价格最高的出价
+func (om *OrderManager) reloadItemBids(collectionAddr string, book *bidBook, tokenID string) error {
+	var orders []*multi.Order
+	if err := om.activeBidsQuery().
+		Where("collection_address = ? and token_id = ? and order_type = ?", collectionAddr, tokenID, multi.ItemBidOrder).
+		Order("price desc").Limit(MaxItemBids + 1).
+		Scan(&orders).Error; err != nil {
+		return errors.Wrap(err, "failed on get item best bids")
+	}
+
+	q := newBidQueue(MaxItemBids)
+	for _, order := range orders {
+		q.Upsert(newBidInfo(order))
+	}
+	book.itemBids[tokenID] = q
+	return nil
+}
+
+// loadCollectionBids 启动时分批加载所有有效出价, 并写入缓存和collection表
+func (om *OrderManager) loadCollectionBids() error {
+	var id int64
+	for {
+		var orders []*multi.Order
+		if err := om.activeBidsQuery().
+			Where("order_type in (?) and id > ?", []int64{multi.CollectionBidOrder, multi.ItemBidOrder}, id).
+			Order("id asc").Limit(1000).
+			Scan(&orders).Error; err != nil {
+			return errors.Wrap(err, "failed on get collection bids")
+		}
+		for _, order := range orders {
+			tradeInfo, ok := om.collectionOrders[strings.ToLower(order.CollectionAddress)]
+			if !ok {
+				continue
+			}
+			tradeInfo.bids.Upsert(newBidInfo(order))
+			if order.OrderType == multi.CollectionBidOrder {
+				tradeInfo.depth.Upsert(order.OrderID, DepthSideBid, order.Price, order.QuantityRemaining, order.Maker, order.TokenId)
+			}
+		}
+		if len(orders) < 1000 {
+			break
+		}
+		id = orders[len(orders)-1].ID
+	}
+
+	for addr, tradeInfo := range om.collectionOrders {
+		if err := om.saveCollectionBids(addr, tradeInfo.bids); err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on save collection bids", zap.String("collection_addr", addr), zap.Error(err))
+		}
+		if err := om.saveAllItemBids(addr, tradeInfo.bids); err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on save item bids", zap.String("collection_addr", addr), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// saveCollectionBids 将collection出价写入缓存, 最高出价变化时同时更新collection表
+func (om *OrderManager) saveCollectionBids(collectionAddr string, book *bidBook) error {
+	raw, err := json.Marshal(book.collectionBids.Snapshot())
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal collection bids")
+	}
+	if err := om.Xkv.Set(GenCollectionBidsKey(om.chain, collectionAddr), string(raw)); err != nil {
+		return errors.Wrap(err, "failed on cache collection bids")
+	}
+
+	best := book.collectionBids.Best()
+	if sameBid(best, book.bestBid) {
+		return nil
+	}
+	updates := map[string]interface{}{"best_bid_price": decimal.Zero, "best_bid_order_id": ""}
+	if best != nil {
+		updates = map[string]interface{}{"best_bid_price": best.Price, "best_bid_order_id": best.OrderID}
+	}
+	if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectCollectionTableName(om.project, om.chain)).
+		Where("address = ?", collectionAddr).Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update collection best bid")
+	}
+	book.bestBid = best
+
+	xzap.WithContext(om.Ctx).Info("update collection best bid",
+		zap.String("collection_addr", collectionAddr), zap.Any("best_bid", updates))
+	return nil
+}
+
+func sameBid(a, b *BidInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.OrderID == b.OrderID && a.Price.Equal(b.Price)
+}
+
+// saveItemBids 将单个item的出价写入缓存
+func (om *OrderManager) saveItemBids(collectionAddr string, book *bidBook, tokenID string) error {
+	key := GenItemBidsKey(om.chain, collectionAddr)
+	q, ok := book.itemBids[tokenID]
+	if !ok || (q.Len() == 0 && q.complete) {
+		delete(book.itemBids, tokenID)
+		if _, err := om.Xkv.Hdel(key, tokenID); err != nil {
+			return errors.Wrap(err, "failed on delete item bids cache")
+		}
+		return nil
+	}
+
+	raw, err := json.Marshal(q.Snapshot())
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal item bids")
+	}
+	if err := om.Xkv.Hmset(key, map[string]string{ItemBidsLoadedField: "1", tokenID: string(raw)}); err != nil {
+		return errors.Wrap(err, "failed on cache item bids")
+	}
+	return nil
+}
+
+// saveAllItemBids 重建collection所有item的出价缓存
+func (om *OrderManager) saveAllItemBids(collectionAddr string, book *bidBook) error {
+	fields := map[string]string{ItemBidsLoadedField: "1"}
+	for tokenID, q := range book.itemBids {
+		raw, err := json.Marshal(q.Snapshot())
+		if err != nil {
+			return errors.Wrap(err, "failed on marshal item bids")
+		}
+		fields[tokenID] = string(raw)
+	}
+
+	key := GenItemBidsKey(om.chain, collectionAddr)
+	if _, err := om.Xkv.Del(key); err != nil {
+		return errors.Wrap(err, "failed on delete item bids cache")
+	}
+	if err := om.Xkv.Hmset(key, fields); err != nil {
+		return errors.Wrap(err, "failed on cache item bids")
+	}
+	return nil
+}
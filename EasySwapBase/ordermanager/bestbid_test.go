@@ -0,0 +1,75 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func newTestBid(orderID string, price int64, eventTime int64) *BidInfo {
+	return &BidInfo{OrderID: orderID, Price: decimal.NewFromInt(price), EventTime: eventTime, OrderType: multi.CollectionBidOrder, QuantityRemaining: 1}
+}
+
+func bidIDs(q *bidQueue) []string {
+	var ids []string
+	for _, bid := range q.bids {
+		ids = append(ids, bid.OrderID)
+	}
+	return ids
+}
+
+func TestBidQueue(t *testing.T) {
+	q := newBidQueue(3)
+	q.Upsert(newTestBid("1", 10, 1))
+	q.Upsert(newTestBid("2", 30, 1))
+	q.Upsert(newTestBid("3", 20, 1))
+	q.Upsert(newTestBid("4", 20, 0)) // 同价格时先出价的在前
+	assert.Equal(t, []string{"2", "4", "3"}, bidIDs(q))
+	assert.False(t, q.complete)
+
+	// 队列不完整时低于最低价的出价排名未知, 不加入
+	q.Upsert(newTestBid("5", 5, 1))
+	assert.Equal(t, []string{"2", "4", "3"}, bidIDs(q))
+
+	// 更新价格
+	q.Upsert(newTestBid("3", 40, 1))
+	assert.Equal(t, []string{"3", "2", "4"}, bidIDs(q))
+	assert.Equal(t, "3", q.Best().OrderID)
+
+	assert.True(t, q.Remove("2"))
+	assert.False(t, q.Remove("2"))
+	q.Remove("3")
+	q.Remove("4")
+	assert.Nil(t, q.Best())
+	assert.True(t, q.NeedReload())
+}
+
+func TestBidBook(t *testing.T) {
+	book := newBidBook()
+	book.Upsert(newTestBid("c1", 10, 1))
+	book.Upsert(&BidInfo{OrderID: "i1", TokenID: "7", Price: decimal.NewFromInt(5), OrderType: multi.ItemBidOrder})
+
+	assert.Equal(t, "c1", book.collectionBids.Best().OrderID)
+	assert.Equal(t, "i1", book.itemBids["7"].Best().OrderID)
+
+	tokenID, ok := book.Remove("i1")
+	assert.True(t, ok)
+	assert.Equal(t, "7", tokenID)
+
+	tokenID, ok = book.Remove("c1")
+	assert.True(t, ok)
+	assert.Equal(t, "", tokenID)
+
+	_, ok = book.Remove("c1")
+	assert.False(t, ok)
+}
+
+func TestSameBid(t *testing.T) {
+	assert.True(t, sameBid(nil, nil))
+	assert.False(t, sameBid(newTestBid("1", 10, 1), nil))
+	assert.True(t, sameBid(newTestBid("1", 10, 1), newTestBid("1", 10, 2)))
+	assert.False(t, sameBid(newTestBid("1", 10, 1), newTestBid("1", 11, 1)))
+}
@@ -0,0 +1,257 @@
+package ordermanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	DepthSideBid = "bid" // collection出价
+	DepthSideAsk = "ask" // 挂单
+
+	MaxDepthLevels     = 100 // 快照中每一侧保留的价格档位数
+	DepthDiffStreamPre = "stream:es:depth:%s"
+)
+
+func GenCollectionDepthKey(chain, address string) string {
+	return fmt.Sprintf("cache:es:%s:collection:depth:%s", strings.ToLower(chain), strings.ToLower(address))
+}
+
+func GenDepthDiffStreamKey(chain string) string {
+	return fmt.Sprintf(DepthDiffStreamPre, strings.ToLower(chain))
+}
+
+// DepthLevel 价格档位
+type DepthLevel struct {
+	Price    decimal.Decimal `json:"price"`
+	Orders   int64           `json:"orders"`   // 订单数
+	Quantity int64           `json:"quantity"` // 剩余数量合计
+}
+
+// DepthSnapshot collection的深度快照, 买方按价格降序, 卖方按价格升序
+type DepthSnapshot struct {
+	Collection string       `json:"collection"`
+	Sequence   int64        `json:"sequence"`
+	Bids       []DepthLevel `json:"bids"`
+	Asks       []DepthLevel `json:"asks"`
+	UpdateTime int64        `json:"update_time"` // 单位毫秒
+}
+
+// DepthDiff 深度增量, 只包含变化的档位, Orders为0表示档位已删除
+// 快照的Sequence为S时, 依次应用Sequence大于S的增量即可得到最新深度
+type DepthDiff struct {
+	Collection string       `json:"collection"`
+	Sequence   int64        `json:"sequence"`
+	Bids       []DepthLevel `json:"bids"`
+	Asks       []DepthLevel `json:"asks"`
+	UpdateTime int64        `json:"update_time"`
+}
+
+type depthOrder struct {
+	side     string
+	price    decimal.Decimal
+	quantity int64
+	maker    string
+	tokenID  string
+}
+
+type depthKey struct {
+	side  string
+	price string
+}
+
+// depthBook 单个collection按价格聚合的挂单和collection出价
+// item出价只针对单个NFT, 不计入深度
+type depthBook struct {
+	orders   map[string]*depthOrder
+	levels   map[depthKey]*DepthLevel
+	touched  map[depthKey]bool // 上次发布后变化的档位
+	sequence int64
+}
+
+// newDepthBook 序号从当前毫秒时间开始, 重启后序号仍然递增
+func newDepthBook() *depthBook {
+	return &depthBook{
+		orders:   make(map[string]*depthOrder),
+		levels:   make(map[depthKey]*DepthLevel),
+		touched:  make(map[depthKey]bool),
+		sequence: time.Now().UnixMilli(),
+	}
+}
+
+func (b *depthBook) apply(order *depthOrder, sign int64) {
+	key := depthKey{side: order.side, price: order.price.String()}
+	level, ok := b.levels[key]
+	if !ok {
+		level = &DepthLevel{Price: order.price}
+		b.levels[key] = level
+	}
+	level.Orders += sign
+	level.Quantity += sign * order.quantity
+	if level.Orders <= 0 {
+		delete(b.levels, key)
+	}
+	b.touched[key] = true
+}
+
+// Upsert 添加或更新订单, quantity不大于0时删除订单
+func (b *depthBook) Upsert(orderID string, side string, price decimal.Decimal, quantity int64, maker, tokenID string) {
+	if quantity <= 0 {
+		b.Remove(orderID)
+		return
+	}
+
+	if old, ok := b.orders[orderID]; ok {
+		if old.side == side && old.price.Equal(price) && old.quantity == quantity {
+			return
+		}
+		b.apply(old, -1)
+	}
+	order := &depthOrder{side: side, price: price, quantity: quantity, maker: strings.ToLower(maker), tokenID: tokenID}
+	b.orders[orderID] = order
+	b.apply(order, 1)
+}
+
+// Remove 删除订单
+func (b *depthBook) Remove(orderID string) {
+	order, ok := b.orders[orderID]
+	if !ok {
+		return
+	}
+	delete(b.orders, orderID)
+	b.apply(order, -1)
+}
+
+// RemoveMakerAsks 删除maker对tokenID的所有挂单, NFT转出后这些挂单不再有效
+func (b *depthBook) RemoveMakerAsks(maker, tokenID string) {
+	maker = strings.ToLower(maker)
+	for orderID, order := range b.orders {
+		if order.side == DepthSideAsk && order.maker == maker && order.tokenID == tokenID {
+			b.Remove(orderID)
+		}
+	}
+}
+
+// Snapshot 每一侧最多levels个档位的深度快照
+func (b *depthBook) Snapshot(collection string, levels int) *DepthSnapshot {
+	snapshot := &DepthSnapshot{
+		Collection: strings.ToLower(collection),
+		Sequence:   b.sequence,
+		Bids:       []DepthLevel{},
+		Asks:       []DepthLevel{},
+		UpdateTime: time.Now().UnixMilli(),
+	}
+	for key, level := range b.levels {
+		if key.side == DepthSideBid {
+			snapshot.Bids = append(snapshot.Bids, *level)
+		} else {
+			snapshot.Asks = append(snapshot.Asks, *level)
+		}
+	}
+	sortDepthLevels(snapshot.Bids, snapshot.Asks)
+	if len(snapshot.Bids) > levels {
+		snapshot.Bids = snapshot.Bids[:levels]
+	}
+	if len(snapshot.Asks) > levels {
+		snapshot.Asks = snapshot.Asks[:levels]
+	}
+	return snapshot
+}
+
+// Diff 上次发布后的增量, 没有变化时返回nil; 发布成功后调用Commit
+func (b *depthBook) Diff(collection string) *DepthDiff {
+	if len(b.touched) == 0 {
+		return nil
+	}
+
+	diff := &DepthDiff{
+		Collection: strings.ToLower(collection),
+		Sequence:   b.sequence + 1,
+		Bids:       []DepthLevel{},
+		Asks:       []DepthLevel{},
+		UpdateTime: time.Now().UnixMilli(),
+	}
+	for key := range b.touched {
+		level, ok := b.levels[key]
+		if !ok {
+			price, _ := decimal.NewFromString(key.price)
+			level = &DepthLevel{Price: price}
+		}
+		if key.side == DepthSideBid {
+			diff.Bids = append(diff.Bids, *level)
+		} else {
+			diff.Asks = append(diff.Asks, *level)
+		}
+	}
+	sortDepthLevels(diff.Bids, diff.Asks)
+	return diff
+}
+
+// Commit 增量发布成功, 更新序号并清空变化记录
+func (b *depthBook) Commit(diff *DepthDiff) {
+	b.sequence = diff.Sequence
+	b.touched = make(map[depthKey]bool)
+}
+
+func sortDepthLevels(bids, asks []DepthLevel) {
+	sort.Slice(bids, func(i, j int) bool { return bids[i].Price.GreaterThan(bids[j].Price) })
+	sort.Slice(asks, func(i, j int) bool { return asks[i].Price.LessThan(asks[j].Price) })
+}
+
+// publishDepth 深度有变化时更新缓存中的快照并发布增量
+func (om *OrderManager) publishDepth(collectionAddr string) error {
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(collectionAddr)]
+	if !ok {
+		return nil
+	}
+	diff := tradeInfo.depth.Diff(collectionAddr)
+	if diff == nil {
+		return nil
+	}
+
+	snapshot := tradeInfo.depth.Snapshot(collectionAddr, MaxDepthLevels)
+	snapshot.Sequence = diff.Sequence
+	if err := om.saveDepthSnapshot(collectionAddr, snapshot); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(diff)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal depth diff")
+	}
+	if _, err := om.Xkv.AddStream(om.Ctx, GenDepthDiffStreamKey(om.chain), string(raw)); err != nil {
+		return errors.Wrap(err, "failed on publish depth diff")
+	}
+	tradeInfo.depth.Commit(diff)
+	return nil
+}
+
+func (om *OrderManager) saveDepthSnapshot(collectionAddr string, snapshot *DepthSnapshot) error {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal depth snapshot")
+	}
+	if err := om.Xkv.Set(GenCollectionDepthKey(om.chain, collectionAddr), string(raw)); err != nil {
+		return errors.Wrap(err, "failed on cache depth snapshot")
+	}
+	return nil
+}
+
+// saveDepthSnapshots 启动加载订单后写入所有collection的深度快照, 作为之后增量的基准
+func (om *OrderManager) saveDepthSnapshots() {
+	for addr, tradeInfo := range om.collectionOrders {
+		tradeInfo.depth.touched = make(map[depthKey]bool)
+		if err := om.saveDepthSnapshot(addr, tradeInfo.depth.Snapshot(addr, MaxDepthLevels)); err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on save depth snapshot", zap.String("collection_addr", addr), zap.Error(err))
+		}
+	}
+}
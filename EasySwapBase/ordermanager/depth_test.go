@@ -0,0 +1,53 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDepthBook(t *testing.T) {
+	book := newDepthBook()
+	book.Upsert("a1", DepthSideAsk, decimal.NewFromInt(10), 1, "0xM1", "1")
+	book.Upsert("a2", DepthSideAsk, decimal.NewFromInt(10), 1, "0xm2", "2")
+	book.Upsert("a3", DepthSideAsk, decimal.NewFromInt(12), 1, "0xm1", "3")
+	book.Upsert("b1", DepthSideBid, decimal.NewFromInt(8), 3, "0xm3", "0")
+	book.Upsert("b2", DepthSideBid, decimal.NewFromInt(9), 2, "0xm3", "0")
+
+	snapshot := book.Snapshot("0xC", 10)
+	assert.Equal(t, "0xc", snapshot.Collection)
+	assert.Equal(t, []DepthLevel{
+		{Price: decimal.NewFromInt(9), Orders: 1, Quantity: 2},
+		{Price: decimal.NewFromInt(8), Orders: 1, Quantity: 3},
+	}, snapshot.Bids)
+	assert.Equal(t, []DepthLevel{
+		{Price: decimal.NewFromInt(10), Orders: 2, Quantity: 2},
+		{Price: decimal.NewFromInt(12), Orders: 1, Quantity: 1},
+	}, snapshot.Asks)
+
+	diff := book.Diff("0xc")
+	assert.Equal(t, book.sequence+1, diff.Sequence)
+	assert.Len(t, diff.Asks, 2)
+	book.Commit(diff)
+	assert.Nil(t, book.Diff("0xc"))
+
+	// 部分成交, 转出后挂单失效, 档位删除
+	book.Upsert("b1", DepthSideBid, decimal.NewFromInt(8), 1, "0xm3", "0")
+	book.RemoveMakerAsks("0xm1", "3")
+	book.Remove("unknown")
+	diff = book.Diff("0xc")
+	assert.Equal(t, []DepthLevel{{Price: decimal.NewFromInt(8), Orders: 1, Quantity: 1}}, diff.Bids)
+	assert.Len(t, diff.Asks, 1)
+	assert.True(t, diff.Asks[0].Price.Equal(decimal.NewFromInt(12)))
+	assert.Equal(t, int64(0), diff.Asks[0].Orders)
+	book.Commit(diff)
+
+	// 数量为0时删除订单
+	book.Upsert("b2", DepthSideBid, decimal.NewFromInt(9), 0, "0xm3", "0")
+	snapshot = book.Snapshot("0xc", 1)
+	assert.Len(t, snapshot.Bids, 1)
+	assert.Len(t, snapshot.Asks, 1)
+	assert.Equal(t, diff.Sequence, snapshot.Sequence)
+	assert.True(t, snapshot.Bids[0].Price.Equal(decimal.NewFromInt(8)))
+}
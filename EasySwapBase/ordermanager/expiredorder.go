@@ -1,22 +1,128 @@
 package ordermanager
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
 
 	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
 )
 
+const (
+	CacheOrderExpiryPre      = "cache:es:orders:expiry:%s"       // 待过期订单, score为过期时间(秒)
+	CacheOrderExpiryLeasePre = "cache:es:orders:expiry:lease:%s" // 已领取待处理的订单, score为租约到期时间(毫秒)
+	CacheOrderExpiryOwnerPre = "cache:es:orders:expiry:owner:%s" // 已领取订单的租约id及领取次数
+
+	ExpiryCheckInterval = time.Second
+	ExpiryBatchSize     = 100
+	ExpiryLease         = 30 * time.Second // 租约到期未完成的订单可被其他实例重新领取
+)
+
+// claimExpiryScript 领取到期的订单
+// 先重新领取租约已过期的订单, 再从待过期队列中领取到期的订单, 已被领取的订单不重复领取
+// 返回 [member, attempt, member, attempt, ...]
+const claimExpiryScript = `local claimed = {}
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[2], 'LIMIT', 0, ARGV[4])
+for _, m in ipairs(stale) do
+    local attempt = 1
+    local owner = redis.call('HGET', KEYS[3], m)
+    if owner then
+        attempt = (tonumber(string.match(owner, ':(%d+)$')) or 0) + 1
+    end
+    redis.call('ZADD', KEYS[2], ARGV[3], m)
+    redis.call('HSET', KEYS[3], m, ARGV[5] .. ':' .. attempt)
+    table.insert(claimed, m)
+    table.insert(claimed, tostring(attempt))
+end
+local left = tonumber(ARGV[4]) - #stale
+if left > 0 then
+    local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, left)
+    for _, m in ipairs(due) do
+        redis.call('ZREM', KEYS[1], m)
+        if not redis.call('ZSCORE', KEYS[2], m) then
+            redis.call('ZADD', KEYS[2], ARGV[3], m)
+            redis.call('HSET', KEYS[3], m, ARGV[5] .. ':1')
+            table.insert(claimed, m)
+            table.insert(claimed, '1')
+        end
+    end
+end
+return claimed`
+
+// completeExpiryScript 完成领取的订单并推送地板价事件
+// 只处理仍由本租约持有的订单, 确认和推送事件在同一脚本中完成, 每个订单的事件只推送一次
+// ARGV: leaseID, maxLen, member, event, member, event, ... event为空时不推送
+const completeExpiryScript = `local done = 0
+local prefix = ARGV[1] .. ':'
+for i = 3, #ARGV, 2 do
+    local m = ARGV[i]
+    local owner = redis.call('HGET', KEYS[2], m)
+    if owner and string.sub(owner, 1, #prefix) == prefix then
+        redis.call('ZREM', KEYS[1], m)
+        redis.call('HDEL', KEYS[2], m)
+        if ARGV[i + 1] ~= '' then
+            redis.call('XADD', KEYS[3], 'MAXLEN', '~', ARGV[2], '*', 'payload', ARGV[i + 1])
+        end
+        done = done + 1
+    end
+end
+return done`
+
+func genOrderExpiryCacheKey(chain string) string {
+	return fmt.Sprintf(CacheOrderExpiryPre, chain)
+}
+
+func genOrderExpiryLeaseCacheKey(chain string) string {
+	return fmt.Sprintf(CacheOrderExpiryLeasePre, chain)
+}
+
+func genOrderExpiryOwnerCacheKey(chain string) string {
+	return fmt.Sprintf(CacheOrderExpiryOwnerPre, chain)
+}
+
+// expiryItem 过期队列中的订单
+type expiryItem struct {
+	OrderID        string
+	CollectionAddr string
+	Attempt        int64 // 第几次被领取, 大于1说明之前的领取者未完成
+}
+
+func (i expiryItem) member() string {
+	return i.OrderID + ":" + strings.ToLower(i.CollectionAddr)
+}
+
+func parseExpiryMember(member string) (expiryItem, bool) {
+	orderID, collectionAddr, ok := strings.Cut(member, ":")
+	if !ok || orderID == "" {
+		return expiryItem{}, false
+	}
+	return expiryItem{OrderID: orderID, CollectionAddr: collectionAddr}, true
+}
+
+// expiryClaim 一次领取的订单
+type expiryClaim struct {
+	leaseID string
+	items   []expiryItem
+}
+
 // orderExpiryProcess 函数负责处理订单过期的逻辑,主要包含以下功能:
 // 1. 使用defer recover防止panic导致主协程退出
-// 2. 启动时从数据库加载所有活跃订单到时间轮队列
-// 3. 每秒检查一次时间轮,处理到期的订单
+// 2. 启动时将数据库中所有活跃订单加入redis过期队列(重复加入不影响)
+// 3. 每秒领取一批到期的订单, 批量更新为过期并推送地板价事件
+// 过期队列及领取记录都在redis中, 重启不丢失, 多个实例通过租约分担处理
 func (om *OrderManager) orderExpiryProcess() {
 	// 1. 使用 defer recover 来捕获可能的 panic,防止主协程死掉
 	defer func() {
@@ -25,222 +131,229 @@ func (om *OrderManager) orderExpiryProcess() {
 		}
 	}()
 
-	// 2. 启动时从数据库加载所有活跃订单到时间轮队列中
+	// 2. 启动时从数据库加载所有活跃订单到过期队列中
 	if err := om.loadOrdersToQueue(); err != nil {
 		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
 		return
 	}
 
-	// 3. 每秒检查一次时间轮
+	// 3. 每秒处理一次到期的订单
 	for {
 		select {
-		case <-time.After(time.Second * 1): // 每秒执行一次检查
-			// 如果当前索引超过时间轮大小,则取模重置
-			if om.CurrentIndex >= WheelSize {
-				om.CurrentIndex = om.CurrentIndex % WheelSize
-			}
+		case <-om.Ctx.Done():
+			xzap.WithContext(om.Ctx).Info("[Order Manage] order expiry process stopped due to context cancellation")
+			return
+		case <-time.After(ExpiryCheckInterval):
+		}
 
-			// 获取当前时间槽的任务链表头
-			taskLinkHead := om.TimeWheel[om.CurrentIndex].NotifyActivities
-			headIndex := om.CurrentIndex
-			om.CurrentIndex++
-
-			// prev指向前一个节点,p指向当前节点
-			prev := taskLinkHead
-			p := taskLinkHead
-
-			// 遍历当前时间槽的所有任务
-			for p != nil {
-				// 如果任务的循环计数为0,说明到期需要处理
-				if p.CycleCount == 0 {
-					// 异步更新订单状态,避免阻塞主循环
-					go func(chain string, orderId string, collectionAddr string) {
-						if err := om.updateOrderState(orderId, collectionAddr); err != nil {
-							xzap.WithContext(om.Ctx).Error("failed on update order status", zap.Error(err), zap.String("chain", chain), zap.String("order_id", orderId))
-						}
-					}(p.ChainSuffix, p.orderID, p.CollectionAddr)
-
-					// 从链表中删除该节点
-					if prev == p { // 如果是头节点
-						om.TimeWheel[headIndex].NotifyActivities = p.Next
-						prev = p.Next
-						p = p.Next
-					} else { // 如果不是头节点
-						prev.Next = p.Next
-						p = p.Next
-					}
-				} else {
-					// 如果任务未到期,循环计数减1
-					p.CycleCount--
-					prev = p
-					p = p.Next
-				}
+		for {
+			processed, err := om.expireDueOrders()
+			if err != nil {
+				xzap.WithContext(om.Ctx).Error("[Order Manage] failed on expire orders", zap.Error(err), zap.String("chain", om.chain))
+				break
+			}
+			if processed < ExpiryBatchSize {
+				break
 			}
 		}
 	}
 }
 
-// loadOrdersToQueue 函数负责在系统启动时加载所有活跃订单并处理它们的过期状态
-// 主要功能包括:
-// 1. 从数据库分批加载所有活跃订单
-// 2. 检查每个订单是否已过期:
-//   - 已过期的订单:更新状态为过期并触发地板价更新事件
-//   - 未过期的订单:添加到延迟队列等待过期检查
+// loadOrdersToQueue 函数负责在系统启动时将所有活跃订单加入过期队列
+// 已过期的订单同样加入队列, 由过期处理统一更新状态并触发地板价更新事件
 func (om *OrderManager) loadOrdersToQueue() error {
-	// 分批加载所有活跃订单
-	var totalOrders []*multi.Order
 	var id int64
 	for {
 		var orders []*multi.Order
 		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-			Select("id, order_id, collection_address, price, expire_time").
+			Select("id, order_id, collection_address, expire_time").
 			Where("order_status = ? and id > ?", multi.OrderStatusActive, id).
 			Order("id asc").Limit(1000).
 			Scan(&orders).Error; err != nil {
 			return errors.Wrap(err, "failed on get collection orders")
 		}
-		totalOrders = append(totalOrders, orders...)
-		if len(orders) < 1000 {
-			break
-		}
 
-		id = orders[len(orders)-1].ID
-	}
-
-	if totalOrders == nil || len(totalOrders) == 0 {
-		return nil
-	}
-
-	// 分别记录已过期和未过期的订单
-	var expiredOrderIDs []int64
-	var expiredOrders []*multi.Order
-	for _, order := range totalOrders {
-		if order.ExpireTime < time.Now().Unix() { // 已过期
-			expiredOrderIDs = append(expiredOrderIDs, order.ID)
-			expiredOrders = append(expiredOrders, order)
-		} else { // 未过期,添加到延迟队列
-			delaySeconds := order.ExpireTime - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, order.OrderID, order.CollectionAddress); err != nil {
-				xzap.WithContext(om.Ctx).Error("[Order Manage] failed on add order to delay queue",
-					zap.Error(err))
-			}
+		items := make([]redis.Pair, 0, len(orders))
+		for _, order := range orders {
+			items = append(items, redis.Pair{
+				Key:   expiryItem{OrderID: order.OrderID, CollectionAddr: order.CollectionAddress}.member(),
+				Score: order.ExpireTime,
+			})
 		}
-	}
-
-	// 批量更新已过期订单的状态
-	for i := 0; i < len(expiredOrderIDs); i += 100 {
-		end := i + MaxBatchReqNum
-		if i+MaxBatchReqNum >= len(expiredOrderIDs) {
-			end = len(expiredOrderIDs)
-		}
-
-		if err := om.DB.WithContext(om.Ctx).Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
-			Where("id in (?)", expiredOrderIDs[i:end]).Update("order_status", multi.OrderStatusExpired).Error; err != nil {
-			return errors.Wrap(err, "failed on update expired orders status")
+		if len(items) > 0 {
+			if _, err := om.Xkv.Redis.ZaddsCtx(om.Ctx, genOrderExpiryCacheKey(om.chain), items...); err != nil {
+				return errors.Wrap(err, "failed on add orders to expiry queue")
+			}
 		}
-	}
 
-	// 为每个过期订单触发地板价更新事件
-	for _, order := range expiredOrders {
-		if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-			EventType:      Expired,
-			CollectionAddr: order.CollectionAddress,
-			OrderId:        order.OrderID,
-		}); err != nil {
-			return errors.Wrap(err, "failed on add update floor price event")
+		if len(orders) < 1000 {
+			break
 		}
+		id = orders[len(orders)-1].ID
 	}
 
 	return nil
 }
 
-// addToOrderExpiryCheckQueue 函数用于将订单添加到过期检查队列中
-// 主要功能:
-// 1. 根据延迟时间计算订单在时间轮上的位置
-// 2. 将订单添加到时间轮对应位置的链表中
+// addToOrderExpiryCheckQueue 函数用于将订单按过期时间加入过期队列
 // 参数说明:
-// - delaySeconds: 延迟秒数,即订单过期前的剩余时间
-// - chainSuffix: 链标识
+// - expireTime: 订单过期时间(秒), 已过期的订单在下一次检查时处理
 // - orderId: 订单ID
 // - collectionAddr: NFT集合地址
-func (om *OrderManager) addToOrderExpiryCheckQueue(delaySeconds int64, chainSuffix string, orderId string, collectionAddr string) error {
-	// 加锁保护并发安全
-	om.Mux.Lock()
-	defer om.Mux.Unlock()
-
-	// 计算订单最终的时间轮位置
-	// 从当前索引开始计数
-	calculateValue := om.CurrentIndex + delaySeconds
-
-	// 计算需要循环的圈数
-	// 如果需要循环,则圈数减1(因为从0开始计数)
-	cycle := calculateValue / WheelSize
-	if cycle > 0 {
-		cycle--
-	}
-
-	// 计算订单在时间轮上的实际位置
-	index := calculateValue % WheelSize
-
-	// 创建订单对象
-	orderActivity := &Order{
-		orderID:        orderId,
-		CollectionAddr: collectionAddr,
-		ChainSuffix:    chainSuffix,
-		CycleCount:     cycle,
-		WheelPosition:  index,
-	}
-
-	// 如果该位置为空,直接放入
-	if om.TimeWheel[index].NotifyActivities == nil {
-		om.TimeWheel[index].NotifyActivities = orderActivity
-	} else {
-		// 否则插入到链表头部
-		// 因为不需要排序,所以直接插入到头部即可
-		head := om.TimeWheel[index].NotifyActivities
-		orderActivity.Next = head
-		om.TimeWheel[index].NotifyActivities = orderActivity
+func (om *OrderManager) addToOrderExpiryCheckQueue(expireTime int64, orderId string, collectionAddr string) error {
+	member := expiryItem{OrderID: orderId, CollectionAddr: collectionAddr}.member()
+	if _, err := om.Xkv.Redis.ZaddCtx(om.Ctx, genOrderExpiryCacheKey(om.chain), expireTime, member); err != nil {
+		return errors.Wrap(err, "failed on add order to expiry queue")
 	}
 	return nil
 }
 
-// GetWheelTaskQuantity :check tasks number in the time wheel at the moment
-func (om *OrderManager) GetWheelTaskQuantity(index int64) int64 {
-	orders := om.TimeWheel[index].NotifyActivities
-	if orders == nil {
-		return 0
+// expireDueOrders 领取一批到期的订单并完成过期处理, 返回领取的订单数
+func (om *OrderManager) expireDueOrders() (int, error) {
+	claim, err := om.claimDueOrders(time.Now(), ExpiryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(claim.items) == 0 {
+		return 0, nil
 	}
-	var orderNum int64
-	for p := orders; p != nil; p = p.Next {
-		orderNum++
+
+	orderIDs := make([]string, 0, len(claim.items))
+	for _, item := range claim.items {
+		orderIDs = append(orderIDs, item.OrderID)
 	}
-	return orderNum
+	// 数据库更新失败时不确认, 租约到期后重新领取
+	orders, transitioned, err := om.expireOrders(orderIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	events := expiryEvents(claim.items, orders, transitioned)
+	if err := om.completeClaim(claim, events); err != nil {
+		return 0, err
+	}
+	return len(claim.items), nil
 }
 
-// updateOrderState : handler function by sql transaction
-func (om *OrderManager) updateOrderState(orderId string, collectionAddr string) error {
-	// update orders status to expired
-	if err := om.updateOrdersStatus(orderId, multi.OrderStatusExpired); err != nil {
-		return errors.Wrap(err, "failed on update activities status")
+// claimDueOrders 领取过期时间不晚于now的订单
+func (om *OrderManager) claimDueOrders(now time.Time, limit int) (*expiryClaim, error) {
+	claim := &expiryClaim{leaseID: strings.ReplaceAll(uuid.NewString(), "-", "")}
+	keys := []string{genOrderExpiryCacheKey(om.chain), genOrderExpiryLeaseCacheKey(om.chain), genOrderExpiryOwnerCacheKey(om.chain)}
+	resp, err := om.Xkv.Redis.EvalCtx(om.Ctx, claimExpiryScript, keys,
+		now.Unix(), now.UnixMilli(), now.Add(ExpiryLease).UnixMilli(), limit, claim.leaseID)
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on claim expired orders")
 	}
 
-	// update floor price
-	if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-		EventType:      Expired,
-		OrderId:        orderId,
-		CollectionAddr: collectionAddr,
-	}); err != nil {
-		return errors.Wrap(err, "failed on add update floor price event")
+	values, _ := resp.([]interface{})
+	for i := 0; i+1 < len(values); i += 2 {
+		member, _ := values[i].(string)
+		item, ok := parseExpiryMember(member)
+		if !ok {
+			xzap.WithContext(om.Ctx).Warn("[Order Manage] invalid order expiry member", zap.String("member", member))
+			continue
+		}
+		attempt, _ := values[i+1].(string)
+		item.Attempt, _ = strconv.ParseInt(attempt, 10, 64)
+		claim.items = append(claim.items, item)
 	}
+	return claim, nil
+}
 
+// completeClaim 确认领取的订单并推送对应的地板价事件
+func (om *OrderManager) completeClaim(claim *expiryClaim, events map[string]*TradeEvent) error {
+	args := []interface{}{claim.leaseID, xkv.DefaultStreamMaxLen}
+	for _, item := range claim.items {
+		rawEvent := ""
+		if event, ok := events[item.OrderID]; ok {
+			raw, err := json.Marshal(event)
+			if err != nil {
+				return errors.Wrap(err, "failed on marshal event")
+			}
+			rawEvent = string(raw)
+		}
+		args = append(args, item.member(), rawEvent)
+	}
+
+	keys := []string{genOrderExpiryLeaseCacheKey(om.chain), genOrderExpiryOwnerCacheKey(om.chain), GenTradeEventsStreamKey(om.chain)}
+	resp, err := om.Xkv.Redis.EvalCtx(om.Ctx, completeExpiryScript, keys, args...)
+	if err != nil && err != redis.Nil {
+		return errors.Wrap(err, "failed on complete expired orders")
+	}
+	if done, _ := resp.(int64); int(done) < len(claim.items) {
+		xzap.WithContext(om.Ctx).Warn("[Order Manage] order expiry lease lost, orders left to new owner",
+			zap.Int("claimed", len(claim.items)), zap.Int64("completed", done))
+	}
 	return nil
 }
 
-func (om *OrderManager) updateOrdersStatus(orderID string, orderStatus int) error {
-	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
-		Where("order_id = ?", orderID).Update("order_status", orderStatus).Error; err != nil {
-		return errors.Wrap(err, "failed on update expired orders status")
+// expireOrders 在一个事务中将活跃订单更新为过期
+// 返回这些订单中状态为活跃或过期的订单, 以及本次由活跃更新为过期的订单
+func (om *OrderManager) expireOrders(orderIDs []string) (map[string]*multi.Order, map[string]bool, error) {
+	orders := make(map[string]*multi.Order)
+	transitioned := make(map[string]bool)
+	err := om.DB.WithContext(om.Ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []*multi.Order
+		if err := tx.Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("order_id, collection_address, token_id, maker, order_status").
+			Where("order_id in (?) and order_status in (?)", orderIDs, []int{multi.OrderStatusActive, multi.OrderStatusExpired}).
+			Scan(&rows).Error; err != nil {
+			return errors.Wrap(err, "failed on get expired orders")
+		}
+
+		var activeIDs []string
+		for _, row := range rows {
+			orders[row.OrderID] = row
+			if row.OrderStatus == multi.OrderStatusActive {
+				activeIDs = append(activeIDs, row.OrderID)
+			}
+		}
+		if len(activeIDs) == 0 {
+			return nil
+		}
+
+		if err := tx.Table(gdb.GetMultiProjectOrderTableName(om.project, om.chain)).
+			Where("order_id in (?) and order_status = ?", activeIDs, multi.OrderStatusActive).
+			Update("order_status", multi.OrderStatusExpired).Error; err != nil {
+			return errors.Wrap(err, "failed on update expired orders status")
+		}
+		for _, orderID := range activeIDs {
+			transitioned[orderID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
+	return orders, transitioned, nil
+}
 
-	return nil
+// expiryEvents 需要推送Expired事件的订单
+// 本次更新为过期的订单推送事件; 重新领取的订单若已是过期状态, 说明之前的领取者更新了状态但未推送, 同样推送
+// 已成交或取消的订单不推送
+func expiryEvents(items []expiryItem, orders map[string]*multi.Order, transitioned map[string]bool) map[string]*TradeEvent {
+	events := make(map[string]*TradeEvent)
+	for _, item := range items {
+		order, ok := orders[item.OrderID]
+		if !ok {
+			continue
+		}
+		if !transitioned[item.OrderID] && (item.Attempt <= 1 || order.OrderStatus != multi.OrderStatusExpired) {
+			continue
+		}
+
+		collectionAddr := order.CollectionAddress
+		if collectionAddr == "" {
+			collectionAddr = item.CollectionAddr
+		}
+		events[item.OrderID] = &TradeEvent{
+			EventType:      Expired,
+			CollectionAddr: collectionAddr,
+			TokenID:        order.TokenId,
+			OrderId:        item.OrderID,
+			From:           order.Maker,
+		}
+	}
+	return events
 }
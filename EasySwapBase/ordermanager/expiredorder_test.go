@@ -0,0 +1,44 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+)
+
+func TestExpiryMember(t *testing.T) {
+	item := expiryItem{OrderID: "0xabc", CollectionAddr: "0xDEF"}
+	assert.Equal(t, "0xabc:0xdef", item.member())
+
+	parsed, ok := parseExpiryMember(item.member())
+	assert.True(t, ok)
+	assert.Equal(t, "0xabc", parsed.OrderID)
+	assert.Equal(t, "0xdef", parsed.CollectionAddr)
+
+	_, ok = parseExpiryMember("0xabc")
+	assert.False(t, ok)
+}
+
+func TestExpiryEvents(t *testing.T) {
+	items := []expiryItem{
+		{OrderID: "1", CollectionAddr: "0xc", Attempt: 1}, // 本次更新为过期
+		{OrderID: "2", CollectionAddr: "0xc", Attempt: 1}, // 已被其他途径更新为过期
+		{OrderID: "3", CollectionAddr: "0xc", Attempt: 2}, // 之前的领取者更新了状态但未推送事件
+		{OrderID: "4", CollectionAddr: "0xc", Attempt: 2}, // 已成交或取消, 查询时已过滤
+	}
+	orders := map[string]*multi.Order{
+		"1": {OrderID: "1", CollectionAddress: "0xc", TokenId: "10", Maker: "0xm", OrderStatus: multi.OrderStatusActive},
+		"2": {OrderID: "2", CollectionAddress: "0xc", OrderStatus: multi.OrderStatusExpired},
+		"3": {OrderID: "3", OrderStatus: multi.OrderStatusExpired},
+	}
+	transitioned := map[string]bool{"1": true}
+
+	events := expiryEvents(items, orders, transitioned)
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, &TradeEvent{EventType: Expired, CollectionAddr: "0xc", TokenID: "10", OrderId: "1", From: "0xm"}, events["1"])
+	assert.Equal(t, Expired, events["3"].EventType)
+	assert.Equal(t, "0xc", events["3"].CollectionAddr)
+}
@@ -1,14 +1,13 @@
 package ordermanager
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/stores/redis"
 	"go.uber.org/zap"
 
 	"github.com/ProjectsTask/EasySwapBase/stores/gdb"
@@ -29,6 +28,9 @@ const (
 	Expired          EventType = 9
 	ImportCollection EventType = 10
 	UpdateCollection EventType = 11
+	Bid              EventType = 12 // 新的出价订单
+	BidFill          EventType = 13 // 出价订单成交, 剩余数量变化
+	Inactive         EventType = 14 // 订单因NFT转出、取消授权或余额不足无法成交, 恢复后以Listing或Bid事件重新加入
 )
 
 const (
@@ -36,11 +38,17 @@ const (
 	maxQueueLength = 100
 )
 
-const CacheTradeEventsQueuePre = "cache:es:trade:events:%s"
+const (
+	CacheTradeEventsQueuePre = "cache:es:trade:events:%s" // 旧版本使用的列表队列, 启动时转入TradeEventsStreamPre
+	TradeEventsStreamPre     = "stream:es:trade:events:%s"
+	TradeEventsConsumerGroup = "floorprice"
+)
 
 type collectionTradeInfo struct {
 	floorPrice decimal.Decimal
 	orders     *PriorityQueueMap // 优先级队列
+	bids       *bidBook          // 最高出价
+	depth      *depthBook        // 按价格聚合的深度
 }
 
 type TradeEvent struct {
@@ -56,182 +64,237 @@ type TradeEvent struct {
 }
 
 func (om *OrderManager) floorPriceProcess() {
-	// 清空缓存中的剩余事件
-	key := genTradeEventsCacheKey(om.chain)
-	if err := om.Xkv.Redis.Ltrim(key, 1, 0); err != nil { // clear all value
-		xzap.WithContext(om.Ctx).Error("failed on flush remaining trade events", zap.Error(err))
-	}
-
 	// 从数据库加载订单并更新地板价
 	if err := om.loadCollectionTradeInfo(); err != nil {
 		xzap.WithContext(om.Ctx).Error("[Order Manage] load orders to queue", zap.Error(err))
 		return
 	}
+	if err := om.loadCollectionBids(); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] load collection bids", zap.Error(err))
+		return
+	}
+	om.saveDepthSnapshots()
 
-	// 持续监听并处理交易事件
-	for {
-		// 从缓存中获取交易事件
-		result, err := om.Xkv.Lpop(key)
-		if err != nil || result == "" {
-			if err != nil && err != redis.Nil {
-				xzap.WithContext(om.Ctx).Warn("failed on get trade events from cache", zap.Error(err), zap.String("result", result))
-			}
-			time.Sleep(1 * time.Second)
-			continue
+	// 停机期间积压的事件保留在队列中, 启动后继续处理
+	if err := om.tradeEvents.EnsureGroup(om.Ctx, xkv.StreamOffsetBegin); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on create trade events group", zap.Error(err))
+		return
+	}
+	if om.tradeEventsReplay != "" {
+		if err := om.tradeEvents.Replay(om.Ctx, om.tradeEventsReplay); err != nil {
+			xzap.WithContext(om.Ctx).Error("[Order Manage] failed on replay trade events", zap.Error(err))
+			return
 		}
+		xzap.WithContext(om.Ctx).Info("[Order Manage] replay trade events", zap.String("offset", om.tradeEventsReplay))
+	}
+	om.drainLegacyQueue(genTradeEventsCacheKey(om.chain), om.tradeEvents, true)
 
-		xzap.WithContext(om.Ctx).Info("get trade events from cache", zap.String("event content", result))
-		// 解析事件内容
-		var event TradeEvent
-		if err := json.Unmarshal([]byte(result), &event); err != nil {
-			xzap.WithContext(om.Ctx).Warn("failed on unmarshal trade event info", zap.Error(err))
-			continue
-		}
+	// 持续监听并处理交易事件
+	om.consumeStream(om.tradeEvents, om.handleTradeEvent)
+}
 
-		// 检查collection是否被跟踪
-		tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
-		if !ok && event.EventType != ImportCollection { //
-			xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", event.CollectionAddr))
-			continue
-		}
+// handleTradeEvent 处理一条交易事件, 返回错误时事件不确认, 等待重新投递
+func (om *OrderManager) handleTradeEvent(result string) error {
+	xzap.WithContext(om.Ctx).Info("get trade events from cache", zap.String("event content", result))
+	// 解析事件内容
+	var event TradeEvent
+	if err := json.Unmarshal([]byte(result), &event); err != nil {
+		return errors.Wrap(errPoisonMessage, "failed on unmarshal trade event info: "+err.Error())
+	}
+
+	// 检查collection是否被跟踪
+	tradeInfo, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]
+	if !ok && event.EventType != ImportCollection { //
+		xzap.WithContext(om.Ctx).Warn("untracked collection", zap.String("collection_addr", event.CollectionAddr))
+		return nil
+	}
+
+	// 通知collection状态更新
+	if event.CollectionAddr != "" {
+		om.collectionListedCh <- event.CollectionAddr
+	}
 
-		// 通知collection状态更新
-		if event.CollectionAddr != "" {
-			om.collectionListedCh <- event.CollectionAddr
+	// 根据不同事件类型处理
+	switch event.EventType {
+	case Listing: // 上架事件
+		// 按数据库中订单的最新状态处理, 事件可能重复投递或晚于取消、成交、转移事件到达
+		if err := om.refreshListing(tradeInfo, event.CollectionAddr, event.OrderId); err != nil {
+			return errors.Wrap(err, "failed on refresh collection listing")
+		}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on update collection floor price")
 		}
 
-		// 根据不同事件类型处理
-		switch event.EventType {
-		case Listing: // 上架事件
-			// 只有当价格低于队列最高价或队列为空时才添加订单
-			_, price := tradeInfo.orders.GetMax()
-			if price.GreaterThan(event.Price) || tradeInfo.orders.Len() == 0 {
-				tradeInfo.orders.Add(event.OrderId, event.Price, event.From, event.TokenID)
-			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
+	case Cancel, Expired, Inactive: // 取消、过期或失效事件
+		// 取消、过期或失效的是出价订单时更新最高出价
+		if err := om.removeBid(event.CollectionAddr, event.OrderId); err != nil {
+			return errors.Wrap(err, "failed on remove collection bid")
+		}
+		// 从队列中删除订单
+		tradeInfo.orders.Remove(event.OrderId)
+		tradeInfo.depth.Remove(event.OrderId)
+		if tradeInfo.orders.Len() == 0 {
+			// 队列为空时重新加载订单
+			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+				return errors.Wrap(err, "failed on reload orders at the lowest price")
 			}
+		}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on update collection floor price")
+		}
 
-		case Cancel, Expired: // 取消或过期事件
-			// 从队列中删除订单
+	case Buy, Transfer: // 购买或转移事件
+		// 如果是购买事件,从队列中删除订单
+		if event.EventType == Buy {
 			tradeInfo.orders.Remove(event.OrderId)
-			if tradeInfo.orders.Len() == 0 {
-				// 队列为空时重新加载订单
-				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
+			tradeInfo.depth.Remove(event.OrderId)
+		}
+		// 卖家对该NFT的挂单失效, 买家之前的挂单恢复有效
+		if err := om.updateDepthOwner(tradeInfo, event.CollectionAddr, event.TokenID, event.From, event.To); err != nil {
+			return errors.Wrap(err, "failed on update collection depth")
+		}
+
+		// 检查队列是否为空,为空则重新加载订单
+		if tradeInfo.orders.Len() == 0 {
+			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+				return errors.Wrap(err, "failed on reload orders at the lowest price")
 			}
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr),
-					zap.Error(err))
+		} else {
+			// 移除卖家的所有订单
+			tradeInfo.orders.RemoveMakerOrders(event.From, event.TokenID)
+			// 获取买家的有效订单
+			orders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, event.To)
+			if err != nil {
+				return errors.Wrap(err, "failed on get users valid orders")
 			}
 
-		case Buy, Transfer: // 购买或转移事件
-			// 如果是购买事件,从队列中删除订单
-			if event.EventType == Buy {
-				tradeInfo.orders.Remove(event.OrderId)
+			// 添加买家的有效订单到队列
+			for _, order := range orders {
+				if !order.IsOpenseaBanned {
+					_, maxPrice := tradeInfo.orders.GetMax()
+					if maxPrice.GreaterThan(order.Price) {
+						tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+					}
+				}
 			}
 
-			// 检查队列是否为空,为空则重新加载订单
+			// 如果队列为空,重新加载订单
 			if tradeInfo.orders.Len() == 0 {
 				if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-					continue
-				}
-			} else {
-				// 移除卖家的所有订单
-				tradeInfo.orders.RemoveMakerOrders(event.From, event.TokenID)
-				// 获取买家的有效订单
-				orders, err := om.getUserValidOrders(event.CollectionAddr, event.TokenID, event.To)
-				if err != nil {
-					xzap.WithContext(om.Ctx).Error("failed on get users valid orders",
-						zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-						zap.String("collection_addr", event.CollectionAddr),
-						zap.String("from", event.From), zap.String("to", event.To),
-						zap.Error(err))
-					continue
+					return errors.Wrap(err, "failed on reload orders at the lowest price")
 				}
+			}
+		}
 
-				// 添加买家的有效订单到队列
-				for _, order := range orders {
-					if !order.IsOpenseaBanned {
-						_, maxPrice := tradeInfo.orders.GetMax()
-						if maxPrice.GreaterThan(order.Price) {
-							tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
-						}
-					}
-				}
+		// 更新地板价
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on update collection floor price")
+		}
 
-				// 如果队列为空,重新加载订单
-				if tradeInfo.orders.Len() == 0 {
-					if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-						xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-							zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-							zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-						continue
-					}
-				}
-			}
+	case Bid, BidFill: // 出价或出价成交事件
+		// 按订单最新状态更新最高出价
+		if err := om.refreshBid(event.CollectionAddr, event.OrderId); err != nil {
+			return errors.Wrap(err, "failed on refresh collection bid")
+		}
 
-			// 更新地板价
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	case ImportCollection: // 导入新的Collection事件
+		// 检查Collection是否已存在
+		if _, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]; ok {
+			xzap.WithContext(om.Ctx).Warn("import collection repeated",
+				zap.String("collection_addr", event.CollectionAddr))
+			return nil
+		}
 
-		case ImportCollection: // 导入新的Collection事件
-			// 检查Collection是否已存在
-			if _, ok := om.collectionOrders[strings.ToLower(event.CollectionAddr)]; ok {
-				xzap.WithContext(om.Ctx).Warn("import collection repeated",
-					zap.String("collection_addr", event.CollectionAddr))
-				continue
-			}
+		// 初始化新的Collection信息
+		om.collectionOrders[strings.ToLower(event.CollectionAddr)] = &collectionTradeInfo{
+			floorPrice: decimal.Zero,
+			orders:     NewPriorityQueueMap(maxQueueLength),
+			bids:       newBidBook(),
+			depth:      newDepthBook(),
+		}
 
-			// 初始化新的Collection信息
-			om.collectionOrders[strings.ToLower(event.CollectionAddr)] = &collectionTradeInfo{
-				floorPrice: decimal.Zero,
-				orders:     NewPriorityQueueMap(maxQueueLength),
-			}
+	case UpdateCollection: // 更新Collection事件
+		// 检查地板价是否变化
+		_, floorPrice := tradeInfo.orders.GetMin()
+		if floorPrice.Equal(event.Price) {
+			return nil
+		}
 
-		case UpdateCollection: // 更新Collection事件
-			// 检查地板价是否变化
-			_, floorPrice := tradeInfo.orders.GetMin()
-			if floorPrice.Equal(event.Price) {
-				continue
-			}
+		// 重新加载订单并更新地板价
+		if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on reload orders at the lowest price")
+		}
+		if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
+			return errors.Wrap(err, "failed on update collection floor price")
+		}
 
-			// 重新加载订单并更新地板价
-			if err := om.reloadCollectionOrders(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on reload orders at the lowest price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.Error(err))
-				continue
-			}
-			if err := om.checkAndUpdateFloorPrice(event.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update collection floor price",
-					zap.Int("event_type", int(event.EventType)), zap.String("order_id", event.OrderId),
-					zap.String("collection_addr", event.CollectionAddr), zap.String("floor_price", event.Price.String()),
-					zap.Error(err))
-			}
+	default:
+		return errors.Wrapf(errPoisonMessage, "unsupported event type %d", event.EventType)
+	}
+
+	// 发布深度变化
+	if err := om.publishDepth(event.CollectionAddr); err != nil {
+		return errors.Wrap(err, "failed on publish collection depth")
+	}
+	if isPublicTradeEvent(event.EventType) {
+		om.publishMarketEvent(&MarketEvent{Type: MarketEventTrade, CollectionAddr: event.CollectionAddr, Trade: &event})
+	}
+	return nil
+}
 
-		default:
-			xzap.WithContext(om.Ctx).Error("unsupported event type", zap.String("event content", result))
+// updateDepthOwner NFT从from转给to后更新深度中双方的挂单
+func (om *OrderManager) updateDepthOwner(tradeInfo *collectionTradeInfo, collectionAddr, tokenID, from, to string) error {
+	tradeInfo.depth.RemoveMakerAsks(from, tokenID)
+	if to == "" {
+		return nil
+	}
+
+	orders, err := om.getUserValidOrders(collectionAddr, tokenID, to)
+	if err != nil {
+		return errors.Wrap(err, "failed on get users valid orders")
+	}
+	for _, order := range orders {
+		if !order.IsOpenseaBanned {
+			tradeInfo.depth.Upsert(order.OrderID, DepthSideAsk, order.Price, 1, order.Maker, order.TokenId)
+		}
+	}
+	return nil
+}
+
+// refreshListing 按数据库中订单的最新状态更新挂单, 订单不再有效或maker不再持有NFT时从队列中删除
+func (om *OrderManager) refreshListing(tradeInfo *collectionTradeInfo, collectionAddr, orderID string) error {
+	var orders []*ValidOrder
+	if err := om.DB.WithContext(om.Ctx).Table(fmt.Sprintf("%s as co", gdb.GetMultiProjectOrderTableName(om.project, om.chain))).
+		Select("co.order_id as order_id, co.maker as maker, ci.is_opensea_banned as is_opensea_banned, co.price as price, co.token_id as token_id").
+		Joins(fmt.Sprintf("join %s ci on co.collection_address = ci.collection_address and co.token_id = ci.token_id", gdb.GetMultiProjectItemTableName(om.project, om.chain))).
+		Where("co.order_type=? and co.order_status = ? and co.maker = ci.owner  and (ci.is_opensea_banned,co.marketplace_id)!=(true,1)", multi.ListingType, multi.OrderStatusActive).
+		Where("co.collection_address = ? and co.order_id = ?", collectionAddr, orderID).
+		Limit(1).
+		Scan(&orders).Error; err != nil {
+		return errors.Wrap(err, "failed on get listing order")
+	}
+
+	if len(orders) == 0 {
+		tradeInfo.orders.Remove(orderID)
+		tradeInfo.depth.Remove(orderID)
+		if tradeInfo.orders.Len() == 0 {
+			return om.reloadCollectionOrders(collectionAddr)
 		}
+		return nil
+	}
+
+	order := orders[0]
+	// 重复投递时先删除已有的订单, 避免队列中出现重复项
+	tradeInfo.orders.Remove(order.OrderID)
+	// 只有当价格低于队列最高价或队列为空时才添加订单
+	_, price := tradeInfo.orders.GetMax()
+	if price.GreaterThan(order.Price) || tradeInfo.orders.Len() == 0 {
+		tradeInfo.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
 	}
+	tradeInfo.depth.Upsert(order.OrderID, DepthSideAsk, order.Price, 1, order.Maker, order.TokenId)
+	return nil
 }
 
 // loadCollectionTradeInfo 函数主要负责初始化和加载集合(Collection)的交易信息,主要包含以下步骤:
@@ -249,6 +312,8 @@ func (om *OrderManager) loadCollectionTradeInfo() error {
 		om.collectionOrders[strings.ToLower(collection.Address)] = &collectionTradeInfo{
 			floorPrice: collection.FloorPrice,
 			orders:     NewPriorityQueueMap(maxQueueLength), // 优先级队列,限制最大长度
+			bids:       newBidBook(),
+			depth:      newDepthBook(),
 		}
 	}
 
@@ -286,6 +351,7 @@ func (om *OrderManager) loadCollectionTradeInfo() error {
 			continue
 		}
 		ordersQueue.orders.Add(order.OrderID, order.Price, order.Maker, order.TokenId)
+		ordersQueue.depth.Upsert(order.OrderID, DepthSideAsk, order.Price, 1, order.Maker, order.TokenId)
 	}
 
 	// 4. 检查并更新每个集合的地板价
@@ -332,6 +398,7 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 	// 3. 如果最低价格发生变化,则更新地板价
 	if !newFloorPrice.Equal(tradeInfo.floorPrice) {
 		// 更新内存缓存中的地板价
+		prevFloorPrice := tradeInfo.floorPrice
 		tradeInfo.floorPrice = newFloorPrice
 		om.collectionOrders[strings.ToLower(address)] = tradeInfo
 
@@ -343,6 +410,14 @@ func (om *OrderManager) checkAndUpdateFloorPrice(address string) error {
 		// 记录地板价更新日志
 		xzap.WithContext(om.Ctx).Info("update collection floor price",
 			zap.String("collection_addr", address), zap.String("floor_price", newFloorPrice.String()))
+
+		// 推送地板价变化
+		om.publishMarketEvent(&MarketEvent{
+			Type:           MarketEventFloorPrice,
+			CollectionAddr: address,
+			FloorPrice:     newFloorPrice,
+			PrevFloorPrice: prevFloorPrice,
+		})
 	}
 	return nil
 }
@@ -474,10 +549,8 @@ func (om *OrderManager) addUpdateFloorPriceEvent(event *TradeEvent) error {
 		return errors.Wrap(err, "failed on marshal event")
 	}
 
-	// 获取Redis队列key
-	key := genTradeEventsCacheKey(om.chain)
 	// 将事件添加到Redis队列
-	if _, err := om.Xkv.Rpush(key, string(rawEvent)); err != nil {
+	if _, err := om.tradeEvents.Add(om.Ctx, string(rawEvent)); err != nil {
 		return errors.Wrap(err, "failed on push trade event to queue")
 	}
 	return nil
@@ -487,6 +560,10 @@ func genTradeEventsCacheKey(chain string) string {
 	return fmt.Sprintf(CacheTradeEventsQueuePre, chain)
 }
 
+func GenTradeEventsStreamKey(chain string) string {
+	return fmt.Sprintf(TradeEventsStreamPre, chain)
+}
+
 // AddUpdatePriceEvent 函数用于添加更新价格的事件
 // 主要功能:
 // 1. 验证事件的合法性:
@@ -521,10 +598,8 @@ func AddUpdatePriceEvent(kv *xkv.Store, event *TradeEvent, chain string) error {
 		return errors.Wrap(err, "failed on marshal event")
 	}
 
-	// 获取Redis队列key
-	key := genTradeEventsCacheKey(chain)
 	// 将事件添加到Redis队列
-	if _, err := kv.Rpush(key, string(rawEvent)); err != nil {
+	if _, err := kv.AddStream(context.Background(), GenTradeEventsStreamKey(chain), string(rawEvent)); err != nil {
 		return errors.Wrap(err, "failed on push trade event to queue")
 	}
 	return nil
@@ -0,0 +1,77 @@
+package ordermanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+)
+
+const (
+	MarketEventsStreamPre = "stream:es:market:events:%s"
+
+	MarketEventTrade      = "trade"       // 交易事件处理完成
+	MarketEventFloorPrice = "floor_price" // 地板价变化
+)
+
+func GenMarketEventsStreamKey(chain string) string {
+	return fmt.Sprintf(MarketEventsStreamPre, strings.ToLower(chain))
+}
+
+// MarketEvent order manager处理交易事件后发布的市场事件, 供推送服务订阅
+type MarketEvent struct {
+	Type           string          `json:"type"`
+	CollectionAddr string          `json:"collection_addr"`
+	Trade          *TradeEvent     `json:"trade,omitempty"`
+	FloorPrice     decimal.Decimal `json:"floor_price"`
+	PrevFloorPrice decimal.Decimal `json:"prev_floor_price"`
+	EventTime      int64           `json:"event_time"` // 单位毫秒
+}
+
+// Topics 事件所属的订阅主题
+func (e *MarketEvent) Topics() []string {
+	collection := strings.ToLower(e.CollectionAddr)
+	if e.Type == MarketEventFloorPrice {
+		return []string{"floor:" + collection}
+	}
+
+	topics := []string{"collection:" + collection}
+	if e.Trade == nil {
+		return topics
+	}
+	if e.Trade.TokenID != "" {
+		topics = append(topics, "item:"+collection+":"+e.Trade.TokenID)
+	}
+	from, to := strings.ToLower(e.Trade.From), strings.ToLower(e.Trade.To)
+	if from != "" {
+		topics = append(topics, "address:"+from)
+	}
+	if to != "" && to != from {
+		topics = append(topics, "address:"+to)
+	}
+	return topics
+}
+
+// isPublicTradeEvent 对外推送的交易事件, 内部的collection维护事件不推送
+func isPublicTradeEvent(eventType EventType) bool {
+	return eventType != ImportCollection && eventType != UpdateCollection
+}
+
+// publishMarketEvent 发布市场事件, 推送失败不影响交易事件的处理
+func (om *OrderManager) publishMarketEvent(event *MarketEvent) {
+	event.EventTime = time.Now().UnixMilli()
+	raw, err := json.Marshal(event)
+	if err != nil {
+		xzap.WithContext(om.Ctx).Warn("failed on marshal market event", zap.Error(err))
+		return
+	}
+	if _, err := om.Xkv.AddStream(om.Ctx, GenMarketEventsStreamKey(om.chain), string(raw)); err != nil {
+		xzap.WithContext(om.Ctx).Warn("failed on publish market event", zap.Error(err),
+			zap.String("type", event.Type), zap.String("collection_addr", event.CollectionAddr))
+	}
+}
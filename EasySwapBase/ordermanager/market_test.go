@@ -0,0 +1,19 @@
+package ordermanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarketEventTopics(t *testing.T) {
+	event := &MarketEvent{Type: MarketEventFloorPrice, CollectionAddr: "0xC"}
+	assert.Equal(t, []string{"floor:0xc"}, event.Topics())
+
+	event = &MarketEvent{Type: MarketEventTrade, CollectionAddr: "0xC", Trade: &TradeEvent{TokenID: "1", From: "0xA", To: "0xB"}}
+	assert.Equal(t, []string{"collection:0xc", "item:0xc:1", "address:0xa", "address:0xb"}, event.Topics())
+
+	// 集合维护事件没有token和地址
+	event = &MarketEvent{Type: MarketEventTrade, CollectionAddr: "0xc", Trade: &TradeEvent{From: "0xa", To: "0xA"}}
+	assert.Equal(t, []string{"collection:0xc", "address:0xa"}, event.Topics())
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
-	"github.com/zeromicro/go-zero/core/stores/redis"
 	"github.com/zeromicro/go-zero/core/threading"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -20,49 +19,32 @@ import (
 )
 
 const (
-	// WheelSize : length of time wheel, 1s for a unit, 1h for a cycle
-	WheelSize           = 3600
 	List                = 3
-	CacheOrdersQueuePre = "cache:es:orders:%s"
+	CacheOrdersQueuePre = "cache:es:orders:%s" // 旧版本使用的列表队列, 启动时转入OrdersStreamPre
+	OrdersStreamPre     = "stream:es:orders:%s"
+	OrdersConsumerGroup = "listing"
 )
 
 func GenOrdersCacheKey(chain string) string {
 	return fmt.Sprintf(CacheOrdersQueuePre, chain)
 }
 
-// Activity ：collection order-activity
-type Order struct {
-	// order Id
-	orderID        string
-	CollectionAddr string
-	// chain suffix name: ethw/bsc
-	ChainSuffix string
-	// expireIn - createIn (unit: s)
-	CycleCount int64
-	// position of the task on the time wheel
-	WheelPosition int64
-
-	Next *Order
-}
-
-type wheel struct {
-	// linked list
-	NotifyActivities *Order
+func GenOrdersStreamKey(chain string) string {
+	return fmt.Sprintf(OrdersStreamPre, chain)
 }
 
 type OrderManager struct {
 	chain string
 
-	// cycle time wheel
-	TimeWheel [WheelSize]wheel
-	// current time wheel index
-	CurrentIndex int64
-
 	collectionOrders map[string]*collectionTradeInfo
 
 	collectionListedCh chan string
 	project            string
 
+	listings          *xkv.Stream // 新挂单队列
+	tradeEvents       *xkv.Stream // 地板价更新事件队列
+	tradeEventsReplay string      // 启动时从该位置重新消费交易事件
+
 	Xkv *xkv.Store
 	DB  *gorm.DB
 	Ctx context.Context
@@ -80,9 +62,17 @@ func New(ctx context.Context, db *gorm.DB, xkv *xkv.Store, chain string, project
 		collectionOrders:   make(map[string]*collectionTradeInfo),
 		collectionListedCh: make(chan string, 1000),
 		project:            project,
+		listings:           xkv.NewStream(GenOrdersStreamKey(chain), OrdersConsumerGroup, ""),
+		tradeEvents:        xkv.NewStream(GenTradeEventsStreamKey(chain), TradeEventsConsumerGroup, ""),
 	}
 }
 
+// ReplayTradeEventsFrom 启动时将交易事件的消费位置重置到offset(消息id, "0"为从头开始), 用于修复地板价
+func (om *OrderManager) ReplayTradeEventsFrom(offset string) *OrderManager {
+	om.tradeEventsReplay = offset
+	return om
+}
+
 func (om *OrderManager) Start() {
 	// listen redis cache
 	threading.GoSafe(om.ListenNewListingLoop) // 处理新订单
@@ -101,78 +91,70 @@ type ListingInfo struct {
 	TokenID        string          `json:"token_id"`
 	Price          decimal.Decimal `json:"price"`
 	Maker          string          `json:"maker"`
+	OrderType      int64           `json:"order_type,omitempty"` // 旧版本的消息没有订单类型, 按挂单处理
 }
 
 func (om *OrderManager) ListenNewListingLoop() {
-	key := GenOrdersCacheKey(om.chain)
-	for {
-		result, err := om.Xkv.Lpop(key)
-		if err != nil || result == "" {
-			if err != nil && err != redis.Nil {
-				xzap.WithContext(context.Background()).Warn("failed on get order from cache", zap.Error(err), zap.String("result", result))
-			}
-			time.Sleep(1 * time.Second)
-			continue
-		}
+	if err := om.listings.EnsureGroup(om.Ctx, xkv.StreamOffsetBegin); err != nil {
+		xzap.WithContext(om.Ctx).Error("[Order Manage] failed on create listings group", zap.Error(err))
+		return
+	}
+	om.drainLegacyQueue(GenOrdersCacheKey(om.chain), om.listings, false)
 
-		xzap.WithContext(om.Ctx).Info("get listing from cache", zap.String("result", result))
-		var listing ListingInfo
-		if err := json.Unmarshal([]byte(result), &listing); err != nil {
-			xzap.WithContext(om.Ctx).Warn("failed on Unmarshal order info", zap.Error(err))
-			continue
-		}
-		if listing.OrderId == "" {
-			xzap.WithContext(om.Ctx).Error("invalid null order id")
-			continue
-		}
+	om.consumeStream(om.listings, om.handleNewListing)
+}
+
+// handleNewListing 处理一条新挂单, 返回错误时不确认, 等待重新投递
+func (om *OrderManager) handleNewListing(result string) error {
+	xzap.WithContext(om.Ctx).Info("get listing from cache", zap.String("result", result))
+	var listing ListingInfo
+	if err := json.Unmarshal([]byte(result), &listing); err != nil {
+		return errors.Wrap(errPoisonMessage, "failed on Unmarshal order info: "+err.Error())
+	}
+	if listing.OrderId == "" {
+		return errors.Wrap(errPoisonMessage, "invalid null order id")
+	}
 
-		if listing.ExpireIn < time.Now().Unix() { // 订单已经过期
-			xzap.WithContext(om.Ctx).Info("expired activity order", zap.String("order_id", listing.OrderId))
-
-			// 更新订单状态
-			if err := om.updateOrdersStatus(listing.OrderId, multi.OrderStatusExpired); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on update activity status", zap.String("order_id", listing.OrderId), zap.Error(err))
-			}
-
-			// 添加更新floorprice事件
-			if err := om.addUpdateFloorPriceEvent(&TradeEvent{
-				EventType:      Expired,
-				CollectionAddr: listing.CollectionAddr,
-				TokenID:        listing.TokenID,
-				OrderId:        listing.OrderId,
-				From:           listing.Maker,
-			}); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on add update floor price event", zap.String("order_id", listing.OrderId), zap.Error(err))
-			}
-			continue
-		} else { // 订单未过期
-			if err := om.addUpdateFloorPriceEvent(&TradeEvent{ // 添加更新floorprice事件
-				EventType:      Listing,
-				CollectionAddr: listing.CollectionAddr,
-				TokenID:        listing.TokenID,
-				OrderId:        listing.OrderId,
-				Price:          listing.Price,
-				From:           listing.Maker,
-			}); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on push order to update price queue", zap.Error(err), zap.String("order_id", listing.OrderId),
-					zap.String("order_id", listing.OrderId),
-					zap.String("price", listing.Price.String()),
-					zap.String("chain", om.chain))
-			}
-
-			// 添加到订单过期检查队列
-			delaySeconds := listing.ExpireIn - time.Now().Unix()
-			if err := om.addToOrderExpiryCheckQueue(delaySeconds, om.chain, listing.OrderId, listing.CollectionAddr); err != nil {
-				xzap.WithContext(om.Ctx).Error("failed on push order to expired check queue", zap.Error(err), zap.String("order_id", listing.OrderId),
-					zap.String("chain", om.chain))
-			}
+	eventType := Listing
+	if listing.OrderType == multi.CollectionBidOrder || listing.OrderType == multi.ItemBidOrder {
+		eventType = Bid
+	}
+	if listing.ExpireIn >= time.Now().Unix() { // 订单未过期
+		if err := om.addUpdateFloorPriceEvent(&TradeEvent{ // 添加更新floorprice或最高出价事件
+			EventType:      eventType,
+			CollectionAddr: listing.CollectionAddr,
+			TokenID:        listing.TokenID,
+			OrderId:        listing.OrderId,
+			Price:          listing.Price,
+			From:           listing.Maker,
+		}); err != nil {
+			return errors.Wrap(err, "failed on push order to update price queue")
 		}
 	}
+
+	// 添加到订单过期队列, 已过期的订单由过期处理更新状态并触发floorprice更新
+	if err := om.addToOrderExpiryCheckQueue(listing.ExpireIn, listing.OrderId, listing.CollectionAddr); err != nil {
+		return errors.Wrap(err, "failed on push order to expired check queue")
+	}
+	return nil
 }
 
 func (om *OrderManager) AddToOrderManagerQueue(order *multi.Order) error {
+	rawInfo, err := marshalListingInfo(order)
+	if err != nil {
+		return err
+	}
+
+	if _, err := om.listings.Add(om.Ctx, string(rawInfo)); err != nil {
+		return errors.Wrap(err, "failed on add to queue")
+	}
+
+	return nil
+}
+
+func marshalListingInfo(order *multi.Order) ([]byte, error) {
 	if order.TokenId == "" {
-		return errors.New("order manger need token id")
+		return nil, errors.New("order manger need token id")
 	}
 	rawInfo, err := json.Marshal(ListingInfo{
 		ExpireIn:       order.ExpireTime,
@@ -181,14 +163,10 @@ func (om *OrderManager) AddToOrderManagerQueue(order *multi.Order) error {
 		TokenID:        order.TokenId,
 		Price:          order.Price,
 		Maker:          order.Maker,
+		OrderType:      order.OrderType,
 	})
 	if err != nil {
-		return errors.Wrap(err, "failed on marshal listing info")
-	}
-
-	if _, err := om.Xkv.Lpush(GenOrdersCacheKey(om.chain), string(rawInfo)); err != nil {
-		return errors.Wrap(err, "failed on add to queue")
+		return nil, errors.Wrap(err, "failed on marshal listing info")
 	}
-
-	return nil
+	return rawInfo, nil
 }
@@ -0,0 +1,93 @@
+package ordermanager
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/xkv"
+)
+
+const streamReadCount = 100
+
+// errPoisonMessage 无法处理的消息, 重试也不会成功, 直接转入死信队列
+var errPoisonMessage = errors.New("poison message")
+
+// consumeStream 持续消费队列中的消息
+// handle成功后确认消息; 返回errPoisonMessage时转入死信队列; 其他错误不确认, 空闲超时后重新投递, 超过最大投递次数转入死信队列
+func (om *OrderManager) consumeStream(stream *xkv.Stream, handle func(payload string) error) {
+	for {
+		select {
+		case <-om.Ctx.Done():
+			xzap.WithContext(om.Ctx).Info("[Order Manage] stream consumer stopped due to context cancellation", zap.String("stream", stream.Key()))
+			return
+		default:
+		}
+
+		messages, err := stream.Read(om.Ctx, streamReadCount)
+		if err != nil {
+			xzap.WithContext(om.Ctx).Warn("failed on read messages from stream", zap.Error(err), zap.String("stream", stream.Key()))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		if len(messages) == 0 {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		for _, msg := range messages {
+			err := handle(msg.Payload)
+			switch {
+			case err == nil:
+				err = stream.Ack(om.Ctx, msg.ID)
+			case errors.Is(err, errPoisonMessage):
+				xzap.WithContext(om.Ctx).Error("dead letter stream message", zap.Error(err),
+					zap.String("stream", stream.Key()), zap.String("id", msg.ID), zap.String("payload", msg.Payload))
+				err = stream.DeadLetter(om.Ctx, msg, err.Error())
+			default:
+				xzap.WithContext(om.Ctx).Warn("failed on handle stream message, wait for redelivery", zap.Error(err),
+					zap.String("stream", stream.Key()), zap.String("id", msg.ID), zap.Int64("deliveries", msg.Deliveries))
+				err = nil
+			}
+			if err != nil {
+				xzap.WithContext(om.Ctx).Warn("failed on ack stream message", zap.Error(err),
+					zap.String("stream", stream.Key()), zap.String("id", msg.ID))
+			}
+		}
+	}
+}
+
+// drainLegacyQueue 将旧版本列表队列中剩余的消息按写入顺序转入stream
+// fromLeft为true时最早的消息在列表左端(Rpush写入), 否则在右端(Lpush写入)
+func (om *OrderManager) drainLegacyQueue(listKey string, stream *xkv.Stream, fromLeft bool) {
+	pop, push := om.Xkv.Redis.RpopCtx, om.Xkv.Redis.RpushCtx
+	if fromLeft {
+		pop, push = om.Xkv.Redis.LpopCtx, om.Xkv.Redis.LpushCtx
+	}
+
+	var moved int
+	for {
+		result, err := pop(om.Ctx, listKey)
+		if err != nil || result == "" {
+			if err != nil && err != redis.Nil {
+				xzap.WithContext(om.Ctx).Warn("failed on drain legacy queue", zap.Error(err), zap.String("key", listKey))
+			}
+			break
+		}
+		if _, err := stream.Add(om.Ctx, result); err != nil {
+			// 放回队列, 下次启动时再转
+			if _, pushErr := push(om.Ctx, listKey, result); pushErr != nil {
+				xzap.WithContext(om.Ctx).Error("failed on restore legacy queue message", zap.Error(pushErr), zap.String("payload", result))
+			}
+			xzap.WithContext(om.Ctx).Warn("failed on drain legacy queue", zap.Error(err), zap.String("key", listKey))
+			break
+		}
+		moved++
+	}
+	if moved > 0 {
+		xzap.WithContext(om.Ctx).Info("[Order Manage] drained legacy queue", zap.String("key", listKey), zap.Int("moved", moved))
+	}
+}
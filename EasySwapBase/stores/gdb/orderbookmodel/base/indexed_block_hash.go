@@ -0,0 +1,35 @@
+package base
+
+// IndexedBlock 已同步区块的哈希记录, 用于检测链重组
+type IndexedBlock struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId     int64  `json:"chain_id" gorm:"column:chain_id;not null"`
+	IndexType   int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	BlockNumber int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`
+	BlockHash   string `json:"block_hash" gorm:"column:block_hash;type:varchar(66);not null"`
+	ParentHash  string `json:"parent_hash" gorm:"column:parent_hash;type:varchar(66);not null"`
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IndexedBlockTableName() string {
+	return "ob_indexed_block"
+}
+
+// BlockUndoLog 同步某个区块时对业务表所做修改的回滚记录
+// PriorValues 为空表示该行由此区块插入, 回滚时删除; 否则回滚时恢复为修改前的值
+type BlockUndoLog struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId     int64  `json:"chain_id" gorm:"column:chain_id;not null"`
+	IndexType   int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	BlockNumber int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`
+	BlockHash   string `json:"block_hash" gorm:"column:block_hash;type:varchar(66);not null"`
+	TableName   string `json:"table_name" gorm:"column:table_name;type:varchar(128);not null"`
+	RowKeys     string `json:"row_keys" gorm:"column:row_keys;type:text;not null"`
+	PriorValues string `json:"prior_values" gorm:"column:prior_values;type:text"`
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func BlockUndoLogTableName() string {
+	return "ob_block_undo_log"
+}
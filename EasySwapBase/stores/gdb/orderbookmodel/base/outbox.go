@@ -0,0 +1,26 @@
+package base
+
+const (
+	OutboxStatusPending = 0
+	OutboxStatusFailed  = 1 // 超过最大重试次数, 不再投递
+)
+
+// OutboxKindOrderQueue 订单管理器的挂单队列, backend保存的签名订单也通过该类型由同步服务投递
+const OutboxKindOrderQueue = "order_queue"
+
+// Outbox 同步服务或backend产生的待投递消息(Redis队列等), 与业务数据在同一事务中写入, 由同步服务投递成功后删除
+type Outbox struct {
+	Id         int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId    int64  `json:"chain_id" gorm:"column:chain_id;not null"`
+	Kind       string `json:"kind" gorm:"column:kind;type:varchar(64);not null"`
+	Payload    string `json:"payload" gorm:"column:payload;type:text;not null"`
+	Status     int    `json:"status" gorm:"column:status;type:tinyint(4);not null;default:0"`
+	Attempts   int    `json:"attempts" gorm:"column:attempts;not null;default:0"`
+	LastError  string `json:"last_error" gorm:"column:last_error;type:varchar(512)"`
+	CreateTime int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OutboxTableName() string {
+	return "ob_outbox"
+}
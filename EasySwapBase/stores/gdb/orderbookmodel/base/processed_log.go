@@ -0,0 +1,16 @@
+package base
+
+// ProcessedLog 已处理的合约日志, 以(tx_hash, log_index)去重, 保证同一日志只被处理一次
+type ProcessedLog struct {
+	Id          int64  `json:"id" gorm:"primaryKey;autoIncrement;column:id;comment:主键"`
+	ChainId     int64  `json:"chain_id" gorm:"column:chain_id;not null"`
+	IndexType   int32  `json:"index_type" gorm:"column:index_type;type:tinyint(4);not null;default:0"`
+	TxHash      string `json:"tx_hash" gorm:"column:tx_hash;type:varchar(66);not null"`
+	LogIndex    int64  `json:"log_index" gorm:"column:log_index;type:bigint(20);not null"`
+	BlockNumber int64  `json:"block_number" gorm:"column:block_number;type:bigint(20);not null"`
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+}
+
+func ProcessedLogTableName() string {
+	return "ob_processed_log"
+}
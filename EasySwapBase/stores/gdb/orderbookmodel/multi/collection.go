@@ -48,6 +48,8 @@ type Collection struct {
 	FloorPrice       decimal.Decimal `gorm:"column:floor_price" json:"floor_price"`
 	SalePrice        decimal.Decimal `gorm:"column:sale_price" json:"sale_price"`                       // 整个collection中item的最低的listing价格
 	VolumeTotal      decimal.Decimal `gorm:"column:volume_total" json:"volume_total"`                   // 总交易量
+	BestBidPrice     decimal.Decimal `gorm:"column:best_bid_price" json:"best_bid_price"`               // 最高的collection出价, 由order manager维护
+	BestBidOrderId   string          `gorm:"column:best_bid_order_id" json:"best_bid_order_id"`         // 最高collection出价的订单id
 	ImageUri         string          `gorm:"column:image_uri" json:"image_uri"`                         // 项目封面图的链接
 	BannerUri        string          `gorm:"column:banner_uri" json:"banner_uri"`                       // banner image uri
 	OpenseaBanScan   int             `gorm:"column:opensea_ban_scan;default:0" json:"opensea_ban_scan"` // （0.未扫描 1扫描过）
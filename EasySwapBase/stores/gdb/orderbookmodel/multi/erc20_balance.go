@@ -0,0 +1,42 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Balance 余额变动明细, Quantity为最小单位(wei)的变动量, 转出为负数
+type Balance struct {
+	ID              int64           `gorm:"column:id" json:"id"` //  主键
+	ChainId         int64           `gorm:"column:chain_id" json:"chain_id"`
+	TokenAddress    string          `gorm:"column:token_address" json:"token_address"`
+	Owner           string          `gorm:"column:owner" json:"owner"`
+	Quantity        decimal.Decimal `gorm:"column:quantity" json:"quantity"`
+	ChangeTime      int64           `gorm:"column:change_time" json:"change_time"`
+	EventType       string          `gorm:"column:event_type" json:"event_type"`
+	TxHash          string          `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex        int64           `gorm:"column:log_index" json:"log_index"`
+	CreateTime      int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime      int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+	WhetherIntegral string          `gorm:"column:whether_integral" json:"whether_integral"`
+}
+
+func BalanceTableName(chainName string) string {
+	return fmt.Sprintf("erc_balance_%s", chainName)
+}
+
+// BalanceSum 账户当前余额, Quantity为最小单位(wei)
+type BalanceSum struct {
+	ChainId      int64           `gorm:"column:chain_id" json:"chain_id"`
+	TokenAddress string          `gorm:"column:token_address" json:"token_address"`
+	Owner        string          `gorm:"column:owner" json:"owner"`
+	Quantity     decimal.Decimal `gorm:"column:quantity" json:"quantity"`
+	ChangeTime   int64           `gorm:"column:change_time" json:"change_time"`
+	CreateTime   int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime   int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func BalanceSumTableName(chainName string) string {
+	return fmt.Sprintf("erc_balance_sum_%s", chainName)
+}
@@ -0,0 +1,24 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// EthWithdraw 合约LogWithdrawETH事件记录
+type EthWithdraw struct {
+	ID          int64           `gorm:"column:id" json:"id"`
+	Recipient   string          `gorm:"column:recipient" json:"recipient"`
+	Amount      decimal.Decimal `gorm:"column:amount" json:"amount"`
+	BlockNumber int64           `gorm:"column:block_number" json:"block_number"`
+	TxHash      string          `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex    int64           `gorm:"column:log_index" json:"log_index"`
+	EventTime   int64           `gorm:"column:event_time" json:"event_time"`
+	CreateTime  int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func EthWithdrawTableName(chainName string) string {
+	return fmt.Sprintf("ob_eth_withdraw_%s", chainName)
+}
@@ -0,0 +1,31 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// FailedMatch 批量撮合(matchOrders)中单笔撮合失败的详情, 对应合约BatchMatchInnerError事件
+type FailedMatch struct {
+	ID                int64           `gorm:"column:id" json:"id"`
+	TxHash            string          `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex          int64           `gorm:"column:log_index" json:"log_index"`
+	BatchOffset       int64           `gorm:"column:batch_offset" json:"batch_offset"` // 失败撮合在matchDetails中的下标
+	CollectionAddress string          `gorm:"column:collection_address" json:"collection_address"`
+	TokenId           string          `gorm:"column:token_id" json:"token_id"`
+	SellMaker         string          `gorm:"column:sell_maker" json:"sell_maker"`
+	BuyMaker          string          `gorm:"column:buy_maker" json:"buy_maker"`
+	SellPrice         decimal.Decimal `gorm:"column:sell_price" json:"sell_price"`
+	BuyPrice          decimal.Decimal `gorm:"column:buy_price" json:"buy_price"`
+	Reason            string          `gorm:"column:reason" json:"reason"`       // 解析后的revert原因
+	RawError          string          `gorm:"column:raw_error" json:"raw_error"` // 原始revert数据
+	BlockNumber       int64           `gorm:"column:block_number" json:"block_number"`
+	EventTime         int64           `gorm:"column:event_time" json:"event_time"`
+	CreateTime        int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime        int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func FailedMatchTableName(chainName string) string {
+	return fmt.Sprintf("ob_failed_match_%s", chainName)
+}
@@ -47,10 +47,11 @@ type Order struct {
 	QuantityRemaining int64           `gorm:"column:quantity_remaining" json:"quantity_remaining"`
 	Size              int64           `gorm:"column:size" json:"size"`
 	// 1: listing 2:offer 3:collection bid 4:item bid
-	OrderType  int64 `gorm:"column:order_type" json:"order_type"`
-	Salt       int64 `gorm:"column:salt" json:"salt"`
-	CreateTime int64 `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
-	UpdateTime int64 `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+	OrderType  int64  `gorm:"column:order_type" json:"order_type"`
+	Salt       int64  `gorm:"column:salt" json:"salt"`
+	Signature  string `gorm:"column:signature" json:"signature,omitempty"`                                             // 链下提交订单的EIP-712签名, 链上挂单为空
+	CreateTime int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
 }
 
 func OrderTableName(chainName string) string {
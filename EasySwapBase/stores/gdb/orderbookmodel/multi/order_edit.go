@@ -0,0 +1,20 @@
+package multi
+
+import "fmt"
+
+// OrderEdit editOrders产生的新旧订单对应关系
+type OrderEdit struct {
+	ID          int64  `gorm:"column:id" json:"id"`
+	OldOrderID  string `gorm:"column:old_order_id" json:"old_order_id"`
+	NewOrderID  string `gorm:"column:new_order_id" json:"new_order_id"`
+	Maker       string `gorm:"column:maker" json:"maker"`
+	BlockNumber int64  `gorm:"column:block_number" json:"block_number"`
+	TxHash      string `gorm:"column:tx_hash" json:"tx_hash"`
+	EventTime   int64  `gorm:"column:event_time" json:"event_time"`
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OrderEditTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_edit_%s", chainName)
+}
@@ -0,0 +1,27 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// OrderFill 订单的单次成交记录, 同一笔成交以(order_id, tx_hash, log_index)去重
+type OrderFill struct {
+	ID          int64           `gorm:"column:id" json:"id"`
+	OrderID     string          `gorm:"column:order_id" json:"order_id"`
+	TxHash      string          `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex    int64           `gorm:"column:log_index" json:"log_index"`
+	Taker       string          `gorm:"column:taker" json:"taker"`
+	TokenId     string          `gorm:"column:token_id" json:"token_id"`
+	FillAmount  int64           `gorm:"column:fill_amount" json:"fill_amount"` // 本次成交数量
+	FillPrice   decimal.Decimal `gorm:"column:fill_price" json:"fill_price"`
+	BlockNumber int64           `gorm:"column:block_number" json:"block_number"`
+	EventTime   int64           `gorm:"column:event_time" json:"event_time"`
+	CreateTime  int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OrderFillTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_fill_%s", chainName)
+}
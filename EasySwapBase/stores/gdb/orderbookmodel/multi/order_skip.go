@@ -0,0 +1,30 @@
+package multi
+
+import "fmt"
+
+// 订单被合约跳过的原因
+const (
+	SkipReasonMake    = "make_rejected"   // makeOrders中订单无效或重复
+	SkipReasonCancel  = "cancel_rejected" // cancelOrders中订单不存在或不属于调用者
+	SkipReasonEdit    = "edit_rejected"   // editOrders中旧订单无法修改或新订单无效
+	SkipReasonUnknown = "unknown"
+)
+
+// OrderSkip 合约LogSkipOrder事件记录
+type OrderSkip struct {
+	ID          int64  `gorm:"column:id" json:"id"`
+	OrderID     string `gorm:"column:order_id" json:"order_id"`
+	Salt        int64  `gorm:"column:salt" json:"salt"`
+	Method      string `gorm:"column:method" json:"method"` // 触发事件的合约方法
+	Reason      string `gorm:"column:reason" json:"reason"`
+	BlockNumber int64  `gorm:"column:block_number" json:"block_number"`
+	TxHash      string `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex    int64  `gorm:"column:log_index" json:"log_index"`
+	EventTime   int64  `gorm:"column:event_time" json:"event_time"`
+	CreateTime  int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime  int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func OrderSkipTableName(chainName string) string {
+	return fmt.Sprintf("ob_order_skip_%s", chainName)
+}
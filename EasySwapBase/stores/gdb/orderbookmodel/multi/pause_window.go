@@ -0,0 +1,22 @@
+package multi
+
+import "fmt"
+
+// PauseWindow 交易所合约暂停的时间段, Unpaused为空表示仍处于暂停状态
+type PauseWindow struct {
+	ID             int64  `gorm:"column:id" json:"id"`
+	PausedBy       string `gorm:"column:paused_by" json:"paused_by"`
+	PausedBlock    int64  `gorm:"column:paused_block" json:"paused_block"`
+	PausedTxHash   string `gorm:"column:paused_tx_hash" json:"paused_tx_hash"`
+	PausedTime     int64  `gorm:"column:paused_time" json:"paused_time"`
+	UnpausedBy     string `gorm:"column:unpaused_by" json:"unpaused_by"`
+	UnpausedBlock  int64  `gorm:"column:unpaused_block" json:"unpaused_block"`
+	UnpausedTxHash string `gorm:"column:unpaused_tx_hash" json:"unpaused_tx_hash"`
+	UnpausedTime   int64  `gorm:"column:unpaused_time" json:"unpaused_time"`
+	CreateTime     int64  `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime     int64  `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func PauseWindowTableName(chainName string) string {
+	return fmt.Sprintf("ob_pause_window_%s", chainName)
+}
@@ -0,0 +1,55 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// IntegralSum 账户累计积分, DeadlineTime为最近一次计入的周期结束时间
+type IntegralSum struct {
+	ChainId      int64           `gorm:"column:chain_id" json:"chain_id"`
+	Owner        string          `gorm:"column:owner" json:"owner"`
+	Integral     decimal.Decimal `gorm:"column:integral" json:"integral"`
+	DeadlineTime int64           `gorm:"column:deadline_time" json:"deadline_time"`
+	CreateTime   int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime   int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IntegralSumTableName(chainName string) string {
+	return fmt.Sprintf("erc_integral_sum_%s", chainName)
+}
+
+// IntegralEpoch 已计算的周期, 最大的epoch_end即积分计算进度
+type IntegralEpoch struct {
+	ChainId    int64           `gorm:"column:chain_id" json:"chain_id"`
+	EpochStart int64           `gorm:"column:epoch_start" json:"epoch_start"`
+	EpochEnd   int64           `gorm:"column:epoch_end" json:"epoch_end"`
+	Rate       decimal.Decimal `gorm:"column:rate" json:"rate"`
+	Multiplier decimal.Decimal `gorm:"column:multiplier" json:"multiplier"`
+	Holders    int64           `gorm:"column:holders" json:"holders"`
+	Points     decimal.Decimal `gorm:"column:points" json:"points"`
+	CreateTime int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IntegralEpochTableName(chainName string) string {
+	return fmt.Sprintf("erc_integral_epoch_%s", chainName)
+}
+
+// IntegralDetail 账户在单个周期内的积分
+type IntegralDetail struct {
+	ChainId        int64           `gorm:"column:chain_id" json:"chain_id"`
+	Owner          string          `gorm:"column:owner" json:"owner"`
+	EpochStart     int64           `gorm:"column:epoch_start" json:"epoch_start"`
+	EpochEnd       int64           `gorm:"column:epoch_end" json:"epoch_end"`
+	OpeningBalance decimal.Decimal `gorm:"column:opening_balance" json:"opening_balance"`
+	ClosingBalance decimal.Decimal `gorm:"column:closing_balance" json:"closing_balance"`
+	Points         decimal.Decimal `gorm:"column:points" json:"points"`
+	CreateTime     int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime     int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func IntegralDetailTableName(chainName string) string {
+	return fmt.Sprintf("erc_integral_detail_%s", chainName)
+}
@@ -0,0 +1,23 @@
+package multi
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// ProtocolShare 协议手续费比例的变更历史, 某区块的费率为该区块及之前最近一次变更的值
+type ProtocolShare struct {
+	ID            int64           `gorm:"column:id" json:"id"`
+	ProtocolShare decimal.Decimal `gorm:"column:protocol_share" json:"protocol_share"`
+	BlockNumber   int64           `gorm:"column:block_number" json:"block_number"`
+	TxHash        string          `gorm:"column:tx_hash" json:"tx_hash"`
+	LogIndex      int64           `gorm:"column:log_index" json:"log_index"`
+	EventTime     int64           `gorm:"column:event_time" json:"event_time"`
+	CreateTime    int64           `json:"create_time" gorm:"column:create_time;type:bigint(20);autoCreateTime:milli;comment:创建时间"` // 创建时间
+	UpdateTime    int64           `json:"update_time" gorm:"column:update_time;type:bigint(20);autoUpdateTime:milli;comment:更新时间"` // 更新时间
+}
+
+func ProtocolShareTableName(chainName string) string {
+	return fmt.Sprintf("ob_protocol_share_%s", chainName)
+}
@@ -0,0 +1,352 @@
+package xkv
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	red "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+const (
+	StreamPayloadField = "payload" // 消息内容所在的字段
+	StreamReasonField  = "reason"  // 死信消息的失败原因
+
+	DefaultStreamMaxLen        = 100000           // 队列保留的消息数(近似)
+	DefaultStreamMaxDeliveries = 10               // 超过投递次数的消息转入死信队列
+	DefaultStreamClaimIdle     = 30 * time.Second // 未确认超过该时长的消息可被其他消费者重新领取
+
+	StreamOffsetBegin  = "0" // 从第一条消息开始消费
+	StreamOffsetLatest = "$" // 只消费之后写入的消息
+)
+
+// StreamMessage 从队列中读取的消息
+type StreamMessage struct {
+	ID         string
+	Payload    string
+	Deliveries int64 // 已投递次数, 首次读取为1
+}
+
+// Stream 基于Redis Streams消费组的队列, 消息确认前一直保留在消费组的待确认列表中
+// 消费者异常退出后, 未确认的消息在空闲ClaimIdle后由其他消费者重新领取
+// 投递超过MaxDeliveries次仍未确认的消息转入死信队列(key + ":dead")
+type Stream struct {
+	redis    *redis.Redis
+	key      string
+	group    string
+	consumer string
+
+	MaxLen        int64
+	MaxDeliveries int64
+	ClaimIdle     time.Duration
+}
+
+// NewStream 创建消费组group下的消费者, consumer为空时使用主机名和进程号
+func (s *Store) NewStream(key, group, consumer string) *Stream {
+	if consumer == "" {
+		consumer = DefaultStreamConsumer()
+	}
+	return &Stream{
+		redis:         s.Redis,
+		key:           key,
+		group:         group,
+		consumer:      consumer,
+		MaxLen:        DefaultStreamMaxLen,
+		MaxDeliveries: DefaultStreamMaxDeliveries,
+		ClaimIdle:     DefaultStreamClaimIdle,
+	}
+}
+
+// DefaultStreamConsumer 当前进程的消费者名称
+func DefaultStreamConsumer() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func (s *Stream) Key() string {
+	return s.key
+}
+
+func (s *Stream) DeadLetterKey() string {
+	return s.key + ":dead"
+}
+
+// AddStream 向队列key写入一条消息, 返回消息id
+func (s *Store) AddStream(ctx context.Context, key string, payload string) (string, error) {
+	return addStream(ctx, s.Redis, key, DefaultStreamMaxLen, map[string]interface{}{StreamPayloadField: payload})
+}
+
+// Add 写入一条消息
+func (s *Stream) Add(ctx context.Context, payload string) (string, error) {
+	return addStream(ctx, s.redis, s.key, s.MaxLen, map[string]interface{}{StreamPayloadField: payload})
+}
+
+func addStream(ctx context.Context, r *redis.Redis, key string, maxLen int64, values map[string]interface{}) (string, error) {
+	var cmd *red.StringCmd
+	err := r.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XAdd(ctx, &red.XAddArgs{Stream: key, MaxLen: maxLen, Approx: true, Values: values})
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed on add stream message")
+	}
+	return cmd.Val(), nil
+}
+
+// EnsureGroup 创建消费组, 消费组不存在时从offset开始消费, 已存在时不做修改
+func (s *Stream) EnsureGroup(ctx context.Context, offset string) error {
+	err := s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XGroupCreateMkStream(ctx, s.key, s.group, offset)
+		return nil
+	})
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return errors.Wrap(err, "failed on create stream group")
+	}
+	return nil
+}
+
+// Replay 将消费组的消费位置重置到offset, 之后的消息会重新投递
+func (s *Stream) Replay(ctx context.Context, offset string) error {
+	if err := s.EnsureGroup(ctx, offset); err != nil {
+		return err
+	}
+	err := s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XGroupSetID(ctx, s.key, s.group, offset)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on reset stream group offset")
+	}
+	return nil
+}
+
+// Read 读取最多count条消息
+// 优先重新领取其他消费者空闲超时未确认的消息, 超过最大投递次数的消息转入死信队列, 之后读取新消息
+func (s *Stream) Read(ctx context.Context, count int64) ([]StreamMessage, error) {
+	messages, err := s.reclaim(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(messages)) >= count {
+		return messages, nil
+	}
+
+	var cmd *red.XStreamSliceCmd
+	err = s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XReadGroup(ctx, &red.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.key, ">"},
+			Count:    count - int64(len(messages)),
+			Block:    -1,
+		})
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on read stream")
+	}
+	for _, stream := range cmd.Val() {
+		for _, msg := range stream.Messages {
+			messages = append(messages, toStreamMessage(msg, 1))
+		}
+	}
+	return messages, nil
+}
+
+func (s *Stream) reclaim(ctx context.Context, count int64) ([]StreamMessage, error) {
+	var pendingCmd *red.XPendingExtCmd
+	err := s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		pendingCmd = p.XPendingExt(ctx, &red.XPendingExtArgs{
+			Stream: s.key,
+			Group:  s.group,
+			Idle:   s.ClaimIdle,
+			Start:  "-",
+			End:    "+",
+			Count:  count,
+		})
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on get pending stream messages")
+	}
+
+	retry, dead := splitPending(pendingCmd.Val(), s.MaxDeliveries)
+	for _, id := range dead {
+		if err := s.deadLetterByID(ctx, id, "exceeded max deliveries"); err != nil {
+			return nil, err
+		}
+	}
+	if len(retry) == 0 {
+		return nil, nil
+	}
+
+	deliveries := make(map[string]int64, len(retry))
+	ids := make([]string, 0, len(retry))
+	for _, p := range retry {
+		deliveries[p.ID] = p.RetryCount + 1
+		ids = append(ids, p.ID)
+	}
+	var claimCmd *red.XMessageSliceCmd
+	err = s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		claimCmd = p.XClaim(ctx, &red.XClaimArgs{
+			Stream:   s.key,
+			Group:    s.group,
+			Consumer: s.consumer,
+			MinIdle:  s.ClaimIdle,
+			Messages: ids,
+		})
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on claim pending stream messages")
+	}
+
+	messages := make([]StreamMessage, 0, len(claimCmd.Val()))
+	for _, msg := range claimCmd.Val() {
+		messages = append(messages, toStreamMessage(msg, deliveries[msg.ID]))
+	}
+	return messages, nil
+}
+
+// splitPending 将空闲超时的待确认消息分为重新投递和转入死信两类
+func splitPending(pending []red.XPendingExt, maxDeliveries int64) ([]red.XPendingExt, []string) {
+	var retry []red.XPendingExt
+	var dead []string
+	for _, p := range pending {
+		if maxDeliveries > 0 && p.RetryCount >= maxDeliveries {
+			dead = append(dead, p.ID)
+			continue
+		}
+		retry = append(retry, p)
+	}
+	return retry, dead
+}
+
+func toStreamMessage(msg red.XMessage, deliveries int64) StreamMessage {
+	payload, _ := msg.Values[StreamPayloadField].(string)
+	return StreamMessage{ID: msg.ID, Payload: payload, Deliveries: deliveries}
+}
+
+// Ack 确认消息已处理
+func (s *Stream) Ack(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		p.XAck(ctx, s.key, s.group, ids...)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on ack stream messages")
+	}
+	return nil
+}
+
+// DeadLetter 将无法处理的消息转入死信队列并确认
+func (s *Stream) DeadLetter(ctx context.Context, msg StreamMessage, reason string) error {
+	values := map[string]interface{}{
+		StreamPayloadField: msg.Payload,
+		StreamReasonField:  reason,
+		"source_id":        msg.ID,
+		"group":            s.group,
+	}
+	if _, err := addStream(ctx, s.redis, s.DeadLetterKey(), s.MaxLen, values); err != nil {
+		return errors.Wrap(err, "failed on add dead letter")
+	}
+	return s.Ack(ctx, msg.ID)
+}
+
+func (s *Stream) deadLetterByID(ctx context.Context, id string, reason string) error {
+	var cmd *red.XMessageSliceCmd
+	err := s.redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XRangeN(ctx, s.key, id, id, 1)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return errors.Wrap(err, "failed on get stream message")
+	}
+
+	msg := StreamMessage{ID: id}
+	if msgs := cmd.Val(); len(msgs) > 0 {
+		msg = toStreamMessage(msgs[0], 0)
+	}
+	return s.DeadLetter(ctx, msg, reason)
+}
+
+// TailStream 不使用消费组读取after之后写入的消息, 没有新消息时最多阻塞block
+// after为StreamOffsetLatest时只读取调用之后写入的消息
+func (s *Store) TailStream(ctx context.Context, key string, after string, count int64, block time.Duration) ([]StreamMessage, error) {
+	var cmd *red.XStreamSliceCmd
+	err := s.Redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XRead(ctx, &red.XReadArgs{Streams: []string{key, after}, Count: count, Block: block})
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on tail stream")
+	}
+
+	var messages []StreamMessage
+	for _, stream := range cmd.Val() {
+		for _, msg := range stream.Messages {
+			messages = append(messages, toStreamMessage(msg, 0))
+		}
+	}
+	return messages, nil
+}
+
+// RangeStream 读取after之后(不含after)最多count条消息, after为空时从第一条开始
+func (s *Store) RangeStream(ctx context.Context, key string, after string, count int64) ([]StreamMessage, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+
+	var cmd *red.XMessageSliceCmd
+	err := s.Redis.PipelinedCtx(ctx, func(p redis.Pipeliner) error {
+		cmd = p.XRangeN(ctx, key, start, "+", count)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "failed on range stream")
+	}
+
+	messages := make([]StreamMessage, 0, len(cmd.Val()))
+	for _, msg := range cmd.Val() {
+		messages = append(messages, toStreamMessage(msg, 0))
+	}
+	return messages, nil
+}
+
+// ParseStreamID 解析消息id(毫秒时间戳-序号)
+func ParseStreamID(id string) (ms uint64, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if found {
+		if seq, err = strconv.ParseUint(seqPart, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return ms, seq, true
+}
+
+// CompareStreamID 比较两个消息id的先后, a在b之前返回-1, 相同返回0, 之后返回1
+func CompareStreamID(a, b string) int {
+	aMs, aSeq, _ := ParseStreamID(a)
+	bMs, bSeq, _ := ParseStreamID(b)
+	switch {
+	case aMs < bMs || (aMs == bMs && aSeq < bSeq):
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,49 @@
+package xkv
+
+import (
+	"testing"
+
+	red "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPending(t *testing.T) {
+	pending := []red.XPendingExt{
+		{ID: "1-0", RetryCount: 1},
+		{ID: "2-0", RetryCount: 10},
+		{ID: "3-0", RetryCount: 9},
+		{ID: "4-0", RetryCount: 12},
+	}
+
+	retry, dead := splitPending(pending, 10)
+	assert.Equal(t, []string{"2-0", "4-0"}, dead)
+	assert.Len(t, retry, 2)
+	assert.Equal(t, "1-0", retry[0].ID)
+	assert.Equal(t, "3-0", retry[1].ID)
+
+	// 不限制投递次数
+	retry, dead = splitPending(pending, 0)
+	assert.Empty(t, dead)
+	assert.Len(t, retry, 4)
+}
+
+func TestToStreamMessage(t *testing.T) {
+	msg := toStreamMessage(red.XMessage{ID: "1-0", Values: map[string]interface{}{StreamPayloadField: `{"a":1}`}}, 2)
+	assert.Equal(t, StreamMessage{ID: "1-0", Payload: `{"a":1}`, Deliveries: 2}, msg)
+}
+
+func TestCompareStreamID(t *testing.T) {
+	ms, seq, ok := ParseStreamID("1700000000000-3")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1700000000000), ms)
+	assert.Equal(t, uint64(3), seq)
+
+	_, _, ok = ParseStreamID("abc-1")
+	assert.False(t, ok)
+
+	assert.Equal(t, -1, CompareStreamID("1-9", "2-0"))
+	assert.Equal(t, -1, CompareStreamID("10-1", "10-2"))
+	assert.Equal(t, 0, CompareStreamID("10-1", "10-1"))
+	assert.Equal(t, 1, CompareStreamID("10-10", "10-9"))
+	assert.Equal(t, 0, CompareStreamID("10", "10-0"))
+}
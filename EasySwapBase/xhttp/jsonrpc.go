@@ -22,6 +22,8 @@ type RPCClient interface {
 	CallRaw(request *RPCRequest) (*RPCResponse, error)
 	// CallFor 进行 JSON-RPC 调用并将响应结果反序列化到所给类型对象中
 	CallFor(out interface{}, method string, params ...interface{}) error
+	// CallBatch 在一个 HTTP 请求中进行批量 JSON-RPC 调用, 响应按请求顺序返回
+	CallBatch(requests []*RPCRequest) ([]*RPCResponse, error)
 }
 
 // RPCOption JSON-RPC 客户端可选配置
@@ -148,6 +150,57 @@ func (c *rpcClient) CallFor(out interface{}, method string, params ...interface{
 	return rpcResp.ReadToObject(out)
 }
 
+// CallBatch 在一个 HTTP 请求中进行批量 JSON-RPC 调用, 响应按请求顺序返回
+// 请求 ID 会被重置为其在切片中的下标, 缺失的响应返回错误
+func (c *rpcClient) CallBatch(requests []*RPCRequest) ([]*RPCResponse, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	for i, req := range requests {
+		req.ID = i
+		if req.JSONRPC == "" {
+			req.JSONRPC = jsonrpcVersion
+		}
+	}
+
+	httpReq, err := c.newRequest(requests)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch call on %s err", c.endpoint)
+	}
+
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "batch call on %s err", httpReq.URL.String())
+	}
+	defer httpResp.Body.Close()
+
+	d := json.NewDecoder(httpResp.Body)
+	d.DisallowUnknownFields()
+	d.UseNumber()
+
+	var rpcResps []*RPCResponse
+	if err := d.Decode(&rpcResps); err != nil {
+		return nil, errors.WithMessagef(err, "batch call on %s status code: %d, decode body err",
+			httpReq.URL.String(), httpResp.StatusCode)
+	}
+
+	results := make([]*RPCResponse, len(requests))
+	for _, resp := range rpcResps {
+		if resp == nil || resp.ID < 0 || resp.ID >= len(requests) {
+			continue
+		}
+		results[resp.ID] = resp
+	}
+	for i, resp := range results {
+		if resp == nil {
+			return nil, errors.Errorf("batch call on %s missing response for %s",
+				httpReq.URL.String(), requests[i].Method)
+		}
+	}
+
+	return results, nil
+}
+
 // RPCRequest 通用 JSON-RPC 请求体
 type RPCRequest struct {
 	JSONRPC string      `json:"jsonrpc"`
@@ -2,6 +2,8 @@ package xhttp
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -95,3 +97,40 @@ func TestRpcClient_CallFor(t *testing.T) {
 		t.Logf("%+v", result)
 	}
 }
+
+func TestRpcClient_CallBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []*RPCRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		resps := make([]*RPCResponse, 0, len(reqs))
+		for i := len(reqs) - 1; i >= 0; i-- { // 乱序返回
+			resp := &RPCResponse{JSONRPC: jsonrpcVersion, ID: reqs[i].ID, Result: reqs[i].Method}
+			if reqs[i].Method == "fail" {
+				resp.Result, resp.Error = nil, map[string]interface{}{"code": -32000, "message": "execution reverted"}
+			}
+			resps = append(resps, resp)
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(resps))
+	}))
+	defer server.Close()
+
+	c := NewRPCClient(server.URL)
+	resps, err := c.CallBatch([]*RPCRequest{
+		NewRPCRequest("first"), NewRPCRequest("fail"), NewRPCRequest("third"),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resps, 3)
+
+	first, err := resps[0].GetString()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", first)
+	_, err = resps[1].GetString()
+	assert.Error(t, err)
+	third, err := resps[2].GetString()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", third)
+
+	resps, err = c.CallBatch(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, resps)
+}
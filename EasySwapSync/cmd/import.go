@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/ProjectsTask/EasySwapSync/model"
+	"github.com/ProjectsTask/EasySwapSync/service/collectionimport"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+var ImportCmd = &cobra.Command{
+	Use:   "import [collection address...]",
+	Short: "add collection import tasks.",
+	Long:  "add collection import tasks, which are executed by the daemon with import_cfg.enable.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.UnmarshalCmdConfig() // 读取和解析配置文件
+		if err != nil {
+			return errors.Wrap(err, "failed to unmarshal config")
+		}
+
+		for _, address := range args {
+			if !common.IsHexAddress(address) {
+				return errors.Errorf("invalid collection address %s", address)
+			}
+		}
+
+		db := model.NewDB(cfg.DB)
+		for _, address := range args {
+			added, err := collectionimport.Enqueue(context.Background(), db, cfg.ChainCfg.Name, address)
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Println("import task added:", address)
+			} else {
+				fmt.Println("import task already pending:", address)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ImportCmd)
+}
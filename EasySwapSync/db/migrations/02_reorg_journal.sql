@@ -0,0 +1,33 @@
+create table ob_indexed_block
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint            not null comment '链id',
+    index_type   tinyint default 0 not null comment '同步任务类型, 与ob_indexed_status.index_type一致',
+    block_number bigint            not null comment '区块号',
+    block_hash   varchar(66)       not null comment '同步时的区块hash',
+    parent_hash  varchar(66)       not null comment '父区块hash',
+    create_time  bigint            null comment '创建时间',
+    update_time  bigint            null comment '更新时间',
+    constraint index_chain_type_block
+        unique (chain_id, index_type, block_number)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_block_undo_log
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint            not null comment '链id',
+    index_type   tinyint default 0 not null comment '同步任务类型',
+    block_number bigint            not null comment '产生修改的区块号',
+    block_hash   varchar(66)       not null comment '产生修改的区块hash',
+    table_name   varchar(128)      not null comment '被修改的表',
+    row_keys     text              not null comment '定位被修改行的条件(json)',
+    prior_values text              null comment '修改前的值(json), 为空表示该行由此区块插入',
+    create_time  bigint            null comment '创建时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_chain_type_block
+    on ob_block_undo_log (chain_id, index_type, block_number);
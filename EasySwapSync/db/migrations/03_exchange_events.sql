@@ -0,0 +1,121 @@
+create table ob_order_skip_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    order_id     varchar(66)  not null comment '被跳过的订单id',
+    salt         bigint       default 0 not null,
+    method       varchar(64)  null comment '触发事件的合约方法',
+    reason       varchar(64)  not null comment '跳过原因(make_rejected,cancel_rejected,edit_rejected,unknown)',
+    block_number bigint       not null comment '区块号',
+    tx_hash      varchar(66)  not null comment '交易事务hash',
+    log_index    bigint       not null comment '日志在区块中的序号',
+    event_time   bigint       null comment '链上事件发生的时间',
+    create_time  bigint       null comment '创建时间',
+    update_time  bigint       null comment '更新时间',
+    constraint index_tx_log
+        unique (tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_order_id
+    on ob_order_skip_sepolia (order_id);
+
+create table ob_order_edit_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    old_order_id varchar(66) not null comment '被修改的订单id',
+    new_order_id varchar(66) not null comment '修改后生成的订单id',
+    maker        varchar(42) not null,
+    block_number bigint      not null comment '区块号',
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    event_time   bigint      null comment '链上事件发生的时间',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间',
+    constraint index_new_order_id
+        unique (new_order_id)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_old_order_id
+    on ob_order_edit_sepolia (old_order_id);
+
+create table ob_protocol_share_sepolia
+(
+    id             bigint auto_increment comment '主键'
+        primary key,
+    protocol_share decimal(30) not null comment '协议手续费比例',
+    block_number   bigint      not null comment '生效区块号',
+    tx_hash        varchar(66) not null comment '交易事务hash',
+    log_index      bigint      not null comment '日志在区块中的序号',
+    event_time     bigint      null comment '链上事件发生的时间',
+    create_time    bigint      null comment '创建时间',
+    update_time    bigint      null comment '更新时间',
+    constraint index_tx_log
+        unique (tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_block_number
+    on ob_protocol_share_sepolia (block_number);
+
+create table ob_pause_window_sepolia
+(
+    id               bigint auto_increment comment '主键'
+        primary key,
+    paused_by        varchar(42) default '' not null comment '暂停操作地址',
+    paused_block     bigint      default 0  not null comment '暂停区块号, 0表示暂停发生在同步起始区块之前',
+    paused_tx_hash   varchar(66) default '' not null,
+    paused_time      bigint      default 0  not null comment '暂停时间',
+    unpaused_by      varchar(42) default '' not null comment '恢复操作地址',
+    unpaused_block   bigint      default 0  not null comment '恢复区块号, 0表示仍处于暂停状态',
+    unpaused_tx_hash varchar(66) default '' not null,
+    unpaused_time    bigint      default 0  not null comment '恢复时间',
+    create_time      bigint                 null comment '创建时间',
+    update_time      bigint                 null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_unpaused_block
+    on ob_pause_window_sepolia (unpaused_block);
+
+create table ob_eth_withdraw_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    recipient    varchar(42) not null comment '接收地址',
+    amount       decimal(30) not null comment '提取数量(wei)',
+    block_number bigint      not null comment '区块号',
+    tx_hash      varchar(66) not null comment '交易事务hash',
+    log_index    bigint      not null comment '日志在区块中的序号',
+    event_time   bigint      null comment '链上事件发生的时间',
+    create_time  bigint      null comment '创建时间',
+    update_time  bigint      null comment '更新时间',
+    constraint index_tx_log
+        unique (tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create table ob_failed_match_sepolia
+(
+    id                 bigint auto_increment comment '主键'
+        primary key,
+    tx_hash            varchar(66)   not null comment '交易事务hash',
+    log_index          bigint        not null comment '日志在区块中的序号',
+    batch_offset       bigint        not null comment '失败撮合在matchDetails中的下标',
+    collection_address varchar(42)   null,
+    token_id           varchar(128)  null,
+    sell_maker         varchar(42)   null,
+    buy_maker          varchar(42)   null,
+    sell_price         decimal(30)   default 0 not null,
+    buy_price          decimal(30)   default 0 not null,
+    reason             varchar(512)  null comment '解析后的revert原因',
+    raw_error          varchar(2048) null comment '原始revert数据',
+    block_number       bigint        not null comment '区块号',
+    event_time         bigint        null comment '链上事件发生的时间',
+    create_time        bigint        null comment '创建时间',
+    update_time        bigint        null comment '更新时间',
+    constraint index_tx_log
+        unique (tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
@@ -0,0 +1,19 @@
+create table ob_order_fill_sepolia
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    order_id     varchar(66)  not null comment '成交的订单id',
+    tx_hash      varchar(66)  not null comment '交易事务hash',
+    log_index    bigint       not null comment '日志在区块中的序号',
+    taker        varchar(42)  null comment '对手方地址',
+    token_id     varchar(128) null comment '成交的NFT',
+    fill_amount  bigint       default 1 not null comment '本次成交数量',
+    fill_price   decimal(30)  default 0 not null comment '成交价格',
+    block_number bigint       not null comment '区块号',
+    event_time   bigint       null comment '链上事件发生的时间',
+    create_time  bigint       null comment '创建时间',
+    update_time  bigint       null comment '更新时间',
+    constraint index_order_tx_log
+        unique (order_id, tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
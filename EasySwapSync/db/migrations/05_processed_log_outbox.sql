@@ -0,0 +1,35 @@
+create table ob_processed_log
+(
+    id           bigint auto_increment comment '主键'
+        primary key,
+    chain_id     bigint            not null comment '链id',
+    index_type   tinyint default 0 not null comment '同步任务类型',
+    tx_hash      varchar(66)       not null comment '交易事务hash',
+    log_index    bigint            not null comment '日志在区块中的序号',
+    block_number bigint            not null comment '区块号',
+    create_time  bigint            null comment '创建时间',
+    constraint index_chain_type_tx_log
+        unique (chain_id, index_type, tx_hash, log_index)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_chain_type_block
+    on ob_processed_log (chain_id, index_type, block_number);
+
+create table ob_outbox
+(
+    id          bigint auto_increment comment '主键'
+        primary key,
+    chain_id    bigint            not null comment '链id',
+    kind        varchar(64)       not null comment '消息类型',
+    payload     text              not null comment '消息内容(json)',
+    status      tinyint default 0 not null comment '0:待投递 1:投递失败',
+    attempts    int     default 0 not null comment '已尝试投递次数',
+    last_error  varchar(512)      null comment '最近一次投递失败原因',
+    create_time bigint            null comment '创建时间',
+    update_time bigint            null comment '更新时间'
+)
+    collate = utf8mb4_general_ci;
+
+create index index_chain_status
+    on ob_outbox (chain_id, status);
@@ -0,0 +1,68 @@
+-- erc_balance_sepolia/erc_balance_sum_sepolia已由旧的余额同步写入, 旧数据只有一个代币, 数量为除以1e18后取整的整币数
+-- 执行前设置旧数据所属的代币: 未配置erc20_tokens时为dex_address, 精度18
+set @token_address = '0x91967508183aefF7A6ff8F01Cf3fD3b7c35CF880';
+set @decimals = 18;
+
+alter table erc_balance_sepolia
+    add column token_address varchar(42) default '' not null comment 'ERC20合约地址' after chain_id,
+    add column tx_hash       varchar(66) default '' not null comment '交易事务hash' after event_type,
+    add column log_index     bigint      default 0  not null comment '日志在区块中的序号' after tx_hash,
+    modify column quantity decimal(65) not null comment '余额变动量(最小单位), 转出为负数';
+
+alter table erc_balance_sum_sepolia
+    add column token_address varchar(42) default '' not null comment 'ERC20合约地址' after chain_id,
+    modify column quantity decimal(65) default 0 not null comment '当前余额(最小单位)';
+
+-- 旧数据换算为最小单位, 用decimal计算避免pow()的浮点误差; 旧数据没有交易信息, 以id区分
+update erc_balance_sepolia
+set token_address = @token_address,
+    tx_hash       = concat('legacy-', id),
+    quantity      = quantity * cast(concat('1', repeat('0', @decimals)) as decimal(65))
+where token_address = '';
+
+update erc_balance_sum_sepolia
+set token_address = @token_address,
+    quantity      = quantity * cast(concat('1', repeat('0', @decimals)) as decimal(65))
+where token_address = '';
+
+-- 删除旧的唯一索引(如按owner唯一), 多个代币时同一owner有多行
+select group_concat(concat('drop index `', index_name, '`') separator ', ')
+into @drop_keys
+from (select distinct index_name
+      from information_schema.statistics
+      where table_schema = database()
+        and table_name = 'erc_balance_sepolia'
+        and non_unique = 0
+        and index_name <> 'PRIMARY') t;
+set @stmt = if(@drop_keys is null, 'do 0', concat('alter table erc_balance_sepolia ', @drop_keys));
+prepare stmt from @stmt;
+execute stmt;
+deallocate prepare stmt;
+
+select group_concat(concat('drop index `', index_name, '`') separator ', ')
+into @drop_keys
+from (select distinct index_name
+      from information_schema.statistics
+      where table_schema = database()
+        and table_name = 'erc_balance_sum_sepolia'
+        and non_unique = 0
+        and index_name <> 'PRIMARY') t;
+set @stmt = if(@drop_keys is null, 'do 0', concat('alter table erc_balance_sum_sepolia ', @drop_keys));
+prepare stmt from @stmt;
+execute stmt;
+deallocate prepare stmt;
+
+alter table erc_balance_sepolia
+    alter column token_address drop default,
+    alter column tx_hash drop default,
+    alter column log_index drop default,
+    add constraint index_token_tx_log_owner
+        unique (token_address, tx_hash, log_index, owner);
+
+create index index_owner_change_time
+    on erc_balance_sepolia (owner, change_time);
+
+alter table erc_balance_sum_sepolia
+    alter column token_address drop default,
+    add constraint index_token_owner
+        unique (token_address, owner);
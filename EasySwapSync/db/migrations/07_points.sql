@@ -0,0 +1,68 @@
+-- erc_integral_sum_sepolia已由旧的积分同步写入, 改为积分引擎使用的结构
+-- 旧的累计积分按旧规则计算, 积分引擎首次计算时会清空并按余额记录重新累计, 这里先清空以便重建唯一索引
+delete from erc_integral_sum_sepolia;
+
+alter table erc_integral_sum_sepolia
+    modify column chain_id      bigint         not null comment '链id',
+    modify column owner         varchar(42)    not null comment '账户地址',
+    modify column integral      decimal(65, 8) default 0 not null comment '累计积分',
+    modify column deadline_time bigint         not null comment '最近一次计入的周期结束时间',
+    modify column create_time   bigint         null comment '创建时间',
+    modify column update_time   bigint         null comment '更新时间';
+
+-- 删除旧的唯一索引, 积分按owner累计
+select group_concat(concat('drop index `', index_name, '`') separator ', ')
+into @drop_keys
+from (select distinct index_name
+      from information_schema.statistics
+      where table_schema = database()
+        and table_name = 'erc_integral_sum_sepolia'
+        and non_unique = 0
+        and index_name <> 'PRIMARY') t;
+set @stmt = if(@drop_keys is null, 'do 0', concat('alter table erc_integral_sum_sepolia ', @drop_keys));
+prepare stmt from @stmt;
+execute stmt;
+deallocate prepare stmt;
+
+alter table erc_integral_sum_sepolia
+    add constraint index_owner
+        unique (owner);
+
+create table erc_integral_epoch_sepolia
+(
+    id          bigint auto_increment comment '主键'
+        primary key,
+    chain_id    bigint          not null comment '链id',
+    epoch_start bigint          not null comment '周期开始时间(UTC)',
+    epoch_end   bigint          not null comment '周期结束时间(UTC)',
+    rate        decimal(65, 18) not null comment '每代币每小时的积分',
+    multiplier  decimal(65, 18) not null comment '倍数',
+    holders     bigint          default 0 not null comment '周期结束时的持有人数',
+    points      decimal(65, 8)  default 0 not null comment '周期内发放的积分',
+    create_time bigint          null comment '创建时间',
+    update_time bigint          null comment '更新时间',
+    constraint index_epoch_start
+        unique (epoch_start)
+)
+    collate = utf8mb4_general_ci;
+
+create table erc_integral_detail_sepolia
+(
+    id              bigint auto_increment comment '主键'
+        primary key,
+    chain_id        bigint          not null comment '链id',
+    owner           varchar(42)     not null comment '账户地址',
+    epoch_start     bigint          not null comment '周期开始时间(UTC)',
+    epoch_end       bigint          not null comment '周期结束时间(UTC)',
+    opening_balance decimal(65)     not null comment '期初余额(最小单位)',
+    closing_balance decimal(65)     not null comment '期末余额(最小单位)',
+    points          decimal(65, 8)  default 0 not null comment '周期内的积分',
+    create_time     bigint          null comment '创建时间',
+    update_time     bigint          null comment '更新时间',
+    constraint index_owner_epoch
+        unique (owner, epoch_start)
+)
+    collate = utf8mb4_general_ci;
+
+create index index_epoch_start
+    on erc_integral_detail_sepolia (epoch_start);
@@ -0,0 +1,6 @@
+alter table ob_collection_sepolia
+    add column best_bid_price    decimal(30) null comment '整个collection中collection bid的最高价格, 由order manager维护' after volume_total,
+    add column best_bid_order_id varchar(66) null comment '最高collection bid的订单id' after best_bid_price;
+
+create index index_collection_type_status_price
+    on ob_order_sepolia (collection_address, order_type, order_status, price);
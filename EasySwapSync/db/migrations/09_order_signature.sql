@@ -0,0 +1,2 @@
+alter table ob_order_sepolia
+    add column signature varchar(512) null comment '链下提交订单的EIP-712签名, 链上挂单为空' after salt;
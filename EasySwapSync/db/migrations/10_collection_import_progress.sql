@@ -0,0 +1,6 @@
+alter table ob_collection_import_record_sepolia
+    add column total_items    bigint default 0 not null comment '需要导入的item数量' after finished_stage,
+    add column imported_items bigint default 0 not null comment '已导入的item数量, 重新执行时从此处继续' after total_items;
+
+create index index_collection_address
+    on ob_collection_import_record_sepolia (collection_address);
@@ -0,0 +1,2 @@
+alter table ob_activity_sepolia
+    add column protocol_fee decimal(30) default 0 not null comment '成交时按当时生效的协议手续费比例计算的手续费' after buy_price;
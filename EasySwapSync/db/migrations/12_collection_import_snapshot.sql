@@ -0,0 +1,2 @@
+alter table ob_collection_import_record_sepolia
+    add column snapshot_block bigint default 0 not null comment '枚举NFT时的区块高度, 之后的转移由Transfer同步处理' after imported_items;
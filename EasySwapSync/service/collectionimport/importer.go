@@ -0,0 +1,532 @@
+package collectionimport
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/headerservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ProjectsTask/EasySwapBase/xhttp"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/outbox"
+)
+
+const (
+	DefaultBlockPeriod  = 2000
+	MaxBlockPeriod      = 50000 // 单个collection的Transfer事件稀疏时每次最多拉取的区块数
+	ImportInterval      = 30    // in seconds, 检查新导入任务的间隔
+	ItemBatchSize       = 50    // 每导入多少个item保存一次进度, 同一批次的tokenURI通过一次批量调用读取
+	EnumerateBatchSize  = 1000  // 每批通过tokenByIndex及ownerOf枚举的NFT数量
+	TokenStandardERC721 = 1
+	maxMsgLength        = 1600
+)
+
+// Importer 执行collection导入任务: 导入collection信息, 枚举NFT并获取元数据及属性, 回填历史活动及成交数据,
+// 枚举前将collection加入过滤器同步NFT转移, 完成后通知订单管理器
+type Importer struct {
+	ctx         context.Context
+	db          *gorm.DB
+	chainClient chainclient.ChainClient
+	chainId     int64
+	chain       string
+	cfg         config.ImportCfg
+	ethAddress  string
+	vault       string
+	nftService  *nftchainservice.Service
+	headers     *headerservice.Service
+	filter      *collectionfilter.Filter
+}
+
+func New(ctx context.Context, cfg *config.Config, db *gorm.DB, chainClient chainclient.ChainClient, chainId int64, chain string, filter *collectionfilter.Filter) (*Importer, error) {
+	parse := cfg.ImportCfg.MetadataParse
+	nftService, err := nftchainservice.NewWithClient(ctx, chainClient, chain,
+		parse.NameTags, parse.ImageTags, parse.AttributesTags, parse.TraitNameTags, parse.TraitValueTags)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on create nft chain service")
+	}
+	// Multicall3未部署时通过JSON-RPC批量请求读取合约
+	rpcUrl := cfg.AnkrCfg.HttpsUrl + cfg.AnkrCfg.ApiKey
+	if len(cfg.AnkrCfg.Endpoints) > 0 {
+		rpcUrl = cfg.AnkrCfg.Endpoints[0]
+	}
+	if rpcUrl != "" {
+		nftService.Multicall.WithRPC(xhttp.NewRPCClient(rpcUrl))
+	}
+	return &Importer{
+		ctx:         ctx,
+		db:          db,
+		chainClient: chainClient,
+		chainId:     chainId,
+		chain:       chain,
+		cfg:         cfg.ImportCfg,
+		ethAddress:  cfg.ContractCfg.EthAddress,
+		vault:       strings.ToLower(cfg.ContractCfg.Vault),
+		nftService:  nftService,
+		headers:     headerservice.New(chainClient, nil, chainId),
+		filter:      filter,
+	}, nil
+}
+
+// Enqueue 加入collection导入任务, 已有未完成的任务时不重复加入
+func Enqueue(ctx context.Context, db *gorm.DB, chain string, collection string) (bool, error) {
+	collection = strings.ToLower(common.HexToAddress(collection).String())
+	var count int64
+	if err := db.WithContext(ctx).Table(multi.CollectionImportRecordTableName(chain)).
+		Where("collection_address = ? and finished_stage < ?", collection, multi.ImportStageFinished).
+		Count(&count).Error; err != nil {
+		return false, errors.Wrap(err, "failed on query import record")
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if err := db.WithContext(ctx).Table(multi.CollectionImportRecordTableName(chain)).
+		Create(&multi.CollectionImportRecord{
+			CollectionAddress: collection,
+			FinishedStage:     multi.ImportStageQueued,
+		}).Error; err != nil {
+		return false, errors.Wrap(err, "failed on create import record")
+	}
+	return true, nil
+}
+
+// Run 定期执行未完成的导入任务, 失败的任务记录错误信息后在下一轮继续
+func (im *Importer) Run() {
+	im.processPending()
+	timer := time.NewTicker(ImportInterval * time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-im.ctx.Done():
+			xzap.WithContext(im.ctx).Info("collection importer stopped due to context cancellation")
+			return
+		case <-timer.C:
+			im.processPending()
+		}
+	}
+}
+
+func (im *Importer) processPending() {
+	var records []multi.CollectionImportRecord
+	if err := im.db.WithContext(im.ctx).Table(multi.CollectionImportRecordTableName(im.chain)).
+		Where("finished_stage < ?", multi.ImportStageFinished).
+		Order("id asc").
+		Find(&records).Error; err != nil {
+		xzap.WithContext(im.ctx).Error("failed on query import records", zap.Error(err))
+		return
+	}
+
+	for i := range records {
+		if err := im.importRecord(&records[i]); err != nil {
+			xzap.WithContext(im.ctx).Error("failed on import collection",
+				zap.String("collection", records[i].CollectionAddress), zap.Error(err))
+			msg := err.Error()
+			if len(msg) > maxMsgLength {
+				msg = msg[:maxMsgLength]
+			}
+			if err := im.updateRecord(records[i].Id, map[string]interface{}{"msg": msg}); err != nil {
+				xzap.WithContext(im.ctx).Error("failed on update import record", zap.Error(err))
+			}
+		}
+	}
+}
+
+// importRecord 从任务已完成的阶段继续导入
+func (im *Importer) importRecord(record *multi.CollectionImportRecord) error {
+	collection := strings.ToLower(record.CollectionAddress)
+	if record.FinishedStage == multi.ImportStageQueued {
+		if err := im.importCollection(collection); err != nil {
+			return err
+		}
+		if err := im.updateRecord(record.Id, map[string]interface{}{"finished_stage": multi.ImportStageCollection}); err != nil {
+			return err
+		}
+		record.FinishedStage = multi.ImportStageCollection
+	}
+
+	if err := im.importItems(record, collection); err != nil {
+		return err
+	}
+	if err := im.backfillSales(collection); err != nil {
+		return err
+	}
+	return im.finish(record, collection)
+}
+
+// importCollection 读取合约的name/symbol, 创建或更新collection
+func (im *Importer) importCollection(collection string) error {
+	var name, symbol string
+	if values, err := im.call(collection, "name"); err == nil {
+		name, _ = values[0].(string)
+	}
+	if values, err := im.call(collection, "symbol"); err == nil {
+		symbol, _ = values[0].(string)
+	}
+
+	if err := im.db.WithContext(im.ctx).Table(multi.CollectionTableName(im.chain)).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "symbol", "is_syncing"}),
+		}).
+		Create(&multi.Collection{
+			ChainId:          int(im.chainId),
+			Address:          collection,
+			Name:             name,
+			Symbol:           symbol,
+			TokenStandard:    TokenStandardERC721,
+			IsSyncing:        1,
+			FloorPriceStatus: comm.CollectionFloorPriceNotImport,
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on create collection")
+	}
+	return nil
+}
+
+// importItems 枚举NFT并逐个导入, 进度保存在imported_items中
+// 实现ERC721Enumerable的合约通过tokenByIndex枚举, 否则回放历史Transfer事件, 并回填Mint/Transfer活动
+// 枚举前先加入过滤器并记录区块高度, 之后的转移由Transfer同步处理, 导入完成后再回放期间的转移修正所有者
+func (im *Importer) importItems(record *multi.CollectionImportRecord, collection string) error {
+	im.filter.Add(collection)
+	if record.SnapshotBlock == 0 {
+		currentBlock, err := im.chainClient.BlockNumber()
+		if err != nil {
+			return errors.Wrap(err, "failed on get current block number")
+		}
+		if err := im.updateRecord(record.Id, map[string]interface{}{"snapshot_block": currentBlock}); err != nil {
+			return err
+		}
+		record.SnapshotBlock = int64(currentBlock)
+	}
+
+	var tokens []token
+	supply, enumerable := im.enumerableSupply(collection)
+	if enumerable {
+		var err error
+		if tokens, err = im.enumerateTokens(collection, supply); err != nil {
+			return err
+		}
+	} else {
+		logs, err := im.fetchTransfers(collection, im.cfg.StartBlock, uint64(record.SnapshotBlock))
+		if err != nil {
+			return err
+		}
+		blockTimes, err := im.blockTimesOf(logs)
+		if err != nil {
+			return err
+		}
+		var activities []multi.Activity
+		tokens, activities = replayTransfers(logs, blockTimes, im.ethAddress)
+		if err := im.replaceTransferActivities(collection, activities); err != nil {
+			return err
+		}
+	}
+
+	if err := im.resolveVaultOwners(collection, tokens); err != nil {
+		return err
+	}
+	if err := im.updateRecord(record.Id, map[string]interface{}{"total_items": len(tokens)}); err != nil {
+		return err
+	}
+
+	for start := record.ImportedItems; start < int64(len(tokens)); start += ItemBatchSize {
+		end := start + ItemBatchSize
+		if end > int64(len(tokens)) {
+			end = int64(len(tokens))
+		}
+		batch := tokens[start:end]
+		refs := make([]nftchainservice.TokenRef, len(batch))
+		for i := range batch {
+			refs[i] = nftchainservice.TokenRef{Collection: collection, TokenID: batch[i].tokenID}
+		}
+		metadatas, err := im.nftService.FetchOnChainMetadatas(refs)
+		if err != nil {
+			return errors.Wrap(err, "failed on fetch nft metadatas")
+		}
+		for i := range batch {
+			if err := im.importItem(collection, batch[i], metadatas[i]); err != nil {
+				return err
+			}
+		}
+		if err := im.updateRecord(record.Id, map[string]interface{}{"imported_items": end}); err != nil {
+			return err
+		}
+		record.ImportedItems = end
+	}
+	if err := im.updateRecord(record.Id, map[string]interface{}{"imported_items": len(tokens)}); err != nil {
+		return err
+	}
+	record.ImportedItems = int64(len(tokens))
+	return im.syncOwners(record, collection)
+}
+
+// syncOwners 导入期间Transfer同步可能已更新了NFT的所有者, 又被导入时读取的所有者覆盖
+// 回放快照区块之后到Transfer同步进度之间的事件修正所有者, 期间锁定同步进度, 避免覆盖之后同步的转移
+func (im *Importer) syncOwners(record *multi.CollectionImportRecord, collection string) error {
+	cursor, err := im.transferCursor(im.db.WithContext(im.ctx))
+	if err != nil || cursor == 0 {
+		return err
+	}
+	fromBlock := uint64(record.SnapshotBlock) + 1
+	var logs []ethereumTypes.Log
+	if cursor >= fromBlock {
+		if logs, err = im.fetchTransfers(collection, fromBlock, cursor); err != nil {
+			return err
+		}
+	}
+
+	return im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		latest, err := im.transferCursor(tx.Clauses(clause.Locking{Strength: "UPDATE"}))
+		if err != nil {
+			return err
+		}
+		from := cursor + 1
+		if from < fromBlock {
+			from = fromBlock
+		}
+		if latest >= from {
+			more, err := im.fetchTransfers(collection, from, latest)
+			if err != nil {
+				return err
+			}
+			logs = append(logs, more...)
+		}
+
+		for tokenID, owner := range lastOwners(logs, im.vault) {
+			if err := tx.Table(multi.ItemTableName(im.chain)).
+				Where("collection_address = ? and token_id = ?", collection, tokenID).
+				Update("owner", owner).Error; err != nil {
+				return errors.Wrap(err, "failed on update item owner")
+			}
+		}
+		return nil
+	})
+}
+
+// transferCursor 读取Transfer同步的进度, 未开始同步时返回0
+func (im *Importer) transferCursor(db *gorm.DB) (uint64, error) {
+	var status base.IndexedStatus
+	if err := db.Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", im.chainId, comm.TransferEventIndexType).
+		Take(&status).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "failed on get transfer index status")
+	}
+	return uint64(status.LastIndexedBlock), nil
+}
+
+// resolveVaultOwners 挂单中的NFT托管在vault, 所有者为挂单的maker
+func (im *Importer) resolveVaultOwners(collection string, tokens []token) error {
+	if im.vault == "" {
+		return nil
+	}
+	for i := range tokens {
+		if tokens[i].owner != im.vault {
+			continue
+		}
+		var makers []string
+		if err := im.db.WithContext(im.ctx).Table(multi.OrderTableName(im.chain)).
+			Where("collection_address = ? and token_id = ? and order_type = ? and order_status in (?)",
+				collection, tokens[i].tokenID, multi.ListingOrder, []int{multi.OrderStatusActive, multi.OrderStatusInactive}).
+			Order("id desc").Limit(1).
+			Pluck("maker", &makers).Error; err != nil {
+			return errors.Wrap(err, "failed on query listing maker")
+		}
+		if len(makers) > 0 {
+			tokens[i].owner = strings.ToLower(makers[0])
+		}
+	}
+	return nil
+}
+
+// importItem 写入item、item_external及item_trait, 获取元数据失败时标记后继续
+func (im *Importer) importItem(collection string, t token, result nftchainservice.MetadataResult) error {
+	external := multi.ItemExternal{CollectionAddress: collection, TokenId: t.tokenID, UploadStatus: multi.OK}
+	metadata := result.Metadata
+	if result.Err != nil {
+		xzap.WithContext(im.ctx).Warn("failed on fetch nft metadata",
+			zap.String("collection", collection), zap.String("token_id", t.tokenID), zap.Error(result.Err))
+		external.UploadStatus = multi.FetchMetadataFailed
+		metadata = nil
+	}
+	var name string
+	if metadata != nil {
+		name = metadata.Name
+		external.ImageUri = metadata.Image
+	}
+
+	return im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		itemUpdates := []string{"owner", "name"}
+		if t.creator != "" {
+			itemUpdates = append(itemUpdates, "creator")
+		}
+		if err := tx.Table(multi.ItemTableName(im.chain)).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.AssignmentColumns(itemUpdates),
+		}).Create(&multi.Item{
+			ChainId:           int(im.chainId),
+			CollectionAddress: collection,
+			TokenId:           t.tokenID,
+			Name:              name,
+			Owner:             t.owner,
+			Creator:           t.creator,
+			Supply:            1,
+		}).Error; err != nil {
+			return errors.Wrap(err, "failed on create item")
+		}
+
+		if err := tx.Table(multi.ItemExternalTableName(im.chain)).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_address"}, {Name: "token_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"image_uri", "upload_status"}),
+		}).Create(&external).Error; err != nil {
+			return errors.Wrap(err, "failed on create item external")
+		}
+
+		if metadata == nil { // 保留之前导入的属性
+			return nil
+		}
+		if err := tx.Table(multi.ItemTraitTableName(im.chain)).
+			Where("collection_address = ? and token_id = ?", collection, t.tokenID).
+			Delete(&multi.ItemTrait{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete item traits")
+		}
+		if traits := traitsOf(collection, t.tokenID, metadata); len(traits) > 0 {
+			if err := tx.Table(multi.ItemTraitTableName(im.chain)).Create(&traits).Error; err != nil {
+				return errors.Wrap(err, "failed on create item traits")
+			}
+		}
+		return nil
+	})
+}
+
+// replaceTransferActivities 用回放得到的Mint/Transfer活动替换之前导入的活动, 重复执行时结果不变
+func (im *Importer) replaceTransferActivities(collection string, activities []multi.Activity) error {
+	return im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.ActivityTableName(im.chain)).
+			Where("collection_address = ? and activity_type in (?)", collection, []int{multi.Mint, multi.Transfer}).
+			Delete(&multi.Activity{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete transfer activities")
+		}
+		if len(activities) == 0 {
+			return nil
+		}
+		if err := tx.Table(multi.ActivityTableName(im.chain)).
+			CreateInBatches(&activities, comm.DBBatchSizeLimit).Error; err != nil {
+			return errors.Wrap(err, "failed on create transfer activities")
+		}
+		return nil
+	})
+}
+
+// backfillSales 根据订单簿已同步的成交活动回填item的成交价及collection的总交易量
+func (im *Importer) backfillSales(collection string) error {
+	var sales []multi.Activity
+	if err := im.db.WithContext(im.ctx).Table(multi.ActivityTableName(im.chain)).
+		Select("token_id", "price").
+		Where("collection_address = ? and activity_type = ?", collection, multi.Sale).
+		Order("event_time asc, id asc").
+		Find(&sales).Error; err != nil {
+		return errors.Wrap(err, "failed on query sale activities")
+	}
+
+	volume := decimal.Zero
+	lastPrices := make(map[string]decimal.Decimal)
+	for _, sale := range sales {
+		volume = volume.Add(sale.Price)
+		lastPrices[sale.TokenId] = sale.Price
+	}
+
+	return im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		for tokenID, price := range lastPrices {
+			if err := tx.Table(multi.ItemTableName(im.chain)).
+				Where("collection_address = ? and token_id = ?", collection, tokenID).
+				Update("sale_price", price).Error; err != nil {
+				return errors.Wrap(err, "failed on update item sale price")
+			}
+		}
+		if err := tx.Table(multi.CollectionTableName(im.chain)).
+			Where("address = ?", collection).
+			Updates(map[string]interface{}{
+				"volume_total":      volume,
+				"history_sale_sync": 1,
+			}).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection volume")
+		}
+		return nil
+	})
+}
+
+// finish 更新collection统计数据并标记为已导入, 通知订单管理器开始跟踪
+func (im *Importer) finish(record *multi.CollectionImportRecord, collection string) error {
+	var amounts struct {
+		OwnerAmount int64
+		ItemAmount  int64
+	}
+	if err := im.db.WithContext(im.ctx).Table(multi.ItemTableName(im.chain)).
+		Select("count(distinct owner) as owner_amount, count(*) as item_amount").
+		Where("collection_address = ? and owner <> ''", collection).
+		Scan(&amounts).Error; err != nil {
+		return errors.Wrap(err, "failed on count collection items")
+	}
+
+	if err := im.db.WithContext(im.ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.CollectionTableName(im.chain)).
+			Where("address = ?", collection).
+			Updates(map[string]interface{}{
+				"owner_amount":       amounts.OwnerAmount,
+				"item_amount":        amounts.ItemAmount,
+				"is_syncing":         0,
+				"floor_price_status": comm.CollectionFloorPriceImported,
+			}).Error; err != nil {
+			return errors.Wrap(err, "failed on update collection")
+		}
+		if err := outbox.Add(tx, im.chainId, outbox.KindTradeEvent, &ordermanager.TradeEvent{
+			EventType:      ordermanager.ImportCollection,
+			CollectionAddr: collection,
+		}); err != nil {
+			return errors.Wrap(err, "failed on add import collection event")
+		}
+		if err := tx.Table(multi.CollectionImportRecordTableName(im.chain)).
+			Where("id = ?", record.Id).
+			Updates(map[string]interface{}{
+				"finished_stage": multi.ImportStageFinished,
+				"msg":            "",
+			}).Error; err != nil {
+			return errors.Wrap(err, "failed on update import record")
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	xzap.WithContext(im.ctx).Info("collection imported", zap.String("collection", collection),
+		zap.Int64("items", amounts.ItemAmount), zap.Int64("owners", amounts.OwnerAmount))
+	return nil
+}
+
+func (im *Importer) updateRecord(id int64, updates map[string]interface{}) error {
+	if err := im.db.WithContext(im.ctx).Table(multi.CollectionImportRecordTableName(im.chain)).
+		Where("id = ?", id).
+		Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update import record")
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package collectionimport
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/multicall"
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/rangefetcher"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// token 需要导入的NFT
+type token struct {
+	tokenID string
+	owner   string
+	creator string
+}
+
+// replayTransfers 按区块顺序回放Transfer事件, 得到每个NFT当前的所有者及Mint/Transfer活动
+// 已销毁的NFT不导入, 返回的NFT按token id排序, 保证中断后从同一位置继续
+func replayTransfers(logs []ethereumTypes.Log, blockTimes map[uint64]uint64, currency string) ([]token, []multi.Activity) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	tokens := make(map[string]*token)
+	var activities []multi.Activity
+	for _, log := range logs {
+		if len(log.Topics) != 4 || log.Topics[0] != nftchainservice.EVMTransferTopic {
+			continue
+		}
+		from := common.BytesToAddress(log.Topics[1].Bytes())
+		to := common.BytesToAddress(log.Topics[2].Bytes())
+		tokenID := log.Topics[3].Big().String()
+
+		activityType := multi.Transfer
+		if from == (common.Address{}) {
+			activityType = multi.Mint
+		}
+		activities = append(activities, multi.Activity{
+			ActivityType:      activityType,
+			Maker:             from.String(),
+			Taker:             to.String(),
+			CollectionAddress: strings.ToLower(log.Address.String()),
+			TokenId:           tokenID,
+			CurrencyAddress:   currency,
+			Price:             decimal.Zero,
+			BlockNumber:       int64(log.BlockNumber),
+			TxHash:            log.TxHash.String(),
+			EventTime:         int64(blockTimes[log.BlockNumber]),
+		})
+
+		if to == (common.Address{}) {
+			delete(tokens, tokenID)
+			continue
+		}
+		t, ok := tokens[tokenID]
+		if !ok {
+			t = &token{tokenID: tokenID}
+			tokens[tokenID] = t
+		}
+		if from == (common.Address{}) {
+			t.creator = strings.ToLower(to.String())
+		}
+		t.owner = strings.ToLower(to.String())
+	}
+
+	result := make([]token, 0, len(tokens))
+	for _, t := range tokens {
+		result = append(result, *t)
+	}
+	sortTokens(result)
+	return result, activities
+}
+
+// sortTokens 按token id的数值排序
+func sortTokens(tokens []token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		a, _ := new(big.Int).SetString(tokens[i].tokenID, 10)
+		b, _ := new(big.Int).SetString(tokens[j].tokenID, 10)
+		if a == nil || b == nil {
+			return tokens[i].tokenID < tokens[j].tokenID
+		}
+		return a.Cmp(b) < 0
+	})
+}
+
+// traitsOf 从元数据中提取属性, 忽略属性名为空的项
+func traitsOf(collection, tokenID string, metadata *nftchainservice.JsonMetadata) []multi.ItemTrait {
+	if metadata == nil {
+		return nil
+	}
+	var traits []multi.ItemTrait
+	for _, attr := range metadata.Attributes {
+		if attr == nil || attr.TraitType == "" {
+			continue
+		}
+		traits = append(traits, multi.ItemTrait{
+			CollectionAddress: collection,
+			TokenId:           tokenID,
+			Trait:             attr.TraitType,
+			TraitValue:        attr.Value,
+		})
+	}
+	return traits
+}
+
+// call 调用NFT合约的只读方法
+func (im *Importer) call(collection string, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := im.nftService.Abi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pack "+method)
+	}
+	to := common.HexToAddress(collection)
+	resp, err := im.chainClient.CallContract(im.ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on call "+method)
+	}
+	values, err := im.nftService.Abi.Unpack(method, resp)
+	if err != nil || len(values) == 0 {
+		return nil, errors.Errorf("failed on unpack %s: %v", method, err)
+	}
+	return values, nil
+}
+
+// enumerableSupply 合约实现ERC721Enumerable时返回totalSupply
+func (im *Importer) enumerableSupply(collection string) (int64, bool) {
+	values, err := im.call(collection, "totalSupply")
+	if err != nil {
+		return 0, false
+	}
+	supply, _ := values[0].(*big.Int)
+	if supply == nil || !supply.IsInt64() {
+		return 0, false
+	}
+	if supply.Sign() > 0 {
+		if _, err := im.call(collection, "tokenByIndex", big.NewInt(0)); err != nil {
+			return 0, false
+		}
+	}
+	return supply.Int64(), true
+}
+
+// enumerateTokens 通过tokenByIndex枚举NFT, 通过ownerOf读取所有者, 每批NFT的调用通过Multicall合并
+func (im *Importer) enumerateTokens(collection string, supply int64) ([]token, error) {
+	tokens := make([]token, 0, supply)
+	target := common.HexToAddress(collection)
+	for start := int64(0); start < supply; start += EnumerateBatchSize {
+		end := start + EnumerateBatchSize
+		if end > supply {
+			end = supply
+		}
+		calls := make([]multicall.Call, 0, end-start)
+		for i := start; i < end; i++ {
+			data, err := im.nftService.Abi.Pack("tokenByIndex", big.NewInt(i))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed on pack tokenByIndex")
+			}
+			calls = append(calls, multicall.Call{Target: target, Data: data})
+		}
+		results, err := im.nftService.Multicall.Call(im.ctx, calls)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on call tokenByIndex")
+		}
+
+		refs := make([]nftchainservice.TokenRef, len(results))
+		for j, result := range results {
+			if result.Err != nil {
+				return nil, errors.Wrapf(result.Err, "failed on call tokenByIndex %d", start+int64(j))
+			}
+			values, err := im.nftService.Abi.Unpack("tokenByIndex", result.Data)
+			if err != nil || len(values) == 0 {
+				return nil, errors.Errorf("invalid token at index %d", start+int64(j))
+			}
+			tokenID, _ := values[0].(*big.Int)
+			if tokenID == nil {
+				return nil, errors.Errorf("invalid token at index %d", start+int64(j))
+			}
+			refs[j] = nftchainservice.TokenRef{Collection: collection, TokenID: tokenID.String()}
+		}
+
+		owners, err := im.nftService.FetchNftOwners(refs)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on fetch nft owners")
+		}
+		for j, owner := range owners {
+			if owner.Err != nil {
+				return nil, errors.Wrapf(owner.Err, "failed on fetch nft owner %s", refs[j].TokenID)
+			}
+			tokens = append(tokens, token{tokenID: refs[j].TokenID, owner: strings.ToLower(owner.Address.String())})
+		}
+	}
+	sortTokens(tokens)
+	return tokens, nil
+}
+
+// fetchTransfers 按自适应的区块区间拉取collection在[fromBlock, toBlock]内的全部Transfer事件
+func (im *Importer) fetchTransfers(collection string, fromBlock, toBlock uint64) ([]ethereumTypes.Log, error) {
+	period := im.cfg.BlockPeriod
+	if period == 0 {
+		period = DefaultBlockPeriod
+	}
+	fetcher := rangefetcher.New(rangefetcher.FilterLogs(im.ctx, im.chainClient, types.FilterQuery{
+		Addresses: []string{collection},
+		Topics:    [][]string{{nftchainservice.EVMTransferTopic.String()}},
+	}), rangefetcher.Config{InitialRange: period, MaxRange: MaxBlockPeriod})
+
+	var logs []ethereumTypes.Log
+	err := fetcher.Fetch(im.ctx, fromBlock, toBlock, func(fromBlock, toBlock uint64, result []ethereumTypes.Log) error {
+		logs = append(logs, result...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on filter transfer logs")
+	}
+	return logs, nil
+}
+
+// blockTimesOf 获取日志所在区块的时间
+func (im *Importer) blockTimesOf(logs []ethereumTypes.Log) (map[uint64]uint64, error) {
+	if err := im.headers.Prefetch(im.ctx, logs); err != nil {
+		return nil, errors.Wrap(err, "failed to get block headers")
+	}
+	blockTimes := make(map[uint64]uint64)
+	for _, log := range logs {
+		blockTime, err := im.headers.BlockTime(im.ctx, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get block time")
+		}
+		blockTimes[log.BlockNumber] = blockTime
+	}
+	return blockTimes, nil
+}
+
+// lastOwners 按区块顺序回放Transfer事件, 得到每个NFT最后的所有者, 销毁的NFT所有者为零地址
+// 与Transfer同步一致, 转入vault为挂单托管, 所有者不变
+func lastOwners(logs []ethereumTypes.Log, vault string) map[string]string {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	owners := make(map[string]string)
+	for _, log := range logs {
+		if len(log.Topics) != 4 || log.Topics[0] != nftchainservice.EVMTransferTopic {
+			continue
+		}
+		to := strings.ToLower(common.BytesToAddress(log.Topics[2].Bytes()).String())
+		if vault != "" && to == vault {
+			continue
+		}
+		owners[log.Topics[3].Big().String()] = to
+	}
+	return owners
+}
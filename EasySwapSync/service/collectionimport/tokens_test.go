@@ -0,0 +1,96 @@
+package collectionimport
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	collection = common.HexToAddress("0x00000000000000000000000000000000000000c1")
+	alice      = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	bob        = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+func transferLog(block uint64, index uint, from, to common.Address, tokenID int64) ethereumTypes.Log {
+	return ethereumTypes.Log{
+		Address: collection,
+		Topics: []common.Hash{
+			nftchainservice.EVMTransferTopic,
+			common.BytesToHash(from.Bytes()),
+			common.BytesToHash(to.Bytes()),
+			common.BigToHash(big.NewInt(tokenID)),
+		},
+		BlockNumber: block,
+		Index:       index,
+	}
+}
+
+func TestReplayTransfers(t *testing.T) {
+	zero := common.Address{}
+	logs := []ethereumTypes.Log{
+		transferLog(12, 0, alice, zero, 3),  // 销毁
+		transferLog(11, 1, alice, bob, 10),  // 同一区块内按日志顺序回放
+		transferLog(11, 0, zero, alice, 10), // mint
+		transferLog(10, 0, zero, alice, 2),
+		transferLog(10, 1, zero, alice, 3),
+	}
+	tokens, activities := replayTransfers(logs, map[uint64]uint64{10: 100, 11: 110, 12: 120}, "0x0")
+
+	lower := func(a common.Address) string { return strings.ToLower(a.String()) }
+	assert.Equal(t, []token{
+		{tokenID: "2", owner: lower(alice), creator: lower(alice)},
+		{tokenID: "10", owner: lower(bob), creator: lower(alice)},
+	}, tokens)
+
+	require.Len(t, activities, 5)
+	assert.Equal(t, multi.Mint, activities[0].ActivityType)
+	assert.Equal(t, int64(100), activities[0].EventTime)
+	assert.Equal(t, multi.Mint, activities[2].ActivityType)
+	assert.Equal(t, multi.Transfer, activities[3].ActivityType)
+	assert.Equal(t, "10", activities[3].TokenId)
+	assert.Equal(t, multi.Transfer, activities[4].ActivityType)
+	assert.Equal(t, int64(120), activities[4].EventTime)
+}
+
+func TestLastOwners(t *testing.T) {
+	zero := common.Address{}
+	vault := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	lower := func(a common.Address) string { return strings.ToLower(a.String()) }
+	logs := []ethereumTypes.Log{
+		transferLog(21, 0, bob, alice, 1),
+		transferLog(20, 0, alice, bob, 1),
+		transferLog(20, 1, alice, zero, 2), // 销毁
+		transferLog(22, 0, bob, vault, 3),  // 挂单托管, 所有者不变
+		transferLog(23, 0, vault, alice, 4),
+	}
+
+	assert.Equal(t, map[string]string{
+		"1": lower(alice),
+		"2": lower(zero),
+		"4": lower(alice),
+	}, lastOwners(logs, lower(vault)))
+}
+
+func TestTraitsOf(t *testing.T) {
+	assert.Nil(t, traitsOf("0xc1", "1", nil))
+
+	traits := traitsOf("0xc1", "1", &nftchainservice.JsonMetadata{
+		Attributes: []*nftchainservice.OpenseaMetadataProps{
+			{TraitType: "Background", Value: "Blue"},
+			{TraitType: "", Value: "ignored"},
+			nil,
+		},
+	})
+	require.Len(t, traits, 1)
+	assert.Equal(t, "Background", traits[0].Trait)
+	assert.Equal(t, "Blue", traits[0].TraitValue)
+	assert.Equal(t, "1", traits[0].TokenId)
+}
@@ -13,3 +13,11 @@ const (
 	MaxCollectionFloorTimeDifference = 10                 // in seconds
 	CollectionFloorTimeRange         = 3600 * 24 * 30 * 2 // in seconds
 )
+
+// ob_indexed_status中各同步任务的index_type
+const (
+	Erc20EventIndexType     = 6
+	OrderBookEventIndexType = 7
+	ValidityEventIndexType  = 8 // 挂单collection的Transfer/Approval事件, 触发订单有效性检查
+	TransferEventIndexType  = 9 // 已导入collection的ERC721 Transfer事件, 维护NFT所有者及Mint/Transfer活动
+)
@@ -18,6 +18,10 @@ type Config struct {
 	ChainCfg    ChainCfg         `toml:"chain_cfg" mapstructure:"chain_cfg" json:"chain_cfg"`
 	ContractCfg ContractCfg      `toml:"contract_cfg" mapstructure:"contract_cfg" json:"contract_cfg"`
 	ProjectCfg  ProjectCfg       `toml:"project_cfg" mapstructure:"project_cfg" json:"project_cfg"`
+	IndexerCfg  IndexerCfg       `toml:"indexer_cfg" mapstructure:"indexer_cfg" json:"indexer_cfg"`
+	PointsCfg   PointsCfg        `toml:"points_cfg" mapstructure:"points_cfg" json:"points_cfg"`
+	OrderMgrCfg OrderMgrCfg      `toml:"order_manager" mapstructure:"order_manager" json:"order_manager"`
+	ImportCfg   ImportCfg        `toml:"import_cfg" mapstructure:"import_cfg" json:"import_cfg"`
 }
 
 type ChainCfg struct {
@@ -26,9 +30,72 @@ type ChainCfg struct {
 }
 
 type ContractCfg struct {
-	EthAddress  string `toml:"eth_address" mapstructure:"eth_address" json:"eth_address"`
-	WethAddress string `toml:"weth_address" mapstructure:"weth_address" json:"weth_address"`
-	DexAddress  string `toml:"dex_address" mapstructure:"dex_address" json:"dex_address"`
+	EthAddress  string       `toml:"eth_address" mapstructure:"eth_address" json:"eth_address"`
+	WethAddress string       `toml:"weth_address" mapstructure:"weth_address" json:"weth_address"`
+	DexAddress  string       `toml:"dex_address" mapstructure:"dex_address" json:"dex_address"`
+	Vault       string       `toml:"vault_address" mapstructure:"vault_address" json:"vault_address"` // 订单簿的vault合约, 挂单的NFT及出价的ETH托管在该合约
+	Erc20Tokens []Erc20Token `toml:"erc20_tokens" mapstructure:"erc20_tokens" json:"erc20_tokens"`    // 需要同步余额的ERC20合约, 第一个用于计算积分
+}
+
+// Erc20Token 同步余额的ERC20合约
+type Erc20Token struct {
+	Address      string `toml:"address" mapstructure:"address" json:"address"`
+	Decimals     *int32 `toml:"decimals" mapstructure:"decimals" json:"decimals"`                // 精度, 未配置时从合约读取
+	CustomEvents bool   `toml:"custom_events" mapstructure:"custom_events" json:"custom_events"` // 使用TokensMinted/TokensBurned/TokensTransferred事件, 而非标准Transfer事件
+}
+
+// IndexerCfg 控制启动哪些同步任务
+type IndexerCfg struct {
+	OrderBook  bool   `toml:"order_book" mapstructure:"order_book" json:"order_book"`
+	Erc20      bool   `toml:"erc20" mapstructure:"erc20" json:"erc20"`
+	Transfer   bool   `toml:"transfer" mapstructure:"transfer" json:"transfer"`          // 同步已导入collection的NFT转移
+	Validity   bool   `toml:"validity" mapstructure:"validity" json:"validity"`          // 检查有效订单是否仍可成交, 需要配置vault_address
+	StartBlock uint64 `toml:"start_block" mapstructure:"start_block" json:"start_block"` // 同步进度不存在时的起始区块
+	// 追赶时每个eth_getLogs请求最多的区块数及同时请求数, 0使用默认值
+	MaxBlockPeriod   uint64 `toml:"max_block_period" mapstructure:"max_block_period" json:"max_block_period"`
+	FetchConcurrency int    `toml:"fetch_concurrency" mapstructure:"fetch_concurrency" json:"fetch_concurrency"`
+}
+
+// PointsCfg 积分计算配置, 按UTC对齐的周期统计持仓时长加权的余额
+type PointsCfg struct {
+	EpochSeconds int64            `toml:"epoch_seconds" mapstructure:"epoch_seconds" json:"epoch_seconds"` // 周期长度, 默认3600
+	Rates        []PointsRate     `toml:"rates" mapstructure:"rates" json:"rates"`                         // 费率表, 未配置时为每代币每小时0.05积分
+	Multipliers  []PointsMultiple `toml:"multipliers" mapstructure:"multipliers" json:"multipliers"`       // 活动倍数
+	Replay       bool             `toml:"replay" mapstructure:"replay" json:"replay"`                      // 启动时清空积分并从第一条余额变动重新计算
+}
+
+// PointsRate 自Since(含)开始的周期使用的费率, 单位为每代币每小时的积分
+type PointsRate struct {
+	Since int64  `toml:"since" mapstructure:"since" json:"since"`
+	Rate  string `toml:"rate" mapstructure:"rate" json:"rate"`
+}
+
+// PointsMultiple 开始时间落在[Start, End)内的周期乘以Multiplier, 多个倍数重叠时相乘
+type PointsMultiple struct {
+	Start      int64  `toml:"start" mapstructure:"start" json:"start"`
+	End        int64  `toml:"end" mapstructure:"end" json:"end"`
+	Multiplier string `toml:"multiplier" mapstructure:"multiplier" json:"multiplier"`
+}
+
+// OrderMgrCfg 订单管理器配置
+type OrderMgrCfg struct {
+	ReplayTradeEventsFrom string `toml:"replay_trade_events_from" mapstructure:"replay_trade_events_from" json:"replay_trade_events_from"` // 启动时从该消息id重新消费交易事件, "0"为从头开始, 为空时从上次确认的位置继续
+}
+
+// ImportCfg collection导入任务配置, 任务由import命令加入
+type ImportCfg struct {
+	Enable        bool          `toml:"enable" mapstructure:"enable" json:"enable"`
+	StartBlock    uint64        `toml:"start_block" mapstructure:"start_block" json:"start_block"`          // 非ERC721Enumerable合约从该区块开始回放Transfer事件
+	BlockPeriod   uint64        `toml:"block_period" mapstructure:"block_period" json:"block_period"`       // 回放Transfer事件时每次拉取的初始区块数, 默认2000
+	MetadataParse MetadataParse `toml:"metadata_parse" mapstructure:"metadata_parse" json:"metadata_parse"` // 解析NFT元数据使用的字段名
+}
+
+type MetadataParse struct {
+	NameTags       []string `toml:"name_tags" mapstructure:"name_tags" json:"name_tags"`
+	ImageTags      []string `toml:"image_tags" mapstructure:"image_tags" json:"image_tags"`
+	AttributesTags []string `toml:"attributes_tags" mapstructure:"attributes_tags" json:"attributes_tags"`
+	TraitNameTags  []string `toml:"trait_name_tags" mapstructure:"trait_name_tags" json:"trait_name_tags"`
+	TraitValueTags []string `toml:"trait_value_tags" mapstructure:"trait_value_tags" json:"trait_value_tags"`
 }
 
 type Monitor struct {
@@ -41,6 +108,12 @@ type AnkrCfg struct {
 	HttpsUrl     string `toml:"https_url" mapstructure:"https_url" json:"https_url"`
 	WebsocketUrl string `toml:"websocket_url" mapstructure:"websocket_url" json:"websocket_url"`
 	EnableWss    bool   `toml:"enable_wss" mapstructure:"enable_wss" json:"enable_wss"`
+	// Endpoints 多个节点地址, 配置后代替HttpsUrl+ApiKey, 按节点健康状况选择并自动切换
+	Endpoints         []string `toml:"endpoints" mapstructure:"endpoints" json:"endpoints"`
+	RequestsPerSecond float64  `toml:"requests_per_second" mapstructure:"requests_per_second" json:"requests_per_second"`
+	Burst             int      `toml:"burst" mapstructure:"burst" json:"burst"`
+	MaxAttempts       int      `toml:"max_attempts" mapstructure:"max_attempts" json:"max_attempts"`
+	MaxHeadLag        uint64   `toml:"max_head_lag" mapstructure:"max_head_lag" json:"max_head_lag"`
 }
 
 type ProjectCfg struct {
@@ -0,0 +1,290 @@
+package orderbookindexer
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+	"github.com/ProjectsTask/EasySwapSync/service/points"
+	"github.com/ProjectsTask/EasySwapSync/service/poller"
+)
+
+const (
+	erc20Abi = `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"from","type":"address"},{"indexed":true,"internalType":"address","name":"to","type":"address"},{"indexed":false,"internalType":"uint256","name":"value","type":"uint256"}],"name":"Transfer","type":"event"},{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"}]`
+
+	BalanceEventMint     = "Mint"
+	BalanceEventBurn     = "Burn"
+	BalanceEventTransfer = "Transfer"
+
+	DefaultTokenDecimals = 18
+)
+
+var erc20TokenAbi, _ = abi.JSON(strings.NewReader(erc20Abi))
+
+// erc20Token 已确定精度的ERC20合约
+type erc20Token struct {
+	address  string
+	decimals int32
+	custom   bool // 使用TokensMinted/TokensBurned/TokensTransferred事件
+}
+
+// balanceChange 单个账户的一次余额变动
+type balanceChange struct {
+	owner     common.Address
+	amount    *big.Int // 带符号的变动量
+	eventType string
+}
+
+// transferChanges 根据转账的两端计算余额变动, from为零地址视为铸币, to为零地址视为销毁
+func transferChanges(from, to common.Address, value *big.Int) []balanceChange {
+	if value == nil || value.Sign() == 0 {
+		return nil
+	}
+	zero := common.HexToAddress(ZeroAddress)
+	switch {
+	case from == zero && to == zero:
+		return nil
+	case from == zero:
+		return []balanceChange{{owner: to, amount: new(big.Int).Set(value), eventType: BalanceEventMint}}
+	case to == zero:
+		return []balanceChange{{owner: from, amount: new(big.Int).Neg(value), eventType: BalanceEventBurn}}
+	case from == to:
+		return nil
+	default:
+		return []balanceChange{
+			{owner: from, amount: new(big.Int).Neg(value), eventType: BalanceEventTransfer},
+			{owner: to, amount: new(big.Int).Set(value), eventType: BalanceEventTransfer},
+		}
+	}
+}
+
+// resolveTokens 解析配置中的ERC20合约, 未配置精度时从合约读取
+// 未配置任何合约时沿用dex_address上的自定义事件, 精度18
+func (s *Service) resolveTokens() ([]erc20Token, error) {
+	cfgs := s.cfg.ContractCfg.Erc20Tokens
+	if len(cfgs) == 0 {
+		decimals := int32(DefaultTokenDecimals)
+		cfgs = []config.Erc20Token{{Address: s.cfg.ContractCfg.DexAddress, Decimals: &decimals, CustomEvents: true}}
+	}
+
+	tokens := make([]erc20Token, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if !common.IsHexAddress(cfg.Address) {
+			return nil, errors.Errorf("invalid erc20 token address %s", cfg.Address)
+		}
+		token := erc20Token{
+			address: common.HexToAddress(cfg.Address).String(),
+			custom:  cfg.CustomEvents,
+		}
+		if cfg.Decimals != nil {
+			token.decimals = *cfg.Decimals
+		} else {
+			decimals, err := s.tokenDecimals(token.address)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed on get decimals of %s, set decimals in config", token.address)
+			}
+			token.decimals = decimals
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// tokenDecimals 查询合约的decimals()
+func (s *Service) tokenDecimals(address string) (int32, error) {
+	data, err := erc20TokenAbi.Pack("decimals")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on pack decimals")
+	}
+
+	to := common.HexToAddress(address)
+	resp, err := s.chainClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on call decimals")
+	}
+
+	out, err := erc20TokenAbi.Unpack("decimals", resp)
+	if err != nil || len(out) == 0 {
+		return 0, errors.Wrap(err, "failed on unpack decimals")
+	}
+	decimals, ok := out[0].(uint8)
+	if !ok {
+		return 0, errors.New("unexpected decimals result")
+	}
+	return int32(decimals), nil
+}
+
+// pointsToken 用于计算积分的合约, 即配置中的第一个合约
+func (s *Service) pointsToken() erc20Token {
+	if len(s.tokens) > 0 {
+		return s.tokens[0]
+	}
+	return erc20Token{address: common.HexToAddress(s.cfg.ContractCfg.DexAddress).String(), decimals: DefaultTokenDecimals, custom: true}
+}
+
+// newPointsEngine 按积分合约的余额变动计算积分
+func (s *Service) newPointsEngine() (*points.Engine, error) {
+	schedule, err := points.NewSchedule(s.cfg.PointsCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	token := s.pointsToken()
+	store := points.NewStore(s.db, s.chainId, s.chain, multi.BalanceTableName(s.chain), token.address)
+	return points.NewEngine(s.ctx, store, schedule, token.decimals, s.erc20SyncedUntil, SleepInterval*time.Second), nil
+}
+
+// erc20SyncedUntil ERC20同步进度所在区块的时间, 早于该时间的余额变动已全部落库
+func (s *Service) erc20SyncedUntil() (int64, error) {
+	var indexedStatus base.IndexedStatus
+	if err := s.db.WithContext(s.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", s.chainId, comm.Erc20EventIndexType).
+		First(&indexedStatus).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on get erc20 index status")
+	}
+
+	header, err := s.headers.Header(s.ctx, uint64(indexedStatus.LastIndexedBlock), "")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get block time")
+	}
+	return int64(header.Time), nil
+}
+
+// applyBalanceChanges 写入余额变动明细并累加账户余额
+// 明细按(token_address, tx_hash, log_index, owner)去重, 重复处理同一日志不会重复累加
+func (s *Service) applyBalanceChanges(tx *gorm.DB, log ethereumTypes.Log, token erc20Token, changes []balanceChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	blockTime, err := s.headers.BlockTime(s.ctx, log)
+	if err != nil {
+		return errors.Wrap(err, "failed to get block time")
+	}
+
+	for _, change := range changes {
+		quantity := decimal.NewFromBigInt(change.amount, 0)
+		balance := multi.Balance{
+			ChainId:         s.chainId,
+			TokenAddress:    token.address,
+			Owner:           change.owner.String(),
+			Quantity:        quantity,
+			ChangeTime:      int64(blockTime),
+			EventType:       change.eventType,
+			TxHash:          log.TxHash.String(),
+			LogIndex:        int64(log.Index),
+			WhetherIntegral: "N",
+		}
+		result := tx.Table(multi.BalanceTableName(s.chain)).Clauses(clause.OnConflict{
+			DoNothing: true,
+		}).Create(&balance) // 将余额信息存入数据库
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on create balance")
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		balanceSum := multi.BalanceSum{
+			ChainId:      s.chainId,
+			TokenAddress: token.address,
+			Owner:        change.owner.String(),
+			Quantity:     quantity,
+			ChangeTime:   int64(blockTime),
+		}
+		if err := tx.Table(multi.BalanceSumTableName(s.chain)).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "token_address"}, {Name: "owner"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"quantity": gorm.Expr("quantity + VALUES(quantity)"), "change_time": gorm.Expr("VALUES(change_time)")}),
+		}).Create(&balanceSum).Error; err != nil { // 将总余额信息存入数据库
+			return errors.Wrap(err, "failed on create balance_sum")
+		}
+	}
+
+	return nil
+}
+
+// erc20TransferHandler 处理标准Transfer事件
+func (s *Service) erc20TransferHandler(token erc20Token) poller.Handler {
+	return func(tx *gorm.DB, log ethereumTypes.Log) error {
+		// ERC721的Transfer事件签名相同, tokenId为indexed参数
+		if len(log.Topics) != 3 {
+			return nil
+		}
+		var event struct {
+			Value *big.Int
+		}
+		if err := erc20TokenAbi.UnpackIntoInterface(&event, "Transfer", log.Data); err != nil {
+			xzap.WithContext(s.ctx).Error("Error unpacking Transfer event:", zap.Error(err))
+			return nil
+		}
+		from := common.BytesToAddress(log.Topics[1].Bytes())
+		to := common.BytesToAddress(log.Topics[2].Bytes())
+
+		return s.applyBalanceChanges(tx, log, token, transferChanges(from, to, event.Value))
+	}
+}
+
+// 处理铸币事件
+func (s *Service) handleMintedEvent(token erc20Token) poller.Handler {
+	return func(tx *gorm.DB, log ethereumTypes.Log) error {
+		var event struct {
+			Amount *big.Int
+		}
+		if err := s.parsedAbi.UnpackIntoInterface(&event, "TokensMinted", log.Data); err != nil { // 通过ABI解析日志数据
+			xzap.WithContext(s.ctx).Error("Error unpacking TokensMinted event:", zap.Error(err))
+			return nil
+		}
+		to := common.BytesToAddress(log.Topics[1].Bytes())
+
+		return s.applyBalanceChanges(tx, log, token, transferChanges(common.HexToAddress(ZeroAddress), to, event.Amount))
+	}
+}
+
+// 处理销毁事件
+func (s *Service) handleBurnedEvent(token erc20Token) poller.Handler {
+	return func(tx *gorm.DB, log ethereumTypes.Log) error {
+		var event struct {
+			Amount *big.Int
+		}
+		if err := s.parsedAbi.UnpackIntoInterface(&event, "TokensBurned", log.Data); err != nil { // 通过ABI解析日志数据
+			xzap.WithContext(s.ctx).Error("Error unpacking TokensBurned event:", zap.Error(err))
+			return nil
+		}
+		from := common.BytesToAddress(log.Topics[1].Bytes())
+
+		return s.applyBalanceChanges(tx, log, token, transferChanges(from, common.HexToAddress(ZeroAddress), event.Amount))
+	}
+}
+
+// 处理转移事件
+func (s *Service) handleTransferredEvent(token erc20Token) poller.Handler {
+	return func(tx *gorm.DB, log ethereumTypes.Log) error {
+		var event struct {
+			Amount *big.Int
+		}
+		if err := s.parsedAbi.UnpackIntoInterface(&event, "TokensTransferred", log.Data); err != nil { // 通过ABI解析日志数据
+			xzap.WithContext(s.ctx).Error("Error unpacking TokensTransferred event:", zap.Error(err))
+			return nil
+		}
+		from := common.BytesToAddress(log.Topics[1].Bytes())
+		to := common.BytesToAddress(log.Topics[2].Bytes())
+
+		return s.applyBalanceChanges(tx, log, token, transferChanges(from, to, event.Amount))
+	}
+}
@@ -0,0 +1,79 @@
+package orderbookindexer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferChanges(t *testing.T) {
+	zero := common.HexToAddress(ZeroAddress)
+	alice := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	// 超过int64范围且带小数部分的数量
+	value, _ := new(big.Int).SetString("123456789012345678901234567", 10)
+
+	type change struct {
+		owner     common.Address
+		amount    string
+		eventType string
+	}
+	tests := []struct {
+		name  string
+		from  common.Address
+		to    common.Address
+		value *big.Int
+		want  []change
+	}{
+		{"mint", zero, alice, value, []change{{alice, "123456789012345678901234567", BalanceEventMint}}},
+		{"burn", alice, zero, value, []change{{alice, "-123456789012345678901234567", BalanceEventBurn}}},
+		{"transfer", alice, bob, big.NewInt(1), []change{
+			{alice, "-1", BalanceEventTransfer},
+			{bob, "1", BalanceEventTransfer},
+		}},
+		{"self transfer", alice, alice, value, nil},
+		{"zero value", alice, bob, big.NewInt(0), nil},
+		{"zero to zero", zero, zero, value, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := transferChanges(tt.from, tt.to, tt.value)
+			require.Len(t, changes, len(tt.want))
+			for i, want := range tt.want {
+				assert.Equal(t, want.owner, changes[i].owner)
+				assert.Equal(t, want.amount, changes[i].amount.String())
+				assert.Equal(t, want.eventType, changes[i].eventType)
+			}
+		})
+	}
+
+	// 不修改事件中的原始数量
+	assert.Equal(t, "123456789012345678901234567", value.String())
+}
+
+func TestBalanceQuantityPrecision(t *testing.T) {
+	amount, _ := new(big.Int).SetString("1500000000000000001", 10)
+	quantity := decimal.NewFromBigInt(amount, 0)
+	assert.Equal(t, "1500000000000000001", quantity.String())
+	assert.Equal(t, "1.500000000000000001", quantity.Shift(-DefaultTokenDecimals).String())
+	assert.Equal(t, "1500000000000.000001", quantity.Shift(-6).String())
+}
+
+func TestErc20TransferDecode(t *testing.T) {
+	event := erc20TokenAbi.Events["Transfer"]
+	assert.Equal(t, "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", event.ID.String())
+
+	amount, _ := new(big.Int).SetString("340282366920938463463374607431768211457", 10)
+	data, err := event.Inputs.NonIndexed().Pack(amount)
+	require.NoError(t, err)
+
+	var decoded struct {
+		Value *big.Int
+	}
+	require.NoError(t, erc20TokenAbi.UnpackIntoInterface(&decoded, "Transfer", data))
+	assert.Equal(t, 0, amount.Cmp(decoded.Value))
+}
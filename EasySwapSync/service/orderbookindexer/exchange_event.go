@@ -0,0 +1,420 @@
+package orderbookindexer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+// MatchDetail matchOrders的单笔撮合参数
+type MatchDetail struct {
+	SellOrder Order
+	BuyOrder  Order
+}
+
+// EditDetail editOrders的单笔修改参数
+type EditDetail struct {
+	OldOrderKey [32]byte
+	NewOrder    Order
+}
+
+// errTxNotDecoded 交易calldata无法按本合约ABI解析(如经由其他合约调用), 可以忽略; 其他错误需重试日志
+var errTxNotDecoded = errors.New("tx calldata not decoded")
+
+var skipReasons = map[string]string{
+	"makeOrders":   multi.SkipReasonMake,
+	"cancelOrders": multi.SkipReasonCancel,
+	"editOrders":   multi.SkipReasonEdit,
+}
+
+// transaction 获取日志所在的交易, 同一区块的日志复用已拉取的区块
+// 按区块号而非Block.Hash()判断: go-ethereum v1.12对Dencun之后的区块计算出的哈希与链上不同
+func (s *Service) transaction(log ethereumTypes.Log) (*ethereumTypes.Transaction, error) {
+	if s.lastBlock == nil || s.lastBlock.NumberU64() != log.BlockNumber {
+		result, err := s.chainClient.BlockWithTxs(s.ctx, log.BlockNumber)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on get block with txs")
+		}
+		block, ok := result.(*ethereumTypes.Block)
+		if !ok {
+			return nil, errors.New("unexpected block type")
+		}
+		s.lastBlock = block
+	}
+
+	tx := s.lastBlock.Transaction(log.TxHash)
+	if tx == nil {
+		s.lastBlock = nil // 缓存的区块可能已被重组, 重试时重新拉取
+		return nil, errors.Errorf("tx %s not found in block %d", log.TxHash.String(), log.BlockNumber)
+	}
+	return tx, nil
+}
+
+// txMethod 解析日志所在交易调用的合约方法及参数, 交易不是直接调用本合约时返回errTxNotDecoded
+func (s *Service) txMethod(log ethereumTypes.Log) (*abi.Method, []interface{}, error) {
+	tx, err := s.transaction(log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil, nil, errors.Wrap(errTxNotDecoded, "tx without calldata")
+	}
+	method, err := s.parsedAbi.MethodById(data[:4])
+	if err != nil {
+		return nil, nil, errors.Wrap(errTxNotDecoded, "failed on match tx method: "+err.Error())
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil, errors.Wrap(errTxNotDecoded, "failed on unpack tx calldata: "+err.Error())
+	}
+	return method, args, nil
+}
+
+// decodeRevertReason 解析revert数据, 支持Error(string)、Panic(uint256)及合约ABI中声明的自定义错误
+func (s *Service) decodeRevertReason(data []byte) string {
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return reason
+	}
+	if len(data) >= 4 {
+		for _, abiErr := range s.parsedAbi.Errors {
+			if bytes.Equal(abiErr.ID[:4], data[:4]) {
+				return abiErr.Name
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Service) blockTime(log ethereumTypes.Log) (int64, error) {
+	blockTime, err := s.headers.BlockTime(s.ctx, log)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get block time")
+	}
+	return int64(blockTime), nil
+}
+
+// 处理订单被合约跳过事件
+func (s *Service) handleSkipOrderEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	var event struct {
+		OrderKey [32]byte
+		Salt     uint64
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "LogSkipOrder", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking LogSkipOrder event:", zap.Error(err))
+		return nil
+	}
+
+	var methodName string
+	reason := multi.SkipReasonUnknown
+	method, _, err := s.txMethod(log)
+	if err != nil && !errors.Is(err, errTxNotDecoded) {
+		return errors.Wrap(err, "failed on get skip order tx method")
+	}
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on get skip order tx method", zap.Error(err))
+	} else {
+		methodName = method.Name
+		if r, ok := skipReasons[method.Name]; ok {
+			reason = r
+		}
+	}
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+
+	skip := multi.OrderSkip{
+		OrderID:     HexPrefix + hex.EncodeToString(event.OrderKey[:]),
+		Salt:        int64(event.Salt),
+		Method:      methodName,
+		Reason:      reason,
+		BlockNumber: int64(log.BlockNumber),
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+		EventTime:   eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.OrderSkipTableName(s.chain),
+		map[string]interface{}{"tx_hash": skip.TxHash, "log_index": skip.LogIndex}, &skip); err != nil {
+		return errors.Wrap(err, "failed on create order skip")
+	}
+
+	return nil
+}
+
+// 处理协议手续费比例变更事件
+func (s *Service) handleUpdatedProtocolShareEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	share := new(big.Int).SetBytes(log.Topics[1].Bytes())
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+
+	protocolShare := multi.ProtocolShare{
+		ProtocolShare: decimal.NewFromBigInt(share, 0),
+		BlockNumber:   int64(log.BlockNumber),
+		TxHash:        log.TxHash.String(),
+		LogIndex:      int64(log.Index),
+		EventTime:     eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.ProtocolShareTableName(s.chain),
+		map[string]interface{}{"tx_hash": protocolShare.TxHash, "log_index": protocolShare.LogIndex}, &protocolShare); err != nil {
+		return errors.Wrap(err, "failed on create protocol share")
+	}
+
+	return nil
+}
+
+// 处理合约提取ETH事件
+func (s *Service) handleWithdrawETHEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	var event struct {
+		Recipient common.Address
+		Amount    *big.Int
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "LogWithdrawETH", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking LogWithdrawETH event:", zap.Error(err))
+		return nil
+	}
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+
+	withdraw := multi.EthWithdraw{
+		Recipient:   event.Recipient.String(),
+		Amount:      decimal.NewFromBigInt(event.Amount, 0),
+		BlockNumber: int64(log.BlockNumber),
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+		EventTime:   eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.EthWithdrawTableName(s.chain),
+		map[string]interface{}{"tx_hash": withdraw.TxHash, "log_index": withdraw.LogIndex}, &withdraw); err != nil {
+		return errors.Wrap(err, "failed on create eth withdraw")
+	}
+
+	return nil
+}
+
+// 处理合约暂停事件, 开启新的暂停时间段
+func (s *Service) handlePausedEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	var event struct {
+		Account common.Address
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "Paused", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking Paused event:", zap.Error(err))
+		return nil
+	}
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+
+	window := multi.PauseWindow{
+		PausedBy:     event.Account.String(),
+		PausedBlock:  int64(log.BlockNumber),
+		PausedTxHash: log.TxHash.String(),
+		PausedTime:   eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.PauseWindowTableName(s.chain),
+		map[string]interface{}{"paused_tx_hash": window.PausedTxHash}, &window); err != nil {
+		return errors.Wrap(err, "failed on create pause window")
+	}
+
+	return nil
+}
+
+// 处理合约恢复事件, 结束当前的暂停时间段
+func (s *Service) handleUnpausedEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	var event struct {
+		Account common.Address
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "Unpaused", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking Unpaused event:", zap.Error(err))
+		return nil
+	}
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+
+	var openWindows int64
+	if err := tx.Table(multi.PauseWindowTableName(s.chain)).
+		Where("unpaused_block = 0").Count(&openWindows).Error; err != nil {
+		return errors.Wrap(err, "failed on get open pause window")
+	}
+
+	// 暂停发生在同步起始区块之前时，补一条只有结束时间的记录
+	if openWindows == 0 {
+		window := multi.PauseWindow{
+			UnpausedBy:     event.Account.String(),
+			UnpausedBlock:  int64(log.BlockNumber),
+			UnpausedTxHash: log.TxHash.String(),
+			UnpausedTime:   eventTime,
+		}
+		if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.PauseWindowTableName(s.chain),
+			map[string]interface{}{"unpaused_tx_hash": window.UnpausedTxHash}, &window); err != nil {
+			return errors.Wrap(err, "failed on create pause window")
+		}
+		return nil
+	}
+
+	if err := s.journal.Update(tx, reorg.RefOf(log), multi.PauseWindowTableName(s.chain),
+		map[string]interface{}{"unpaused_block": 0},
+		map[string]interface{}{
+			"unpaused_by":      event.Account.String(),
+			"unpaused_block":   log.BlockNumber,
+			"unpaused_tx_hash": log.TxHash.String(),
+			"unpaused_time":    eventTime,
+		}); err != nil {
+		return errors.Wrap(err, "failed on close pause window")
+	}
+
+	return nil
+}
+
+// 处理批量撮合中单笔撮合失败事件, 根据交易参数还原失败的订单并记录为撮合失败活动
+func (s *Service) handleBatchMatchInnerErrorEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	var event struct {
+		Offset *big.Int
+		Msg    []byte
+	}
+	if err := s.parsedAbi.UnpackIntoInterface(&event, "BatchMatchInnerError", log.Data); err != nil {
+		xzap.WithContext(s.ctx).Error("Error unpacking BatchMatchInnerError event:", zap.Error(err))
+		return nil
+	}
+
+	failedMatch := multi.FailedMatch{
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+		BatchOffset: event.Offset.Int64(),
+		Reason:      s.decodeRevertReason(event.Msg),
+		RawError:    HexPrefix + hex.EncodeToString(event.Msg),
+		BlockNumber: int64(log.BlockNumber),
+	}
+
+	var detail *MatchDetail
+	method, args, err := s.txMethod(log)
+	if err != nil && !errors.Is(err, errTxNotDecoded) {
+		return errors.Wrap(err, "failed on get batch match tx method")
+	}
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on get batch match tx method", zap.Error(err))
+	} else if method.Name == "matchOrders" {
+		var details []MatchDetail
+		if err := method.Inputs.Copy(&details, args); err != nil {
+			xzap.WithContext(s.ctx).Warn("failed on decode match details", zap.Error(err))
+		} else if event.Offset.IsInt64() && event.Offset.Int64() < int64(len(details)) {
+			detail = &details[event.Offset.Int64()]
+		}
+	}
+	if detail != nil {
+		failedMatch.CollectionAddress = detail.SellOrder.Nft.CollectionAddr.String()
+		failedMatch.TokenId = detail.SellOrder.Nft.TokenId.String()
+		failedMatch.SellMaker = detail.SellOrder.Maker.String()
+		failedMatch.BuyMaker = detail.BuyOrder.Maker.String()
+		failedMatch.SellPrice = decimal.NewFromBigInt(detail.SellOrder.Price, 0)
+		failedMatch.BuyPrice = decimal.NewFromBigInt(detail.BuyOrder.Price, 0)
+	}
+
+	eventTime, err := s.blockTime(log)
+	if err != nil {
+		return err
+	}
+	failedMatch.EventTime = eventTime
+
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.FailedMatchTableName(s.chain),
+		map[string]interface{}{"tx_hash": failedMatch.TxHash, "log_index": failedMatch.LogIndex}, &failedMatch); err != nil {
+		return errors.Wrap(err, "failed on create failed match")
+	}
+
+	if detail == nil {
+		return nil
+	}
+	newActivity := multi.Activity{
+		ActivityType:      multi.MatchFailed,
+		Maker:             failedMatch.SellMaker,
+		Taker:             failedMatch.BuyMaker,
+		MarketplaceID:     multi.MarketOrderBook,
+		CollectionAddress: failedMatch.CollectionAddress,
+		TokenId:           failedMatch.TokenId,
+		CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
+		Price:             failedMatch.SellPrice,
+		SellPrice:         failedMatch.SellPrice,
+		BuyPrice:          failedMatch.BuyPrice,
+		BlockNumber:       int64(log.BlockNumber),
+		TxHash:            log.TxHash.String(),
+		EventTime:         eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.ActivityTableName(s.chain),
+		activityKeys(&newActivity), &newActivity); err != nil {
+		return errors.Wrap(err, "failed on create activity")
+	}
+
+	return nil
+}
+
+// recordOrderEdit editOrders产生的新订单, 记录其对应的旧订单
+func (s *Service) recordOrderEdit(tx *gorm.DB, log ethereumTypes.Log, newOrder *multi.Order, salt uint64) error {
+	method, args, err := s.txMethod(log)
+	if errors.Is(err, errTxNotDecoded) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed on get edit order tx method")
+	}
+	if method.Name != "editOrders" {
+		return nil
+	}
+
+	var details []EditDetail
+	if err := method.Inputs.Copy(&details, args); err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on decode edit details", zap.Error(err))
+		return nil
+	}
+
+	for _, detail := range details {
+		order := detail.NewOrder
+		if order.Salt != salt ||
+			order.Maker.String() != newOrder.Maker ||
+			order.Nft.CollectionAddr.String() != newOrder.CollectionAddress ||
+			order.Nft.TokenId.String() != newOrder.TokenId ||
+			!decimal.NewFromBigInt(order.Price, 0).Equal(newOrder.Price) {
+			continue
+		}
+
+		orderEdit := multi.OrderEdit{
+			OldOrderID:  HexPrefix + hex.EncodeToString(detail.OldOrderKey[:]),
+			NewOrderID:  newOrder.OrderID,
+			Maker:       newOrder.Maker,
+			BlockNumber: int64(log.BlockNumber),
+			TxHash:      log.TxHash.String(),
+			EventTime:   newOrder.EventTime,
+		}
+		if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.OrderEditTableName(s.chain),
+			map[string]interface{}{"new_order_id": orderEdit.NewOrderID}, &orderEdit); err != nil {
+			return errors.Wrap(err, "failed on create order edit")
+		}
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOrder(side uint8, maker common.Address, tokenId, price int64, salt uint64) Order {
+	order := Order{
+		Side:   side,
+		Maker:  maker,
+		Price:  big.NewInt(price),
+		Expiry: 1700000000,
+		Salt:   salt,
+	}
+	order.Nft.TokenId = big.NewInt(tokenId)
+	order.Nft.CollectionAddr = common.HexToAddress("0xc01ec7100000000000000000000000000000000a")
+	order.Nft.Amount = big.NewInt(1)
+	return order
+}
+
+// packCall 打包单参数的合约调用, 参数先按位置转换为ABI生成的结构体类型(字段名与Order不同)
+func packCall(t *testing.T, name string, arg interface{}) []byte {
+	method := orderBookAbi.Methods[name]
+	require.Len(t, method.Inputs, 1)
+	converted := abi.ConvertType(arg, reflect.New(method.Inputs[0].Type.GetType()).Interface())
+	calldata, err := orderBookAbi.Pack(name, reflect.ValueOf(converted).Elem().Interface())
+	require.NoError(t, err)
+	return calldata
+}
+
+// serviceWithTx 构造一个区块内只有一笔调用calldata交易的服务, 返回该交易上的日志
+func serviceWithTx(t *testing.T, calldata []byte) (*Service, ethereumTypes.Log) {
+	tx := ethereumTypes.NewTx(&ethereumTypes.LegacyTx{
+		To:   &common.Address{},
+		Data: calldata,
+	})
+	block := ethereumTypes.NewBlockWithHeader(&ethereumTypes.Header{Number: big.NewInt(100)}).
+		WithBody([]*ethereumTypes.Transaction{tx}, nil)
+
+	s := &Service{ctx: context.Background(), parsedAbi: orderBookAbi, lastBlock: block}
+	return s, ethereumTypes.Log{BlockNumber: 100, BlockHash: block.Hash(), TxHash: tx.Hash()}
+}
+
+func TestTxMethodMatchOrders(t *testing.T) {
+	seller := common.HexToAddress("0x5e11e10000000000000000000000000000000001")
+	buyer := common.HexToAddress("0xb0ee100000000000000000000000000000000002")
+	details := []MatchDetail{
+		{SellOrder: testOrder(1, seller, 1, 100, 1), BuyOrder: testOrder(0, buyer, 1, 110, 2)},
+		{SellOrder: testOrder(1, seller, 7, 200, 3), BuyOrder: testOrder(0, buyer, 7, 210, 4)},
+	}
+	calldata := packCall(t, "matchOrders", details)
+
+	s, log := serviceWithTx(t, calldata)
+	method, args, err := s.txMethod(log)
+	require.NoError(t, err)
+	assert.Equal(t, "matchOrders", method.Name)
+
+	var decoded []MatchDetail
+	require.NoError(t, method.Inputs.Copy(&decoded, args))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, seller, decoded[1].SellOrder.Maker)
+	assert.Equal(t, buyer, decoded[1].BuyOrder.Maker)
+	assert.Equal(t, int64(7), decoded[1].SellOrder.Nft.TokenId.Int64())
+	assert.Equal(t, int64(210), decoded[1].BuyOrder.Price.Int64())
+}
+
+func TestTxMethodEditOrders(t *testing.T) {
+	maker := common.HexToAddress("0x5e11e10000000000000000000000000000000001")
+	details := []EditDetail{
+		{OldOrderKey: [32]byte{0x01}, NewOrder: testOrder(1, maker, 3, 300, 9)},
+	}
+	calldata := packCall(t, "editOrders", details)
+
+	s, log := serviceWithTx(t, calldata)
+	method, args, err := s.txMethod(log)
+	require.NoError(t, err)
+	assert.Equal(t, "editOrders", method.Name)
+	assert.Equal(t, "edit_rejected", skipReasons[method.Name])
+
+	var decoded []EditDetail
+	require.NoError(t, method.Inputs.Copy(&decoded, args))
+	require.Len(t, decoded, 1)
+	assert.Equal(t, [32]byte{0x01}, decoded[0].OldOrderKey)
+	assert.Equal(t, uint64(9), decoded[0].NewOrder.Salt)
+
+	// 区块中找不到日志所在的交易时返回需要重试的错误
+	s.lastBlock = s.lastBlock.WithBody(nil, nil)
+	_, _, err = s.txMethod(log)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, errTxNotDecoded))
+	assert.Nil(t, s.lastBlock)
+}
+
+func TestTxMethodNotDecoded(t *testing.T) {
+	calldata := packCall(t, "editOrders", []EditDetail{
+		{NewOrder: testOrder(1, common.HexToAddress("0x01"), 3, 300, 9)},
+	})
+	for name, data := range map[string][]byte{
+		"no calldata":      nil,
+		"unknown selector": {0xde, 0xad, 0xbe, 0xef},
+		"truncated args":   calldata[:len(calldata)-32],
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, log := serviceWithTx(t, data)
+			_, _, err := s.txMethod(log)
+			assert.True(t, errors.Is(err, errTxNotDecoded))
+		})
+	}
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	s := &Service{parsedAbi: orderBookAbi}
+
+	revert, err := (abi.Arguments{{Type: mustType(t, "string")}}).Pack("HD: order expired")
+	require.NoError(t, err)
+	errorSelector := []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	assert.Equal(t, "HD: order expired", s.decodeRevertReason(append(errorSelector, revert...)))
+
+	assert.Equal(t, "", s.decodeRevertReason(nil))
+	assert.Equal(t, "", s.decodeRevertReason([]byte{0xde, 0xad, 0xbe, 0xef}))
+}
+
+func mustType(t *testing.T, name string) abi.Type {
+	typ, err := abi.NewType(name, "", nil)
+	require.NoError(t, err)
+	return typ
+}
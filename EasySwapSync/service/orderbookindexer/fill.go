@@ -0,0 +1,118 @@
+package orderbookindexer
+
+import (
+	"math/big"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+// filledAmount 查询合约中订单在指定区块的已成交数量, 避免读到之后区块的成交
+func (s *Service) filledAmount(orderKey common.Hash, blockNumber uint64) (int64, error) {
+	data, err := s.parsedAbi.Pack("filledAmount", orderKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on pack filledAmount")
+	}
+
+	to := common.HexToAddress(s.cfg.ContractCfg.DexAddress)
+	resp, err := s.chainClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: data}, new(big.Int).SetUint64(blockNumber))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on call filledAmount")
+	}
+
+	out, err := s.parsedAbi.Unpack("filledAmount", resp)
+	if err != nil || len(out) == 0 {
+		return 0, errors.Wrap(err, "failed on unpack filledAmount")
+	}
+	amount, ok := out[0].(*big.Int)
+	if !ok || !amount.IsInt64() {
+		return 0, errors.New("unexpected filledAmount result")
+	}
+	return amount.Int64(), nil
+}
+
+// recordedFilledAmount 已记录的成交数量之和
+func (s *Service) recordedFilledAmount(tx *gorm.DB, orderId string) (int64, error) {
+	var filled int64
+	if err := tx.Table(multi.OrderFillTableName(s.chain)).
+		Select("coalesce(sum(fill_amount), 0)").
+		Where("order_id = ?", orderId).
+		Scan(&filled).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on sum order fills")
+	}
+	return filled, nil
+}
+
+// remainingQuantity 根据订单总数量和已成交数量计算剩余数量
+// 链上数量与本地成交记录取较大值, 链上查询失败时chainFilled传-1
+func remainingQuantity(size, chainFilled, recordedFilled int64) int64 {
+	filled := recordedFilled
+	if chainFilled > filled {
+		filled = chainFilled
+	}
+	if filled >= size {
+		return 0
+	}
+	return size - filled
+}
+
+// fillAmountOf 单次撮合成交的数量, 以卖单的NFT数量为准
+func fillAmountOf(sellOrder Order) int64 {
+	if sellOrder.Nft.Amount == nil || sellOrder.Nft.Amount.Sign() <= 0 || !sellOrder.Nft.Amount.IsInt64() {
+		return 1
+	}
+	return sellOrder.Nft.Amount.Int64()
+}
+
+// applyBidFill 记录买单的一次成交, 并以合约的filledAmount校准剩余数量
+// 成交记录按(order_id, tx_hash, log_index)去重, 重复处理同一日志不会重复扣减
+func (s *Service) applyBidFill(tx *gorm.DB, log ethereumTypes.Log, orderKey common.Hash, buyOrder, sellOrder Order, fillPrice *big.Int, eventTime int64) error {
+	orderId := orderKey.String()
+	fill := multi.OrderFill{
+		OrderID:     orderId,
+		TxHash:      log.TxHash.String(),
+		LogIndex:    int64(log.Index),
+		Taker:       sellOrder.Maker.String(),
+		TokenId:     sellOrder.Nft.TokenId.String(),
+		FillAmount:  fillAmountOf(sellOrder),
+		FillPrice:   decimal.NewFromBigInt(fillPrice, 0),
+		BlockNumber: int64(log.BlockNumber),
+		EventTime:   eventTime,
+	}
+	if _, err := s.journal.Insert(tx, reorg.RefOf(log), multi.OrderFillTableName(s.chain),
+		map[string]interface{}{"order_id": fill.OrderID, "tx_hash": fill.TxHash, "log_index": fill.LogIndex}, &fill); err != nil {
+		return errors.Wrap(err, "failed on create order fill")
+	}
+
+	recordedFilled, err := s.recordedFilledAmount(tx, orderId)
+	if err != nil {
+		return err
+	}
+	chainFilled, err := s.filledAmount(orderKey, log.BlockNumber)
+	if err != nil {
+		xzap.WithContext(s.ctx).Warn("failed on get filled amount, use recorded fills",
+			zap.String("order_id", orderId), zap.Error(err))
+		chainFilled = -1
+	}
+
+	size := fillAmountOf(buyOrder)
+	remaining := remainingQuantity(size, chainFilled, recordedFilled)
+	updates := map[string]interface{}{"quantity_remaining": remaining}
+	if remaining == 0 {
+		updates["order_status"] = multi.OrderStatusFilled
+	}
+	if err := s.journal.Update(tx, reorg.RefOf(log), multi.OrderTableName(s.chain),
+		map[string]interface{}{"order_id": orderId}, updates); err != nil {
+		return errors.Wrap(err, "failed on update order quantity_remaining")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package orderbookindexer
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func TestRemainingQuantity(t *testing.T) {
+	tests := []struct {
+		name           string
+		size           int64
+		chainFilled    int64
+		recordedFilled int64
+		want           int64
+	}{
+		{"first fill", 3, 1, 1, 2},
+		{"chain ahead of local fills", 5, 3, 1, 2},
+		{"chain unavailable falls back to fills", 5, -1, 2, 3},
+		{"fully filled", 2, 2, 2, 0},
+		{"over filled is clamped", 2, 3, 1, 0},
+		{"no fills", 4, 0, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, remainingQuantity(tt.size, tt.chainFilled, tt.recordedFilled))
+		})
+	}
+}
+
+func TestFillAmountOf(t *testing.T) {
+	order := testOrder(1, common.Address{}, 1, 100, 1)
+	assert.Equal(t, int64(1), fillAmountOf(order))
+
+	order.Nft.Amount = big.NewInt(5)
+	assert.Equal(t, int64(5), fillAmountOf(order))
+
+	order.Nft.Amount = nil
+	assert.Equal(t, int64(1), fillAmountOf(order))
+}
+
+func TestFilledAmountAbi(t *testing.T) {
+	data, err := orderBookAbi.Pack("filledAmount", common.Hash{0x01})
+	assert.NoError(t, err)
+	assert.Len(t, data, 4+32)
+
+	out, err := orderBookAbi.Unpack("filledAmount", big.NewInt(7).FillBytes(make([]byte, 32)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), out[0].(*big.Int).Int64())
+}
+
+// blockClient 记录CallContract请求的区块号
+type blockClient struct {
+	chainclient.ChainClient
+	blockNumber *big.Int
+}
+
+func (c *blockClient) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.blockNumber = blockNumber
+	return big.NewInt(2).FillBytes(make([]byte, 32)), nil
+}
+
+func TestFilledAmountAtLogBlock(t *testing.T) {
+	client := &blockClient{}
+	s := &Service{ctx: context.Background(), cfg: &config.Config{}, parsedAbi: orderBookAbi, chainClient: client}
+
+	filled, err := s.filledAmount(common.Hash{0x01}, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), filled)
+	require.NotNil(t, client.blockNumber)
+	assert.Equal(t, uint64(100), client.blockNumber.Uint64())
+}
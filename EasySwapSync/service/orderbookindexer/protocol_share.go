@@ -0,0 +1,63 @@
+package orderbookindexer
+
+import (
+	"math/big"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// TotalShare 与合约LibPayInfo.TOTAL_SHARE一致
+const TotalShare = 10000
+
+// protocolShareAt 返回日志处生效的协议手续费比例, 即该日志之前最近一次变更的值
+// 没有变更记录时(如合约初始化时设置的比例)查询合约在上一区块的protocolShare, 同一区块内的变更均有记录
+func (s *Service) protocolShareAt(tx *gorm.DB, log ethereumTypes.Log) (*big.Int, error) {
+	var shares []multi.ProtocolShare
+	if err := tx.Table(multi.ProtocolShareTableName(s.chain)).
+		Where("block_number < ? or (block_number = ? and log_index < ?)", log.BlockNumber, log.BlockNumber, log.Index).
+		Order("block_number desc, log_index desc").
+		Limit(1).
+		Find(&shares).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on query protocol share")
+	}
+	if len(shares) > 0 {
+		return shares[0].ProtocolShare.BigInt(), nil
+	}
+
+	data, err := s.parsedAbi.Pack("protocolShare")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pack protocolShare")
+	}
+	var blockNumber *big.Int
+	if log.BlockNumber > 0 {
+		blockNumber = new(big.Int).SetUint64(log.BlockNumber - 1)
+	}
+	to := common.HexToAddress(s.cfg.ContractCfg.DexAddress)
+	resp, err := s.chainClient.CallContract(s.ctx, ethereum.CallMsg{To: &to, Data: data}, blockNumber)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on call protocolShare")
+	}
+	out, err := s.parsedAbi.Unpack("protocolShare", resp)
+	if err != nil || len(out) == 0 {
+		return nil, errors.Errorf("failed on unpack protocolShare: %v", err)
+	}
+	share, ok := out[0].(*big.Int)
+	if !ok {
+		return nil, errors.New("unexpected protocolShare result")
+	}
+	return share, nil
+}
+
+// protocolFee 成交价格中的协议手续费, 与合约的计算方式一致
+func protocolFee(price, share *big.Int) *big.Int {
+	if price == nil || share == nil {
+		return new(big.Int)
+	}
+	fee := new(big.Int).Mul(price, share)
+	return fee.Div(fee, big.NewInt(TotalShare))
+}
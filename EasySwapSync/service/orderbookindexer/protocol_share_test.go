@@ -0,0 +1,37 @@
+package orderbookindexer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolFee(t *testing.T) {
+	tests := []struct {
+		name  string
+		price *big.Int
+		share *big.Int
+		want  int64
+	}{
+		{"2 percent", big.NewInt(1000000), big.NewInt(200), 20000},
+		{"rounds down", big.NewInt(999), big.NewInt(250), 24},
+		{"zero share", big.NewInt(1000), big.NewInt(0), 0},
+		{"missing share", big.NewInt(1000), nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, protocolFee(tt.price, tt.share).Int64())
+		})
+	}
+}
+
+func TestProtocolShareAbi(t *testing.T) {
+	data, err := orderBookAbi.Pack("protocolShare")
+	assert.NoError(t, err)
+	assert.Len(t, data, 4)
+
+	out, err := orderBookAbi.Unpack("protocolShare", big.NewInt(200).FillBytes(make([]byte, 32)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(200), out[0].(*big.Int).Int64())
+}
@@ -0,0 +1,50 @@
+package orderbookindexer
+
+import (
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/outbox"
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+// activityKeys 活动表的唯一索引列, 回滚时按其删除插入的活动
+func activityKeys(activity *multi.Activity) map[string]interface{} {
+	return map[string]interface{}{
+		"tx_hash":            activity.TxHash,
+		"collection_address": activity.CollectionAddress,
+		"token_id":           activity.TokenId,
+		"activity_type":      activity.ActivityType,
+	}
+}
+
+// rollbackOrderBook 回滚forkBlock之后写入的订单、活动及NFT所有者变更, 并通知订单管理器重新计算受影响集合的地板价
+// 通知与回滚在同一事务中写入outbox, 回滚成功后不会丢失
+func (s *Service) rollbackOrderBook(forkBlock uint64) error {
+	var collections []string
+	count, err := s.journal.Rollback(s.ctx, forkBlock, func(tx *gorm.DB, rows []reorg.UndoneRow) error {
+		collections = reorg.KeyValues(rows, multi.ActivityTableName(s.chain), "collection_address")
+		for _, collection := range collections {
+			if err := outbox.Add(tx, s.chainId, outbox.KindTradeEvent, &ordermanager.TradeEvent{
+				EventType:      ordermanager.UpdateCollection,
+				CollectionAddr: collection,
+			}); err != nil {
+				return errors.Wrap(err, "failed on add update price event")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on rollback orphaned blocks")
+	}
+
+	xzap.WithContext(s.ctx).Warn("chain reorg detected, orderbook events rolled back",
+		zap.Uint64("fork_block", forkBlock),
+		zap.Int("undo_count", count),
+		zap.Strings("collections", collections))
+	return nil
+}
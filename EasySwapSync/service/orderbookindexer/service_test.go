@@ -42,11 +42,11 @@ func TestSyncEvent(t *testing.T) {
 		ethLog := log.(ethereumTypes.Log)
 		switch ethLog.Topics[0].String() {
 		case LogMakeTopic:
-			orderbookSyncer.handleMakeEvent(ethLog)
+			orderbookSyncer.handleMakeEvent(db, ethLog)
 		case LogCancelTopic:
-			orderbookSyncer.handleCancelEvent(ethLog)
+			orderbookSyncer.handleCancelEvent(db, ethLog)
 		case LogMatchTopic:
-			orderbookSyncer.handleMatchEvent(ethLog)
+			orderbookSyncer.handleMatchEvent(db, ethLog)
 		default:
 
 		}
@@ -79,5 +79,5 @@ func TestHandleMakeEvent(t *testing.T) {
 		BlockNumber: 111482956,
 		TxHash:      common.HexToHash("0x000000000000000000000000f39fd6e51aad88f6f4ce6ab8827279cfffb92266"),
 	}
-	orderbookSyncer.handleMakeEvent(log)
+	orderbookSyncer.handleMakeEvent(db, log)
 }
@@ -0,0 +1,16 @@
+package orderbookindexer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTopicsFromAbi(t *testing.T) {
+	assert.Equal(t, "0xfc37f2ff950f95913eb7182357ba3c14df60ef354bc7d6ab1ba2815f249fffe6", LogMakeTopic)
+	assert.Equal(t, "0x0ac8bb53fac566d7afc05d8b4df11d7690a7b27bdc40b54e4060f9b21fb849bd", LogCancelTopic)
+	assert.Equal(t, "0xf629aecab94607bc43ce4aebd564bf6e61c7327226a797b002de724b9944b20e", LogMatchTopic)
+	assert.Equal(t, "0x969cd201f68f120baff2bf3c59bc3b534434e08b69a71a14ab85cb79cd3b63e4", TokensMinted)
+	assert.Equal(t, "0x08009940fb138ae33fbb70c10b643e840c71f1654344cc173975a815e117e687", TokensBurned)
+	assert.Equal(t, "0x1b89874203ff7f0bba87c969ada3f32fda22ed38a6706d35199d21280c7811b1", TokensTransferred)
+}
@@ -0,0 +1,333 @@
+package orderbookindexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/nftchainservice"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/collectionfilter"
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/outbox"
+	"github.com/ProjectsTask/EasySwapSync/service/poller"
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+// transferAction NFT转移的处理方式
+type transferAction struct {
+	activityType int  // 记录的活动类型, 为0时不记录
+	updateOwner  bool // 更新NFT的所有者
+	notify       bool // 通知订单管理器所有者变化
+}
+
+// WithCollectionFilter 设置NFT转移同步使用的collection过滤器, 只同步已导入的collection
+func (s *Service) WithCollectionFilter(filter *collectionfilter.Filter) *Service {
+	s.collectionFilter = filter
+	return s
+}
+
+// classifyTransfer 转入vault为挂单托管, 所有者不变; 从vault转出为成交或取消挂单, 由订单簿事件记录活动及通知订单管理器
+func classifyTransfer(from, to, vault common.Address) transferAction {
+	switch {
+	case vault != (common.Address{}) && to == vault:
+		return transferAction{}
+	case vault != (common.Address{}) && from == vault:
+		return transferAction{updateOwner: true}
+	case from == (common.Address{}):
+		return transferAction{activityType: multi.Mint, updateOwner: true, notify: true}
+	default:
+		return transferAction{activityType: multi.Transfer, updateOwner: true, notify: true}
+	}
+}
+
+// newTransferPoller 同步全链ERC721的Transfer事件, 只处理collection过滤器中的collection, 开启链重组检测
+func (s *Service) newTransferPoller() (*poller.Poller, error) {
+	if s.collectionFilter == nil {
+		return nil, errors.New("collection filter not set")
+	}
+
+	nftService := &nftchainservice.Service{NodeClient: s.chainClient, ChainName: s.chain}
+	fetch := func(fromBlock, toBlock uint64) ([]ethereumTypes.Log, error) {
+		transferLogs, err := nftService.GetNFTTransferEvent(fromBlock, toBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		var logs []ethereumTypes.Log
+		for _, transferLog := range transferLogs {
+			if !s.collectionFilter.Contains(transferLog.Address) {
+				continue
+			}
+			logs = append(logs, ethereumTypes.Log{
+				Address:     common.HexToAddress(transferLog.Address),
+				Topics:      transferLog.Topics,
+				Data:        transferLog.Data,
+				BlockNumber: transferLog.BlockNumber,
+				TxHash:      common.HexToHash(transferLog.TransactionHash),
+				TxIndex:     transferLog.TxIndex,
+				BlockHash:   common.HexToHash(transferLog.BlockHash),
+				Index:       transferLog.Index,
+				Removed:     transferLog.Removed,
+			})
+		}
+		return logs, nil
+	}
+
+	s.transferJournal = reorg.NewJournal(s.db, s.chainId, comm.TransferEventIndexType)
+	return s.newPoller("transfer", comm.TransferEventIndexType, nil).
+		WithFetcher(fetch, s.handleTransferEvent).
+		WithReorg(s.transferJournal, s.rollbackTransfers), nil
+}
+
+// itemOwner NFT当前的所有者
+type itemOwner struct {
+	Id                int64
+	CollectionAddress string
+	TokenId           string
+	Owner             string
+}
+
+// rollbackTransfers 回滚forkBlock之后的NFT所有者变更及Mint/Transfer活动
+// 在同一事务中通知订单管理器NFT回到原所有者, 并重新统计受影响collection的持有人数及NFT数量
+func (s *Service) rollbackTransfers(forkBlock uint64) error {
+	var events []*ordermanager.TradeEvent
+	var collections []string
+	count, err := s.transferJournal.Rollback(s.ctx, forkBlock, func(tx *gorm.DB, rows []reorg.UndoneRow) error {
+		items, err := s.undoneItems(tx, rows)
+		if err != nil {
+			return err
+		}
+		events = ownerRollbackEvents(rows, multi.ItemTableName(s.chain), items)
+		collections = reorg.KeyValues(rows, multi.ActivityTableName(s.chain), "collection_address")
+		seen := make(map[string]bool)
+		for _, collection := range collections {
+			seen[collection] = true
+		}
+
+		for _, event := range events {
+			if err := outbox.Add(tx, s.chainId, outbox.KindTradeEvent, event); err != nil {
+				return errors.Wrap(err, "failed on add transfer event")
+			}
+			if !seen[event.CollectionAddr] {
+				seen[event.CollectionAddr] = true
+				collections = append(collections, event.CollectionAddr)
+			}
+		}
+		for _, collection := range collections {
+			if err := outbox.Add(tx, s.chainId, outbox.KindCollectionAmounts, collection); err != nil {
+				return errors.Wrap(err, "failed on add collection amounts")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on rollback orphaned blocks")
+	}
+
+	xzap.WithContext(s.ctx).Warn("chain reorg detected, nft transfers rolled back",
+		zap.Uint64("fork_block", forkBlock),
+		zap.Int("undo_count", count),
+		zap.Int("owner_changes", len(events)),
+		zap.Strings("collections", collections))
+	return nil
+}
+
+// undoneItems 查询回滚涉及的NFT在回滚前的所有者
+func (s *Service) undoneItems(tx *gorm.DB, rows []reorg.UndoneRow) ([]itemOwner, error) {
+	itemTable := multi.ItemTableName(s.chain)
+	var items []itemOwner
+	if ids := reorg.KeyValues(rows, itemTable, "id"); len(ids) > 0 {
+		if err := tx.Table(itemTable).
+			Select("id, collection_address, token_id, owner").
+			Where("id in (?)", ids).
+			Find(&items).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on get updated items")
+		}
+	}
+	for _, row := range rows {
+		if row.Table != itemTable || row.Prior != nil {
+			continue
+		}
+		var inserted []itemOwner
+		if err := tx.Table(itemTable).
+			Select("id, collection_address, token_id, owner").
+			Where(row.Keys).
+			Find(&inserted).Error; err != nil {
+			return nil, errors.Wrap(err, "failed on get inserted items")
+		}
+		items = append(items, inserted...)
+	}
+	return items, nil
+}
+
+// ownerRollbackEvents 由撤销的行计算每个NFT回滚前后的所有者, 生成NFT从回滚前所有者转回原所有者的Transfer事件
+// 在回滚的区块中创建的NFT回滚后删除, 原所有者为空
+func ownerRollbackEvents(rows []reorg.UndoneRow, itemTable string, items []itemOwner) []*ordermanager.TradeEvent {
+	byID := make(map[string]itemOwner)
+	byToken := make(map[string]itemOwner)
+	tokenKey := func(collection, tokenID interface{}) string {
+		return fmt.Sprintf("%v/%v", collection, tokenID)
+	}
+	for _, item := range items {
+		byID[fmt.Sprint(item.Id)] = item
+		byToken[tokenKey(item.CollectionAddress, item.TokenId)] = item
+	}
+
+	// rows按修改的逆序排列, 最早的修改前的值即为回滚后的所有者
+	restored := make(map[string]string)
+	var order []string
+	for i := len(rows) - 1; i >= 0; i-- {
+		row := rows[i]
+		if row.Table != itemTable {
+			continue
+		}
+		var key, owner string
+		if row.Prior == nil {
+			key = tokenKey(row.Keys["collection_address"], row.Keys["token_id"])
+		} else {
+			item, ok := byID[fmt.Sprint(row.Keys["id"])]
+			prior, changed := row.Prior["owner"]
+			if !ok || !changed {
+				continue
+			}
+			key = tokenKey(item.CollectionAddress, item.TokenId)
+			owner = fmt.Sprint(prior)
+		}
+		if _, ok := restored[key]; !ok {
+			restored[key] = owner
+			order = append(order, key)
+		}
+	}
+
+	var events []*ordermanager.TradeEvent
+	for _, key := range order {
+		item, ok := byToken[key]
+		if !ok || item.Owner == restored[key] {
+			continue
+		}
+		events = append(events, &ordermanager.TradeEvent{
+			EventType:      ordermanager.Transfer,
+			CollectionAddr: item.CollectionAddress,
+			TokenID:        item.TokenId,
+			From:           item.Owner,
+			To:             restored[key],
+		})
+	}
+	return events
+}
+
+// handleTransferEvent 更新NFT的所有者, 记录Mint/Transfer活动, 并通知订单管理器
+func (s *Service) handleTransferEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	if len(log.Topics) != 4 {
+		return nil
+	}
+	from := common.BytesToAddress(log.Topics[1].Bytes())
+	to := common.BytesToAddress(log.Topics[2].Bytes())
+	collection := strings.ToLower(log.Address.String())
+	tokenId := log.Topics[3].Big().String()
+
+	action := classifyTransfer(from, to, common.HexToAddress(s.cfg.ContractCfg.Vault))
+	if !action.updateOwner {
+		return nil
+	}
+	journal := s.transferJournal
+	ref := reorg.RefOf(log)
+	owner := strings.ToLower(to.String())
+	var creator string
+	if from == (common.Address{}) {
+		creator = owner
+	}
+
+	keys := map[string]interface{}{"collection_address": collection, "token_id": tokenId}
+	inserted, err := journal.Insert(tx, ref, multi.ItemTableName(s.chain), keys, &multi.Item{
+		ChainId:           int(s.chainId),
+		CollectionAddress: collection,
+		TokenId:           tokenId,
+		Owner:             owner,
+		Creator:           creator,
+		Supply:            1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed on create item")
+	}
+	if !inserted {
+		if err := journal.Update(tx, ref, multi.ItemTableName(s.chain), keys,
+			map[string]interface{}{"owner": owner}); err != nil {
+			return errors.Wrap(err, "failed to update item owner")
+		}
+	}
+	// 与所有者变化在同一事务中记录, 重启后仍会重新统计
+	if err := outbox.Add(tx, s.chainId, outbox.KindCollectionAmounts, collection); err != nil {
+		return errors.Wrap(err, "failed on add collection amounts")
+	}
+
+	if action.activityType != 0 {
+		blockTime, err := s.headers.BlockTime(s.ctx, log)
+		if err != nil {
+			return errors.Wrap(err, "failed to get block time")
+		}
+		newActivity := multi.Activity{
+			ActivityType:      action.activityType,
+			Maker:             from.String(),
+			Taker:             to.String(),
+			CollectionAddress: collection,
+			TokenId:           tokenId,
+			CurrencyAddress:   s.cfg.ContractCfg.EthAddress,
+			Price:             decimal.Zero,
+			BlockNumber:       int64(log.BlockNumber),
+			TxHash:            log.TxHash.String(),
+			EventTime:         int64(blockTime),
+		}
+		if _, err := journal.Insert(tx, ref, multi.ActivityTableName(s.chain),
+			activityKeys(&newActivity), &newActivity); err != nil {
+			return errors.Wrap(err, "failed on create activity")
+		}
+	}
+
+	if action.notify {
+		if err := outbox.Add(tx, s.chainId, outbox.KindTradeEvent, &ordermanager.TradeEvent{
+			EventType:      ordermanager.Transfer,
+			CollectionAddr: collection,
+			TokenID:        tokenId,
+			From:           strings.ToLower(from.String()),
+			To:             owner,
+			TxHash:         log.TxHash.String(),
+		}); err != nil {
+			return errors.Wrap(err, "failed on add transfer event")
+		}
+	}
+	return nil
+}
+
+// updateCollectionAmounts 按NFT当前所有者统计collection的owner_amount/item_amount, 已销毁的NFT不计入
+func (s *Service) updateCollectionAmounts(collection string) error {
+	var amounts struct {
+		OwnerAmount int64
+		ItemAmount  int64
+	}
+	if err := s.db.WithContext(s.ctx).Table(multi.ItemTableName(s.chain)).
+		Select("count(distinct owner) as owner_amount, count(*) as item_amount").
+		Where("collection_address = ? and owner <> '' and owner <> ?", collection, ZeroAddress).
+		Scan(&amounts).Error; err != nil {
+		return errors.Wrap(err, "failed on count collection items")
+	}
+
+	if err := s.db.WithContext(s.ctx).Table(multi.CollectionTableName(s.chain)).
+		Where("address = ?", collection).
+		Updates(map[string]interface{}{
+			"owner_amount": amounts.OwnerAmount,
+			"item_amount":  amounts.ItemAmount,
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on update collection amounts")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package orderbookindexer
+
+import (
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+func TestClassifyTransfer(t *testing.T) {
+	zero := common.HexToAddress(ZeroAddress)
+	vault := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	alice := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	bob := common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+	tests := []struct {
+		name  string
+		from  common.Address
+		to    common.Address
+		vault common.Address
+		want  transferAction
+	}{
+		{"mint", zero, alice, vault, transferAction{activityType: multi.Mint, updateOwner: true, notify: true}},
+		{"transfer", alice, bob, vault, transferAction{activityType: multi.Transfer, updateOwner: true, notify: true}},
+		{"burn", alice, zero, vault, transferAction{activityType: multi.Transfer, updateOwner: true, notify: true}},
+		{"deposit into vault", alice, vault, vault, transferAction{}},
+		{"withdraw from vault", vault, bob, vault, transferAction{updateOwner: true}},
+		{"vault not configured", alice, bob, zero, transferAction{activityType: multi.Transfer, updateOwner: true, notify: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifyTransfer(tt.from, tt.to, tt.vault))
+		})
+	}
+}
+
+func TestOwnerRollbackEvents(t *testing.T) {
+	const items = "ob_item_sepolia"
+	rows := []reorg.UndoneRow{ // 按修改的逆序
+		{Table: items, Keys: map[string]interface{}{"id": "1"}, Prior: map[string]interface{}{"owner": "0xbob"}},
+		{Table: "ob_activity_sepolia", Keys: map[string]interface{}{"collection_address": "0xc1", "token_id": "1"}},
+		{Table: items, Keys: map[string]interface{}{"id": "1"}, Prior: map[string]interface{}{"owner": "0xalice"}},
+		{Table: items, Keys: map[string]interface{}{"collection_address": "0xc1", "token_id": "2"}}, // 回滚的区块中mint
+		{Table: items, Keys: map[string]interface{}{"id": "3"}, Prior: map[string]interface{}{"owner": "0xalice"}},
+		{Table: items, Keys: map[string]interface{}{"id": "4"}, Prior: map[string]interface{}{"name": "x"}},
+	}
+	current := []itemOwner{
+		{Id: 1, CollectionAddress: "0xc1", TokenId: "1", Owner: "0xcarol"},
+		{Id: 2, CollectionAddress: "0xc1", TokenId: "2", Owner: "0xbob"},
+		{Id: 3, CollectionAddress: "0xc2", TokenId: "1", Owner: "0xalice"}, // 转出后又转回, 所有者不变
+		{Id: 4, CollectionAddress: "0xc2", TokenId: "2", Owner: "0xbob"},
+	}
+
+	assert.Equal(t, []*ordermanager.TradeEvent{
+		{EventType: ordermanager.Transfer, CollectionAddr: "0xc1", TokenID: "2", From: "0xbob", To: ""},
+		{EventType: ordermanager.Transfer, CollectionAddr: "0xc1", TokenID: "1", From: "0xcarol", To: "0xalice"},
+	}, ownerRollbackEvents(rows, items, current))
+}
@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	KindTradeEvent = "trade_event"             // 订单管理器的价格更新队列
+	KindOrderQueue = base.OutboxKindOrderQueue // 订单管理器的挂单过期队列
+
+	KindCollectionAmounts = "collection_amounts" // 需要重新统计持有人数及NFT数量的collection
+)
+
+// Add 在事务tx中写入一条待投递消息, 与业务数据一起提交
+func Add(tx *gorm.DB, chainId int64, kind string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal outbox payload")
+	}
+
+	message := base.Outbox{
+		ChainId: chainId,
+		Kind:    kind,
+		Payload: string(raw),
+		Status:  base.OutboxStatusPending,
+	}
+	if err := tx.Table(base.OutboxTableName()).Create(&message).Error; err != nil {
+		return errors.Wrap(err, "failed on create outbox message")
+	}
+
+	return nil
+}
+
+// Store 待投递消息的存储
+type Store interface {
+	Pending(ctx context.Context, limit int) ([]base.Outbox, error)
+	Delete(ctx context.Context, id int64) error
+	MarkAttempt(ctx context.Context, id int64, attempts int, status int, lastErr string) error
+}
+
+type dbStore struct {
+	db      *gorm.DB
+	chainId int64
+}
+
+func NewStore(db *gorm.DB, chainId int64) Store {
+	return &dbStore{db: db, chainId: chainId}
+}
+
+func (s *dbStore) Pending(ctx context.Context, limit int) ([]base.Outbox, error) {
+	var messages []base.Outbox
+	if err := s.db.WithContext(ctx).Table(base.OutboxTableName()).
+		Where("chain_id = ? and status = ?", s.chainId, base.OutboxStatusPending).
+		Order("id asc").Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get pending outbox messages")
+	}
+
+	return messages, nil
+}
+
+func (s *dbStore) Delete(ctx context.Context, id int64) error {
+	if err := s.db.WithContext(ctx).Table(base.OutboxTableName()).
+		Where("id = ?", id).
+		Delete(&base.Outbox{}).Error; err != nil {
+		return errors.Wrap(err, "failed on delete outbox message")
+	}
+
+	return nil
+}
+
+func (s *dbStore) MarkAttempt(ctx context.Context, id int64, attempts int, status int, lastErr string) error {
+	if len(lastErr) > 512 {
+		lastErr = lastErr[:512]
+	}
+	if err := s.db.WithContext(ctx).Table(base.OutboxTableName()).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":   attempts,
+			"status":     status,
+			"last_error": lastErr,
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on update outbox message")
+	}
+
+	return nil
+}
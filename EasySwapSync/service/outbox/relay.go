@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultBatchSize   = 100
+	DefaultMaxAttempts = 10
+)
+
+// Sender 投递一条消息
+type Sender func(payload []byte) error
+
+// Relay 按写入顺序投递待发送消息, 投递成功后删除
+// 某条消息投递失败时停止本轮投递以保持顺序, 超过最大重试次数的消息标记为失败并跳过
+type Relay struct {
+	ctx         context.Context
+	store       Store
+	senders     map[string]Sender
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewRelay(ctx context.Context, store Store, interval time.Duration) *Relay {
+	return &Relay{
+		ctx:         ctx,
+		store:       store,
+		senders:     make(map[string]Sender),
+		interval:    interval,
+		batchSize:   DefaultBatchSize,
+		maxAttempts: DefaultMaxAttempts,
+	}
+}
+
+// Handle 注册某类消息的投递方式
+func (r *Relay) Handle(kind string, sender Sender) *Relay {
+	r.senders[kind] = sender
+	return r
+}
+
+func (r *Relay) Run() {
+	for {
+		select {
+		case <-r.ctx.Done():
+			xzap.WithContext(r.ctx).Info("outbox relay stopped due to context cancellation")
+			return
+		default:
+		}
+
+		sent, err := r.RelayOnce()
+		if err != nil {
+			xzap.WithContext(r.ctx).Warn("failed on relay outbox messages", zap.Error(err))
+		}
+		if err != nil || sent < r.batchSize {
+			time.Sleep(r.interval)
+		}
+	}
+}
+
+// RelayOnce 投递一批消息, 返回投递成功的数量
+func (r *Relay) RelayOnce() (int, error) {
+	messages, err := r.store.Pending(r.ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+	for _, message := range messages {
+		sendErr := errors.Errorf("no sender for outbox kind %s", message.Kind)
+		if sender, ok := r.senders[message.Kind]; ok {
+			sendErr = sender([]byte(message.Payload))
+		}
+		if sendErr == nil {
+			if err := r.store.Delete(r.ctx, message.Id); err != nil {
+				return sent, err
+			}
+			sent++
+			continue
+		}
+
+		attempts := message.Attempts + 1
+		status := base.OutboxStatusPending
+		if attempts >= r.maxAttempts {
+			status = base.OutboxStatusFailed
+		}
+		if err := r.store.MarkAttempt(r.ctx, message.Id, attempts, status, sendErr.Error()); err != nil {
+			return sent, err
+		}
+		if status == base.OutboxStatusFailed {
+			xzap.WithContext(r.ctx).Error("outbox message dropped after max attempts",
+				zap.Int64("id", message.Id), zap.String("kind", message.Kind), zap.Error(sendErr))
+			continue
+		}
+		return sent, errors.Wrapf(sendErr, "failed on send outbox message %d", message.Id)
+	}
+
+	return sent, nil
+}
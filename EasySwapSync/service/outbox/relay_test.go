@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type memoryStore struct {
+	messages map[int64]*base.Outbox
+}
+
+func newMemoryStore(messages ...base.Outbox) *memoryStore {
+	store := &memoryStore{messages: make(map[int64]*base.Outbox)}
+	for i := range messages {
+		store.messages[messages[i].Id] = &messages[i]
+	}
+	return store
+}
+
+func (m *memoryStore) Pending(ctx context.Context, limit int) ([]base.Outbox, error) {
+	var pending []base.Outbox
+	for _, message := range m.messages {
+		if message.Status == base.OutboxStatusPending {
+			pending = append(pending, *message)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Id < pending[j].Id })
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, id int64) error {
+	delete(m.messages, id)
+	return nil
+}
+
+func (m *memoryStore) MarkAttempt(ctx context.Context, id int64, attempts int, status int, lastErr string) error {
+	m.messages[id].Attempts = attempts
+	m.messages[id].Status = status
+	m.messages[id].LastError = lastErr
+	return nil
+}
+
+func testContext() context.Context {
+	return xzap.ToContext(context.Background(), zap.NewNop())
+}
+
+func TestRelayKeepsOrderOnFailure(t *testing.T) {
+	store := newMemoryStore(
+		base.Outbox{Id: 1, Kind: KindTradeEvent, Payload: "a"},
+		base.Outbox{Id: 2, Kind: KindOrderQueue, Payload: "b"},
+		base.Outbox{Id: 3, Kind: KindTradeEvent, Payload: "c"},
+	)
+
+	var delivered []string
+	redisDown := true
+	relay := NewRelay(testContext(), store, 0).
+		Handle(KindTradeEvent, func(payload []byte) error {
+			delivered = append(delivered, string(payload))
+			return nil
+		}).
+		Handle(KindOrderQueue, func(payload []byte) error {
+			if redisDown {
+				return errors.New("redis unavailable")
+			}
+			delivered = append(delivered, string(payload))
+			return nil
+		})
+
+	sent, err := relay.RelayOnce()
+	assert.Error(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"a"}, delivered)
+	require.Contains(t, store.messages, int64(2))
+	assert.Equal(t, 1, store.messages[2].Attempts)
+	assert.Contains(t, store.messages, int64(3))
+
+	redisDown = false
+	sent, err = relay.RelayOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []string{"a", "b", "c"}, delivered)
+	assert.Empty(t, store.messages)
+}
+
+func TestRelayDropsAfterMaxAttempts(t *testing.T) {
+	store := newMemoryStore(
+		base.Outbox{Id: 1, Kind: "unknown", Payload: "a", Attempts: DefaultMaxAttempts - 1},
+		base.Outbox{Id: 2, Kind: KindTradeEvent, Payload: "b"},
+	)
+
+	var delivered []string
+	relay := NewRelay(testContext(), store, 0).
+		Handle(KindTradeEvent, func(payload []byte) error {
+			delivered = append(delivered, string(payload))
+			return nil
+		})
+
+	sent, err := relay.RelayOnce()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"b"}, delivered)
+	require.Contains(t, store.messages, int64(1))
+	assert.Equal(t, base.OutboxStatusFailed, store.messages[1].Status)
+	assert.Contains(t, store.messages[1].LastError, "no sender")
+}
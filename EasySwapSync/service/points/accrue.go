@@ -0,0 +1,103 @@
+package points
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// Change 一次余额变动, Quantity为最小单位(wei), 转出为负数
+type Change struct {
+	Owner      string
+	Quantity   decimal.Decimal
+	ChangeTime int64
+}
+
+// Accrual 单个账户在一个周期内的积分
+type Accrual struct {
+	Owner      string
+	EpochStart int64
+	EpochEnd   int64
+	Opening    decimal.Decimal // 周期开始时的余额(wei)
+	Closing    decimal.Decimal // 周期结束时的余额(wei)
+	Integral   decimal.Decimal // 余额对持有秒数的积分(wei*秒)
+	Points     decimal.Decimal
+}
+
+// Accrue 计算周期[start, end)内每个账户的积分
+// opening为周期开始时的余额, changes为周期内的余额变动, 变动在change_time时刻生效
+// 积分 = 余额(代币)*持有小时数*rate*multiplier, 余额为负的时段不计积分
+// 结果按账户排序, 只与输入有关, 重复计算得到相同结果
+func Accrue(opening map[string]decimal.Decimal, changes []Change, start, end int64, decimals int32, rate, multiplier decimal.Decimal) []Accrual {
+	byOwner := make(map[string][]Change)
+	for _, change := range changes {
+		byOwner[change.Owner] = append(byOwner[change.Owner], change)
+	}
+	owners := make([]string, 0, len(opening)+len(byOwner))
+	for owner, balance := range opening {
+		if _, ok := byOwner[owner]; !ok && balance.IsZero() {
+			continue
+		}
+		owners = append(owners, owner)
+	}
+	for owner := range byOwner {
+		if _, ok := opening[owner]; !ok {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+
+	accruals := make([]Accrual, 0, len(owners))
+	for _, owner := range owners {
+		ownerChanges := byOwner[owner]
+		sort.SliceStable(ownerChanges, func(i, j int) bool { return ownerChanges[i].ChangeTime < ownerChanges[j].ChangeTime })
+
+		balance := opening[owner]
+		integral := decimal.Zero
+		last := start
+		for _, change := range ownerChanges {
+			at := clamp(change.ChangeTime, start, end)
+			integral = integral.Add(holding(balance, at-last))
+			balance = balance.Add(change.Quantity)
+			last = at
+		}
+		integral = integral.Add(holding(balance, end-last))
+
+		accruals = append(accruals, Accrual{
+			Owner:      owner,
+			EpochStart: start,
+			EpochEnd:   end,
+			Opening:    opening[owner],
+			Closing:    balance,
+			Integral:   integral,
+			Points:     PointsOf(integral, decimals, rate, multiplier),
+		})
+	}
+
+	return accruals
+}
+
+// PointsOf 将wei*秒的积分按代币精度、费率和倍数换算为积分
+func PointsOf(integral decimal.Decimal, decimals int32, rate, multiplier decimal.Decimal) decimal.Decimal {
+	return integral.Shift(-decimals).
+		Mul(rate).
+		Mul(multiplier).
+		DivRound(decimal.NewFromInt(HourSeconds), PointsPrecision)
+}
+
+func holding(balance decimal.Decimal, seconds int64) decimal.Decimal {
+	if !balance.IsPositive() || seconds <= 0 {
+		return decimal.Zero
+	}
+	return balance.Mul(decimal.NewFromInt(seconds))
+}
+
+func clamp(t, start, end int64) int64 {
+	if t < start {
+		return start
+	}
+	if t > end {
+		return end
+	}
+	return t
+}
@@ -0,0 +1,105 @@
+package points
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wei(tokens string) decimal.Decimal {
+	return decimal.RequireFromString(tokens).Shift(18)
+}
+
+func TestAccrue(t *testing.T) {
+	type want struct {
+		owner   string
+		closing string // 代币
+		points  string
+	}
+	tests := []struct {
+		name       string
+		opening    map[string]decimal.Decimal
+		changes    []Change
+		multiplier string
+		want       []want
+	}{
+		{
+			name:    "hold whole epoch",
+			opening: map[string]decimal.Decimal{"alice": wei("100")},
+			want:    []want{{"alice", "100", "5"}},
+		},
+		{
+			name:    "mint at half epoch",
+			changes: []Change{{Owner: "alice", Quantity: wei("100"), ChangeTime: 1800}},
+			want:    []want{{"alice", "100", "2.5"}},
+		},
+		{
+			name:    "transfer moves holding time",
+			opening: map[string]decimal.Decimal{"alice": wei("100")},
+			changes: []Change{
+				{Owner: "alice", Quantity: wei("-40"), ChangeTime: 900},
+				{Owner: "bob", Quantity: wei("40"), ChangeTime: 900},
+			},
+			// alice: 100*0.25h + 60*0.75h = 70 token*h, bob: 40*0.75h = 30 token*h
+			want: []want{{"alice", "60", "3.5"}, {"bob", "40", "1.5"}},
+		},
+		{
+			name:    "fractional balance keeps precision",
+			changes: []Change{{Owner: "alice", Quantity: decimal.RequireFromString("1500000000000000001"), ChangeTime: 0}},
+			want:    []want{{"alice", "1.500000000000000001", "0.075"}},
+		},
+		{
+			name:    "burn all at start",
+			opening: map[string]decimal.Decimal{"alice": wei("10")},
+			changes: []Change{{Owner: "alice", Quantity: wei("-10"), ChangeTime: 0}},
+			want:    []want{{"alice", "0", "0"}},
+		},
+		{
+			name:    "unsorted changes",
+			changes: []Change{{Owner: "alice", Quantity: wei("-50"), ChangeTime: 2700}, {Owner: "alice", Quantity: wei("100"), ChangeTime: 900}},
+			// 100*0.5h + 50*0.25h = 62.5 token*h
+			want: []want{{"alice", "50", "3.125"}},
+		},
+		{
+			name:       "multiplier",
+			opening:    map[string]decimal.Decimal{"alice": wei("100")},
+			multiplier: "2",
+			want:       []want{{"alice", "100", "10"}},
+		},
+		{
+			name:    "zero opening without changes skipped",
+			opening: map[string]decimal.Decimal{"alice": decimal.Zero},
+			want:    []want{},
+		},
+		{
+			name:    "negative balance earns nothing",
+			opening: map[string]decimal.Decimal{"alice": wei("-5")},
+			want:    []want{{"alice", "-5", "0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			multiplier := decimal.NewFromInt(1)
+			if tt.multiplier != "" {
+				multiplier = decimal.RequireFromString(tt.multiplier)
+			}
+			accruals := Accrue(tt.opening, tt.changes, 0, 3600, 18, DefaultRate, multiplier)
+			require.Len(t, accruals, len(tt.want))
+			for i, w := range tt.want {
+				assert.Equal(t, w.owner, accruals[i].Owner)
+				assert.Equal(t, w.closing, accruals[i].Closing.Shift(-18).String())
+				assert.Equal(t, w.points, accruals[i].Points.String())
+				assert.Equal(t, int64(0), accruals[i].EpochStart)
+				assert.Equal(t, int64(3600), accruals[i].EpochEnd)
+			}
+		})
+	}
+}
+
+func TestPointsOfDecimals(t *testing.T) {
+	// 6位精度的代币, 1代币持有1小时
+	integral := decimal.NewFromInt(1_000_000 * HourSeconds)
+	assert.Equal(t, "0.05", PointsOf(integral, 6, DefaultRate, decimal.NewFromInt(1)).String())
+}
@@ -0,0 +1,173 @@
+package points
+
+import (
+	"context"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+const DefaultMaxEpochs = 24 // 每轮最多计算的周期数
+
+// Engine 按周期顺序计算积分
+// 每个周期的积分只由余额变动和配置决定, 清空后重新计算(Replay)得到相同结果
+// 发现已计算周期内有晚到的余额变动时, 从该周期起重新计算
+type Engine struct {
+	ctx         context.Context
+	store       Store
+	schedule    *Schedule
+	decimals    int32
+	syncedUntil func() (int64, error) // 余额变动已完整落库的时间, 只计算结束时间不晚于它的周期
+	now         func() int64
+	interval    time.Duration
+	maxEpochs   int
+}
+
+func NewEngine(ctx context.Context, store Store, schedule *Schedule, decimals int32, syncedUntil func() (int64, error), interval time.Duration) *Engine {
+	return &Engine{
+		ctx:         ctx,
+		store:       store,
+		schedule:    schedule,
+		decimals:    decimals,
+		syncedUntil: syncedUntil,
+		now:         func() int64 { return time.Now().Unix() },
+		interval:    interval,
+		maxEpochs:   DefaultMaxEpochs,
+	}
+}
+
+func (e *Engine) Run() {
+	for {
+		select {
+		case <-e.ctx.Done():
+			xzap.WithContext(e.ctx).Info("points engine stopped due to context cancellation")
+			return
+		default:
+		}
+
+		computed, err := e.RunOnce()
+		if err != nil {
+			xzap.WithContext(e.ctx).Warn("failed on compute points", zap.Error(err))
+		}
+		if err != nil || computed < e.maxEpochs {
+			time.Sleep(e.interval)
+		}
+	}
+}
+
+// Replay 清空所有周期积分, 之后从第一条余额变动重新计算
+func (e *Engine) Replay() error {
+	first, ok, err := e.store.FirstChangeTime(e.ctx)
+	if err != nil {
+		return err
+	}
+	from := int64(0)
+	if ok {
+		from = e.schedule.EpochStart(first)
+	}
+	if err := e.store.Rewind(e.ctx, from); err != nil {
+		return errors.Wrap(err, "failed on rewind points")
+	}
+	return nil
+}
+
+// RunOnce 计算已完整同步的周期, 返回计算的周期数
+func (e *Engine) RunOnce() (int, error) {
+	cursor, ok, err := e.store.Cursor(e.ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		first, ok, err := e.store.FirstChangeTime(e.ctx)
+		if err != nil || !ok {
+			return 0, err
+		}
+		// 首次计算时清掉旧的累计积分, 与Replay结果一致
+		cursor = e.schedule.EpochStart(first)
+		if err := e.store.Rewind(e.ctx, cursor); err != nil {
+			return 0, errors.Wrap(err, "failed on rewind points")
+		}
+	}
+
+	late, ok, err := e.store.EarliestUncounted(e.ctx, cursor)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		from := e.schedule.EpochStart(late)
+		xzap.WithContext(e.ctx).Warn("late balance change found, recompute points",
+			zap.Int64("from", from), zap.Int64("cursor", cursor))
+		if err := e.store.Rewind(e.ctx, from); err != nil {
+			return 0, errors.Wrap(err, "failed on rewind points")
+		}
+		cursor = from
+	}
+
+	until, err := e.syncedUntil()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed on get balance sync progress")
+	}
+	if now := e.now(); now < until {
+		until = now
+	}
+
+	var (
+		computed int
+		balances map[string]decimal.Decimal
+	)
+	for computed < e.maxEpochs {
+		start, end := cursor, cursor+e.schedule.EpochSeconds
+		if end > until {
+			break
+		}
+
+		if balances == nil {
+			if balances, err = e.store.Balances(e.ctx, start); err != nil {
+				return computed, err
+			}
+		}
+		changes, err := e.store.Changes(e.ctx, start, end)
+		if err != nil {
+			return computed, err
+		}
+
+		rate, multiplier := e.schedule.RateAt(start), e.schedule.MultiplierAt(start)
+		accruals := Accrue(balances, changes, start, end, e.decimals, rate, multiplier)
+		epoch := multi.IntegralEpoch{
+			EpochStart: start,
+			EpochEnd:   end,
+			Rate:       rate,
+			Multiplier: multiplier,
+			Points:     decimal.Zero,
+		}
+		for _, accrual := range accruals {
+			if accrual.Closing.IsPositive() {
+				epoch.Holders++
+			}
+			epoch.Points = epoch.Points.Add(accrual.Points)
+		}
+		if err := e.store.SaveEpoch(e.ctx, epoch, accruals); err != nil {
+			return computed, err
+		}
+
+		// 下一个周期的期初余额即本周期的期末余额
+		balances = make(map[string]decimal.Decimal, len(accruals))
+		for _, accrual := range accruals {
+			if !accrual.Closing.IsZero() {
+				balances[accrual.Owner] = accrual.Closing
+			}
+		}
+		cursor = end
+		computed++
+	}
+
+	if computed > 0 {
+		xzap.WithContext(e.ctx).Info("sync integral ...",
+			zap.Int("epochs", computed), zap.Int64("end_time", cursor))
+	}
+	return computed, nil
+}
@@ -0,0 +1,221 @@
+package points
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+type memoryChange struct {
+	Change
+	counted bool
+}
+
+type memoryStore struct {
+	changes []*memoryChange
+	epochs  []multi.IntegralEpoch
+	details []multi.IntegralDetail
+	sums    map[string]decimal.Decimal
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{sums: make(map[string]decimal.Decimal)}
+}
+
+func (m *memoryStore) add(owner string, tokens string, at int64) {
+	m.changes = append(m.changes, &memoryChange{Change: Change{Owner: owner, Quantity: wei(tokens), ChangeTime: at}})
+}
+
+func (m *memoryStore) Cursor(ctx context.Context) (int64, bool, error) {
+	if len(m.epochs) == 0 {
+		return 0, false, nil
+	}
+	return m.epochs[len(m.epochs)-1].EpochEnd, true, nil
+}
+
+func (m *memoryStore) FirstChangeTime(ctx context.Context) (int64, bool, error) {
+	var first int64
+	found := false
+	for _, change := range m.changes {
+		if !found || change.ChangeTime < first {
+			first, found = change.ChangeTime, true
+		}
+	}
+	return first, found, nil
+}
+
+func (m *memoryStore) EarliestUncounted(ctx context.Context, before int64) (int64, bool, error) {
+	var earliest int64
+	found := false
+	for _, change := range m.changes {
+		if change.counted || change.ChangeTime >= before {
+			continue
+		}
+		if !found || change.ChangeTime < earliest {
+			earliest, found = change.ChangeTime, true
+		}
+	}
+	return earliest, found, nil
+}
+
+func (m *memoryStore) Balances(ctx context.Context, at int64) (map[string]decimal.Decimal, error) {
+	balances := make(map[string]decimal.Decimal)
+	for _, change := range m.changes {
+		if change.ChangeTime < at {
+			balances[change.Owner] = balances[change.Owner].Add(change.Quantity)
+		}
+	}
+	for owner, balance := range balances {
+		if balance.IsZero() {
+			delete(balances, owner)
+		}
+	}
+	return balances, nil
+}
+
+func (m *memoryStore) Changes(ctx context.Context, start, end int64) ([]Change, error) {
+	var changes []Change
+	for _, change := range m.changes {
+		if change.ChangeTime >= start && change.ChangeTime < end {
+			changes = append(changes, change.Change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].ChangeTime < changes[j].ChangeTime })
+	return changes, nil
+}
+
+func (m *memoryStore) SaveEpoch(ctx context.Context, epoch multi.IntegralEpoch, accruals []Accrual) error {
+	m.epochs = append(m.epochs, epoch)
+	for _, accrual := range accruals {
+		m.details = append(m.details, multi.IntegralDetail{
+			Owner:          accrual.Owner,
+			EpochStart:     accrual.EpochStart,
+			EpochEnd:       accrual.EpochEnd,
+			OpeningBalance: accrual.Opening,
+			ClosingBalance: accrual.Closing,
+			Points:         accrual.Points,
+		})
+		m.sums[accrual.Owner] = m.sums[accrual.Owner].Add(accrual.Points)
+	}
+	for _, change := range m.changes {
+		if change.ChangeTime >= epoch.EpochStart && change.ChangeTime < epoch.EpochEnd {
+			change.counted = true
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) Rewind(ctx context.Context, from int64) error {
+	var epochs []multi.IntegralEpoch
+	for _, epoch := range m.epochs {
+		if epoch.EpochStart < from {
+			epochs = append(epochs, epoch)
+		}
+	}
+	var details []multi.IntegralDetail
+	m.sums = make(map[string]decimal.Decimal)
+	for _, detail := range m.details {
+		if detail.EpochStart < from {
+			details = append(details, detail)
+			m.sums[detail.Owner] = m.sums[detail.Owner].Add(detail.Points)
+		}
+	}
+	m.epochs, m.details = epochs, details
+	for _, change := range m.changes {
+		if change.ChangeTime >= from {
+			change.counted = false
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) snapshot() map[string]string {
+	sums := make(map[string]string, len(m.sums))
+	for owner, sum := range m.sums {
+		sums[owner] = sum.String()
+	}
+	return sums
+}
+
+func newTestEngine(t *testing.T, store Store, syncedUntil *int64) *Engine {
+	schedule, err := NewSchedule(config.PointsCfg{
+		Multipliers: []config.PointsMultiple{{Start: 7200, End: 10800, Multiplier: "2"}},
+	})
+	require.NoError(t, err)
+
+	ctx := xzap.ToContext(context.Background(), zap.NewNop())
+	engine := NewEngine(ctx, store, schedule, 18, func() (int64, error) { return *syncedUntil, nil }, 0)
+	engine.now = func() int64 { return 1 << 40 }
+	engine.maxEpochs = 2
+	return engine
+}
+
+func runAll(t *testing.T, engine *Engine) {
+	for {
+		computed, err := engine.RunOnce()
+		require.NoError(t, err)
+		if computed == 0 {
+			return
+		}
+	}
+}
+
+func TestEngineIncrementalEqualsReplay(t *testing.T) {
+	store := newMemoryStore()
+	store.add("alice", "100", 1800)  // epoch [0, 3600)
+	store.add("alice", "-40", 4500)  // epoch [3600, 7200)
+	store.add("bob", "40", 4500)     //
+	store.add("bob", "-40", 9000)    // epoch [7200, 10800), x2
+	store.add("carol", "40", 9000)   //
+	store.add("alice", "-60", 12600) // epoch [10800, 14400)
+
+	syncedUntil := int64(5000)
+	engine := newTestEngine(t, store, &syncedUntil)
+
+	// 同步进度只覆盖第一个周期
+	runAll(t, engine)
+	require.Len(t, store.epochs, 1)
+	assert.Equal(t, map[string]string{"alice": "2.5"}, store.snapshot())
+
+	syncedUntil = 20000
+	runAll(t, engine)
+	require.Len(t, store.epochs, 5)
+	// alice: 2.5 + (100*0.25+60*0.75)*0.05 + 60*0.05*2 + 60*0.5*0.05 + 0
+	// bob: 40*0.75*0.05 + 40*0.5*0.05*2
+	// carol: 40*0.5*0.05*2 + 40*0.05 + 40*0.05
+	incremental := map[string]string{"alice": "13.5", "bob": "3.5", "carol": "6"}
+	assert.Equal(t, incremental, store.snapshot())
+	assert.Equal(t, int64(1), store.epochs[4].Holders)
+
+	require.NoError(t, engine.Replay())
+	assert.Empty(t, store.epochs)
+	runAll(t, engine)
+	assert.Equal(t, incremental, store.snapshot())
+	require.Len(t, store.epochs, 5)
+}
+
+func TestEngineRecomputesLateChange(t *testing.T) {
+	store := newMemoryStore()
+	store.add("alice", "100", 0)
+
+	syncedUntil := int64(3 * 3600)
+	engine := newTestEngine(t, store, &syncedUntil)
+	runAll(t, engine)
+	require.Len(t, store.epochs, 3)
+	assert.Equal(t, map[string]string{"alice": "20"}, store.snapshot())
+
+	// 已计算周期内晚到的转出
+	store.add("alice", "-100", 3600)
+	runAll(t, engine)
+	require.Len(t, store.epochs, 3)
+	assert.Equal(t, map[string]string{"alice": "5"}, store.snapshot())
+}
@@ -0,0 +1,109 @@
+package points
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+const (
+	DefaultEpochSeconds = 3600
+	HourSeconds         = 3600
+	PointsPrecision     = 8 // 积分保留的小数位数
+)
+
+// DefaultRate 未配置费率表时每代币每小时的积分
+var DefaultRate = decimal.RequireFromString("0.05")
+
+// Rate 自Since(含)开始的周期使用的费率
+type Rate struct {
+	Since int64
+	Rate  decimal.Decimal
+}
+
+// Multiplier 开始时间落在[Start, End)内的周期乘以Multiplier
+type Multiplier struct {
+	Start      int64
+	End        int64
+	Multiplier decimal.Decimal
+}
+
+// Schedule 周期划分及每个周期的费率和倍数, 只依赖配置, 相同配置下结果确定
+type Schedule struct {
+	EpochSeconds int64
+	Rates        []Rate // 按Since升序
+	Multipliers  []Multiplier
+}
+
+func NewSchedule(cfg config.PointsCfg) (*Schedule, error) {
+	schedule := &Schedule{EpochSeconds: cfg.EpochSeconds}
+	if schedule.EpochSeconds == 0 {
+		schedule.EpochSeconds = DefaultEpochSeconds
+	}
+	if schedule.EpochSeconds < 0 {
+		return nil, errors.Errorf("invalid points epoch seconds %d", cfg.EpochSeconds)
+	}
+
+	for _, rate := range cfg.Rates {
+		value, err := decimal.NewFromString(rate.Rate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid points rate %s", rate.Rate)
+		}
+		if value.IsNegative() {
+			return nil, errors.Errorf("negative points rate %s", rate.Rate)
+		}
+		schedule.Rates = append(schedule.Rates, Rate{Since: rate.Since, Rate: value})
+	}
+	if len(schedule.Rates) == 0 {
+		schedule.Rates = []Rate{{Since: 0, Rate: DefaultRate}}
+	}
+	sort.SliceStable(schedule.Rates, func(i, j int) bool { return schedule.Rates[i].Since < schedule.Rates[j].Since })
+
+	for _, multiplier := range cfg.Multipliers {
+		value, err := decimal.NewFromString(multiplier.Multiplier)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid points multiplier %s", multiplier.Multiplier)
+		}
+		if value.IsNegative() || multiplier.End <= multiplier.Start {
+			return nil, errors.Errorf("invalid points multiplier %s [%d, %d)", multiplier.Multiplier, multiplier.Start, multiplier.End)
+		}
+		schedule.Multipliers = append(schedule.Multipliers, Multiplier{Start: multiplier.Start, End: multiplier.End, Multiplier: value})
+	}
+
+	return schedule, nil
+}
+
+// EpochStart 时间t所在周期的开始时间, 周期按UTC从1970-01-01起对齐
+func (s *Schedule) EpochStart(t int64) int64 {
+	start := t - t%s.EpochSeconds
+	if t < 0 && t%s.EpochSeconds != 0 {
+		start -= s.EpochSeconds
+	}
+	return start
+}
+
+// RateAt 开始于epochStart的周期的费率, 早于费率表第一项时为0
+func (s *Schedule) RateAt(epochStart int64) decimal.Decimal {
+	rate := decimal.Zero
+	for _, r := range s.Rates {
+		if r.Since > epochStart {
+			break
+		}
+		rate = r.Rate
+	}
+	return rate
+}
+
+// MultiplierAt 开始于epochStart的周期的倍数, 多个倍数重叠时相乘
+func (s *Schedule) MultiplierAt(epochStart int64) decimal.Decimal {
+	multiplier := decimal.NewFromInt(1)
+	for _, m := range s.Multipliers {
+		if epochStart >= m.Start && epochStart < m.End {
+			multiplier = multiplier.Mul(m.Multiplier)
+		}
+	}
+	return multiplier
+}
@@ -0,0 +1,83 @@
+package points
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ProjectsTask/EasySwapSync/service/config"
+)
+
+func TestNewSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.PointsCfg
+		wantErr bool
+	}{
+		{"defaults", config.PointsCfg{}, false},
+		{"negative epoch", config.PointsCfg{EpochSeconds: -1}, true},
+		{"bad rate", config.PointsCfg{Rates: []config.PointsRate{{Since: 0, Rate: "abc"}}}, true},
+		{"negative rate", config.PointsCfg{Rates: []config.PointsRate{{Since: 0, Rate: "-1"}}}, true},
+		{"empty multiplier window", config.PointsCfg{Multipliers: []config.PointsMultiple{{Start: 10, End: 10, Multiplier: "2"}}}, true},
+		{"bad multiplier", config.PointsCfg{Multipliers: []config.PointsMultiple{{Start: 0, End: 10, Multiplier: "x"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchedule(tt.cfg)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScheduleEpochStart(t *testing.T) {
+	schedule, err := NewSchedule(config.PointsCfg{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		t    int64
+		want int64
+	}{
+		{0, 0},
+		{3599, 0},
+		{3600, 3600},
+		{1755805572, 1755802800}, // 2025-08-21 19:46:12 UTC => 19:00:00 UTC
+		{-1, -3600},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, schedule.EpochStart(tt.t), "t=%d", tt.t)
+	}
+}
+
+func TestScheduleRateAndMultiplier(t *testing.T) {
+	schedule, err := NewSchedule(config.PointsCfg{
+		Rates: []config.PointsRate{
+			{Since: 7200, Rate: "0.1"},
+			{Since: 3600, Rate: "0.05"},
+		},
+		Multipliers: []config.PointsMultiple{
+			{Start: 3600, End: 10800, Multiplier: "2"},
+			{Start: 7200, End: 10800, Multiplier: "1.5"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		epochStart     int64
+		wantRate       string
+		wantMultiplier string
+	}{
+		{0, "0", "1"},
+		{3600, "0.05", "2"},
+		{7200, "0.1", "3"},
+		{10800, "0.1", "1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.wantRate, schedule.RateAt(tt.epochStart).String(), "epoch=%d", tt.epochStart)
+		assert.Equal(t, tt.wantMultiplier, schedule.MultiplierAt(tt.epochStart).String(), "epoch=%d", tt.epochStart)
+	}
+}
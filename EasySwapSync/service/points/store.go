@@ -0,0 +1,196 @@
+package points
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+)
+
+// Store 积分计算的输入(余额变动)和输出(周期积分)
+type Store interface {
+	// Cursor 最近一次计算的周期结束时间
+	Cursor(ctx context.Context) (int64, bool, error)
+	// FirstChangeTime 第一条余额变动的时间
+	FirstChangeTime(ctx context.Context) (int64, bool, error)
+	// EarliestUncounted before之前未计入积分的最早的余额变动时间, 用于发现晚到的余额变动
+	EarliestUncounted(ctx context.Context, before int64) (int64, bool, error)
+	// Balances at之前(不含)所有余额变动累加得到的非零余额
+	Balances(ctx context.Context, at int64) (map[string]decimal.Decimal, error)
+	// Changes [start, end)内的余额变动, 按时间升序
+	Changes(ctx context.Context, start, end int64) ([]Change, error)
+	// SaveEpoch 在一个事务中写入周期及账户积分, 累加账户总积分, 并将周期内的余额变动标记为已计入
+	SaveEpoch(ctx context.Context, epoch multi.IntegralEpoch, accruals []Accrual) error
+	// Rewind 删除from及之后的周期, 按剩余周期重建账户总积分
+	Rewind(ctx context.Context, from int64) error
+}
+
+type dbStore struct {
+	db           *gorm.DB
+	chainId      int64
+	chain        string
+	balanceTable string
+	token        string
+}
+
+// NewStore balanceTable为余额变动明细表, 只统计token合约的余额
+func NewStore(db *gorm.DB, chainId int64, chain string, balanceTable string, token string) Store {
+	return &dbStore{db: db, chainId: chainId, chain: chain, balanceTable: balanceTable, token: token}
+}
+
+func (s *dbStore) balances(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx).Table(s.balanceTable).Where("token_address = ?", s.token)
+}
+
+func (s *dbStore) Cursor(ctx context.Context) (int64, bool, error) {
+	var cursor *int64
+	if err := s.db.WithContext(ctx).Table(multi.IntegralEpochTableName(s.chain)).
+		Select("max(epoch_end)").
+		Scan(&cursor).Error; err != nil {
+		return 0, false, errors.Wrap(err, "failed on get integral cursor")
+	}
+	if cursor == nil {
+		return 0, false, nil
+	}
+	return *cursor, true, nil
+}
+
+func (s *dbStore) FirstChangeTime(ctx context.Context) (int64, bool, error) {
+	var first *int64
+	if err := s.balances(ctx).Select("min(change_time)").Scan(&first).Error; err != nil {
+		return 0, false, errors.Wrap(err, "failed on get first balance change")
+	}
+	if first == nil {
+		return 0, false, nil
+	}
+	return *first, true, nil
+}
+
+func (s *dbStore) EarliestUncounted(ctx context.Context, before int64) (int64, bool, error) {
+	var earliest *int64
+	if err := s.balances(ctx).Select("min(change_time)").
+		Where("whether_integral = ? and change_time < ?", "N", before).
+		Scan(&earliest).Error; err != nil {
+		return 0, false, errors.Wrap(err, "failed on get uncounted balance change")
+	}
+	if earliest == nil {
+		return 0, false, nil
+	}
+	return *earliest, true, nil
+}
+
+func (s *dbStore) Balances(ctx context.Context, at int64) (map[string]decimal.Decimal, error) {
+	var rows []struct {
+		Owner    string
+		Quantity decimal.Decimal
+	}
+	if err := s.balances(ctx).Select("owner, sum(quantity) as quantity").
+		Where("change_time < ?", at).
+		Group("owner").
+		Having("sum(quantity) <> 0").
+		Scan(&rows).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get balances")
+	}
+
+	balances := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		balances[row.Owner] = row.Quantity
+	}
+	return balances, nil
+}
+
+func (s *dbStore) Changes(ctx context.Context, start, end int64) ([]Change, error) {
+	var changes []Change
+	if err := s.balances(ctx).Select("owner, quantity, change_time").
+		Where("change_time >= ? and change_time < ?", start, end).
+		Order("change_time asc, id asc").
+		Scan(&changes).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get balance changes")
+	}
+	return changes, nil
+}
+
+func (s *dbStore) SaveEpoch(ctx context.Context, epoch multi.IntegralEpoch, accruals []Accrual) error {
+	details := make([]multi.IntegralDetail, 0, len(accruals))
+	sums := make([]multi.IntegralSum, 0, len(accruals))
+	for _, accrual := range accruals {
+		details = append(details, multi.IntegralDetail{
+			ChainId:        s.chainId,
+			Owner:          accrual.Owner,
+			EpochStart:     accrual.EpochStart,
+			EpochEnd:       accrual.EpochEnd,
+			OpeningBalance: accrual.Opening,
+			ClosingBalance: accrual.Closing,
+			Points:         accrual.Points,
+		})
+		sums = append(sums, multi.IntegralSum{
+			ChainId:      s.chainId,
+			Owner:        accrual.Owner,
+			Integral:     accrual.Points,
+			DeadlineTime: accrual.EpochEnd,
+		})
+	}
+
+	epoch.ChainId = s.chainId
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.IntegralEpochTableName(s.chain)).Create(&epoch).Error; err != nil {
+			return errors.Wrap(err, "failed on create integral epoch")
+		}
+		if len(details) > 0 {
+			if err := tx.Table(multi.IntegralDetailTableName(s.chain)).
+				CreateInBatches(&details, comm.DBBatchSizeLimit).Error; err != nil {
+				return errors.Wrap(err, "failed on create integral detail")
+			}
+			if err := tx.Table(multi.IntegralSumTableName(s.chain)).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "owner"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"integral": gorm.Expr("integral + VALUES(integral)"), "deadline_time": gorm.Expr("VALUES(deadline_time)")}),
+			}).CreateInBatches(&sums, comm.DBBatchSizeLimit).Error; err != nil {
+				return errors.Wrap(err, "failed on create integral_sum")
+			}
+		}
+		if err := tx.Table(s.balanceTable).
+			Where("token_address = ? and change_time >= ? and change_time < ?", s.token, epoch.EpochStart, epoch.EpochEnd).
+			Update("whether_integral", "Y").Error; err != nil {
+			return errors.Wrap(err, "failed on update balance")
+		}
+		return nil
+	})
+}
+
+func (s *dbStore) Rewind(ctx context.Context, from int64) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(multi.IntegralEpochTableName(s.chain)).
+			Where("epoch_start >= ?", from).
+			Delete(&multi.IntegralEpoch{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete integral epoch")
+		}
+		if err := tx.Table(multi.IntegralDetailTableName(s.chain)).
+			Where("epoch_start >= ?", from).
+			Delete(&multi.IntegralDetail{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete integral detail")
+		}
+
+		if err := tx.Exec(fmt.Sprintf(`DELETE FROM %s`, multi.IntegralSumTableName(s.chain))).Error; err != nil {
+			return errors.Wrap(err, "failed on clear integral_sum")
+		}
+		stmt := fmt.Sprintf(`INSERT INTO %s (chain_id, owner, integral, deadline_time, create_time, update_time)
+			SELECT ?, owner, sum(points), max(epoch_end), UNIX_TIMESTAMP()*1000, UNIX_TIMESTAMP()*1000 FROM %s GROUP BY owner`,
+			multi.IntegralSumTableName(s.chain), multi.IntegralDetailTableName(s.chain))
+		if err := tx.Exec(stmt, s.chainId).Error; err != nil {
+			return errors.Wrap(err, "failed on rebuild integral_sum")
+		}
+
+		if err := tx.Table(s.balanceTable).
+			Where("token_address = ? and change_time >= ?", s.token, from).
+			Update("whether_integral", "N").Error; err != nil {
+			return errors.Wrap(err, "failed on update balance")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,173 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// liveFeed 新区块及日志的订阅
+type liveFeed struct {
+	heads   chan *types.BlockHeader
+	logs    chan ethereumTypes.Log
+	headSub ethereum.Subscription
+	logSub  ethereum.Subscription // 不订阅日志时为空
+}
+
+func (f *liveFeed) unsubscribe() {
+	f.headSub.Unsubscribe()
+	if f.logSub != nil {
+		f.logSub.Unsubscribe()
+	}
+}
+
+// logErr 日志订阅断开时返回错误, 不订阅日志时返回nil channel, select时不会被选中
+func (f *liveFeed) logErr() <-chan error {
+	if f.logSub == nil {
+		return nil
+	}
+	return f.logSub.Err()
+}
+
+// liveLogs 订阅的日志未经区块确认, 只有开启链重组检测的任务才能在日志被移除时回滚
+func (p *Poller) liveLogs() bool {
+	return p.journal != nil && p.fetch == nil && p.registry != nil
+}
+
+func (p *Poller) subscribe() (*liveFeed, error) {
+	feed := &liveFeed{
+		heads: make(chan *types.BlockHeader, 16),
+		logs:  make(chan ethereumTypes.Log, 256),
+	}
+	var err error
+	feed.headSub, err = p.subClient.SubscribeNewHead(p.ctx, feed.heads)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on subscribe new head")
+	}
+
+	if !p.liveLogs() {
+		return feed, nil
+	}
+	addresses := p.registry.Addresses()
+	if len(addresses) == 0 {
+		return feed, nil
+	}
+	feed.logSub, err = p.subClient.SubscribeFilterLogs(p.ctx, types.FilterQuery{
+		Addresses: addresses,
+		Topics:    [][]string{p.registry.Topics()},
+	}, feed.logs)
+	if err != nil {
+		feed.headSub.Unsubscribe()
+		return nil, errors.Wrap(err, "failed on subscribe logs")
+	}
+	return feed, nil
+}
+
+// wait 已追上最新区块时等待下一次轮询, 返回新的同步起点
+// 未开启订阅或订阅失败时等待SleepInterval; 开启订阅时收到新区块立即返回, 期间订阅到的日志直接处理
+func (p *Poller) wait(lastSyncBlock uint64) uint64 {
+	if p.subClient == nil {
+		time.Sleep(p.cfg.SleepInterval)
+		return lastSyncBlock
+	}
+	if p.live == nil {
+		live, err := p.subscribe()
+		if err != nil {
+			xzap.WithContext(p.ctx).Warn("failed on subscribe, fallback to polling",
+				zap.String("poller", p.cfg.Name), zap.Error(err))
+			time.Sleep(p.cfg.SleepInterval)
+			return lastSyncBlock
+		}
+		p.live = live
+	}
+
+	timer := time.NewTimer(p.cfg.SleepInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return lastSyncBlock
+		case <-timer.C:
+			return lastSyncBlock
+		case <-p.live.heads:
+			return lastSyncBlock
+		case log := <-p.live.logs:
+			if log.Removed { // 链重组, 回滚被移除日志所在区块之后的数据
+				if log.BlockNumber < lastSyncBlock || p.liveDirty {
+					return p.rollbackLive(lastSyncBlock, log.BlockNumber)
+				}
+				continue
+			}
+			if log.BlockNumber < lastSyncBlock { // 已由区块区间轮询处理
+				continue
+			}
+			if err := p.process(log, false); err != nil {
+				xzap.WithContext(p.ctx).Warn("failed on process live log, wait for range polling",
+					zap.String("poller", p.cfg.Name),
+					zap.Uint64("block", log.BlockNumber),
+					zap.String("tx_hash", log.TxHash.String()),
+					zap.Error(err))
+				continue
+			}
+			if !p.liveDirty || log.BlockNumber > p.liveBlock {
+				p.liveBlock = log.BlockNumber
+			}
+			p.liveDirty = true
+		case err := <-p.live.headSub.Err():
+			return p.resetLive(lastSyncBlock, err)
+		case err := <-p.live.logErr():
+			return p.resetLive(lastSyncBlock, err)
+		}
+	}
+}
+
+// confirmLive 区块区间轮询越过订阅处理过的最高区块后, 这些区块已记录到重组检测中, 不再需要订阅回滚
+func (p *Poller) confirmLive(lastSyncBlock uint64) {
+	if p.liveDirty && lastSyncBlock > p.liveBlock {
+		p.liveDirty = false
+	}
+}
+
+// resetLive 订阅断开期间可能错过被移除的日志, 取消订阅并回滚未确认的数据, 下次等待时重新订阅
+func (p *Poller) resetLive(lastSyncBlock uint64, err error) uint64 {
+	xzap.WithContext(p.ctx).Warn("subscription dropped, fallback to range polling",
+		zap.String("poller", p.cfg.Name), zap.Error(err))
+	p.live.unsubscribe()
+	p.live = nil
+	if !p.liveDirty {
+		return lastSyncBlock
+	}
+	return p.rollbackLive(lastSyncBlock, lastSyncBlock)
+}
+
+// rollbackLive 回滚removedBlock及lastSyncBlock中较小者开始的数据, 返回新的同步起点
+// 回滚失败时重试, 否则区块区间轮询会因已处理标记跳过重新打包的日志
+func (p *Poller) rollbackLive(lastSyncBlock, removedBlock uint64) uint64 {
+	syncFrom := lastSyncBlock
+	if removedBlock < syncFrom {
+		syncFrom = removedBlock
+	}
+	if syncFrom == 0 {
+		return lastSyncBlock
+	}
+
+	for {
+		err := p.rollback(syncFrom - 1)
+		if err == nil {
+			p.liveDirty = false
+			return syncFrom
+		}
+		xzap.WithContext(p.ctx).Error("failed on rollback live blocks",
+			zap.String("poller", p.cfg.Name), zap.Uint64("fork_block", syncFrom-1), zap.Error(err))
+		select {
+		case <-p.ctx.Done():
+			return syncFrom
+		case <-time.After(p.cfg.SleepInterval):
+		}
+	}
+}
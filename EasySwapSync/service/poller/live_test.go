@@ -0,0 +1,76 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient/simclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type failingSubscriber struct {
+	*simclient.Service
+}
+
+func (f failingSubscriber) SubscribeNewHead(ctx context.Context, ch chan<- *types.BlockHeader) (ethereum.Subscription, error) {
+	return nil, errors.New("notifications not supported")
+}
+
+func testContext() context.Context {
+	return xzap.ToContext(context.Background(), zap.NewNop())
+}
+
+func TestWaitWakesOnNewHead(t *testing.T) {
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{}, 10_000_000)
+	t.Cleanup(func() { backend.Close() })
+
+	client := simclient.New(backend)
+	p := New(testContext(), nil, client, Config{Name: "test", SleepInterval: time.Minute}, NewRegistry()).
+		WithSubscription(client)
+
+	done := make(chan uint64)
+	go func() { done <- p.wait(5) }()
+	require.Eventually(t, func() bool {
+		backend.Commit()
+		select {
+		case block := <-done:
+			assert.Equal(t, uint64(5), block)
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.NotNil(t, p.live)
+	assert.Nil(t, p.live.logSub, "poller without reorg journal should not subscribe logs")
+}
+
+func TestWaitFallbackToPolling(t *testing.T) {
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{}, 10_000_000)
+	t.Cleanup(func() { backend.Close() })
+
+	client := simclient.New(backend)
+	p := New(testContext(), nil, client, Config{Name: "test", SleepInterval: 10 * time.Millisecond}, NewRegistry()).
+		WithSubscription(failingSubscriber{client})
+
+	assert.Equal(t, uint64(5), p.wait(5))
+	assert.Nil(t, p.live)
+}
+
+func TestConfirmLive(t *testing.T) {
+	p := &Poller{liveDirty: true, liveBlock: 10}
+
+	p.confirmLive(10) // 区块10尚未被区块区间轮询处理
+	assert.True(t, p.liveDirty)
+
+	p.confirmLive(11)
+	assert.False(t, p.liveDirty)
+}
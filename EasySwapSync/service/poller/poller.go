@@ -0,0 +1,380 @@
+package poller
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/headerservice"
+	"github.com/ProjectsTask/EasySwapBase/chain/rangefetcher"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ProjectsTask/EasySwapSync/service/reorg"
+)
+
+// Config 单个同步任务的配置
+type Config struct {
+	Name               string        // 任务名称, 用于日志
+	ChainId            int64         // 链id
+	IndexType          int           // ob_indexed_status中的index_type, 每个任务使用独立的同步进度
+	StartBlock         uint64        // 同步进度不存在时的起始区块
+	MaxBlockDifference uint64        // 与最新区块保持的距离
+	BlockPeriod        uint64        // 每个请求初始的区块数, 之后根据返回的日志数调整
+	MaxBlockPeriod     uint64        // 每个请求最多的区块数, 0使用默认值
+	Concurrency        int           // 追赶时同时请求的区块区间数, 0使用默认值
+	SleepInterval      time.Duration // 追上最新区块或出错后的等待时间
+}
+
+// Fetcher 拉取区块区间[fromBlock, toBlock]内的日志
+type Fetcher func(fromBlock, toBlock uint64) ([]ethereumTypes.Log, error)
+
+// Poller 按区块区间轮询已注册合约的日志, 分发给注册的处理函数, 并维护同步进度
+type Poller struct {
+	ctx         context.Context
+	db          *gorm.DB
+	chainClient chainclient.ChainClient
+	cfg         Config
+	registry    *Registry
+	journal     *reorg.Journal
+	detector    *reorg.Detector
+	rollback    func(forkBlock uint64) error
+	fetch       Fetcher
+	handler     Handler
+	ranges      *rangefetcher.Fetcher
+	headers     *headerservice.Service
+	subClient   chainclient.ChainClient
+	live        *liveFeed
+	liveDirty   bool   // 是否有订阅处理的未确认数据
+	liveBlock   uint64 // 订阅处理过的最高区块
+}
+
+func New(ctx context.Context, db *gorm.DB, chainClient chainclient.ChainClient, cfg Config, registry *Registry) *Poller {
+	p := &Poller{
+		ctx:         ctx,
+		db:          db,
+		chainClient: chainClient,
+		cfg:         cfg,
+		registry:    registry,
+	}
+	p.ranges = rangefetcher.New(p.fetchLogs, rangefetcher.Config{
+		InitialRange: cfg.BlockPeriod,
+		MaxRange:     cfg.MaxBlockPeriod,
+		Concurrency:  cfg.Concurrency,
+	})
+	return p
+}
+
+// Progress 返回追赶进度
+func (p *Poller) Progress() rangefetcher.Progress {
+	return p.ranges.Progress()
+}
+
+// WithReorg 开启链重组检测, 发现重组时调用rollback回滚分叉点之后的数据
+// rollback为空时直接按journal中的记录回滚
+func (p *Poller) WithReorg(journal *reorg.Journal, rollback func(forkBlock uint64) error) *Poller {
+	p.journal = journal
+	p.detector = reorg.NewDetector(p.chainClient, journal)
+	p.rollback = rollback
+	if p.rollback == nil {
+		p.rollback = func(forkBlock uint64) error {
+			_, err := journal.Rollback(p.ctx, forkBlock, nil)
+			return err
+		}
+	}
+	return p
+}
+
+// WithFetcher 由fetch拉取日志并全部交给handler处理, 用于不按合约地址过滤的同步任务, 如全链NFT的Transfer事件
+func (p *Poller) WithFetcher(fetch Fetcher, handler Handler) *Poller {
+	p.fetch = fetch
+	p.handler = handler
+	return p
+}
+
+// WithHeaders 处理日志前批量获取并缓存日志所在区块的区块头, 处理函数通过headers获取区块时间时直接命中缓存
+func (p *Poller) WithHeaders(headers *headerservice.Service) *Poller {
+	p.headers = headers
+	return p
+}
+
+// WithSubscription 通过client订阅新区块, 追上最新区块后收到新区块立即轮询, 不再等待SleepInterval
+// 开启链重组检测且按注册合约过滤日志的任务同时订阅日志, 收到后立即处理, 不等待区块确认
+// 订阅失败或断开时退回按SleepInterval轮询, 并回滚未确认的数据, 由区块区间轮询补齐
+func (p *Poller) WithSubscription(client chainclient.ChainClient) *Poller {
+	p.subClient = client
+	return p
+}
+
+// loadCursor 读取同步进度, 不存在时以StartBlock初始化
+func (p *Poller) loadCursor() (uint64, error) {
+	var indexedStatus base.IndexedStatus
+	err := p.db.WithContext(p.ctx).Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", p.cfg.ChainId, p.cfg.IndexType).
+		First(&indexedStatus).Error
+	if err == nil {
+		return uint64(indexedStatus.LastIndexedBlock), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errors.Wrap(err, "failed on get index status")
+	}
+
+	indexedStatus = base.IndexedStatus{
+		ChainId:          int(p.cfg.ChainId),
+		IndexType:        int32(p.cfg.IndexType),
+		LastIndexedBlock: int64(p.cfg.StartBlock),
+	}
+	if err := p.db.WithContext(p.ctx).Table(base.IndexedStatusTableName()).
+		Create(&indexedStatus).Error; err != nil {
+		return 0, errors.Wrap(err, "failed on create index status")
+	}
+	return p.cfg.StartBlock, nil
+}
+
+func (p *Poller) saveCursor(block uint64) error {
+	return p.saveCursorTx(p.db.WithContext(p.ctx), block)
+}
+
+func (p *Poller) saveCursorTx(tx *gorm.DB, block uint64) error {
+	if err := tx.Table(base.IndexedStatusTableName()).
+		Where("chain_id = ? and index_type = ?", p.cfg.ChainId, p.cfg.IndexType).
+		Updates(map[string]interface{}{
+			"last_indexed_block": block,
+			"last_indexed_time":  time.Now().Unix(),
+		}).Error; err != nil {
+		return errors.Wrap(err, "failed on update index status")
+	}
+	return nil
+}
+
+// process 在一个事务中处理单条日志: 记录已处理标记、调用处理函数, saveCursor时推进同步进度
+// 标记已存在说明该日志已处理过(如重启后重新拉取同一区块), 直接跳过
+// 同步进度只推进到日志所在区块, 重启后从该区块重新拉取, 已处理的日志由标记去重
+func (p *Poller) process(log ethereumTypes.Log, saveCursor bool) error {
+	return p.db.WithContext(p.ctx).Transaction(func(tx *gorm.DB) error {
+		marker := base.ProcessedLog{
+			ChainId:     p.cfg.ChainId,
+			IndexType:   int32(p.cfg.IndexType),
+			TxHash:      log.TxHash.String(),
+			LogIndex:    int64(log.Index),
+			BlockNumber: int64(log.BlockNumber),
+		}
+
+		var inserted bool
+		if p.journal != nil { // 重组回滚时一并删除标记, 重新打包的日志可以再次处理
+			var err error
+			inserted, err = p.journal.Insert(tx, reorg.RefOf(log), base.ProcessedLogTableName(), map[string]interface{}{
+				"chain_id":   marker.ChainId,
+				"index_type": marker.IndexType,
+				"tx_hash":    marker.TxHash,
+				"log_index":  marker.LogIndex,
+			}, &marker)
+			if err != nil {
+				return errors.Wrap(err, "failed on create processed log")
+			}
+		} else {
+			result := tx.Table(base.ProcessedLogTableName()).Clauses(clause.OnConflict{DoNothing: true}).Create(&marker)
+			if result.Error != nil {
+				return errors.Wrap(result.Error, "failed on create processed log")
+			}
+			inserted = result.RowsAffected > 0
+		}
+		if !inserted {
+			return nil
+		}
+
+		if p.handler != nil {
+			if err := p.handler(tx, log); err != nil {
+				return err
+			}
+		} else if _, err := p.registry.Dispatch(tx, log); err != nil {
+			return err
+		}
+
+		if !saveCursor {
+			return nil
+		}
+		return p.saveCursorTx(tx, log.BlockNumber)
+	})
+}
+
+// pruneProcessed 清理低于belowBlock的已处理标记, 重启或重组后不会再重新拉取这些区块
+func (p *Poller) pruneProcessed(belowBlock uint64) error {
+	if err := p.db.WithContext(p.ctx).Table(base.ProcessedLogTableName()).
+		Where("chain_id = ? and index_type = ? and block_number < ?", p.cfg.ChainId, p.cfg.IndexType, belowBlock).
+		Delete(&base.ProcessedLog{}).Error; err != nil {
+		return errors.Wrap(err, "failed on prune processed logs")
+	}
+	return nil
+}
+
+func (p *Poller) Run() {
+	lastSyncBlock, err := p.loadCursor()
+	if err != nil {
+		xzap.WithContext(p.ctx).Error("failed on get index status",
+			zap.String("poller", p.cfg.Name), zap.Error(err))
+		return
+	}
+
+LOOP:
+	for {
+		select {
+		case <-p.ctx.Done():
+			if p.live != nil {
+				p.live.unsubscribe()
+			}
+			xzap.WithContext(p.ctx).Info("poller stopped due to context cancellation", zap.String("poller", p.cfg.Name))
+			return
+		default:
+		}
+
+		currentBlockNum, err := p.chainClient.BlockNumber() // 以轮询的方式获取当前区块高度
+		if err != nil {
+			xzap.WithContext(p.ctx).Error("failed on get current block number",
+				zap.String("poller", p.cfg.Name), zap.Error(err))
+			time.Sleep(p.cfg.SleepInterval)
+			continue
+		}
+
+		if currentBlockNum < p.cfg.MaxBlockDifference || lastSyncBlock > currentBlockNum-p.cfg.MaxBlockDifference { // 已追上最新区块，等待新区块或一段时间后再次轮询
+			lastSyncBlock = p.wait(lastSyncBlock)
+			continue
+		}
+
+		// 检查已同步的区块是否仍在主链上，发生重组时回滚分叉点之后的数据并从分叉点重新同步
+		if p.detector != nil {
+			forkBlock, reorged, err := p.detector.FindForkPoint(p.ctx)
+			if err != nil {
+				xzap.WithContext(p.ctx).Error("failed on check chain reorg",
+					zap.String("poller", p.cfg.Name), zap.Error(err))
+				time.Sleep(p.cfg.SleepInterval)
+				continue
+			}
+			if reorged {
+				if err := p.rollback(forkBlock); err != nil {
+					xzap.WithContext(p.ctx).Error("failed on rollback reorged blocks",
+						zap.String("poller", p.cfg.Name), zap.Uint64("fork_block", forkBlock), zap.Error(err))
+					time.Sleep(p.cfg.SleepInterval)
+					continue
+				}
+				lastSyncBlock = forkBlock + 1
+				p.liveDirty = false
+				continue
+			}
+		}
+
+		startBlock := lastSyncBlock
+		// 按自适应的区块区间并发拉取日志, 结束区块不超过当前区块高度减去MaxBlockDifference
+		endBlock, ethLogs, err := p.ranges.Next(p.ctx, startBlock, currentBlockNum-p.cfg.MaxBlockDifference)
+		if err != nil {
+			xzap.WithContext(p.ctx).Error("failed on get log",
+				zap.String("poller", p.cfg.Name), zap.Error(err))
+			time.Sleep(p.cfg.SleepInterval)
+			continue
+		}
+
+		// 校验日志所在区块的哈希，并记录本次同步的区块
+		if p.detector != nil {
+			headers, err := p.detector.CheckLogs(p.ctx, ethLogs, endBlock)
+			if err != nil {
+				xzap.WithContext(p.ctx).Warn("failed on check logs block hash",
+					zap.String("poller", p.cfg.Name), zap.Error(err))
+				time.Sleep(p.cfg.SleepInterval)
+				continue
+			}
+			if err := p.journal.RecordBlocks(p.ctx, headers); err != nil {
+				xzap.WithContext(p.ctx).Error("failed on record indexed blocks",
+					zap.String("poller", p.cfg.Name), zap.Error(err))
+				time.Sleep(p.cfg.SleepInterval)
+				continue
+			}
+			if p.headers != nil { // 校验时已获取的区块头直接缓存
+				p.headers.Add(p.ctx, headers...)
+			}
+		} else if p.headers != nil {
+			if err := p.headers.Prefetch(p.ctx, ethLogs); err != nil {
+				xzap.WithContext(p.ctx).Warn("failed on prefetch block headers",
+					zap.String("poller", p.cfg.Name), zap.Error(err))
+			}
+		}
+
+		for _, ethLog := range ethLogs { // 遍历日志，每条日志在独立的事务中交给注册的处理函数
+			if err := p.process(ethLog, true); err != nil {
+				xzap.WithContext(p.ctx).Error("failed on process log, retry from its block",
+					zap.String("poller", p.cfg.Name),
+					zap.Uint64("block", ethLog.BlockNumber),
+					zap.String("tx_hash", ethLog.TxHash.String()),
+					zap.Uint("log_index", ethLog.Index),
+					zap.Error(err))
+				lastSyncBlock = ethLog.BlockNumber
+				time.Sleep(p.cfg.SleepInterval)
+				continue LOOP
+			}
+		}
+
+		lastSyncBlock = endBlock + 1 // 更新最后同步的区块高度
+		if err := p.saveCursor(lastSyncBlock); err != nil {
+			xzap.WithContext(p.ctx).Error("failed on update sync block number",
+				zap.String("poller", p.cfg.Name), zap.Error(err))
+			return
+		}
+		p.confirmLive(lastSyncBlock)
+
+		if endBlock > reorg.MaxReorgDepth {
+			if p.journal != nil {
+				if err := p.journal.Prune(p.ctx, endBlock-reorg.MaxReorgDepth); err != nil {
+					xzap.WithContext(p.ctx).Warn("failed on prune reorg journal",
+						zap.String("poller", p.cfg.Name), zap.Error(err))
+				}
+			}
+			if err := p.pruneProcessed(endBlock - reorg.MaxReorgDepth); err != nil {
+				xzap.WithContext(p.ctx).Warn("failed on prune processed logs",
+					zap.String("poller", p.cfg.Name), zap.Error(err))
+			}
+		}
+
+		progress := p.ranges.Progress()
+		xzap.WithContext(p.ctx).Info("sync event ...",
+			zap.String("poller", p.cfg.Name),
+			zap.Uint64("start_block", startBlock),
+			zap.Uint64("end_block", endBlock),
+			zap.Uint64("remaining_blocks", progress.Remaining()),
+			zap.Uint64("block_period", progress.Window),
+			zap.Float64("blocks_per_second", progress.BlocksPerSecond))
+	}
+}
+
+// fetchLogs 拉取区块区间内的日志, 未设置Fetcher时按注册的合约地址及事件签名过滤
+func (p *Poller) fetchLogs(startBlock, endBlock uint64) ([]ethereumTypes.Log, error) {
+	if p.fetch != nil {
+		return p.fetch(startBlock, endBlock)
+	}
+
+	addresses := p.registry.Addresses()
+	if len(addresses) == 0 { // 尚未注册合约时不拉取日志, 否则会返回链上所有合约的日志
+		return nil, nil
+	}
+
+	logs, err := p.chainClient.FilterLogs(p.ctx, types.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(startBlock),
+		ToBlock:   new(big.Int).SetUint64(endBlock),
+		Addresses: addresses,
+		Topics:    [][]string{p.registry.Topics()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ethLogs := make([]ethereumTypes.Log, 0, len(logs))
+	for _, log := range logs {
+		ethLogs = append(ethLogs, log.(ethereumTypes.Log))
+	}
+	return ethLogs, nil
+}
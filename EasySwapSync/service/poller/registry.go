@@ -0,0 +1,94 @@
+package poller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Handler 在事务tx中处理单条合约日志, 返回错误时事务回滚, 该日志会在下次轮询时重新处理
+// 日志本身无法解析等无法重试的情况应记录日志并返回nil
+type Handler func(tx *gorm.DB, log ethereumTypes.Log) error
+
+// Registry 按合约地址+事件签名注册日志处理函数
+// 事件签名由合约ABI计算得到, 不需要手动维护topic哈希
+type Registry struct {
+	lock     *sync.RWMutex
+	handlers map[string]map[string]Handler // address => topic0 => handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		lock:     &sync.RWMutex{},
+		handlers: make(map[string]map[string]Handler),
+	}
+}
+
+// Register 为合约地址上ABI声明的事件注册处理函数
+func (r *Registry) Register(address string, contractAbi abi.ABI, eventName string, handler Handler) error {
+	event, ok := contractAbi.Events[eventName]
+	if !ok {
+		return errors.Errorf("event %s not found in abi", eventName)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	addr := strings.ToLower(common.HexToAddress(address).String())
+	if _, ok := r.handlers[addr]; !ok {
+		r.handlers[addr] = make(map[string]Handler)
+	}
+	r.handlers[addr][strings.ToLower(event.ID.String())] = handler
+	return nil
+}
+
+// Addresses 返回已注册的合约地址, 用于日志过滤
+func (r *Registry) Addresses() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	addresses := make([]string, 0, len(r.handlers))
+	for addr := range r.handlers {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// Topics 返回已注册的事件签名, 用于日志过滤
+func (r *Registry) Topics() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	set := make(map[string]bool)
+	for _, handlers := range r.handlers {
+		for topic := range handlers {
+			set[topic] = true
+		}
+	}
+	topics := make([]string, 0, len(set))
+	for topic := range set {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Dispatch 将日志交给对应的处理函数, 没有匹配的处理函数时返回false
+func (r *Registry) Dispatch(tx *gorm.DB, log ethereumTypes.Log) (bool, error) {
+	if len(log.Topics) == 0 {
+		return false, nil
+	}
+
+	r.lock.RLock()
+	handler, ok := r.handlers[strings.ToLower(log.Address.String())][strings.ToLower(log.Topics[0].String())]
+	r.lock.RUnlock()
+	if !ok {
+		return false, nil
+	}
+
+	return true, handler(tx, log)
+}
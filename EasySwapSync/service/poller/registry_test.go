@@ -0,0 +1,57 @@
+package poller
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const testAbi = `[{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"name":"account","type":"address"}],"name":"Paused","type":"event"}]`
+
+func TestRegistryDispatch(t *testing.T) {
+	contractAbi, err := abi.JSON(strings.NewReader(testAbi))
+	require.NoError(t, err)
+
+	tokenA := common.HexToAddress("0xaaaa000000000000000000000000000000000001")
+	tokenB := common.HexToAddress("0xbbbb000000000000000000000000000000000002")
+
+	var calls []string
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(tokenA.String(), contractAbi, "Transfer", func(tx *gorm.DB, log ethereumTypes.Log) error {
+		calls = append(calls, "a.transfer")
+		return nil
+	}))
+	require.NoError(t, registry.Register(strings.ToUpper(tokenB.Hex()[2:]), contractAbi, "Paused", func(tx *gorm.DB, log ethereumTypes.Log) error {
+		calls = append(calls, "b.paused")
+		return errors.New("db unavailable")
+	}))
+	assert.Error(t, registry.Register(tokenA.String(), contractAbi, "Unknown", func(tx *gorm.DB, log ethereumTypes.Log) error { return nil }))
+
+	transferID := contractAbi.Events["Transfer"].ID
+	pausedID := contractAbi.Events["Paused"].ID
+	assert.Equal(t, "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", transferID.String())
+
+	handled, err := registry.Dispatch(nil, ethereumTypes.Log{Address: tokenA, Topics: []common.Hash{transferID}})
+	assert.True(t, handled)
+	assert.NoError(t, err)
+	// 处理函数的错误返回给调用方
+	handled, err = registry.Dispatch(nil, ethereumTypes.Log{Address: tokenB, Topics: []common.Hash{pausedID}})
+	assert.True(t, handled)
+	assert.EqualError(t, err, "db unavailable")
+	// 事件已注册但合约地址不匹配
+	handled, _ = registry.Dispatch(nil, ethereumTypes.Log{Address: tokenB, Topics: []common.Hash{transferID}})
+	assert.False(t, handled)
+	handled, _ = registry.Dispatch(nil, ethereumTypes.Log{Address: tokenA})
+	assert.False(t, handled)
+	assert.Equal(t, []string{"a.transfer", "b.paused"}, calls)
+
+	assert.Len(t, registry.Addresses(), 2)
+	assert.ElementsMatch(t, []string{transferID.String(), pausedID.String()}, registry.Topics())
+}
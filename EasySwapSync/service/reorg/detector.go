@@ -0,0 +1,143 @@
+package reorg
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// MaxReorgDepth 保留区块哈希及回滚记录的深度, 超过该深度的重组无法自动回滚
+const MaxReorgDepth = 128
+
+var (
+	// ErrChainReorged 拉取日志过程中链发生了重组, 需要重新拉取
+	ErrChainReorged = errors.New("chain reorganized while fetching logs")
+	// ErrReorgTooDeep 重组深度超过了本地保留的区块记录
+	ErrReorgTooDeep = errors.New("reorg deeper than tracked blocks")
+)
+
+// BlockStore 已同步区块哈希的存储
+type BlockStore interface {
+	// RecentBlocks 按区块高度倒序返回最近记录的区块
+	RecentBlocks(ctx context.Context, limit int) ([]base.IndexedBlock, error)
+}
+
+// BlockRef 一次写入所属的区块
+type BlockRef struct {
+	Number uint64
+	Hash   string
+}
+
+// RefOf 返回日志所在的区块
+func RefOf(log ethereumTypes.Log) BlockRef {
+	return BlockRef{Number: log.BlockNumber, Hash: log.BlockHash.String()}
+}
+
+// Detector 比较本地记录的区块哈希与链上哈希, 找出链重组的分叉点
+type Detector struct {
+	chainClient chainclient.ChainClient
+	blocks      BlockStore
+}
+
+func NewDetector(chainClient chainclient.ChainClient, blocks BlockStore) *Detector {
+	return &Detector{
+		chainClient: chainClient,
+		blocks:      blocks,
+	}
+}
+
+// FindForkPoint 从最新的记录开始向前查找仍在主链上的区块
+// 返回该区块高度, reorged 表示其之后的记录已不在主链上, 需要回滚
+func (d *Detector) FindForkPoint(ctx context.Context) (uint64, bool, error) {
+	blocks, err := d.blocks.RecentBlocks(ctx, MaxReorgDepth)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed on get recent indexed blocks")
+	}
+
+	for i, block := range blocks {
+		header, err := d.chainClient.HeaderByNumber(ctx, big.NewInt(block.BlockNumber))
+		if err != nil {
+			return 0, false, errors.Wrap(err, "failed on get block header")
+		}
+
+		if strings.EqualFold(header.Hash, block.BlockHash) {
+			return uint64(block.BlockNumber), i > 0, nil
+		}
+	}
+
+	if len(blocks) == 0 {
+		return 0, false, nil
+	}
+
+	return 0, false, ErrReorgTooDeep
+}
+
+// CheckLogs 校验日志所在区块仍在主链上, 并返回日志所在区块及toBlock的区块头
+// 日志被标记为Removed, 或日志中的区块哈希与链上不一致时返回ErrChainReorged
+func (d *Detector) CheckLogs(ctx context.Context, logs []ethereumTypes.Log, toBlock uint64) ([]*types.BlockHeader, error) {
+	tail, err := d.chainClient.HeaderByNumber(ctx, new(big.Int).SetUint64(toBlock))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+
+	// 日志所在区块的区块头通过一次批量请求获取
+	var blockNums []uint64
+	seen := map[uint64]bool{toBlock: true}
+	for _, log := range logs {
+		if log.Removed {
+			return nil, ErrChainReorged
+		}
+		if !seen[log.BlockNumber] {
+			seen[log.BlockNumber] = true
+			blockNums = append(blockNums, log.BlockNumber)
+		}
+	}
+	headers := map[uint64]*types.BlockHeader{toBlock: tail}
+	if len(blockNums) > 0 {
+		fetched, err := d.chainClient.HeadersByNumber(ctx, blockNums)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed on get block headers")
+		}
+		for _, header := range fetched {
+			headers[header.Number] = header
+		}
+	}
+
+	var result []*types.BlockHeader
+	added := make(map[uint64]bool)
+	for _, log := range logs {
+		header, ok := headers[log.BlockNumber]
+		if !ok {
+			return nil, errors.Errorf("block header %d not found", log.BlockNumber)
+		}
+		if !added[log.BlockNumber] {
+			added[log.BlockNumber] = true
+			result = append(result, header)
+		}
+
+		if !strings.EqualFold(header.Hash, log.BlockHash.String()) {
+			return nil, ErrChainReorged
+		}
+	}
+
+	// 再次确认区间末尾的区块没有变化, 避免校验过程中发生重组
+	latest, err := d.chainClient.HeaderByNumber(ctx, new(big.Int).SetUint64(toBlock))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get block header")
+	}
+	if !strings.EqualFold(latest.Hash, tail.Hash) {
+		return nil, ErrChainReorged
+	}
+
+	if !added[toBlock] {
+		result = append(result, tail)
+	}
+
+	return result, nil
+}
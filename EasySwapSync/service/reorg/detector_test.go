@@ -0,0 +1,231 @@
+package reorg
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient/simclient"
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 部署后每次被调用都会触发一条无topic的日志(LOG0)
+var emitterCode = hexutil.MustDecode("0x600680600b6000396000f360006000a000")
+
+type memoryBlockStore struct {
+	blocks map[uint64]base.IndexedBlock
+}
+
+func (m *memoryBlockStore) RecentBlocks(ctx context.Context, limit int) ([]base.IndexedBlock, error) {
+	var blocks []base.IndexedBlock
+	for _, block := range m.blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].BlockNumber > blocks[j].BlockNumber
+	})
+	if len(blocks) > limit {
+		blocks = blocks[:limit]
+	}
+	return blocks, nil
+}
+
+func (m *memoryBlockStore) record(headers []*types.BlockHeader) {
+	for _, header := range headers {
+		m.blocks[header.Number] = base.IndexedBlock{
+			BlockNumber: int64(header.Number),
+			BlockHash:   header.Hash,
+			ParentHash:  header.ParentHash,
+		}
+	}
+}
+
+type simChain struct {
+	t        *testing.T
+	backend  *backends.SimulatedBackend
+	client   *simclient.Service
+	signer   ethereumTypes.Signer
+	key      []byte
+	from     common.Address
+	contract common.Address
+}
+
+func newSimChain(t *testing.T) *simChain {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		from: {Balance: new(big.Int).Mul(big.NewInt(1000), big.NewInt(1e18))},
+	}, 10_000_000)
+	t.Cleanup(func() { backend.Close() })
+
+	chain := &simChain{
+		t:       t,
+		backend: backend,
+		client:  simclient.New(backend),
+		signer:  ethereumTypes.LatestSignerForChainID(big.NewInt(1337)),
+		key:     crypto.FromECDSA(key),
+		from:    from,
+	}
+
+	tx := chain.send(nil, emitterCode)
+	backend.Commit()
+	receipt, err := backend.TransactionReceipt(context.Background(), tx.Hash())
+	require.NoError(t, err)
+	chain.contract = receipt.ContractAddress
+
+	return chain
+}
+
+func (c *simChain) send(to *common.Address, data []byte) *ethereumTypes.Transaction {
+	ctx := context.Background()
+	nonce, err := c.backend.PendingNonceAt(ctx, c.from)
+	require.NoError(c.t, err)
+
+	key, err := crypto.ToECDSA(c.key)
+	require.NoError(c.t, err)
+	tx, err := ethereumTypes.SignNewTx(key, c.signer, &ethereumTypes.LegacyTx{
+		Nonce:    nonce,
+		To:       to,
+		Gas:      200_000,
+		GasPrice: big.NewInt(1e9),
+		Data:     data,
+	})
+	require.NoError(c.t, err)
+	require.NoError(c.t, c.backend.SendTransaction(ctx, tx))
+	return tx
+}
+
+// emit 在新区块中调用合约产生一条日志
+func (c *simChain) emit() {
+	c.send(&c.contract, nil)
+	c.backend.Commit()
+}
+
+func (c *simChain) head() uint64 {
+	number, err := c.client.BlockNumber()
+	require.NoError(c.t, err)
+	return number
+}
+
+func (c *simChain) hashAt(number uint64) common.Hash {
+	header, err := c.backend.HeaderByNumber(context.Background(), new(big.Int).SetUint64(number))
+	require.NoError(c.t, err)
+	return header.Hash()
+}
+
+func (c *simChain) logs(from, to uint64) []ethereumTypes.Log {
+	logs, err := c.client.FilterLogs(context.Background(), types.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []string{c.contract.String()},
+	})
+	require.NoError(c.t, err)
+
+	var ethLogs []ethereumTypes.Log
+	for _, log := range logs {
+		ethLogs = append(ethLogs, log.(ethereumTypes.Log))
+	}
+	return ethLogs
+}
+
+// ingest 模拟索引服务同步[from, to]区间并记录区块哈希
+func ingest(t *testing.T, chain *simChain, detector *Detector, store *memoryBlockStore, from, to uint64) []ethereumTypes.Log {
+	logs := chain.logs(from, to)
+	headers, err := detector.CheckLogs(context.Background(), logs, to)
+	require.NoError(t, err)
+	store.record(headers)
+	return logs
+}
+
+func TestFindForkPointWithoutReorg(t *testing.T) {
+	chain := newSimChain(t)
+	store := &memoryBlockStore{blocks: make(map[uint64]base.IndexedBlock)}
+	detector := NewDetector(chain.client, store)
+
+	forkBlock, reorged, err := detector.FindForkPoint(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, reorged)
+	assert.Equal(t, uint64(0), forkBlock)
+
+	chain.emit()
+	chain.emit()
+	logs := ingest(t, chain, detector, store, 1, chain.head())
+	assert.Len(t, logs, 2)
+
+	forkBlock, reorged, err = detector.FindForkPoint(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, reorged)
+	assert.Equal(t, chain.head(), forkBlock)
+}
+
+func TestFindForkPointAfterReorg(t *testing.T) {
+	chain := newSimChain(t)
+	store := &memoryBlockStore{blocks: make(map[uint64]base.IndexedBlock)}
+	detector := NewDetector(chain.client, store)
+
+	// 区块2、3为首次同步的区间
+	chain.emit()
+	ingest(t, chain, detector, store, 1, chain.head())
+	forkPoint := chain.head()
+	forkHash := chain.hashAt(forkPoint)
+
+	chain.emit()
+	chain.emit()
+	orphaned := ingest(t, chain, detector, store, forkPoint+1, chain.head())
+	require.Len(t, orphaned, 2)
+	orphanedHead := chain.head()
+
+	// 从forkPoint分叉出一条更长的、不包含日志的链
+	require.NoError(t, chain.backend.Fork(context.Background(), forkHash))
+	for i := uint64(0); i <= orphanedHead-forkPoint; i++ {
+		chain.backend.Commit()
+	}
+	require.Greater(t, chain.head(), orphanedHead)
+
+	forkBlock, reorged, err := detector.FindForkPoint(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, reorged)
+	assert.Equal(t, forkPoint, forkBlock)
+
+	// 旧链上的日志已不在主链上
+	_, err = detector.CheckLogs(context.Background(), orphaned, orphanedHead)
+	assert.ErrorIs(t, err, ErrChainReorged)
+	assert.Empty(t, chain.logs(forkPoint+1, chain.head()))
+}
+
+func TestCheckLogsRemoved(t *testing.T) {
+	chain := newSimChain(t)
+	store := &memoryBlockStore{blocks: make(map[uint64]base.IndexedBlock)}
+	detector := NewDetector(chain.client, store)
+
+	chain.emit()
+	logs := chain.logs(1, chain.head())
+	require.Len(t, logs, 1)
+
+	logs[0].Removed = true
+	_, err := detector.CheckLogs(context.Background(), logs, chain.head())
+	assert.ErrorIs(t, err, ErrChainReorged)
+}
+
+func TestFindForkPointTooDeep(t *testing.T) {
+	chain := newSimChain(t)
+	store := &memoryBlockStore{blocks: map[uint64]base.IndexedBlock{
+		1: {BlockNumber: 1, BlockHash: common.Hash{0x1}.String()},
+	}}
+	detector := NewDetector(chain.client, store)
+
+	_, _, err := detector.FindForkPoint(context.Background())
+	assert.ErrorIs(t, err, ErrReorgTooDeep)
+}
@@ -0,0 +1,317 @@
+package reorg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/types"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/base"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UndoneRow 回滚时撤销修改的一行, 按修改的逆序排列
+// Keys为定位该行的列: 插入的行为插入时指定的列, 更新的行为id; Prior为更新前的值, 插入的行为nil
+type UndoneRow struct {
+	Table string
+	Keys  map[string]interface{}
+	Prior map[string]interface{}
+}
+
+// KeyValues 返回table中撤销的行在column列上去重后的值, 没有该列的行忽略
+func KeyValues(rows []UndoneRow, table, column string) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, row := range rows {
+		if row.Table != table {
+			continue
+		}
+		value, ok := row.Keys[column]
+		if !ok {
+			continue
+		}
+		v := fmt.Sprint(value)
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Journal 记录某个同步任务已同步区块的哈希, 以及每个区块对业务表所做的修改
+// 发生链重组时按修改的逆序恢复数据
+type Journal struct {
+	db        *gorm.DB
+	chainId   int64
+	indexType int
+}
+
+func NewJournal(db *gorm.DB, chainId int64, indexType int) *Journal {
+	return &Journal{
+		db:        db,
+		chainId:   chainId,
+		indexType: indexType,
+	}
+}
+
+func (j *Journal) RecentBlocks(ctx context.Context, limit int) ([]base.IndexedBlock, error) {
+	var blocks []base.IndexedBlock
+	if err := j.db.WithContext(ctx).Table(base.IndexedBlockTableName()).
+		Where("chain_id = ? and index_type = ?", j.chainId, j.indexType).
+		Order("block_number desc").Limit(limit).
+		Find(&blocks).Error; err != nil {
+		return nil, errors.Wrap(err, "failed on get indexed blocks")
+	}
+
+	return blocks, nil
+}
+
+// RecordBlocks 记录已同步区块的哈希
+func (j *Journal) RecordBlocks(ctx context.Context, headers []*types.BlockHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	var blocks []base.IndexedBlock
+	for _, header := range headers {
+		blocks = append(blocks, base.IndexedBlock{
+			ChainId:     j.chainId,
+			IndexType:   int32(j.indexType),
+			BlockNumber: int64(header.Number),
+			BlockHash:   header.Hash,
+			ParentHash:  header.ParentHash,
+		})
+	}
+
+	if err := j.db.WithContext(ctx).Table(base.IndexedBlockTableName()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "index_type"}, {Name: "block_number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"block_hash", "parent_hash", "update_time"}),
+	}).Create(&blocks).Error; err != nil {
+		return errors.Wrap(err, "failed on record indexed blocks")
+	}
+
+	return nil
+}
+
+// Insert 插入一行数据, 若该行由本次插入产生则记录回滚日志
+// keys 为能唯一定位该行的列, 回滚时按其删除
+func (j *Journal) Insert(db *gorm.DB, ref BlockRef, table string, keys map[string]interface{}, value interface{}) (bool, error) {
+	result := db.Table(table).Clauses(clause.OnConflict{
+		DoNothing: true,
+	}).Create(value)
+	if result.Error != nil {
+		return false, errors.Wrap(result.Error, "failed on insert row")
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := j.addUndoLog(db, ref, table, keys, nil); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Update 更新满足keys的行, 并记录被更新列修改前的值
+func (j *Journal) Update(db *gorm.DB, ref BlockRef, table string, keys map[string]interface{}, updates map[string]interface{}) error {
+	columns := []string{"id"}
+	for column := range updates {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns[1:])
+
+	var rows []map[string]interface{}
+	if err := db.Table(table).Select(columns).Where(keys).Find(&rows).Error; err != nil {
+		return errors.Wrap(err, "failed on get rows before update")
+	}
+
+	for _, row := range rows {
+		prior := make(map[string]interface{})
+		for _, column := range columns[1:] {
+			prior[column] = normalizeValue(row[column])
+		}
+		if err := j.addUndoLog(db, ref, table, map[string]interface{}{"id": row["id"]}, prior); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Table(table).Where(keys).Updates(updates).Error; err != nil {
+		return errors.Wrap(err, "failed on update rows")
+	}
+
+	return nil
+}
+
+func (j *Journal) addUndoLog(db *gorm.DB, ref BlockRef, table string, keys, prior map[string]interface{}) error {
+	rowKeys, err := json.Marshal(keys)
+	if err != nil {
+		return errors.Wrap(err, "failed on marshal row keys")
+	}
+
+	var priorValues []byte
+	if prior != nil {
+		if priorValues, err = json.Marshal(prior); err != nil {
+			return errors.Wrap(err, "failed on marshal prior values")
+		}
+	}
+
+	undo := base.BlockUndoLog{
+		ChainId:     j.chainId,
+		IndexType:   int32(j.indexType),
+		BlockNumber: int64(ref.Number),
+		BlockHash:   ref.Hash,
+		TableName:   table,
+		RowKeys:     string(rowKeys),
+		PriorValues: string(priorValues),
+	}
+	if err := db.Table(base.BlockUndoLogTableName()).Create(&undo).Error; err != nil {
+		return errors.Wrap(err, "failed on create block undo log")
+	}
+
+	return nil
+}
+
+// Rollback 撤销forkBlock之后所有区块的修改, 删除对应的区块记录, 并将同步进度重置到forkBlock+1
+// onRollback不为空时在同一事务中、撤销修改前以撤销的行调用, 用于读取回滚前的数据并记录回滚后需要重新处理的数据
+func (j *Journal) Rollback(ctx context.Context, forkBlock uint64, onRollback func(tx *gorm.DB, rows []UndoneRow) error) (int, error) {
+	var count int
+	err := j.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var undoLogs []base.BlockUndoLog
+		if err := tx.Table(base.BlockUndoLogTableName()).
+			Where("chain_id = ? and index_type = ? and block_number > ?", j.chainId, j.indexType, forkBlock).
+			Order("id desc").
+			Find(&undoLogs).Error; err != nil {
+			return errors.Wrap(err, "failed on get block undo logs")
+		}
+
+		rows := make([]UndoneRow, 0, len(undoLogs))
+		for _, undo := range undoLogs {
+			keys, err := decodeValues(undo.RowKeys)
+			if err != nil {
+				return errors.Wrap(err, "failed on decode row keys")
+			}
+			row := UndoneRow{Table: undo.TableName, Keys: keys}
+			if undo.PriorValues != "" {
+				if row.Prior, err = decodeValues(undo.PriorValues); err != nil {
+					return errors.Wrap(err, "failed on decode prior values")
+				}
+			}
+			rows = append(rows, row)
+		}
+		if onRollback != nil {
+			if err := onRollback(tx, rows); err != nil {
+				return err
+			}
+		}
+
+		for _, row := range rows {
+			if row.Prior == nil {
+				stmt, args := deleteStatement(row.Table, row.Keys)
+				if err := tx.Exec(stmt, args...).Error; err != nil {
+					return errors.Wrap(err, "failed on delete inserted row")
+				}
+				continue
+			}
+			if err := tx.Table(row.Table).Where(row.Keys).Updates(row.Prior).Error; err != nil {
+				return errors.Wrap(err, "failed on restore updated row")
+			}
+		}
+		count = len(undoLogs)
+
+		if err := tx.Table(base.BlockUndoLogTableName()).
+			Where("chain_id = ? and index_type = ? and block_number > ?", j.chainId, j.indexType, forkBlock).
+			Delete(&base.BlockUndoLog{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete block undo logs")
+		}
+
+		if err := tx.Table(base.IndexedBlockTableName()).
+			Where("chain_id = ? and index_type = ? and block_number > ?", j.chainId, j.indexType, forkBlock).
+			Delete(&base.IndexedBlock{}).Error; err != nil {
+			return errors.Wrap(err, "failed on delete indexed blocks")
+		}
+
+		if err := tx.Table(base.IndexedStatusTableName()).
+			Where("chain_id = ? and index_type = ?", j.chainId, j.indexType).
+			Update("last_indexed_block", forkBlock+1).Error; err != nil {
+			return errors.Wrap(err, "failed on reset indexed block")
+		}
+
+		return nil
+	})
+
+	return count, err
+}
+
+// Prune 清理低于belowBlock的区块记录和回滚日志, 每个任务至少保留最新的一条区块记录
+func (j *Journal) Prune(ctx context.Context, belowBlock uint64) error {
+	if err := j.db.WithContext(ctx).Table(base.BlockUndoLogTableName()).
+		Where("chain_id = ? and index_type = ? and block_number < ?", j.chainId, j.indexType, belowBlock).
+		Delete(&base.BlockUndoLog{}).Error; err != nil {
+		return errors.Wrap(err, "failed on prune block undo logs")
+	}
+
+	blocks, err := j.RecentBlocks(ctx, 1)
+	if err != nil {
+		return err
+	}
+	if len(blocks) > 0 && uint64(blocks[0].BlockNumber) < belowBlock {
+		belowBlock = uint64(blocks[0].BlockNumber)
+	}
+
+	if err := j.db.WithContext(ctx).Table(base.IndexedBlockTableName()).
+		Where("chain_id = ? and index_type = ? and block_number < ?", j.chainId, j.indexType, belowBlock).
+		Delete(&base.IndexedBlock{}).Error; err != nil {
+		return errors.Wrap(err, "failed on prune indexed blocks")
+	}
+
+	return nil
+}
+
+func deleteStatement(table string, keys map[string]interface{}) (string, []interface{}) {
+	columns := make([]string, 0, len(keys))
+	for column := range keys {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	conditions := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		conditions = append(conditions, fmt.Sprintf("%s = ?", column))
+		args = append(args, keys[column])
+	}
+
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", table, strings.Join(conditions, " and ")), args
+}
+
+func decodeValues(data string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+
+	for k, v := range values {
+		if n, ok := v.(json.Number); ok {
+			values[k] = n.String()
+		}
+	}
+
+	return values, nil
+}
+
+// normalizeValue 驱动返回的[]byte转为字符串, 避免json序列化为base64
+func normalizeValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
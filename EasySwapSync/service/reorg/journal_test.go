@@ -0,0 +1,21 @@
+package reorg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyValues(t *testing.T) {
+	rows := []UndoneRow{
+		{Table: "ob_activity_sepolia", Keys: map[string]interface{}{"collection_address": "0xc1", "token_id": "1"}},
+		{Table: "ob_item_sepolia", Keys: map[string]interface{}{"collection_address": "0xc3", "token_id": "1"}},
+		{Table: "ob_activity_sepolia", Keys: map[string]interface{}{"collection_address": "0xc2", "token_id": "2"}},
+		{Table: "ob_activity_sepolia", Keys: map[string]interface{}{"collection_address": "0xc1", "token_id": "3"}},
+		{Table: "ob_activity_sepolia", Keys: map[string]interface{}{"id": "7"}}, // 更新的行只有id
+	}
+
+	assert.Equal(t, []string{"0xc1", "0xc2"}, KeyValues(rows, "ob_activity_sepolia", "collection_address"))
+	assert.Equal(t, []string{"7"}, KeyValues(rows, "ob_activity_sepolia", "id"))
+	assert.Nil(t, KeyValues(rows, "ob_order_sepolia", "collection_address"))
+}
@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/ProjectsTask/EasySwapBase/chain"
 	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
@@ -22,6 +25,9 @@ import (
 	"github.com/ProjectsTask/EasySwapSync/service/config"
 )
 
+// HealthCheckInterval 多节点客户端检查节点区块高度的间隔
+const HealthCheckInterval = 15 * time.Second
+
 type Service struct {
 	ctx              context.Context
 	config           *config.Config
@@ -51,19 +57,31 @@ func New(ctx context.Context, cfg *config.Config) (*Service, error) {
 	var err error
 	db := model.NewDB(cfg.DB)
 	collectionFilter := collectionfilter.New(ctx, db, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
-	orderManager := ordermanager.New(ctx, db, kvStore, cfg.ChainCfg.Name, cfg.ProjectCfg.Name)
+	orderManager := ordermanager.New(ctx, db, kvStore, cfg.ChainCfg.Name, cfg.ProjectCfg.Name).
+		ReplayTradeEventsFrom(cfg.OrderMgrCfg.ReplayTradeEventsFrom)
 	var orderbookSyncer *orderbookindexer.Service
 	var chainClient chainclient.ChainClient
-	fmt.Println("chainClient url:" + cfg.AnkrCfg.HttpsUrl + cfg.AnkrCfg.ApiKey)
-
-	chainClient, err = chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey)
+	if len(cfg.AnkrCfg.Endpoints) > 0 {
+		chainClient, err = newMultiClient(ctx, cfg)
+	} else {
+		fmt.Println("chainClient url:" + cfg.AnkrCfg.HttpsUrl + cfg.AnkrCfg.ApiKey)
+		chainClient, err = chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.HttpsUrl+cfg.AnkrCfg.ApiKey)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on create evm client")
 	}
 
 	switch cfg.ChainCfg.ID {
 	case chain.EthChainID, chain.OptimismChainID, chain.SepoliaChainID, chain.BasepoliaChainID:
-		orderbookSyncer = orderbookindexer.New(ctx, cfg, db, kvStore, chainClient, cfg.ChainCfg.ID, cfg.ChainCfg.Name, orderManager)
+		orderbookSyncer = orderbookindexer.New(ctx, cfg, db, kvStore, chainClient, cfg.ChainCfg.ID, cfg.ChainCfg.Name, orderManager).
+			WithCollectionFilter(collectionFilter)
+		if cfg.AnkrCfg.EnableWss {
+			subClient, err := chainclient.New(int(cfg.ChainCfg.ID), cfg.AnkrCfg.WebsocketUrl+cfg.AnkrCfg.ApiKey)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed on create websocket client")
+			}
+			orderbookSyncer.WithSubscriber(subClient)
+		}
 	}
 	if err != nil {
 		return nil, errors.Wrap(err, "failed on create trade info server")
@@ -87,7 +105,29 @@ func (s *Service) Start() error {
 		return errors.Wrap(err, "failed on preload collection to filter")
 	}
 
-	s.orderbookIndexer.Start()
+	if err := s.orderbookIndexer.Start(); err != nil {
+		return errors.Wrap(err, "failed on start orderbook indexer")
+	}
 	s.orderManager.Start()
 	return nil
 }
+
+// newMultiClient 创建多节点客户端, 定时检查各节点区块高度, 节点状态通过pprof端口的/debug/chainclient查看
+func newMultiClient(ctx context.Context, cfg *config.Config) (chainclient.ChainClient, error) {
+	client, err := chainclient.NewMulti(int(cfg.ChainCfg.ID), cfg.AnkrCfg.Endpoints, chainclient.MultiConfig{
+		RequestsPerSecond: cfg.AnkrCfg.RequestsPerSecond,
+		Burst:             cfg.AnkrCfg.Burst,
+		MaxAttempts:       cfg.AnkrCfg.MaxAttempts,
+		MaxHeadLag:        cfg.AnkrCfg.MaxHeadLag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.StartHealthCheck(ctx, HealthCheckInterval)
+
+	http.HandleFunc("/debug/chainclient", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(client.Stats())
+	})
+	return client, nil
+}
@@ -0,0 +1,61 @@
+package validity
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// orderState 检查订单时读取的链上状态
+type orderState struct {
+	onChain  bool           // 订单仍保存在订单簿合约中
+	owner    common.Address // 挂单NFT当前的持有人
+	approved bool           // maker已将挂单NFT授权给vault
+	balance  *big.Int       // 出价可用的ETH: 链上出价为vault中的余额, 链下签名出价为maker的余额
+}
+
+// isBid 订单是否为出价
+func isBid(order *multi.Order) bool {
+	return order.OrderType == multi.CollectionBidOrder || order.OrderType == multi.ItemBidOrder
+}
+
+// isOffChain 订单是否为链下签名提交, 尚未在订单簿合约中创建
+func isOffChain(order *multi.Order) bool {
+	return order.Signature != ""
+}
+
+// fillable 根据链上状态判断订单能否成交
+// 链上订单已不在合约中时由订单簿事件更新状态, 返回known为false不做处理
+func fillable(order *multi.Order, state orderState, vault common.Address) (ok bool, known bool) {
+	if !isOffChain(order) && !state.onChain {
+		return false, false
+	}
+
+	if isBid(order) {
+		if state.balance == nil {
+			return false, false
+		}
+		need := new(big.Int).Mul(order.Price.BigInt(), big.NewInt(order.QuantityRemaining))
+		return state.balance.Cmp(need) >= 0, true
+	}
+
+	// 链上挂单的NFT托管在vault中, 链下签名挂单需要maker持有并授权给vault
+	if !isOffChain(order) {
+		return state.owner == vault, true
+	}
+	return strings.EqualFold(state.owner.String(), order.Maker) && state.approved, true
+}
+
+// targetStatus 返回订单需要切换到的状态, 不需要切换时返回false
+func targetStatus(order *multi.Order, ok bool) (int, bool) {
+	switch {
+	case ok && order.OrderStatus == multi.OrderStatusInactive:
+		return multi.OrderStatusActive, true
+	case !ok && order.OrderStatus == multi.OrderStatusActive:
+		return multi.OrderStatusInactive, true
+	default:
+		return 0, false
+	}
+}
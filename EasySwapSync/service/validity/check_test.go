@@ -0,0 +1,67 @@
+package validity
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	vault = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	maker = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+)
+
+func TestFillable(t *testing.T) {
+	listing := &multi.Order{OrderType: multi.ListingOrder, Maker: maker.String()}
+	signedListing := &multi.Order{OrderType: multi.ListingOrder, Maker: maker.String(), Signature: "0x01"}
+	bid := &multi.Order{OrderType: multi.CollectionBidOrder, Maker: maker.String(),
+		Price: decimal.NewFromInt(100), QuantityRemaining: 2}
+
+	tests := []struct {
+		name  string
+		order *multi.Order
+		state orderState
+		ok    bool
+		known bool
+	}{
+		{"on-chain order removed", listing, orderState{}, false, false},
+		{"listing escrowed in vault", listing, orderState{onChain: true, owner: vault}, true, true},
+		{"listing withdrawn from vault", listing, orderState{onChain: true, owner: other}, false, true},
+		{"signed listing approved", signedListing, orderState{owner: maker, approved: true}, true, true},
+		{"signed listing not approved", signedListing, orderState{owner: maker}, false, true},
+		{"signed listing transferred", signedListing, orderState{owner: other, approved: true}, false, true},
+		{"bid fully funded", bid, orderState{onChain: true, balance: big.NewInt(200)}, true, true},
+		{"bid underfunded", bid, orderState{onChain: true, balance: big.NewInt(199)}, false, true},
+		{"bid balance unknown", bid, orderState{onChain: true}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, known := fillable(tt.order, tt.state, vault)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.known, known)
+		})
+	}
+}
+
+func TestTargetStatus(t *testing.T) {
+	active := &multi.Order{OrderStatus: multi.OrderStatusActive}
+	inactive := &multi.Order{OrderStatus: multi.OrderStatusInactive}
+
+	status, changed := targetStatus(active, false)
+	assert.True(t, changed)
+	assert.Equal(t, multi.OrderStatusInactive, status)
+
+	status, changed = targetStatus(inactive, true)
+	assert.True(t, changed)
+	assert.Equal(t, multi.OrderStatusActive, status)
+
+	_, changed = targetStatus(active, true)
+	assert.False(t, changed)
+	_, changed = targetStatus(inactive, false)
+	assert.False(t, changed)
+}
@@ -0,0 +1,397 @@
+package validity
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProjectsTask/EasySwapBase/chain/chainclient"
+	"github.com/ProjectsTask/EasySwapBase/logger/xzap"
+	"github.com/ProjectsTask/EasySwapBase/ordermanager"
+	"github.com/ProjectsTask/EasySwapBase/stores/gdb/orderbookmodel/multi"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	ethereumTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/ProjectsTask/EasySwapSync/service/comm"
+	"github.com/ProjectsTask/EasySwapSync/service/outbox"
+	"github.com/ProjectsTask/EasySwapSync/service/poller"
+)
+
+const (
+	SweepInterval = 10 * time.Minute // 全量检查有效及失效订单的间隔
+	CheckInterval = 5 * time.Second  // 检查Transfer/Approval事件涉及订单的间隔
+
+	contractAbi = `[
+{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Transfer","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"approved","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Approval","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"operator","type":"address"},{"indexed":false,"name":"approved","type":"bool"}],"name":"ApprovalForAll","type":"event"},
+{"inputs":[{"name":"tokenId","type":"uint256"}],"name":"ownerOf","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"tokenId","type":"uint256"}],"name":"getApproved","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"},{"name":"operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"","type":"bytes32"}],"name":"ETHBalance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"","type":"bytes32"}],"name":"orders","outputs":[{"name":"order","type":"tuple","components":[{"name":"side","type":"uint8"},{"name":"saleKind","type":"uint8"},{"name":"maker","type":"address"},{"name":"nft","type":"tuple","components":[{"name":"tokenId","type":"uint256"},{"name":"collection","type":"address"},{"name":"amount","type":"uint96"}]},{"name":"price","type":"uint128"},{"name":"expiry","type":"uint64"},{"name":"salt","type":"uint64"}]},{"name":"next","type":"bytes32"}],"stateMutability":"view","type":"function"}]`
+)
+
+// 包含ERC721、vault及订单簿合约中用到的事件和方法
+var validityAbi, _ = abi.JSON(strings.NewReader(contractAbi))
+
+// dirtyKey Transfer/Approval事件涉及的NFT或ApprovalForAll涉及的maker
+type dirtyKey struct {
+	collection string
+	tokenID    string
+	maker      string
+}
+
+// Monitor 检查有效订单是否仍可成交, 不可成交时改为OrderStatusInactive, 恢复后改回OrderStatusActive
+// 状态变化通过outbox通知订单管理器更新地板价及最高出价
+type Monitor struct {
+	ctx         context.Context
+	db          *gorm.DB
+	chainClient chainclient.ChainClient
+	chainId     int64
+	chain       string
+	orderBook   common.Address
+	vault       common.Address
+	registry    *poller.Registry
+
+	mu      sync.Mutex
+	tracked map[string]bool // 已注册事件的collection
+	dirty   map[dirtyKey]struct{}
+}
+
+func New(ctx context.Context, db *gorm.DB, chainClient chainclient.ChainClient, chainId int64, chain string, orderBook, vault string) *Monitor {
+	return &Monitor{
+		ctx:         ctx,
+		db:          db,
+		chainClient: chainClient,
+		chainId:     chainId,
+		chain:       chain,
+		orderBook:   common.HexToAddress(orderBook),
+		vault:       common.HexToAddress(vault),
+		registry:    poller.NewRegistry(),
+		tracked:     make(map[string]bool),
+		dirty:       make(map[dirtyKey]struct{}),
+	}
+}
+
+// Poller 同步有挂单的collection的Transfer/Approval事件, collection在每次全量检查时更新
+func (m *Monitor) Poller(cfg poller.Config) (*poller.Poller, error) {
+	if err := m.trackCollections(); err != nil {
+		return nil, err
+	}
+	return poller.New(m.ctx, m.db, m.chainClient, cfg, m.registry), nil
+}
+
+// Run 定期处理事件涉及的订单, 并全量检查有效及失效订单
+func (m *Monitor) Run() {
+	m.sweep()
+	checkTicker := time.NewTicker(CheckInterval)
+	defer checkTicker.Stop()
+	sweepTicker := time.NewTicker(SweepInterval)
+	defer sweepTicker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			xzap.WithContext(m.ctx).Info("validity monitor stopped due to context cancellation")
+			return
+		case <-checkTicker.C:
+			m.checkDirty()
+		case <-sweepTicker.C:
+			m.sweep()
+		}
+	}
+}
+
+// trackCollections 为有挂单的collection注册Transfer/Approval事件
+func (m *Monitor) trackCollections() error {
+	var collections []string
+	if err := m.db.WithContext(m.ctx).Table(multi.OrderTableName(m.chain)).
+		Distinct("collection_address").
+		Where("order_type = ? and order_status in (?) and marketplace_id = ?",
+			multi.ListingOrder, []int{multi.OrderStatusActive, multi.OrderStatusInactive}, multi.MarketOrderBook).
+		Pluck("collection_address", &collections).Error; err != nil {
+		return errors.Wrap(err, "failed on query listed collections")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, collection := range collections {
+		addr := strings.ToLower(collection)
+		if m.tracked[addr] || !common.IsHexAddress(addr) {
+			continue
+		}
+		handlers := map[string]poller.Handler{
+			"Transfer":       m.handleTokenEvent,
+			"Approval":       m.handleTokenEvent,
+			"ApprovalForAll": m.handleApprovalForAllEvent,
+		}
+		for event, handler := range handlers {
+			if err := m.registry.Register(addr, validityAbi, event, handler); err != nil {
+				return err
+			}
+		}
+		m.tracked[addr] = true
+	}
+	return nil
+}
+
+// handleTokenEvent NFT转移或单个授权变化, 标记该NFT的挂单需要检查
+func (m *Monitor) handleTokenEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	if len(log.Topics) != 4 { // ERC20的Transfer/Approval事件tokenId不是indexed
+		return nil
+	}
+	m.markDirty(dirtyKey{
+		collection: strings.ToLower(log.Address.String()),
+		tokenID:    log.Topics[3].Big().String(),
+	})
+	return nil
+}
+
+// handleApprovalForAllEvent 全部授权变化, 标记maker在该collection的挂单需要检查
+func (m *Monitor) handleApprovalForAllEvent(tx *gorm.DB, log ethereumTypes.Log) error {
+	if len(log.Topics) != 3 {
+		return nil
+	}
+	m.markDirty(dirtyKey{
+		collection: strings.ToLower(log.Address.String()),
+		maker:      strings.ToLower(common.BytesToAddress(log.Topics[1].Bytes()).String()),
+	})
+	return nil
+}
+
+func (m *Monitor) markDirty(key dirtyKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dirty[key] = struct{}{}
+}
+
+// checkDirty 检查事件涉及的挂单, 检查失败的保留到下次
+func (m *Monitor) checkDirty() {
+	m.mu.Lock()
+	dirty := m.dirty
+	m.dirty = make(map[dirtyKey]struct{})
+	m.mu.Unlock()
+
+	for key := range dirty {
+		query := m.ordersQuery().Where("collection_address = ? and order_type = ?", key.collection, multi.ListingOrder)
+		if key.tokenID != "" {
+			query = query.Where("token_id = ?", key.tokenID)
+		} else {
+			query = query.Where("maker = ?", key.maker)
+		}
+
+		var orders []multi.Order
+		if err := query.Find(&orders).Error; err != nil {
+			xzap.WithContext(m.ctx).Error("failed on query orders to check", zap.Error(err))
+			m.markDirty(key)
+			continue
+		}
+		for i := range orders {
+			if err := m.check(&orders[i]); err != nil {
+				xzap.WithContext(m.ctx).Warn("failed on check order validity",
+					zap.String("order_id", orders[i].OrderID), zap.Error(err))
+				m.markDirty(key)
+			}
+		}
+	}
+}
+
+// sweep 全量检查未过期的有效及失效订单
+func (m *Monitor) sweep() {
+	if err := m.trackCollections(); err != nil {
+		xzap.WithContext(m.ctx).Error("failed on track listed collections", zap.Error(err))
+	}
+
+	var id int64
+	for {
+		var orders []multi.Order
+		if err := m.ordersQuery().
+			Where("order_type in (?) and id > ?", []int{multi.ListingOrder, multi.CollectionBidOrder, multi.ItemBidOrder}, id).
+			Order("id asc").Limit(comm.DBBatchSizeLimit).
+			Find(&orders).Error; err != nil {
+			xzap.WithContext(m.ctx).Error("failed on query orders to sweep", zap.Error(err))
+			return
+		}
+
+		for i := range orders {
+			if err := m.check(&orders[i]); err != nil {
+				xzap.WithContext(m.ctx).Warn("failed on check order validity",
+					zap.String("order_id", orders[i].OrderID), zap.Error(err))
+			}
+		}
+		if len(orders) < comm.DBBatchSizeLimit {
+			return
+		}
+		id = orders[len(orders)-1].ID
+	}
+}
+
+func (m *Monitor) ordersQuery() *gorm.DB {
+	return m.db.WithContext(m.ctx).Table(multi.OrderTableName(m.chain)).
+		Where("order_status in (?) and marketplace_id = ? and expire_time > ?",
+			[]int{multi.OrderStatusActive, multi.OrderStatusInactive}, multi.MarketOrderBook, time.Now().Unix())
+}
+
+// check 读取订单的链上状态, 需要时切换订单状态
+func (m *Monitor) check(order *multi.Order) error {
+	state, err := m.loadState(order)
+	if err != nil {
+		return err
+	}
+	ok, known := fillable(order, state, m.vault)
+	if !known {
+		return nil
+	}
+	status, changed := targetStatus(order, ok)
+	if !changed {
+		return nil
+	}
+	return m.updateStatus(order, status)
+}
+
+func (m *Monitor) loadState(order *multi.Order) (orderState, error) {
+	var state orderState
+	if !isOffChain(order) {
+		values, err := m.call(m.orderBook, "orders", common.HexToHash(order.OrderID))
+		if err != nil {
+			return state, err
+		}
+		maker := reflect.ValueOf(values[0]).FieldByName("Maker")
+		if !maker.IsValid() {
+			return state, errors.New("invalid orders response")
+		}
+		state.onChain = maker.Interface().(common.Address) != (common.Address{}) // 已成交或取消的订单被删除
+		if !state.onChain {
+			return state, nil
+		}
+	}
+
+	if isBid(order) {
+		if isOffChain(order) {
+			balance, err := m.balanceAt(common.HexToAddress(order.Maker))
+			if err != nil {
+				return state, err
+			}
+			state.balance = balance
+			return state, nil
+		}
+		values, err := m.call(m.vault, "ETHBalance", common.HexToHash(order.OrderID))
+		if err != nil {
+			return state, err
+		}
+		state.balance, _ = values[0].(*big.Int)
+		return state, nil
+	}
+
+	tokenID, ok := new(big.Int).SetString(order.TokenId, 10)
+	if !ok {
+		return state, errors.Errorf("invalid token id %s", order.TokenId)
+	}
+	collection := common.HexToAddress(order.CollectionAddress)
+	values, err := m.call(collection, "ownerOf", tokenID)
+	if err != nil {
+		if !isReverted(err) {
+			return state, err
+		}
+		return state, nil // 已销毁的NFT
+	}
+	state.owner, _ = values[0].(common.Address)
+	if !isOffChain(order) || !strings.EqualFold(state.owner.String(), order.Maker) {
+		return state, nil
+	}
+
+	values, err = m.call(collection, "isApprovedForAll", state.owner, m.vault)
+	if err != nil {
+		return state, err
+	}
+	if state.approved, _ = values[0].(bool); state.approved {
+		return state, nil
+	}
+	values, err = m.call(collection, "getApproved", tokenID)
+	if err != nil {
+		return state, err
+	}
+	approved, _ := values[0].(common.Address)
+	state.approved = approved == m.vault
+	return state, nil
+}
+
+// updateStatus 切换订单状态并通知订单管理器, 失效的订单按取消处理, 恢复的订单重新作为挂单或出价加入
+func (m *Monitor) updateStatus(order *multi.Order, status int) error {
+	eventType := ordermanager.Inactive
+	if status == multi.OrderStatusActive {
+		eventType = ordermanager.Listing
+		if isBid(order) {
+			eventType = ordermanager.Bid
+		}
+	}
+
+	return m.db.WithContext(m.ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Table(multi.OrderTableName(m.chain)).
+			Where("order_id = ? and order_status = ?", order.OrderID, order.OrderStatus).
+			Update("order_status", status)
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "failed on update order status")
+		}
+		if result.RowsAffected == 0 { // 订单状态已被订单簿事件修改
+			return nil
+		}
+
+		xzap.WithContext(m.ctx).Info("order validity changed", zap.String("order_id", order.OrderID),
+			zap.Int("from", order.OrderStatus), zap.Int("to", status))
+		if err := outbox.Add(tx, m.chainId, outbox.KindTradeEvent, &ordermanager.TradeEvent{
+			EventType:      eventType,
+			CollectionAddr: order.CollectionAddress,
+			TokenID:        order.TokenId,
+			OrderId:        order.OrderID,
+			Price:          order.Price,
+			From:           order.Maker,
+		}); err != nil {
+			return errors.Wrap(err, "failed on add order validity event")
+		}
+		return nil
+	})
+}
+
+func (m *Monitor) call(to common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := validityAbi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on pack "+method)
+	}
+	resp, err := m.chainClient.CallContract(m.ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on call "+method)
+	}
+	values, err := validityAbi.Unpack(method, resp)
+	if err != nil || len(values) == 0 {
+		return nil, errors.Errorf("failed on unpack %s: %v", method, err)
+	}
+	return values, nil
+}
+
+func (m *Monitor) balanceAt(account common.Address) (*big.Int, error) {
+	client, ok := m.chainClient.Client().(interface {
+		BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+	})
+	if !ok {
+		return nil, errors.New("chain client not support balance query")
+	}
+	balance, err := client.BalanceAt(m.ctx, account, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed on get balance")
+	}
+	return balance, nil
+}
+
+func isReverted(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "execution reverted")
+}